@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/heptiolabs/cruise/internal/cruise"
+	"github.com/heptiolabs/cruise/internal/monitor"
+)
+
+// adoptCommand annotates the Ingresses whose hosts have checks cruise
+// did not create, so that cruise adopts them.
+type adoptCommand struct {
+	cmd       *kingpin.CmdClause
+	kube      *kubeFlags
+	providers *providerFlags
+	namespace *string
+	yes       *bool
+}
+
+func addAdoptCommand(app *kingpin.Application) *adoptCommand {
+	cmd := app.Command("adopt", "Find existing checks, not created by cruise, for the hosts of Ingresses and annotate the Ingresses so that cruise adopts them.")
+	return &adoptCommand{
+		cmd:       cmd,
+		kube:      addKubeFlags(cmd),
+		providers: addProviderFlags(cmd),
+		namespace: cmd.Flag("namespace", "only adopt the checks for the Ingresses of namespace").String(),
+		yes:       cmd.Flag("yes", "annotate the Ingresses without asking for confirmation").Short('y').Bool(),
+	}
+}
+
+// adoption is an existing check matched to an Ingress.
+type adoption struct {
+	provider  string
+	check     *monitor.UptimeCheck
+	namespace string
+	ingress   string
+}
+
+func (a *adoptCommand) run(ctx context.Context, in io.Reader, out io.Writer) error {
+	config, err := a.kube.config()
+	if err != nil {
+		return err
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	list, err := client.ExtensionsV1beta1().Ingresses(*a.namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("listing ingresses: %v", err)
+	}
+	members, err := a.providers.uptimeCheckers(ctx, monitor.Options{KubeConfig: config})
+	if err != nil {
+		return err
+	}
+	for _, m := range members {
+		// cruise would create duplicates at such a provider instead.
+		if !monitor.Adopts(m.Checker) {
+			return fmt.Errorf("%s lists only the checks created by cruise, so existing checks cannot be adopted", m.Name)
+		}
+	}
+
+	var adoptions []adoption
+	for _, ing := range list.Items {
+		if adopted, _ := strconv.ParseBool(ing.Annotations[cruise.AdoptAnnotation]); adopted {
+			continue
+		}
+		for _, r := range ing.Spec.Rules {
+			for _, m := range members {
+				check, ok := m.Checker.UptimeChecks()[r.Host]
+				if !ok || r.Host == "" {
+					continue
+				}
+				if _, _, owned := cruise.Owner(check); owned {
+					continue
+				}
+				if d, ok := m.Checker.(monitor.Definer); ok && !d.Defined(r.Host) {
+					fmt.Fprintf(out, "skipping %s at %s: the check is of a kind which cannot be adopted\n", r.Host, m.Name)
+					continue
+				}
+				adoptions = append(adoptions, adoption{provider: m.Name, check: check, namespace: ing.Namespace, ingress: ing.Name})
+			}
+		}
+	}
+	if len(adoptions) == 0 {
+		fmt.Fprintln(out, "no checks to adopt")
+		return nil
+	}
+	sort.Slice(adoptions, func(i, j int) bool {
+		a, b := adoptions[i], adoptions[j]
+		if a.check.Hostname != b.check.Hostname {
+			return a.check.Hostname < b.check.Hostname
+		}
+		return a.provider < b.provider
+	})
+
+	ingresses := make(map[types.NamespacedName]bool)
+	tw := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROVIDER\tHOSTNAME\tCHECK\tINGRESS")
+	for _, ad := range adoptions {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s/%s\n", ad.provider, ad.check.Hostname, ad.check.Name, ad.namespace, ad.ingress)
+		ingresses[types.NamespacedName{Namespace: ad.namespace, Name: ad.ingress}] = true
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if !*a.yes && !confirm(in, out, fmt.Sprintf("Annotate %d Ingresses to adopt %d checks?", len(ingresses), len(adoptions))) {
+		fmt.Fprintln(out, "no Ingresses annotated")
+		return nil
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{cruise.AdoptAnnotation: "true"},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	var names []types.NamespacedName
+	for name := range ingresses {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i].String() < names[j].String() })
+	failed := 0
+	for _, name := range names {
+		_, err := client.ExtensionsV1beta1().Ingresses(name.Namespace).Patch(name.Name, types.MergePatchType, patch)
+		if err != nil {
+			fmt.Fprintf(out, "%s: %v\n", name, err)
+			failed++
+			continue
+		}
+		fmt.Fprintf(out, "%s: annotated\n", name)
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to annotate %d of %d Ingresses", failed, len(names))
+	}
+	return nil
+}
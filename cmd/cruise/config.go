@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/heptiolabs/cruise/internal/config"
+	"github.com/heptiolabs/cruise/internal/cruise"
+	"github.com/heptiolabs/cruise/internal/monitor"
+	"github.com/heptiolabs/cruise/internal/secret"
+)
+
+// loadConfig looks in args for cmd's --config flag and, if it is given,
+// loads the file and applies its settings to cmd's flags, so that the
+// flags given on the command line override them. It returns nil
+// if no file is given.
+func loadConfig(app *kingpin.Application, cmd *kingpin.CmdClause, args []string) (*config.Config, error) {
+	ctx, err := app.ParseContext(args)
+	if err != nil {
+		// reported when args are parsed
+		return nil, nil
+	}
+	path := ""
+	for _, e := range ctx.Elements {
+		if f, ok := e.Clause.(*kingpin.FlagClause); ok && f == cmd.GetFlag("config") && e.Value != nil {
+			path = *e.Value
+		}
+	}
+	if path == "" {
+		return nil, nil
+	}
+	c, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyConfig(cmd, c); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return c, nil
+}
+
+// applyConfig makes the settings of c the defaults of cmd's flags, or
+// the values of those which hold secrets.
+func applyConfig(cmd *kingpin.CmdClause, c *config.Config) error {
+	var errs config.Errors
+	if names := c.ProviderNames(); len(names) > 0 {
+		for _, name := range names {
+			if _, err := monitor.Lookup(name); err != nil {
+				errs = append(errs, fmt.Errorf("providers.%s: unknown provider, expected one of %s", name, strings.Join(monitor.Providers(), ", ")))
+			}
+		}
+		cmd.GetFlag("provider").Default(names...)
+	}
+	for _, name := range c.ProviderNames() {
+		var keys []string
+		for key := range c.Providers[name] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s := c.Providers[name][key]
+			flag := cmd.GetFlag(name + "-" + key)
+			if flag == nil {
+				errs = append(errs, fmt.Errorf("providers.%s.%s: unknown setting, there is no --%s-%s flag", name, key, name, key))
+				continue
+			}
+			values, err := s.Resolve()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("providers.%s.%s: %v", name, key, err))
+				continue
+			}
+			// as when environment variables were the defaults of
+			// flags, the file takes precedence over them.
+			flag.NoEnvar()
+			if value := flag.Model().Value; secret.IsSecret(value) {
+				// set, rather than shown by --help as the default; the
+				// command line is parsed after and still overrides it.
+				for _, v := range values {
+					if err := value.Set(v); err != nil {
+						errs = append(errs, fmt.Errorf("providers.%s.%s: %v", name, key, err))
+					}
+				}
+				continue
+			}
+			flag.Default(values...)
+		}
+	}
+	if c.Cluster != "" {
+		cmd.GetFlag("cluster-name").Default(c.Cluster)
+	}
+	if c.Budgets.MaxChecks != 0 {
+		cmd.GetFlag("max-checks").Default(strconv.Itoa(c.Budgets.MaxChecks))
+	}
+	if c.Budgets.MaxChecksPerNamespace != 0 {
+		cmd.GetFlag("max-checks-per-namespace").Default(strconv.Itoa(c.Budgets.MaxChecksPerNamespace))
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// configure applies the settings of c which have no flags to cr. cr is
+// left unchanged if they are invalid.
+func configure(cr *cruise.Cruise, c *config.Config) error {
+	var nameTemplate *template.Template
+	if c.Naming.Template != "" {
+		t, err := cruise.ParseNameTemplate(c.Naming.Template)
+		if err != nil {
+			return err
+		}
+		nameTemplate = t
+	}
+	cr.Filter = cruise.Filter{
+		Namespaces:        c.Filters.Namespaces,
+		ExcludeNamespaces: c.Filters.ExcludeNamespaces,
+		ExcludeHosts:      c.Filters.ExcludeHosts,
+	}
+	cr.Defaults = c.Annotations()
+	cr.Contacts = c.ContactMap()
+	cr.NameTemplate = nameTemplate
+	return nil
+}
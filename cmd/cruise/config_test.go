@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/heptiolabs/cruise/internal/config"
+)
+
+func TestApplyConfigSecrets(t *testing.T) {
+	c, err := config.Parse([]byte(`
+version: cruise.heptio.com/v1
+providers:
+  pingdom:
+    username: ops@example.com
+    password: config-test-password
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := kingpin.New("cruise", "")
+	s := addServeCommand(app)
+	if err := applyConfig(s.cmd, c); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"ops@example.com"}, s.cmd.GetFlag("pingdom-username").Model().Default)
+	assert.Empty(t, s.cmd.GetFlag("pingdom-password").Model().Default)
+
+	var help bytes.Buffer
+	app.UsageWriter(&help)
+	app.Usage([]string{"serve"})
+	assert.Contains(t, help.String(), "ops@example.com")
+	assert.NotContains(t, help.String(), "config-test-password", "--help prints the secrets of the configuration file")
+}
@@ -15,81 +15,112 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
-	"path/filepath"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 
 	"k8s.io/api/core/v1"
 	"k8s.io/api/extensions/v1beta1"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
-	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
 
-	"github.com/heptiolabs/cruise/internal/cruise"
-	"github.com/heptiolabs/cruise/internal/pingdom"
+	_ "github.com/heptiolabs/cruise/internal/blackbox"
+	_ "github.com/heptiolabs/cruise/internal/datadog"
+	_ "github.com/heptiolabs/cruise/internal/gatus"
+	_ "github.com/heptiolabs/cruise/internal/grafana"
+	_ "github.com/heptiolabs/cruise/internal/pingdom"
+	_ "github.com/heptiolabs/cruise/internal/prober"
+	_ "github.com/heptiolabs/cruise/internal/route53"
+	_ "github.com/heptiolabs/cruise/internal/statuscake"
+	_ "github.com/heptiolabs/cruise/internal/uptimerobot"
+
+	"github.com/heptiolabs/cruise/internal/secret"
 
 	"github.com/sirupsen/logrus"
 )
 
-func init() {
+func main() {
 	// thanks, glog
 	flag.Parse()
-}
 
-func main() {
 	log := logrus.StandardLogger()
+	secret.RedactLogs(log)
 	app := kingpin.New("cruise", "Remote HTTP monitoring operator.")
 
-	serve := app.Command("serve", "Serve xDS API traffic")
-	inCluster := serve.Flag("incluster", "use in cluster configuration.").Bool()
-	kubeconfig := serve.Flag("kubeconfig", "path to kubeconfig (if not in running inside a cluster)").Default(filepath.Join(os.Getenv("HOME"), ".kube", "config")).String()
-	username := serve.Flag("username", "Pingdom Username").Default(os.Getenv("PINGDOM_USERNAME")).String()
-	password := serve.Flag("password", "Pingdom Password").Default(os.Getenv("PINGDOM_PASSWORD")).String()
-	apikey := serve.Flag("apikey", "Pingdom API Key").Default(os.Getenv("PINGDOM_APIKEY")).String()
+	serve := addServeCommand(app)
+	list := addListCommand(app)
+	prune := addPruneCommand(app)
+	export := addExportCommand(app)
+	imp := addImportCommand(app)
+	migrate := addMigrateCommand(app)
+	doctor := addDoctorCommand(app)
+	report := addReportCommand(app)
+	adoption := addAdoptCommand(app)
 
 	args := os.Args[1:]
+	serveConfig, err := loadConfig(app, serve.cmd, args)
+	exitOnError(err)
 	switch kingpin.MustParse(app.Parse(args)) {
 	default:
 		app.Usage(args)
 		os.Exit(2)
-	case serve.FullCommand():
-		log.Infof("args: %v", args)
-
-		client := newClient(*kubeconfig, *inCluster)
-		uptimeChecker, err := pingdom.NewPindomUptimeChecker(*username, *password, *apikey)
-
-		exitOnError(err)
-
-		logger := logrus.New().WithField("context", "cruise")
-
-		c := cruise.NewCruise(uptimeChecker, logger)
-		w := watchIngress(client, c)
-		w.Run(nil)
+	case serve.cmd.FullCommand():
+		exitOnError(serve.run(args, serveConfig, log))
+	case list.cmd.FullCommand():
+		exitOnError(list.run(context.Background(), os.Stdout))
+	case prune.cmd.FullCommand():
+		exitOnError(prune.run(context.Background(), os.Stdin, os.Stdout, os.Stderr))
+	case export.cmd.FullCommand():
+		exitOnError(export.run(context.Background(), os.Stdout, os.Stderr))
+	case imp.cmd.FullCommand():
+		exitOnError(imp.run(context.Background(), os.Stdin, os.Stdout))
+	case migrate.cmd.FullCommand():
+		exitOnError(migrate.run(context.Background(), log))
+	case doctor.cmd.FullCommand():
+		exitOnError(doctor.run(context.Background(), os.Stdout))
+	case report.cmd.FullCommand():
+		exitOnError(report.run(context.Background(), os.Stdout, os.Stderr))
+	case adoption.cmd.FullCommand():
+		exitOnError(adoption.run(context.Background(), os.Stdin, os.Stdout))
 	}
 }
 
-func newClient(kubeconfig string, inCluster bool) *kubernetes.Clientset {
-	var err error
-	var config *rest.Config
-	if kubeconfig != "" && !inCluster {
-		config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
-		exitOnError(err)
-	} else {
-		config, err = rest.InClusterConfig()
-		exitOnError(err)
-	}
-
+func newClient(config *rest.Config) *kubernetes.Clientset {
 	client, err := kubernetes.NewForConfig(config)
 	exitOnError(err)
 	return client
 }
 
+func newRecorder(client *kubernetes.Clientset) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	return broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: "cruise"})
+}
+
+// serveMetrics serves Prometheus metrics, and the status of each
+// provider and the pages of those which serve one, on addr.
+func serveMetrics(addr string, providers http.Handler, log logrus.FieldLogger) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/providers", http.StripPrefix("/providers", providers))
+	mux.Handle("/providers/", http.StripPrefix("/providers", providers))
+	log.Infof("serving metrics on %s", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Errorf("metrics server: %v", err)
+	}
+}
+
 func watchIngress(client *kubernetes.Clientset, rs ...cache.ResourceEventHandler) cache.SharedInformer {
 	lw := cache.NewListWatchFromClient(client.ExtensionsV1beta1().RESTClient(), "ingresses", v1.NamespaceAll, fields.Everything())
 	sw := cache.NewSharedInformer(lw, new(v1beta1.Ingress), 30*time.Minute)
@@ -101,7 +132,7 @@ func watchIngress(client *kubernetes.Clientset, rs ...cache.ResourceEventHandler
 
 func exitOnError(err error) {
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, secret.Redact(err.Error()))
 		os.Exit(1)
 	}
 }
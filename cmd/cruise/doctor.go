@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/heptiolabs/cruise/internal/cruise"
+	"github.com/heptiolabs/cruise/internal/monitor"
+)
+
+// doctorCommand diagnoses the configuration of cruise.
+type doctorCommand struct {
+	cmd       *kingpin.CmdClause
+	kube      *kubeFlags
+	providers *providerFlags
+	output    *string
+}
+
+func addDoctorCommand(app *kingpin.Application) *doctorCommand {
+	cmd := app.Command("doctor", "Check that cruise can access the cluster and its monitoring providers, and that the Ingresses' annotations are valid.")
+	return &doctorCommand{
+		cmd:       cmd,
+		kube:      addKubeFlags(cmd),
+		providers: addProviderFlags(cmd),
+		output:    cmd.Flag("output", "output format").Short('o').Default("text").Enum("text", "json"),
+	}
+}
+
+// The results of a diagnosis.
+const (
+	pass = "pass"
+	warn = "warn"
+	fail = "fail"
+	skip = "skip"
+)
+
+// diagnosis is the result of one of the checks made by the doctor
+// command.
+type diagnosis struct {
+	Check  string `json:"check"`
+	Result string `json:"result"`
+	Detail string `json:"detail"`
+}
+
+// doctor accumulates diagnoses.
+type doctor struct {
+	diagnoses []diagnosis
+}
+
+func (d *doctor) report(check, result, format string, args ...interface{}) {
+	d.diagnoses = append(d.diagnoses, diagnosis{Check: check, Result: result, Detail: fmt.Sprintf(format, args...)})
+}
+
+func (d *doctor) failed() bool {
+	for _, diag := range d.diagnoses {
+		if diag.Result == fail {
+			return true
+		}
+	}
+	return false
+}
+
+// access is a permission cruise needs in the cluster.
+type access struct {
+	verb, group, resource string
+
+	// optional permissions are only needed for some features.
+	optional bool
+	purpose  string
+}
+
+var accesses = []access{
+	{verb: "list", group: "extensions", resource: "ingresses", purpose: "to find the hosts to check"},
+	{verb: "watch", group: "extensions", resource: "ingresses", purpose: "to follow changes to the hosts"},
+	{verb: "create", resource: "events", purpose: "to record events on Ingresses"},
+	{verb: "patch", group: "extensions", resource: "ingresses", optional: true, purpose: "to write annotations on Ingresses"},
+}
+
+func (c *doctorCommand) run(ctx context.Context, w io.Writer) error {
+	d := new(doctor)
+	ingresses := c.diagnoseCluster(d)
+
+	names := *c.providers.names
+	config, _ := c.kube.config() // only some providers need a cluster
+	for _, name := range names {
+		check := "provider " + name
+		checker, err := c.providers.uptimeChecker(ctx, name, monitor.Options{KubeConfig: config})
+		if err != nil {
+			hint := ""
+			if monitor.KindOf(err) == monitor.AuthFailed {
+				hint = fmt.Sprintf("; check the --%s-* flags or their environment variables", name)
+			}
+			d.report(check, fail, "%v%s", err, hint)
+			continue
+		}
+		d.report(check, pass, "authenticated, %d checks", len(checker.UptimeChecks()))
+		c.diagnoseContacts(d, name, checker, ingresses)
+		c.diagnoseQuota(ctx, d, name, checker, ingresses)
+	}
+
+	if ingresses != nil {
+		invalid := 0
+		for _, ing := range ingresses {
+			for _, err := range cruise.ValidateAnnotations(ing, names) {
+				d.report("annotations", warn, "%s/%s: %v", ing.Namespace, ing.Name, err)
+				invalid++
+			}
+		}
+		if invalid == 0 {
+			d.report("annotations", pass, "the annotations of %d Ingresses are valid", len(ingresses))
+		}
+	}
+
+	if err := d.write(w, *c.output); err != nil {
+		return err
+	}
+	if d.failed() {
+		return fmt.Errorf("doctor found problems")
+	}
+	return nil
+}
+
+// diagnoseCluster checks cruise can reach the cluster with the access it
+// needs, returning its Ingresses if they can be listed.
+func (c *doctorCommand) diagnoseCluster(d *doctor) []*v1beta1.Ingress {
+	config, err := c.kube.config()
+	if err != nil {
+		d.report("kubernetes", fail, "%v", err)
+		return nil
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		d.report("kubernetes", fail, "%v", err)
+		return nil
+	}
+	version, err := client.Discovery().ServerVersion()
+	if err != nil {
+		d.report("kubernetes", fail, "cannot reach %s: %v", config.Host, err)
+		return nil
+	}
+	d.report("kubernetes", pass, "connected to %s, version %s", config.Host, version.GitVersion)
+
+	for _, a := range accesses {
+		check := fmt.Sprintf("rbac %s %s", a.verb, a.resource)
+		review, err := client.AuthorizationV1().SelfSubjectAccessReviews().Create(&authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Verb:     a.verb,
+					Group:    a.group,
+					Resource: a.resource,
+				},
+			},
+		})
+		switch {
+		case err != nil:
+			d.report(check, warn, "cannot review access: %v", err)
+		case review.Status.Allowed:
+			d.report(check, pass, "allowed in all namespaces")
+		case a.optional:
+			d.report(check, warn, "denied, needed %s", a.purpose)
+		default:
+			d.report(check, fail, "denied, needed %s", a.purpose)
+		}
+	}
+
+	list, err := client.ExtensionsV1beta1().Ingresses(metav1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		d.report("ingresses", fail, "%v", err)
+		return nil
+	}
+	ingresses := make([]*v1beta1.Ingress, len(list.Items))
+	for i := range list.Items {
+		ingresses[i] = &list.Items[i]
+	}
+	sort.Slice(ingresses, func(i, j int) bool {
+		return ingresses[i].Namespace+"/"+ingresses[i].Name < ingresses[j].Namespace+"/"+ingresses[j].Name
+	})
+	d.report("ingresses", pass, "found %d Ingresses", len(ingresses))
+	return ingresses
+}
+
+// diagnoseContacts checks the contacts annotations of the Ingresses
+// whose hosts the provider name checks resolve at the provider.
+func (c *doctorCommand) diagnoseContacts(d *doctor, name string, checker monitor.UptimeChecker, ingresses []*v1beta1.Ingress) {
+	check := "contacts " + name
+	r, ok := checker.(monitor.ContactResolver)
+	if !ok {
+		d.report(check, skip, "the provider's contacts cannot be resolved in advance")
+		return
+	}
+	unresolved := 0
+	for _, ing := range ingresses {
+		contacts := annotationList(ing, cruise.ContactsAnnotation)
+		if len(contacts) == 0 || !selects(ing, name) {
+			continue
+		}
+		if err := r.ResolveContacts(contacts); err != nil {
+			d.report(check, fail, "%s/%s: %v", ing.Namespace, ing.Name, err)
+			unresolved++
+		}
+	}
+	if unresolved == 0 {
+		d.report(check, pass, "all contacts resolve")
+	}
+}
+
+// diagnoseQuota checks the provider name has room for the checks of the
+// Ingresses' hosts which it does not yet have.
+func (c *doctorCommand) diagnoseQuota(ctx context.Context, d *doctor, name string, checker monitor.UptimeChecker, ingresses []*v1beta1.Ingress) {
+	check := "quota " + name
+	q, ok := checker.(monitor.QuotaReporter)
+	if !ok {
+		d.report(check, skip, "the provider does not report a quota")
+		return
+	}
+	var used, limit int
+	err := c.providers.call(ctx, func(ctx context.Context) error {
+		var err error
+		used, limit, err = q.Quota(ctx)
+		return err
+	})
+	if err != nil {
+		d.report(check, fail, "%v", err)
+		return
+	}
+	if limit <= 0 {
+		d.report(check, pass, "%d checks used, no limit", used)
+		return
+	}
+
+	missing := make(map[string]bool)
+	for _, ing := range ingresses {
+		if !selects(ing, name) {
+			continue
+		}
+		for _, r := range ing.Spec.Rules {
+			if _, ok := checker.UptimeChecks()[r.Host]; r.Host != "" && !ok {
+				missing[r.Host] = true
+			}
+		}
+	}
+	headroom := limit - used
+	switch {
+	case len(missing) > headroom:
+		d.report(check, fail, "%d of %d checks used, %d more hosts need checks", used, limit, len(missing))
+	case headroom-len(missing) < limit/10:
+		d.report(check, warn, "%d of %d checks used, %d more hosts need checks", used, limit, len(missing))
+	default:
+		d.report(check, pass, "%d of %d checks used, %d more hosts need checks", used, limit, len(missing))
+	}
+}
+
+// selects reports whether the hosts of ing are checked by the provider
+// name.
+func selects(ing *v1beta1.Ingress, name string) bool {
+	providers := annotationList(ing, cruise.ProvidersAnnotation)
+	if len(providers) == 0 {
+		return true
+	}
+	for _, p := range providers {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// annotationList returns the elements of the comma separated annotation
+// key of ing.
+func annotationList(ing *v1beta1.Ingress, key string) []string {
+	var values []string
+	for _, v := range strings.Split(ing.Annotations[key], ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func (d *doctor) write(w io.Writer, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(d.diagnoses)
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, diag := range d.diagnoses {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", strings.ToUpper(diag.Result), diag.Check, diag.Detail)
+	}
+	return tw.Flush()
+}
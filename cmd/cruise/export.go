@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/ghodss/yaml"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/heptiolabs/cruise/internal/composite"
+	"github.com/heptiolabs/cruise/internal/monitor"
+)
+
+// checkFileVersion identifies the format of the files written by export
+// and read by import.
+const checkFileVersion = "cruise.heptio.com/v1"
+
+// checkFile is the declarative form of a set of checks.
+type checkFile struct {
+	Version string      `json:"version"`
+	Checks  []checkSpec `json:"checks"`
+}
+
+// checkSpec is the definition of a check, as in monitor.UptimeCheck
+// less the fields the provider assigns. Providers is not exported, as it
+// names the providers of the source rather than those the file is
+// applied to, but may be given to import.
+type checkSpec struct {
+	Hostname    string   `json:"hostname"`
+	Name        string   `json:"name"`
+	TLS         bool     `json:"tls,omitempty"`
+	Interval    string   `json:"interval"`
+	Paused      bool     `json:"paused,omitempty"`
+	Path        string   `json:"path,omitempty"`
+	Keyword     string   `json:"keyword,omitempty"`
+	HTTP2       bool     `json:"http2,omitempty"`
+	StatusCodes []int    `json:"statusCodes,omitempty"`
+	Contacts    []string `json:"contacts,omitempty"`
+	Regions     []string `json:"regions,omitempty"`
+	Namespace   string   `json:"namespace,omitempty"`
+	Ingress     string   `json:"ingress,omitempty"`
+	Providers   []string `json:"providers,omitempty"`
+}
+
+func toCheckSpec(check *monitor.UptimeCheck) checkSpec {
+	return checkSpec{
+		Hostname:    check.Hostname,
+		Name:        check.Name,
+		TLS:         check.EnableTLS,
+		Interval:    formatInterval(check.CheckIntervalInMinutes),
+		Paused:      check.Paused,
+		Path:        check.Path,
+		Keyword:     check.Keyword,
+		HTTP2:       check.HTTP2,
+		StatusCodes: check.StatusCodes,
+		Contacts:    check.Contacts,
+		Regions:     check.Regions,
+		Namespace:   check.Namespace,
+		Ingress:     check.Ingress,
+	}
+}
+
+// uptimeCheck returns the check defined by s.
+func (s checkSpec) uptimeCheck() (*monitor.UptimeCheck, error) {
+	if s.Hostname == "" {
+		return nil, fmt.Errorf("check %q: missing hostname", s.Name)
+	}
+	d, err := time.ParseDuration(s.Interval)
+	if err != nil || d <= 0 {
+		return nil, fmt.Errorf("check for %q: invalid interval %q", s.Hostname, s.Interval)
+	}
+	return &monitor.UptimeCheck{
+		Hostname:               s.Hostname,
+		Name:                   s.Name,
+		EnableTLS:              s.TLS,
+		CheckIntervalInMinutes: int((d + time.Minute - 1) / time.Minute),
+		Paused:                 s.Paused,
+		Path:                   s.Path,
+		Keyword:                s.Keyword,
+		HTTP2:                  s.HTTP2,
+		StatusCodes:            s.StatusCodes,
+		Contacts:               s.Contacts,
+		Regions:                s.Regions,
+		Namespace:              s.Namespace,
+		Ingress:                s.Ingress,
+		Providers:              s.Providers,
+	}, nil
+}
+
+// exportCommand writes the checks of the selected providers as a
+// checkFile.
+type exportCommand struct {
+	cmd       *kingpin.CmdClause
+	kube      *kubeFlags
+	providers *providerFlags
+}
+
+func addExportCommand(app *kingpin.Application) *exportCommand {
+	cmd := app.Command("export", "Write the checks of the monitoring providers as YAML, to be applied with import.")
+	return &exportCommand{
+		cmd:       cmd,
+		kube:      addKubeFlags(cmd),
+		providers: addProviderFlags(cmd),
+	}
+}
+
+func (e *exportCommand) run(ctx context.Context, out, status io.Writer) error {
+	config, _ := e.kube.config() // only some providers need a cluster
+	members, err := e.providers.uptimeCheckers(ctx, monitor.Options{KubeConfig: config})
+	if err != nil {
+		return err
+	}
+	c, err := composite.NewCompositeUptimeChecker(members...)
+	if err != nil {
+		return err
+	}
+
+	checks := c.UptimeChecks()
+	var hosts []string
+	for host := range checks {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	f := checkFile{Version: checkFileVersion, Checks: []checkSpec{}}
+	skipped := make(map[string]bool)
+	for _, host := range hosts {
+		if m, ok := undefined(members, host); ok {
+			fmt.Fprintf(status, "skipping %s: the check at %s is of a kind which cannot be exported\n", host, m)
+			skipped[host] = true
+			continue
+		}
+		f.Checks = append(f.Checks, toCheckSpec(checks[host]))
+	}
+
+	// the composite does not report hosts whose checks differ between
+	// providers, as they have no single definition.
+	for _, m := range members {
+		for host := range m.Checker.UptimeChecks() {
+			if _, ok := checks[host]; !ok && !skipped[host] {
+				fmt.Fprintf(status, "skipping %s: the checks of the providers differ\n", host)
+				skipped[host] = true
+			}
+		}
+	}
+
+	b, err := yaml.Marshal(f)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(b)
+	return err
+}
+
+// undefined returns the name of the first of members whose check for
+// host an UptimeCheck describes only in part, see monitor.Definer.
+func undefined(members []composite.Member, host string) (string, bool) {
+	for _, m := range members {
+		if d, ok := m.Checker.(monitor.Definer); ok && !d.Defined(host) {
+			return m.Name, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/ghodss/yaml"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/heptiolabs/cruise/internal/composite"
+	"github.com/heptiolabs/cruise/internal/monitor"
+)
+
+// importCommand applies the checks of a checkFile to the selected
+// providers.
+type importCommand struct {
+	cmd         *kingpin.CmdClause
+	kube        *kubeFlags
+	providers   *providerFlags
+	file        *string
+	clusterName *string
+	dryRun      *bool
+}
+
+func addImportCommand(app *kingpin.Application) *importCommand {
+	cmd := app.Command("import", "Create or update the checks of the monitoring providers to match a file written by export.")
+	return &importCommand{
+		cmd:         cmd,
+		kube:        addKubeFlags(cmd),
+		providers:   addProviderFlags(cmd),
+		file:        cmd.Arg("file", "file of checks to apply, - for standard input").Required().String(),
+		clusterName: cmd.Flag("cluster-name", "name of the cluster recorded by providers which label checks with their origin").String(),
+		dryRun:      cmd.Flag("dry-run", "only print the changes which would be made").Bool(),
+	}
+}
+
+// readCheckFile reads and validates the checks of the checkFile r.
+func readCheckFile(r io.Reader) ([]*monitor.UptimeCheck, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var f checkFile
+	if err := yaml.Unmarshal(b, &f); err != nil {
+		return nil, err
+	}
+	if f.Version != checkFileVersion {
+		return nil, fmt.Errorf("unsupported version %q, expected %q", f.Version, checkFileVersion)
+	}
+	seen := make(map[string]bool)
+	var checks []*monitor.UptimeCheck
+	for _, s := range f.Checks {
+		check, err := s.uptimeCheck()
+		if err != nil {
+			return nil, err
+		}
+		if seen[check.Hostname] {
+			return nil, fmt.Errorf("duplicate check for %q", check.Hostname)
+		}
+		seen[check.Hostname] = true
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+func (i *importCommand) run(ctx context.Context, in io.Reader, out io.Writer) error {
+	if *i.file != "-" {
+		f, err := os.Open(*i.file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	checks, err := readCheckFile(in)
+	if err != nil {
+		return fmt.Errorf("%s: %v", *i.file, err)
+	}
+
+	config, _ := i.kube.config() // only some providers need a cluster
+	members, err := i.providers.uptimeCheckers(ctx, monitor.Options{
+		KubeConfig: config,
+		Cluster:    *i.clusterName,
+	})
+	if err != nil {
+		return err
+	}
+	c, err := composite.NewCompositeUptimeChecker(members...)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, check := range checks {
+		action, err := i.apply(ctx, c, check)
+		if err != nil {
+			fmt.Fprintf(out, "%s: %v\n", check.Hostname, err)
+			failed++
+			continue
+		}
+		fmt.Fprintf(out, "%s: %s\n", check.Hostname, action)
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to apply %d of %d checks", failed, len(checks))
+	}
+	return nil
+}
+
+// apply makes the check for check.Hostname match check, returning what
+// was done. A check which already matches is left alone, so applying
+// the same file again changes nothing.
+func (i *importCommand) apply(ctx context.Context, c *composite.CompositeUptimeChecker, check *monitor.UptimeCheck) (string, error) {
+	existing, exists := c.UptimeChecks()[check.Hostname]
+	action := "created"
+	switch {
+	case exists && monitor.SameCheck(existing, check) && existing.Paused == check.Paused:
+		return "unchanged", nil
+	case exists:
+		action = "updated"
+	}
+	if *i.dryRun {
+		return action + " (dry run)", nil
+	}
+
+	return action, i.providers.call(ctx, func(ctx context.Context) error {
+		if exists {
+			return c.UpdateUptimeCheck(ctx, check)
+		}
+		return c.CreateUptimeCheck(ctx, check)
+	})
+}
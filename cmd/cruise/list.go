@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/ghodss/yaml"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/heptiolabs/cruise/internal/composite"
+	"github.com/heptiolabs/cruise/internal/cruise"
+	"github.com/heptiolabs/cruise/internal/monitor"
+)
+
+// listCommand prints the checks of the selected providers.
+type listCommand struct {
+	cmd       *kingpin.CmdClause
+	kube      *kubeFlags
+	providers *providerFlags
+	output    *string
+	namespace *string
+	host      *string
+	owner     *string
+}
+
+func addListCommand(app *kingpin.Application) *listCommand {
+	cmd := app.Command("list", "List the checks of the monitoring providers.")
+	return &listCommand{
+		cmd:       cmd,
+		kube:      addKubeFlags(cmd),
+		providers: addProviderFlags(cmd),
+		output:    cmd.Flag("output", "output format").Short('o').Default("table").Enum("table", "json", "yaml"),
+		namespace: cmd.Flag("namespace", "only list the checks for the Ingresses of namespace").String(),
+		host:      cmd.Flag("host", "only list the checks for hostnames matching the pattern, eg. *.example.com").String(),
+		owner:     cmd.Flag("owner", "only list the checks created by cruise, or those which were not").Default("any").Enum("any", "cruise", "other"),
+	}
+}
+
+// listedCheck is a check as output by the list command.
+type listedCheck struct {
+	Provider  string `json:"provider"`
+	ID        string `json:"id,omitempty"`
+	Hostname  string `json:"hostname"`
+	Name      string `json:"name"`
+	TLS       bool   `json:"tls"`
+	Interval  string `json:"interval"`
+	Cluster   string `json:"cluster,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Ingress   string `json:"ingress,omitempty"`
+	Owned     bool   `json:"owned"`
+	Status    string `json:"status"`
+}
+
+func (l *listCommand) run(ctx context.Context, w io.Writer) error {
+	if _, err := path.Match(*l.host, ""); err != nil {
+		return fmt.Errorf("invalid --host pattern %q: %v", *l.host, err)
+	}
+	config, _ := l.kube.config() // only some providers need a cluster
+	members, err := l.providers.uptimeCheckers(ctx, monitor.Options{KubeConfig: config})
+	if err != nil {
+		return err
+	}
+
+	var checks []listedCheck
+	for _, m := range members {
+		var hosts []string
+		for host := range m.Checker.UptimeChecks() {
+			hosts = append(hosts, host)
+		}
+		sort.Strings(hosts)
+		for _, host := range hosts {
+			lc := listed(m, m.Checker.UptimeChecks()[host])
+			if l.matches(lc) {
+				checks = append(checks, lc)
+			}
+		}
+	}
+	return writeChecks(w, *l.output, checks)
+}
+
+// listed returns check, of member m, as it is listed.
+func listed(m composite.Member, check *monitor.UptimeCheck) listedCheck {
+	namespace, ingress, owned := cruise.Owner(check)
+	lc := listedCheck{
+		Provider:  m.Name,
+		Hostname:  check.Hostname,
+		Name:      check.Name,
+		TLS:       check.EnableTLS,
+		Interval:  formatInterval(check.CheckIntervalInMinutes),
+		Cluster:   check.Cluster,
+		Namespace: namespace,
+		Ingress:   ingress,
+		Owned:     owned,
+		Status:    check.Status,
+	}
+	if id, ok := m.Checker.(monitor.Identifier); ok {
+		lc.ID = id.CheckID(check.Hostname)
+	} else if check.ID != 0 {
+		lc.ID = strconv.Itoa(check.ID)
+	}
+	switch {
+	case check.Paused:
+		lc.Status = "paused"
+	case lc.Status == "":
+		lc.Status = "unknown"
+	}
+	return lc
+}
+
+func (l *listCommand) matches(lc listedCheck) bool {
+	if *l.namespace != "" && lc.Namespace != *l.namespace {
+		return false
+	}
+	if *l.host != "" {
+		if ok, _ := path.Match(*l.host, lc.Hostname); !ok {
+			return false
+		}
+	}
+	switch *l.owner {
+	case "cruise":
+		return lc.Owned
+	case "other":
+		return !lc.Owned
+	}
+	return true
+}
+
+// writeChecks writes checks to w in format, table, json or yaml.
+func writeChecks(w io.Writer, format string, checks []listedCheck) error {
+	if checks == nil {
+		checks = []listedCheck{}
+	}
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(checks)
+	case "yaml":
+		b, err := yaml.Marshal(checks)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROVIDER\tID\tHOSTNAME\tTLS\tINTERVAL\tCLUSTER\tINGRESS\tSTATUS")
+	for _, c := range checks {
+		ingress := "-"
+		if c.Owned {
+			ingress = c.Namespace + "/" + c.Ingress
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%t\t%s\t%s\t%s\t%s\n",
+			c.Provider, dash(c.ID), c.Hostname, c.TLS, c.Interval, dash(c.Cluster), ingress, c.Status)
+	}
+	return tw.Flush()
+}
+
+// formatInterval formats an interval in minutes, eg. "5m" or "1h".
+func formatInterval(minutes int) string {
+	if minutes >= 60 && minutes%60 == 0 {
+		return strconv.Itoa(minutes/60) + "h"
+	}
+	return strconv.Itoa(minutes) + "m"
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/heptiolabs/cruise/internal/migrate"
+	"github.com/heptiolabs/cruise/internal/monitor"
+	"github.com/sirupsen/logrus"
+)
+
+// migrateCommand copies the checks of one provider to another.
+type migrateCommand struct {
+	cmd          *kingpin.CmdClause
+	kube         *kubeFlags
+	providers    *providerFlags
+	from         *string
+	to           *string
+	host         *string
+	clusterName  *string
+	removeSource *bool
+	progress     *string
+}
+
+func addMigrateCommand(app *kingpin.Application) *migrateCommand {
+	cmd := app.Command("migrate", "Copy the checks of one monitoring provider to another, optionally removing them from the first.")
+	return &migrateCommand{
+		cmd:          cmd,
+		kube:         addKubeFlags(cmd),
+		providers:    addProviderConfigFlags(cmd),
+		from:         cmd.Flag("from", "provider whose checks are copied").Required().Enum(monitor.Providers()...),
+		to:           cmd.Flag("to", "provider to which the checks are copied").Required().Enum(monitor.Providers()...),
+		host:         cmd.Flag("host", "only migrate the checks for hostnames matching the pattern, eg. *.example.com").String(),
+		clusterName:  cmd.Flag("cluster-name", "name of the cluster recorded by providers which label checks with their origin").String(),
+		removeSource: cmd.Flag("remove-source", "delete each check from the source provider once it is verified at the destination").Bool(),
+		progress:     cmd.Flag("progress", "file recording the progress of the migration, from which it is resumed").Default("cruise-migrate.json").String(),
+	}
+}
+
+func (m *migrateCommand) run(ctx context.Context, log logrus.FieldLogger) error {
+	if *m.from == *m.to {
+		return fmt.Errorf("cannot migrate from %s to itself", *m.from)
+	}
+	if _, err := path.Match(*m.host, ""); err != nil {
+		return fmt.Errorf("invalid --host pattern %q: %v", *m.host, err)
+	}
+	progress, err := migrate.Load(*m.progress, *m.from, *m.to)
+	if err != nil {
+		return err
+	}
+
+	config, _ := m.kube.config() // only some providers need a cluster
+	opts := monitor.Options{KubeConfig: config, Cluster: *m.clusterName}
+	from, err := m.providers.uptimeChecker(ctx, *m.from, opts)
+	if err != nil {
+		return err
+	}
+	to, err := m.providers.uptimeChecker(ctx, *m.to, opts)
+	if err != nil {
+		return err
+	}
+
+	hosts := []string{}
+	for host := range from.UptimeChecks() {
+		if ok, _ := path.Match(*m.host, host); ok || *m.host == "" {
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
+	log.Infof("migrating %d checks from %s to %s", len(hosts), *m.from, *m.to)
+
+	migration := &migrate.Migration{
+		From:           from,
+		To:             to,
+		Progress:       progress,
+		Save:           func() error { return progress.Save(*m.progress) },
+		RemoveSource:   *m.removeSource,
+		RequestTimeout: *m.providers.requestTimeout,
+		Logger:         log,
+	}
+	return migration.Run(ctx, hosts)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/heptiolabs/cruise/internal/composite"
+	"github.com/heptiolabs/cruise/internal/monitor"
+)
+
+// providerFlags are the flags which select and configure the uptime
+// monitoring providers used by a command.
+type providerFlags struct {
+	names          *[]string
+	providers      map[string]monitor.Provider
+	requestTimeout *time.Duration
+	rateLimit      *float64
+	rateLimitBurst *int
+}
+
+func addProviderFlags(cmd *kingpin.CmdClause) *providerFlags {
+	names := cmd.Flag("provider", "uptime monitoring provider to manage checks with, may be repeated").Default("pingdom").Enums(monitor.Providers()...)
+	f := addProviderConfigFlags(cmd)
+	f.names = names
+	return f
+}
+
+// addProviderConfigFlags adds the flags which configure the providers,
+// for commands which select them otherwise.
+func addProviderConfigFlags(cmd *kingpin.CmdClause) *providerFlags {
+	providers := make(map[string]monitor.Provider)
+	for _, name := range monitor.Providers() {
+		p, _ := monitor.Lookup(name)
+		p.Flags(cmd)
+		providers[name] = p
+	}
+	return &providerFlags{
+		providers:      providers,
+		requestTimeout: cmd.Flag("request-timeout", "timeout for each call to the monitoring provider").Default("30s").Duration(),
+		rateLimit:      cmd.Flag("rate-limit", "maximum sustained requests per second to the monitoring provider, 0 to disable").Default("1").Float64(),
+		rateLimitBurst: cmd.Flag("rate-limit-burst", "maximum burst of requests to the monitoring provider").Default("5").Int(),
+	}
+}
+
+// uptimeCheckers returns an UptimeChecker for each selected provider,
+// whose checks have been synced.
+func (f *providerFlags) uptimeCheckers(ctx context.Context, opts monitor.Options) ([]composite.Member, error) {
+	var members []composite.Member
+	for _, name := range *f.names {
+		checker, err := f.uptimeChecker(ctx, name, opts)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, composite.Member{Name: name, Checker: checker})
+	}
+	return members, nil
+}
+
+// uptimeChecker returns an UptimeChecker for the provider name, whose
+// checks have been synced.
+func (f *providerFlags) uptimeChecker(ctx context.Context, name string, opts monitor.Options) (monitor.UptimeChecker, error) {
+	p, ok := f.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown provider %q", name)
+	}
+	opts.RateLimit = monitor.RateLimit{
+		QPS:   *f.rateLimit,
+		Burst: *f.rateLimitBurst,
+	}
+	var checker monitor.UptimeChecker
+	err := f.call(ctx, func(ctx context.Context) error {
+		var err error
+		checker, err = p.New(ctx, opts)
+		return err
+	})
+	return checker, err
+}
+
+// call calls fn with ctx bounded by --request-timeout. A call which the
+// provider rate limits is retried once the provider allows, so that a
+// command's sequence of calls is not abandoned at the first limit.
+func (f *providerFlags) call(ctx context.Context, fn func(context.Context) error) error {
+	return monitor.Retry(ctx, *f.requestTimeout, func(d time.Duration, err error) {
+		fmt.Fprintf(os.Stderr, "%v, retrying in %v\n", err, d)
+	}, fn)
+}
+
+// kubeFlags are the flags which configure access to a cluster.
+type kubeFlags struct {
+	inCluster  *bool
+	kubeconfig *string
+}
+
+func addKubeFlags(cmd *kingpin.CmdClause) *kubeFlags {
+	return &kubeFlags{
+		inCluster:  cmd.Flag("incluster", "use in cluster configuration.").Bool(),
+		kubeconfig: cmd.Flag("kubeconfig", "path to kubeconfig (if not in running inside a cluster)").Default(filepath.Join(os.Getenv("HOME"), ".kube", "config")).String(),
+	}
+}
+
+// config returns the configuration for access to the cluster.
+func (f *kubeFlags) config() (*rest.Config, error) {
+	if *f.kubeconfig != "" && !*f.inCluster {
+		return clientcmd.BuildConfigFromFlags("", *f.kubeconfig)
+	}
+	return rest.InClusterConfig()
+}
+
+// contextConfig returns the configuration for access to the cluster of
+// the kubeconfig context name.
+func (f *kubeFlags) contextConfig(name string) (*rest.Config, error) {
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: *f.kubeconfig},
+		&clientcmd.ConfigOverrides{CurrentContext: name},
+	).ClientConfig()
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"github.com/heptiolabs/cruise/internal/composite"
+	"github.com/heptiolabs/cruise/internal/cruise"
+	"github.com/heptiolabs/cruise/internal/monitor"
+)
+
+// pruneCommand deletes the checks created by cruise for hosts which no
+// Ingress references any more.
+type pruneCommand struct {
+	cmd       *kingpin.CmdClause
+	kube      *kubeFlags
+	providers *providerFlags
+	contexts  *[]string
+	cluster   *string
+	paused    *bool
+	yes       *bool
+	report    *string
+}
+
+func addPruneCommand(app *kingpin.Application) *pruneCommand {
+	cmd := app.Command("prune", "Delete the checks created by cruise whose hosts are no longer referenced by any Ingress.")
+	return &pruneCommand{
+		cmd:       cmd,
+		kube:      addKubeFlags(cmd),
+		providers: addProviderFlags(cmd),
+		contexts:  cmd.Flag("context", "kubeconfig context of a cluster whose Ingresses own checks, may be repeated; defaults to the current context").Strings(),
+		cluster:   cmd.Flag("cluster", "only prune the checks recorded as created by cruise in the named cluster").String(),
+		paused:    cmd.Flag("include-paused", "also prune paused checks, which are otherwise kept as they may have been paused on removal of their Ingress").Bool(),
+		yes:       cmd.Flag("yes", "delete the orphaned checks without asking for confirmation").Short('y').Bool(),
+		report:    cmd.Flag("report", "file to write the JSON report of the deleted checks to").Default("-").String(),
+	}
+}
+
+// prunedCheck is a check in the report of the prune command.
+type prunedCheck struct {
+	listedCheck
+	Deleted bool   `json:"deleted"`
+	Error   string `json:"error,omitempty"`
+}
+
+// orphan is a check which has no live owner.
+type orphan struct {
+	member composite.Member
+	check  *monitor.UptimeCheck
+}
+
+func (p *pruneCommand) run(ctx context.Context, in io.Reader, out, status io.Writer) error {
+	live, err := p.liveHosts()
+	if err != nil {
+		return err
+	}
+	config, _ := p.kube.config() // only some providers need a cluster
+	members, err := p.providers.uptimeCheckers(ctx, monitor.Options{KubeConfig: config})
+	if err != nil {
+		return err
+	}
+
+	orphans := findOrphans(members, live, *p.cluster, *p.paused)
+	if len(orphans) == 0 {
+		fmt.Fprintln(status, "no orphaned checks found")
+		return p.writeReport(out, nil)
+	}
+
+	candidates := make([]listedCheck, len(orphans))
+	for i, o := range orphans {
+		candidates[i] = listed(o.member, o.check)
+	}
+	if err := writeChecks(status, "table", candidates); err != nil {
+		return err
+	}
+	if !*p.yes && !confirm(in, status, fmt.Sprintf("Delete %d checks?", len(orphans))) {
+		fmt.Fprintln(status, "no checks deleted")
+		return p.writeReport(out, nil)
+	}
+
+	report := make([]prunedCheck, len(orphans))
+	failed := 0
+	for i, o := range orphans {
+		report[i].listedCheck = candidates[i]
+		err := p.providers.call(ctx, func(ctx context.Context) error {
+			return o.member.Checker.DeleteUptimeCheck(ctx, o.check.Hostname)
+		})
+		if err != nil {
+			report[i].Error = err.Error()
+			failed++
+			continue
+		}
+		report[i].Deleted = true
+	}
+	if err := p.writeReport(out, report); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to delete %d of %d checks", failed, len(orphans))
+	}
+	return nil
+}
+
+// liveHosts returns the hosts of the Ingresses of every selected
+// cluster.
+func (p *pruneCommand) liveHosts() (map[string]bool, error) {
+	contexts := *p.contexts
+	if len(contexts) == 0 {
+		contexts = []string{""}
+	}
+	live := make(map[string]bool)
+	for _, name := range contexts {
+		var config *rest.Config
+		var err error
+		if name == "" {
+			config, err = p.kube.config()
+		} else {
+			config, err = p.kube.contextConfig(name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("context %q: %v", name, err)
+		}
+		client, err := kubernetes.NewForConfig(config)
+		if err != nil {
+			return nil, fmt.Errorf("context %q: %v", name, err)
+		}
+		ingresses, err := client.ExtensionsV1beta1().Ingresses(metav1.NamespaceAll).List(metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("context %q: listing ingresses: %v", name, err)
+		}
+		for _, ing := range ingresses.Items {
+			for _, r := range ing.Spec.Rules {
+				if r.Host != "" {
+					live[r.Host] = true
+				}
+			}
+		}
+	}
+	return live, nil
+}
+
+// findOrphans returns the checks, created by cruise in cluster if it is
+// set, whose hosts are not in live. Checks cruise did not create are
+// never orphans, nor are paused checks unless paused is true.
+func findOrphans(members []composite.Member, live map[string]bool, cluster string, paused bool) []orphan {
+	var orphans []orphan
+	for _, m := range members {
+		checks := m.Checker.UptimeChecks()
+		var hosts []string
+		for host := range checks {
+			hosts = append(hosts, host)
+		}
+		sort.Strings(hosts)
+		for _, host := range hosts {
+			check := checks[host]
+			if _, _, owned := cruise.Owner(check); !owned || live[host] {
+				continue
+			}
+			if cluster != "" && check.Cluster != cluster {
+				continue
+			}
+			if check.Paused && !paused {
+				continue
+			}
+			orphans = append(orphans, orphan{member: m, check: check})
+		}
+	}
+	return orphans
+}
+
+// confirm asks question on w and reports whether the answer read from r
+// was yes.
+func confirm(r io.Reader, w io.Writer, question string) bool {
+	fmt.Fprintf(w, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(r).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// writeReport writes report as JSON to the --report file, or to out.
+func (p *pruneCommand) writeReport(out io.Writer, report []prunedCheck) error {
+	if report == nil {
+		report = []prunedCheck{}
+	}
+	if *p.report == "-" {
+		return encodeReport(out, report)
+	}
+	f, err := os.Create(*p.report)
+	if err != nil {
+		return err
+	}
+	if err := encodeReport(f, report); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func encodeReport(w io.Writer, report []prunedCheck) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
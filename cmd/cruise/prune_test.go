@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/heptiolabs/cruise/internal/composite"
+	"github.com/heptiolabs/cruise/internal/monitor"
+)
+
+// listing is an UptimeChecker which only lists its checks.
+type listing map[string]*monitor.UptimeCheck
+
+func (l listing) UptimeChecks() map[string]*monitor.UptimeCheck                 { return l }
+func (l listing) SyncUptimeChecks(context.Context) error                        { return nil }
+func (l listing) CreateUptimeCheck(context.Context, *monitor.UptimeCheck) error { return nil }
+func (l listing) DeleteUptimeCheck(context.Context, string) error               { return nil }
+func (l listing) PauseUptimeCheck(context.Context, string) error                { return nil }
+func (l listing) ResumeUptimeCheck(context.Context, string) error               { return nil }
+
+func TestFindOrphans(t *testing.T) {
+	a := listing{
+		"live.example.com":   {Hostname: "live.example.com", Name: "ns/live (live.example.com:80)"},
+		"gone.example.com":   {Hostname: "gone.example.com", Name: "ns/gone (gone.example.com:80)"},
+		"manual.example.com": {Hostname: "manual.example.com", Name: "Manual check"},
+		"paused.example.com": {Hostname: "paused.example.com", Name: "ns/paused (paused.example.com:80)", Paused: true},
+	}
+	b := listing{
+		"other.example.com": {Hostname: "other.example.com", Namespace: "ns", Ingress: "other", Cluster: "other"},
+		"here.example.com":  {Hostname: "here.example.com", Namespace: "ns", Ingress: "here", Cluster: "here"},
+	}
+	members := []composite.Member{{Name: "a", Checker: a}, {Name: "b", Checker: b}}
+	live := map[string]bool{"live.example.com": true}
+
+	hosts := func(orphans []orphan) []string {
+		var hosts []string
+		for _, o := range orphans {
+			hosts = append(hosts, o.member.Name+":"+o.check.Hostname)
+		}
+		return hosts
+	}
+	tests := map[string]struct {
+		cluster string
+		paused  bool
+		want    []string
+	}{
+		"all":            {want: []string{"a:gone.example.com", "b:here.example.com", "b:other.example.com"}},
+		"include paused": {paused: true, want: []string{"a:gone.example.com", "a:paused.example.com", "b:here.example.com", "b:other.example.com"}},
+		"cluster":        {cluster: "here", want: []string{"b:here.example.com"}},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, hosts(findOrphans(members, live, tc.cluster, tc.paused)))
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+	"k8s.io/client-go/rest"
+
+	"github.com/heptiolabs/cruise/internal/composite"
+	"github.com/heptiolabs/cruise/internal/config"
+	"github.com/heptiolabs/cruise/internal/cruise"
+	"github.com/heptiolabs/cruise/internal/monitor"
+	"github.com/heptiolabs/cruise/internal/secret"
+)
+
+// reloader applies changes to the configuration file of cruise serve,
+// to the files it references, and to the files given for credentials,
+// such as mounted Secrets, while cruise runs. The command line is parsed
+// again with each version of the file, the providers whose settings have
+// changed are replaced, and the new settings are applied. A
+// configuration which is invalid, or with which a provider cannot be
+// constructed, is not applied. The providers replaced, or constructed
+// for a configuration not applied, are closed.
+type reloader struct {
+	args       []string
+	path       string // of the configuration file, if any
+	kubeConfig *rest.Config
+	cruise     *cruise.Cruise
+	checker    *composite.CompositeUptimeChecker
+
+	// serve and members are the flags, and the providers constructed
+	// from them, last applied.
+	serve   *serveCommand
+	members []composite.Member
+
+	logger logrus.FieldLogger
+}
+
+// run looks for changes every interval until ctx is done.
+func (r *reloader) run(ctx context.Context, interval time.Duration, cfg *config.Config) {
+	files := watchedFiles(r.path, cfg, r.serve.cmd)
+	applied := fingerprint(files)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if fingerprint(files) == applied {
+			continue
+		}
+		cfg, err := r.reload(ctx)
+		if err != nil {
+			// retried at the next tick, eg. once a Secret is fully updated.
+			r.logger.Errorf("reloading: %v; keeping the previous configuration", err)
+			continue
+		}
+		files = watchedFiles(r.path, cfg, r.serve.cmd)
+		applied = fingerprint(files)
+		r.logger.Infof("reloaded %s", strings.Join(files, ", "))
+	}
+}
+
+// reload parses the command line with the current configuration and
+// credential files, and applies it.
+func (r *reloader) reload(ctx context.Context) (*config.Config, error) {
+	app := kingpin.New("cruise", "")
+	s := addServeCommand(app)
+	cfg, err := loadConfig(app, s.cmd, r.args)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := app.Parse(r.args); err != nil {
+		return nil, err
+	}
+
+	opts := monitor.Options{
+		KubeConfig: r.kubeConfig,
+		Cluster:    *s.clusterName,
+	}
+	var members []composite.Member
+	for _, name := range *s.providers.names {
+		if m, ok := r.unchanged(s, name); ok {
+			members = append(members, m)
+			continue
+		}
+		r.logger.Infof("reconfiguring provider %s", name)
+		checker, err := s.providers.uptimeChecker(ctx, name, opts)
+		if err != nil {
+			composite.Close(members, r.members)
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		members = append(members, composite.Member{Name: name, Checker: checker})
+	}
+
+	err = r.cruise.Reconfigure(func() error {
+		c := r.cruise
+		filter, defaults, contacts, nameTemplate, budget := c.Filter, c.Defaults, c.Contacts, c.NameTemplate, c.Budget
+		if cfg != nil {
+			if err := configure(c, cfg); err != nil {
+				return err
+			}
+		}
+		if err := r.checker.SetMembers(members...); err != nil {
+			c.Filter, c.Defaults, c.Contacts, c.NameTemplate = filter, defaults, contacts, nameTemplate
+			return err
+		}
+		c.RequestTimeout = *s.providers.requestTimeout
+		c.Budget = cruise.Budget{
+			Max:             *s.maxChecks,
+			MaxPerNamespace: *s.maxChecksPerNamespace,
+		}
+		if c.Budget != budget {
+			r.logger.Infof("check budget now %d, %d per namespace", c.Budget.Max, c.Budget.MaxPerNamespace)
+		}
+		c.Provider = strings.Join(*s.providers.names, ",")
+		return nil
+	})
+	if err != nil {
+		// the providers constructed for it are not used.
+		composite.Close(members, r.members)
+		return nil, err
+	}
+	r.serve, r.members = s, members
+	return cfg, nil
+}
+
+// unchanged returns the member for the provider name last applied, if
+// its settings in s are as they were.
+func (r *reloader) unchanged(s *serveCommand, name string) (composite.Member, bool) {
+	prev, next := r.serve.providers, s.providers
+	if *prev.rateLimit != *next.rateLimit || *prev.rateLimitBurst != *next.rateLimitBurst || *r.serve.clusterName != *s.clusterName {
+		return composite.Member{}, false
+	}
+	if !reflect.DeepEqual(prev.providers[name], next.providers[name]) {
+		return composite.Member{}, false
+	}
+	for _, m := range r.members {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return composite.Member{}, false
+}
+
+// watchedFiles returns the configuration file path, the files referenced
+// by cfg, and the credential files given to cmd, whose changes are
+// reloaded.
+func watchedFiles(path string, cfg *config.Config, cmd *kingpin.CmdClause) []string {
+	var files []string
+	if cfg != nil {
+		for _, name := range cfg.ProviderNames() {
+			for _, s := range cfg.Providers[name] {
+				if s.File != "" {
+					files = append(files, s.File)
+				}
+			}
+		}
+		sort.Strings(files)
+		files = append([]string{path}, files...)
+	}
+	return append(files, secret.Files(cmd)...)
+}
+
+// fingerprint returns a digest of the contents of files. Files which
+// cannot be read contribute their error.
+func fingerprint(files []string) string {
+	h := sha256.New()
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			data = []byte(err.Error())
+		}
+		fmt.Fprintf(h, "%s %d\n", f, len(data))
+		h.Write(data)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/heptiolabs/cruise/internal/cruise"
+	"github.com/heptiolabs/cruise/internal/monitor"
+	"github.com/heptiolabs/cruise/internal/report"
+)
+
+// reportCommand reports the availability of the hosts checked by
+// cruise.
+type reportCommand struct {
+	cmd       *kingpin.CmdClause
+	kube      *kubeFlags
+	providers *providerFlags
+	from      *string
+	to        *string
+	slo       *float64
+	groupBy   *string
+	output    *string
+}
+
+func addReportCommand(app *kingpin.Application) *reportCommand {
+	cmd := app.Command("report", "Report the availability of the hosts checked by cruise over a period.")
+	return &reportCommand{
+		cmd:       cmd,
+		kube:      addKubeFlags(cmd),
+		providers: addProviderFlags(cmd),
+		from:      cmd.Flag("from", "start of the period, as a date, eg. 2018-05-01, or RFC 3339 time; defaults to the start of last month").String(),
+		to:        cmd.Flag("to", "end of the period, as a date or RFC 3339 time; defaults to the start of this month").String(),
+		slo:       cmd.Flag("slo", "target uptime percentage").Default("99.9").Float64(),
+		groupBy:   cmd.Flag("group-by", "group the hosts by the namespace of their Ingress, or its "+cruise.TeamAnnotation+" annotation").Default("namespace").Enum("namespace", "team"),
+		output:    cmd.Flag("output", "output format").Short('o').Default("markdown").Enum("markdown", "csv", "json"),
+	}
+}
+
+// noGroup is the group of hosts whose Ingress is unknown or does not
+// name a team.
+const noGroup = "(none)"
+
+func (r *reportCommand) run(ctx context.Context, out, status io.Writer) error {
+	from, to, err := r.period(time.Now())
+	if err != nil {
+		return err
+	}
+	var teams map[string]string
+	if *r.groupBy == "team" {
+		if teams, err = r.teams(); err != nil {
+			return err
+		}
+	}
+
+	config, _ := r.kube.config() // only some providers need a cluster
+	members, err := r.providers.uptimeCheckers(ctx, monitor.Options{KubeConfig: config})
+	if err != nil {
+		return err
+	}
+
+	var checks []report.Check
+	for _, m := range members {
+		reporter, ok := m.Checker.(monitor.AvailabilityReporter)
+		if !ok {
+			fmt.Fprintf(status, "skipping %s: the provider does not report availability\n", m.Name)
+			continue
+		}
+		var hosts []string
+		for host := range m.Checker.UptimeChecks() {
+			hosts = append(hosts, host)
+		}
+		sort.Strings(hosts)
+		for _, host := range hosts {
+			namespace, ingress, owned := cruise.Owner(m.Checker.UptimeChecks()[host])
+			if !owned {
+				continue
+			}
+			c := report.Check{
+				Provider:  m.Name,
+				Hostname:  host,
+				Namespace: namespace,
+				Ingress:   ingress,
+				Group:     namespace,
+			}
+			if teams != nil {
+				c.Group = teams[namespace+"/"+ingress]
+			}
+			if c.Group == "" {
+				c.Group = noGroup
+			}
+
+			var a *monitor.Availability
+			err := r.providers.call(ctx, func(ctx context.Context) error {
+				var err error
+				a, err = reporter.Availability(ctx, host, from, to)
+				return err
+			})
+			if err != nil {
+				c.Error = err.Error()
+			} else {
+				c.Availability = *a
+			}
+			checks = append(checks, c)
+		}
+	}
+
+	rep := report.New(from, to, *r.slo, checks)
+	switch *r.output {
+	case "csv":
+		return rep.WriteCSV(out)
+	case "json":
+		return rep.WriteJSON(out)
+	default:
+		return rep.WriteMarkdown(out)
+	}
+}
+
+// period returns the period reported, defaulting to the last calendar
+// month before now, in UTC.
+func (r *reportCommand) period(now time.Time) (from, to time.Time, err error) {
+	now = now.UTC()
+	to = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	from = to.AddDate(0, -1, 0)
+	if *r.from != "" {
+		if from, err = parseTime(*r.from); err != nil {
+			return from, to, fmt.Errorf("invalid --from: %v", err)
+		}
+	}
+	if *r.to != "" {
+		if to, err = parseTime(*r.to); err != nil {
+			return from, to, fmt.Errorf("invalid --to: %v", err)
+		}
+	}
+	if !to.After(from) {
+		return from, to, fmt.Errorf("--from %s is not before --to %s", from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}
+	return from, to, nil
+}
+
+// parseTime parses s as a date, in UTC, or an RFC 3339 time.
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// teams returns the team of each Ingress in the cluster, keyed by its
+// namespace and name.
+func (r *reportCommand) teams() (map[string]string, error) {
+	config, err := r.kube.config()
+	if err != nil {
+		return nil, err
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	list, err := client.ExtensionsV1beta1().Ingresses(metav1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("listing ingresses: %v", err)
+	}
+	teams := make(map[string]string)
+	for _, ing := range list.Items {
+		teams[ing.Namespace+"/"+ing.Name] = ing.Annotations[cruise.TeamAnnotation]
+	}
+	return teams, nil
+}
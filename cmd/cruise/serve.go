@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/heptiolabs/cruise/internal/composite"
+	"github.com/heptiolabs/cruise/internal/config"
+	"github.com/heptiolabs/cruise/internal/cruise"
+	"github.com/heptiolabs/cruise/internal/monitor"
+	"github.com/heptiolabs/cruise/internal/secret"
+)
+
+// serveCommand manages the checks of the Ingresses in the cluster.
+type serveCommand struct {
+	cmd                   *kingpin.CmdClause
+	kube                  *kubeFlags
+	providers             *providerFlags
+	maxChecks             *int
+	maxChecksPerNamespace *int
+	gracePeriod           *time.Duration
+	pauseDuringGrace      *bool
+	removalPolicy         *string
+	clusterName           *string
+	metricsAddr           *string
+	config                *string
+	reloadInterval        *time.Duration
+}
+
+func addServeCommand(app *kingpin.Application) *serveCommand {
+	serve := app.Command("serve", "Serve xDS API traffic")
+	return &serveCommand{
+		cmd:                   serve,
+		kube:                  addKubeFlags(serve),
+		providers:             addProviderFlags(serve),
+		maxChecks:             serve.Flag("max-checks", "maximum number of checks managed across all namespaces, 0 for unlimited").Default("0").Int(),
+		maxChecksPerNamespace: serve.Flag("max-checks-per-namespace", "maximum number of checks managed for any one namespace, 0 for unlimited").Default("0").Int(),
+		gracePeriod:           serve.Flag("deletion-grace-period", "how long to keep checks for hosts no longer referenced by any ingress, in case they reappear").Default("0s").Duration(),
+		pauseDuringGrace:      serve.Flag("pause-during-grace-period", "pause checks while they await deletion").Bool(),
+		removalPolicy:         serve.Flag("removal-policy", "what to do with the checks of hosts no longer referenced by any ingress").Default(string(cruise.RemovalPolicyDelete)).Enum(string(cruise.RemovalPolicyDelete), string(cruise.RemovalPolicyPause)),
+		clusterName:           serve.Flag("cluster-name", "name of the cluster, recorded by providers which label checks with their origin").String(),
+		metricsAddr:           serve.Flag("metrics-address", "address on which to serve Prometheus metrics").Default(":8000").String(),
+		config:                serve.Flag("config", "path to a configuration file, whose settings are overridden by flags").String(),
+		reloadInterval:        serve.Flag("config-reload-interval", "how often to look for changes to the configuration file, the files it references and the credential files, 0 to disable").Default("10s").Duration(),
+	}
+}
+
+func (s *serveCommand) run(args []string, cfg *config.Config, log *logrus.Logger) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stop := make(chan struct{})
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		log.Infof("received %v, shutting down", <-sig)
+		cancel()
+		close(stop)
+	}()
+
+	kubeConfig, err := s.kube.config()
+	if err != nil {
+		return err
+	}
+	client := newClient(kubeConfig)
+	recorder := newRecorder(client)
+
+	opts := monitor.Options{
+		KubeConfig: kubeConfig,
+		Cluster:    *s.clusterName,
+	}
+	members, err := s.providers.uptimeCheckers(ctx, opts)
+	if err != nil {
+		return err
+	}
+	uptimeChecker, err := composite.NewCompositeUptimeChecker(members...)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("providers: %s", strings.Join(*s.providers.names, ", "))
+	logger := secret.NewLogger().WithField("context", "cruise")
+
+	c := cruise.NewCruise(ctx, uptimeChecker, logger)
+	c.RequestTimeout = *s.providers.requestTimeout
+	c.Budget = cruise.Budget{
+		Max:             *s.maxChecks,
+		MaxPerNamespace: *s.maxChecksPerNamespace,
+	}
+	c.GracePeriod = *s.gracePeriod
+	c.PauseDuringGrace = *s.pauseDuringGrace
+	c.RemovalPolicy = cruise.RemovalPolicy(*s.removalPolicy)
+	c.Recorder = recorder
+	c.Provider = strings.Join(*s.providers.names, ",")
+	if cfg != nil {
+		if err := configure(c, cfg); err != nil {
+			return err
+		}
+	}
+	if *s.reloadInterval > 0 && (cfg != nil || len(secret.Files(s.cmd)) > 0) {
+		r := &reloader{
+			args:       args,
+			path:       *s.config,
+			kubeConfig: kubeConfig,
+			cruise:     c,
+			checker:    uptimeChecker,
+			serve:      s,
+			members:    members,
+			logger:     secret.NewLogger().WithField("context", "reload"),
+		}
+		go r.run(ctx, *s.reloadInterval, cfg)
+	}
+	go c.Run()
+
+	go serveMetrics(*s.metricsAddr, uptimeChecker.Handler(), log)
+	w := watchIngress(client, c)
+	w.Run(stop)
+	return nil
+}
@@ -0,0 +1,354 @@
+// Package blackbox implements an UptimeChecker which, rather than calling
+// a SaaS provider, renders checks as targets for the Prometheus blackbox
+// exporter, either as a file_sd targets file or as Prometheus Operator
+// Probe resources.
+package blackbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+)
+
+// Output formats.
+const (
+	OutputFile  = "file"
+	OutputProbe = "probe"
+)
+
+// Config configures a BlackboxUptimeChecker.
+type Config struct {
+	// Output selects whether checks are rendered to a file_sd targets
+	// file, OutputFile, or as Probe resources, OutputProbe.
+	Output string
+
+	// File is the path of the file_sd targets file.
+	File string
+
+	// Namespace is the namespace of the Probe resources.
+	Namespace string
+
+	// ProberURL is the address of the blackbox exporter used by the
+	// Probe resources, eg. "blackbox-exporter:9115".
+	ProberURL string
+
+	// JobName is the Prometheus job name of the Probe resources.
+	JobName string
+
+	// Modules are the blackbox exporter modules available to checks.
+	Modules []Module
+}
+
+// Module describes a blackbox exporter module. A check uses the first
+// module which matches its requirements exactly, falling back to a
+// module which differs only in not requiring TLS.
+type Module struct {
+	Name string
+
+	// TLS, if set, fails the probe unless it is made over TLS.
+	TLS bool
+
+	// HTTP2, if set, fails the probe unless it is made over HTTP/2.
+	HTTP2 bool
+
+	// StatusCodes are the status codes accepted by the module. If
+	// empty any 2xx status is accepted.
+	StatusCodes []int
+}
+
+// DefaultModule is the module used when none are configured; it is
+// present in the blackbox exporter's example configuration.
+var DefaultModule = Module{Name: "http_2xx"}
+
+// ParseModule parses a module description of the form
+//
+//	name[:feature,...]
+//
+// where each feature is one of "tls", "http2" or "codes=" followed by a
+// list of status codes separated by "+", eg. "http_301:tls,codes=301+302".
+func ParseModule(s string) (Module, error) {
+	parts := strings.SplitN(s, ":", 2)
+	m := Module{Name: parts[0]}
+	if m.Name == "" {
+		return m, fmt.Errorf("invalid module %q: missing name", s)
+	}
+	if len(parts) == 1 {
+		return m, nil
+	}
+	for _, f := range strings.Split(parts[1], ",") {
+		switch {
+		case f == "tls":
+			m.TLS = true
+		case f == "http2":
+			m.HTTP2 = true
+		case strings.HasPrefix(f, "codes="):
+			for _, c := range strings.Split(strings.TrimPrefix(f, "codes="), "+") {
+				code, err := strconv.Atoi(c)
+				if err != nil {
+					return m, fmt.Errorf("invalid module %q: bad status code %q", s, c)
+				}
+				m.StatusCodes = append(m.StatusCodes, code)
+			}
+		default:
+			return m, fmt.Errorf("invalid module %q: unknown feature %q", s, f)
+		}
+	}
+	return m, nil
+}
+
+// matches reports whether m satisfies the requirements of check. If tls
+// is false the TLS requirement of check is ignored.
+func (m *Module) matches(check *monitor.UptimeCheck, tls bool) bool {
+	if tls && m.TLS != check.EnableTLS || !tls && m.TLS {
+		return false
+	}
+	return m.HTTP2 == check.HTTP2 && sameCodes(m.StatusCodes, check.StatusCodes)
+}
+
+func sameCodes(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]int(nil), a...)
+	b = append([]int(nil), b...)
+	sort.Ints(a)
+	sort.Ints(b)
+	return reflect.DeepEqual(a, b)
+}
+
+// output stores the rendered checks.
+type output interface {
+	// load returns the checks previously stored.
+	load(ctx context.Context) ([]*monitor.UptimeCheck, error)
+
+	// apply stores targets, the rendering of every check, after the
+	// check for hostname has changed or been removed.
+	apply(ctx context.Context, targets map[string]*target, hostname string) error
+}
+
+// target is a check rendered for the blackbox exporter.
+type target struct {
+	check  *monitor.UptimeCheck
+	module string
+}
+
+// url is the URL probed by the target.
+func (t *target) url() string {
+	u := url.URL{
+		Scheme: "http",
+		Host:   t.check.Hostname,
+		Path:   t.check.Path,
+	}
+	if t.check.EnableTLS {
+		u.Scheme = "https"
+	}
+	return u.String()
+}
+
+func (t *target) interval() string {
+	minutes := t.check.CheckIntervalInMinutes
+	if minutes < 1 {
+		minutes = 1
+	}
+	return (time.Duration(minutes) * time.Minute).String()
+}
+
+// encode returns the serialised check, which is stored alongside the
+// target so it can be recovered by load.
+func (t *target) encode() string {
+	buf, _ := json.Marshal(t.check)
+	return string(buf)
+}
+
+func decode(s string) (*monitor.UptimeCheck, error) {
+	var check monitor.UptimeCheck
+	if err := json.Unmarshal([]byte(s), &check); err != nil {
+		return nil, err
+	}
+	if check.Hostname == "" {
+		return nil, fmt.Errorf("check has no hostname")
+	}
+	return &check, nil
+}
+
+type BlackboxUptimeChecker struct {
+	config       Config
+	output       output
+	nextID       int
+	uptimeChecks map[string]*monitor.UptimeCheck
+}
+
+// NewBlackboxUptimeChecker returns an UptimeChecker which renders checks
+// as blackbox exporter targets, in the format selected by config.Output.
+// Probe resources are managed with the Kubernetes API described by opts.
+func NewBlackboxUptimeChecker(ctx context.Context, config Config, opts monitor.Options) (monitor.UptimeChecker, error) {
+	var out output
+	switch config.Output {
+	case OutputFile:
+		if config.File == "" {
+			return nil, fmt.Errorf("blackbox: a targets file is required")
+		}
+		out = &fileOutput{path: config.File}
+	case OutputProbe:
+		if opts.KubeConfig == nil {
+			return nil, fmt.Errorf("blackbox: Probe output requires access to a cluster")
+		}
+		probes, err := newProbeClient(opts.KubeConfig, config.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		out = &probeOutput{
+			config:   config,
+			client:   probes,
+			throttle: monitor.NewThrottle(opts.RateLimit),
+		}
+	default:
+		return nil, fmt.Errorf("blackbox: unknown output %q", config.Output)
+	}
+	return newBlackboxUptimeChecker(ctx, config, out)
+}
+
+func newBlackboxUptimeChecker(ctx context.Context, config Config, out output) (*BlackboxUptimeChecker, error) {
+	if len(config.Modules) == 0 {
+		config.Modules = []Module{DefaultModule}
+	}
+	c := &BlackboxUptimeChecker{
+		config:       config,
+		output:       out,
+		nextID:       1,
+		uptimeChecks: make(map[string]*monitor.UptimeCheck),
+	}
+	return c, c.SyncUptimeChecks(ctx)
+}
+
+func (c *BlackboxUptimeChecker) UptimeChecks() map[string]*monitor.UptimeCheck {
+	return c.uptimeChecks
+}
+
+func (c *BlackboxUptimeChecker) SyncUptimeChecks(ctx context.Context) error {
+	checks, err := c.output.load(ctx)
+	if err != nil {
+		return err
+	}
+	for _, check := range checks {
+		c.uptimeChecks[check.Hostname] = check
+		if check.ID >= c.nextID {
+			c.nextID = check.ID + 1
+		}
+	}
+	return nil
+}
+
+func (c *BlackboxUptimeChecker) CreateUptimeCheck(ctx context.Context, check *monitor.UptimeCheck) error {
+	if check.ID == 0 {
+		check.ID = c.nextID
+	}
+	if err := c.put(ctx, "create", check); err != nil {
+		return err
+	}
+	if check.ID >= c.nextID {
+		c.nextID = check.ID + 1
+	}
+	return nil
+}
+
+// UpdateUptimeCheck replaces the target for check.Hostname with check.
+func (c *BlackboxUptimeChecker) UpdateUptimeCheck(ctx context.Context, check *monitor.UptimeCheck) error {
+	existing, exists := c.uptimeChecks[check.Hostname]
+	if !exists {
+		return &monitor.Error{Kind: monitor.NotFound, Op: "update", Err: fmt.Errorf("no check for %q", check.Hostname)}
+	}
+	check.ID = existing.ID
+	return c.put(ctx, "update", check)
+}
+
+func (c *BlackboxUptimeChecker) DeleteUptimeCheck(ctx context.Context, hostName string) error {
+	if _, exists := c.uptimeChecks[hostName]; !exists {
+		return nil
+	}
+	checks := c.copyChecks()
+	delete(checks, hostName)
+	return c.apply(ctx, "delete", checks, hostName)
+}
+
+func (c *BlackboxUptimeChecker) PauseUptimeCheck(ctx context.Context, hostName string) error {
+	return c.setPaused(ctx, "pause", hostName, true)
+}
+
+func (c *BlackboxUptimeChecker) ResumeUptimeCheck(ctx context.Context, hostName string) error {
+	return c.setPaused(ctx, "resume", hostName, false)
+}
+
+func (c *BlackboxUptimeChecker) setPaused(ctx context.Context, op, hostName string, paused bool) error {
+	existing, exists := c.uptimeChecks[hostName]
+	if !exists {
+		return &monitor.Error{Kind: monitor.NotFound, Op: op, Err: fmt.Errorf("no check for %q", hostName)}
+	}
+	if existing.Paused == paused {
+		return nil
+	}
+	check := *existing
+	check.Paused = paused
+	return c.put(ctx, op, &check)
+}
+
+// put stores check, replacing any existing check for its hostname.
+func (c *BlackboxUptimeChecker) put(ctx context.Context, op string, check *monitor.UptimeCheck) error {
+	if _, err := c.module(check); err != nil {
+		return &monitor.Error{Kind: monitor.ValidationFailed, Op: op, Err: err}
+	}
+	checks := c.copyChecks()
+	checks[check.Hostname] = check
+	return c.apply(ctx, op, checks, check.Hostname)
+}
+
+// apply renders checks and, if they are stored successfully, adopts them
+// as the current set of checks.
+func (c *BlackboxUptimeChecker) apply(ctx context.Context, op string, checks map[string]*monitor.UptimeCheck, hostname string) error {
+	if err := ctx.Err(); err != nil {
+		return monitor.Wrap(ctx, op, err)
+	}
+	targets := make(map[string]*target, len(checks))
+	for host, check := range checks {
+		module, err := c.module(check)
+		if err != nil {
+			// only possible for checks loaded from a previous
+			// configuration; fall back to the default.
+			module = c.config.Modules[0].Name
+		}
+		targets[host] = &target{check: check, module: module}
+	}
+	if err := c.output.apply(ctx, targets, hostname); err != nil {
+		return monitor.Wrap(ctx, op, err)
+	}
+	c.uptimeChecks = checks
+	return nil
+}
+
+func (c *BlackboxUptimeChecker) copyChecks() map[string]*monitor.UptimeCheck {
+	checks := make(map[string]*monitor.UptimeCheck, len(c.uptimeChecks))
+	for host, check := range c.uptimeChecks {
+		checks[host] = check
+	}
+	return checks
+}
+
+// module returns the name of the module which probes check.
+func (c *BlackboxUptimeChecker) module(check *monitor.UptimeCheck) (string, error) {
+	for _, tls := range []bool{true, false} {
+		for i := range c.config.Modules {
+			if m := &c.config.Modules[i]; m.matches(check, tls) {
+				return m.Name, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no blackbox module for %s (tls: %v, http2: %v, status codes: %v)", check.Hostname, check.EnableTLS, check.HTTP2, check.StatusCodes)
+}
@@ -0,0 +1,296 @@
+package blackbox
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "blackbox")
+	check(t, err)
+	return dir
+}
+
+func readTargets(t *testing.T, path string) []targetGroup {
+	t.Helper()
+	buf, err := ioutil.ReadFile(path)
+	check(t, err)
+	var groups []targetGroup
+	check(t, json.Unmarshal(buf, &groups))
+	return groups
+}
+
+var testModules = []Module{
+	{Name: "http_2xx"},
+	{Name: "https_2xx", TLS: true},
+	{Name: "https_h2", TLS: true, HTTP2: true},
+	{Name: "http_redirect", StatusCodes: []int{301, 302}},
+}
+
+func TestFileOutput(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "targets.json")
+
+	ctx := context.Background()
+	c, err := newBlackboxUptimeChecker(ctx, Config{Modules: testModules}, &fileOutput{path: path})
+	check(t, err)
+
+	check(t, c.CreateUptimeCheck(ctx, &monitor.UptimeCheck{
+		Hostname:               "b.example.com",
+		Name:                   "ns/b (b.example.com:443)",
+		EnableTLS:              true,
+		CheckIntervalInMinutes: 5,
+		Path:                   "/healthz",
+	}))
+	check(t, c.CreateUptimeCheck(ctx, &monitor.UptimeCheck{
+		Hostname:               "a.example.com",
+		Name:                   "ns/a (a.example.com:80)",
+		CheckIntervalInMinutes: 1,
+	}))
+
+	groups := readTargets(t, path)
+	assert.Len(t, groups, 2)
+	assert.Equal(t, []string{"http://a.example.com"}, groups[0].Targets)
+	assert.Equal(t, "http_2xx", groups[0].Labels["__param_module"])
+	assert.Equal(t, "1m0s", groups[0].Labels["__scrape_interval__"])
+	assert.Equal(t, []string{"https://b.example.com/healthz"}, groups[1].Targets)
+	assert.Equal(t, "https_2xx", groups[1].Labels["__param_module"])
+	assert.Equal(t, "ns/b (b.example.com:443)", groups[1].Labels["cruise_name"])
+
+	check(t, c.PauseUptimeCheck(ctx, "b.example.com"))
+	assert.Empty(t, readTargets(t, path)[1].Targets)
+
+	// a new checker recovers the checks from the file.
+	n, err := newBlackboxUptimeChecker(ctx, Config{Modules: testModules}, &fileOutput{path: path})
+	check(t, err)
+	assert.Len(t, n.UptimeChecks(), 2)
+	b := n.UptimeChecks()["b.example.com"]
+	assert.True(t, b.Paused)
+	assert.Equal(t, "/healthz", b.Path)
+	assert.Equal(t, 5, b.CheckIntervalInMinutes)
+	assert.Equal(t, 3, n.nextID)
+
+	check(t, n.DeleteUptimeCheck(ctx, "a.example.com"))
+	groups = readTargets(t, path)
+	assert.Len(t, groups, 1)
+	assert.Equal(t, "ns/b (b.example.com:443)", groups[0].Labels["cruise_name"])
+}
+
+func TestModuleSelection(t *testing.T) {
+	c := &BlackboxUptimeChecker{config: Config{Modules: testModules}}
+	tests := map[string]struct {
+		check monitor.UptimeCheck
+		want  string
+	}{
+		"plain":          {check: monitor.UptimeCheck{}, want: "http_2xx"},
+		"tls":            {check: monitor.UptimeCheck{EnableTLS: true}, want: "https_2xx"},
+		"http2":          {check: monitor.UptimeCheck{EnableTLS: true, HTTP2: true}, want: "https_h2"},
+		"redirect":       {check: monitor.UptimeCheck{StatusCodes: []int{302, 301}}, want: "http_redirect"},
+		"tls redirect":   {check: monitor.UptimeCheck{EnableTLS: true, StatusCodes: []int{301, 302}}, want: "http_redirect"},
+		"no such module": {check: monitor.UptimeCheck{HTTP2: true}},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := c.module(&tc.check)
+			if tc.want == "" {
+				assert.Error(t, err)
+				return
+			}
+			check(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+
+	err := c.CreateUptimeCheck(context.Background(), &monitor.UptimeCheck{Hostname: "example.com", HTTP2: true})
+	assert.Equal(t, monitor.ValidationFailed, monitor.KindOf(err))
+}
+
+func TestParseModule(t *testing.T) {
+	m, err := ParseModule("http_2xx")
+	check(t, err)
+	assert.Equal(t, Module{Name: "http_2xx"}, m)
+
+	m, err = ParseModule("https_redirect:tls,http2,codes=301+302")
+	check(t, err)
+	assert.Equal(t, Module{Name: "https_redirect", TLS: true, HTTP2: true, StatusCodes: []int{301, 302}}, m)
+
+	for _, s := range []string{"", ":tls", "m:bogus", "m:codes=abc"} {
+		_, err := ParseModule(s)
+		assert.Error(t, err, s)
+	}
+}
+
+// fakeProbes is an in memory dynamic.ResourceInterface for Probes.
+type fakeProbes struct {
+	dynamic.ResourceInterface // unused methods panic
+	probes                    map[string]*unstructured.Unstructured
+	version                   int
+	err                       error
+}
+
+func newFakeProbes() *fakeProbes {
+	return &fakeProbes{probes: make(map[string]*unstructured.Unstructured)}
+}
+
+var probeGR = schema.GroupResource{Group: "monitoring.coreos.com", Resource: "probes"}
+
+func (f *fakeProbes) List(opts metav1.ListOptions) (runtime.Object, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	list := &unstructured.UnstructuredList{}
+	for _, p := range f.probes {
+		if p.GetLabels()[managedByLabel] == "cruise" {
+			list.Items = append(list.Items, *p.DeepCopy())
+		}
+	}
+	return list, nil
+}
+
+func (f *fakeProbes) Get(name string, opts metav1.GetOptions) (*unstructured.Unstructured, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	p, ok := f.probes[name]
+	if !ok {
+		return nil, apierrors.NewNotFound(probeGR, name)
+	}
+	return p.DeepCopy(), nil
+}
+
+func (f *fakeProbes) Create(obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	if _, ok := f.probes[obj.GetName()]; ok {
+		return nil, apierrors.NewAlreadyExists(probeGR, obj.GetName())
+	}
+	f.version++
+	obj.SetResourceVersion(strconv.Itoa(f.version))
+	f.probes[obj.GetName()] = obj.DeepCopy()
+	return obj, nil
+}
+
+func (f *fakeProbes) Update(obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	existing, ok := f.probes[obj.GetName()]
+	if !ok {
+		return nil, apierrors.NewNotFound(probeGR, obj.GetName())
+	}
+	if existing.GetResourceVersion() != obj.GetResourceVersion() {
+		return nil, apierrors.NewConflict(probeGR, obj.GetName(), nil)
+	}
+	f.version++
+	obj.SetResourceVersion(strconv.Itoa(f.version))
+	f.probes[obj.GetName()] = obj.DeepCopy()
+	return obj, nil
+}
+
+func (f *fakeProbes) Delete(name string, opts *metav1.DeleteOptions) error {
+	if _, ok := f.probes[name]; !ok {
+		return apierrors.NewNotFound(probeGR, name)
+	}
+	delete(f.probes, name)
+	return nil
+}
+
+func newProbeChecker(t *testing.T, f *fakeProbes) *BlackboxUptimeChecker {
+	t.Helper()
+	out := &probeOutput{
+		config: Config{
+			Namespace: "monitoring",
+			ProberURL: "blackbox:9115",
+		},
+		client:   f,
+		throttle: monitor.NewThrottle(monitor.RateLimit{}),
+	}
+	c, err := newBlackboxUptimeChecker(context.Background(), Config{Modules: testModules}, out)
+	check(t, err)
+	return c
+}
+
+func TestProbeOutput(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeProbes()
+	c := newProbeChecker(t, f)
+
+	check(t, c.CreateUptimeCheck(ctx, &monitor.UptimeCheck{
+		Hostname:               "example.com",
+		Name:                   "ns/example (example.com:443)",
+		EnableTLS:              true,
+		CheckIntervalInMinutes: 2,
+	}))
+
+	p := f.probes["cruise-example.com"]
+	if !assert.NotNil(t, p) {
+		return
+	}
+	assert.Equal(t, "monitoring", p.GetNamespace())
+	assert.Equal(t, "Probe", p.GetKind())
+	assert.Equal(t, "monitoring.coreos.com/v1", p.GetAPIVersion())
+	module, _, _ := unstructured.NestedString(p.Object, "spec", "module")
+	assert.Equal(t, "https_2xx", module)
+	interval, _, _ := unstructured.NestedString(p.Object, "spec", "interval")
+	assert.Equal(t, "2m0s", interval)
+	prober, _, _ := unstructured.NestedString(p.Object, "spec", "prober", "url")
+	assert.Equal(t, "blackbox:9115", prober)
+	static, _, _ := unstructured.NestedSlice(p.Object, "spec", "targets", "staticConfig", "static")
+	assert.Equal(t, []interface{}{"https://example.com"}, static)
+
+	check(t, c.PauseUptimeCheck(ctx, "example.com"))
+	static, _, _ = unstructured.NestedSlice(f.probes["cruise-example.com"].Object, "spec", "targets", "staticConfig", "static")
+	assert.Empty(t, static)
+
+	// Probes not managed by cruise are ignored.
+	other := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	other.SetName("other")
+	f.probes["other"] = other
+
+	n := newProbeChecker(t, f)
+	assert.Len(t, n.UptimeChecks(), 1)
+	assert.True(t, n.UptimeChecks()["example.com"].Paused)
+
+	check(t, n.DeleteUptimeCheck(ctx, "example.com"))
+	assert.NotContains(t, f.probes, "cruise-example.com")
+	assert.Contains(t, f.probes, "other")
+	assert.Empty(t, n.UptimeChecks())
+}
+
+func TestProbeErrors(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeProbes()
+	c := newProbeChecker(t, f)
+
+	f.err = apierrors.NewForbidden(probeGR, "cruise-example.com", nil)
+	err := c.CreateUptimeCheck(ctx, &monitor.UptimeCheck{Hostname: "example.com", Name: "example"})
+	assert.Equal(t, monitor.AuthFailed, monitor.KindOf(err))
+	assert.Empty(t, c.UptimeChecks())
+
+	f.err = apierrors.NewServiceUnavailable("unavailable")
+	err = c.CreateUptimeCheck(ctx, &monitor.UptimeCheck{Hostname: "example.com", Name: "example"})
+	assert.True(t, monitor.IsRetryable(err))
+}
+
+func TestProbeName(t *testing.T) {
+	assert.Equal(t, "cruise-example.com", probeName("Example.com"))
+	assert.Equal(t, "cruise-wildcard.example.com", probeName("*.example.com"))
+}
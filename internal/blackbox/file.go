@@ -0,0 +1,107 @@
+package blackbox
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+)
+
+// checkLabel holds the serialised check of a target group. Labels
+// beginning with "__" are discarded by Prometheus after relabelling, so
+// it does not appear in the scraped series.
+const checkLabel = "__cruise_check"
+
+// targetGroup is an entry in a Prometheus file_sd targets file.
+type targetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// fileOutput writes targets to a file_sd targets file. Paused checks are
+// written as groups without targets so they survive a restart.
+type fileOutput struct {
+	path string
+}
+
+func (f *fileOutput) load(ctx context.Context) ([]*monitor.UptimeCheck, error) {
+	buf, err := ioutil.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var groups []targetGroup
+	if err := json.Unmarshal(buf, &groups); err != nil {
+		return nil, err
+	}
+	var checks []*monitor.UptimeCheck
+	for _, g := range groups {
+		check, err := decode(g.Labels[checkLabel])
+		if err != nil {
+			// not written by cruise.
+			continue
+		}
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+func (f *fileOutput) apply(ctx context.Context, targets map[string]*target, hostname string) error {
+	var hosts []string
+	for host := range targets {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	groups := []targetGroup{}
+	for _, host := range hosts {
+		t := targets[host]
+		g := targetGroup{
+			Targets: []string{},
+			Labels: map[string]string{
+				"__param_module":      t.module,
+				"__scrape_interval__": t.interval(),
+				"cruise_name":         t.check.Name,
+				checkLabel:            t.encode(),
+			},
+		}
+		if !t.check.Paused {
+			g.Targets = append(g.Targets, t.url())
+		}
+		groups = append(groups, g)
+	}
+	buf, err := json.MarshalIndent(groups, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(f.path, buf)
+}
+
+// writeFile atomically replaces the contents of path with buf, so that
+// Prometheus never reads a partially written file.
+func writeFile(path string, buf []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
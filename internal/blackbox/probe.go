@@ -0,0 +1,154 @@
+package blackbox
+
+import (
+	"context"
+	"strings"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// managedByLabel marks the Probe resources managed by cruise.
+	managedByLabel = "app.kubernetes.io/managed-by"
+
+	// checkAnnotation holds the serialised check of a Probe.
+	checkAnnotation = "cruise.heptio.com/check"
+)
+
+var probeGroupVersion = schema.GroupVersion{Group: "monitoring.coreos.com", Version: "v1"}
+
+var probeResource = &metav1.APIResource{
+	Name:       "probes",
+	Namespaced: true,
+	Kind:       "Probe",
+}
+
+// newProbeClient returns a client for the Probe resources in namespace.
+func newProbeClient(config *rest.Config, namespace string) (dynamic.ResourceInterface, error) {
+	conf := *config
+	conf.GroupVersion = &probeGroupVersion
+	conf.APIPath = "/apis"
+	client, err := dynamic.NewClient(&conf)
+	if err != nil {
+		return nil, err
+	}
+	return client.Resource(probeResource, namespace), nil
+}
+
+// probeOutput renders each check as a Prometheus Operator Probe. Paused
+// checks are rendered as Probes without targets.
+type probeOutput struct {
+	config   Config
+	client   dynamic.ResourceInterface
+	throttle *monitor.Throttle
+}
+
+func (p *probeOutput) load(ctx context.Context) ([]*monitor.UptimeCheck, error) {
+	if err := p.throttle.Wait(ctx, "list"); err != nil {
+		return nil, err
+	}
+	obj, err := p.client.List(metav1.ListOptions{LabelSelector: managedByLabel + "=cruise"})
+	if err != nil {
+		return nil, monitor.WrapKube(ctx, "list", err)
+	}
+	list, ok := obj.(*unstructured.UnstructuredList)
+	if !ok {
+		return nil, nil
+	}
+	var checks []*monitor.UptimeCheck
+	for _, item := range list.Items {
+		check, err := decode(item.GetAnnotations()[checkAnnotation])
+		if err != nil {
+			continue
+		}
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+func (p *probeOutput) apply(ctx context.Context, targets map[string]*target, hostname string) error {
+	name := probeName(hostname)
+	t, ok := targets[hostname]
+	if !ok {
+		if err := p.throttle.Wait(ctx, "delete"); err != nil {
+			return err
+		}
+		err := p.client.Delete(name, &metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return monitor.WrapKube(ctx, "delete", err)
+		}
+		return nil
+	}
+
+	probe := p.render(name, t)
+	if err := p.throttle.Wait(ctx, "get"); err != nil {
+		return err
+	}
+	existing, err := p.client.Get(name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		if err := p.throttle.Wait(ctx, "create"); err != nil {
+			return err
+		}
+		_, err = p.client.Create(probe)
+		return monitor.WrapKube(ctx, "create", err)
+	case err != nil:
+		return monitor.WrapKube(ctx, "get", err)
+	}
+	probe.SetResourceVersion(existing.GetResourceVersion())
+	if err := p.throttle.Wait(ctx, "update"); err != nil {
+		return err
+	}
+	_, err = p.client.Update(probe)
+	return monitor.WrapKube(ctx, "update", err)
+}
+
+// render returns the Probe named name for t.
+func (p *probeOutput) render(name string, t *target) *unstructured.Unstructured {
+	static := []interface{}{}
+	if !t.check.Paused {
+		static = append(static, t.url())
+	}
+	jobName := p.config.JobName
+	if jobName == "" {
+		jobName = "cruise"
+	}
+	probe := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"spec": map[string]interface{}{
+				"jobName":  jobName,
+				"interval": t.interval(),
+				"module":   t.module,
+				"prober": map[string]interface{}{
+					"url": p.config.ProberURL,
+				},
+				"targets": map[string]interface{}{
+					"staticConfig": map[string]interface{}{
+						"static": static,
+						"labels": map[string]interface{}{
+							"cruise_name": t.check.Name,
+						},
+					},
+				},
+			},
+		},
+	}
+	probe.SetAPIVersion(probeGroupVersion.String())
+	probe.SetKind(probeResource.Kind)
+	probe.SetName(name)
+	probe.SetNamespace(p.config.Namespace)
+	probe.SetLabels(map[string]string{managedByLabel: "cruise"})
+	probe.SetAnnotations(map[string]string{checkAnnotation: t.encode()})
+	return probe
+}
+
+// probeName returns the name of the Probe for hostname.
+func probeName(hostname string) string {
+	return "cruise-" + strings.ToLower(strings.Replace(hostname, "*", "wildcard", -1))
+}
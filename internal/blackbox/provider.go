@@ -0,0 +1,38 @@
+package blackbox
+
+import (
+	"context"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+)
+
+func init() {
+	monitor.Register("blackbox", func() monitor.Provider { return new(provider) })
+}
+
+// provider configures a BlackboxUptimeChecker from command line flags.
+type provider struct {
+	config  Config
+	modules []string
+}
+
+func (p *provider) Flags(fs monitor.FlagSet) {
+	fs.Flag("blackbox-output", "render blackbox exporter targets to a file_sd targets file or as Prometheus Operator Probes").Default(OutputFile).EnumVar(&p.config.Output, OutputFile, OutputProbe)
+	fs.Flag("blackbox-file", "path of the file_sd targets file").StringVar(&p.config.File)
+	fs.Flag("blackbox-probe-namespace", "namespace of the Probe resources").Default("heptio-cruise").StringVar(&p.config.Namespace)
+	fs.Flag("blackbox-prober-url", "address of the blackbox exporter used by Probes").Default("blackbox-exporter:9115").StringVar(&p.config.ProberURL)
+	fs.Flag("blackbox-job-name", "Prometheus job name of the Probes").Default("cruise").StringVar(&p.config.JobName)
+	fs.Flag("blackbox-module", "blackbox exporter module as name[:tls,http2,codes=200+301], may be repeated").StringsVar(&p.modules)
+}
+
+func (p *provider) New(ctx context.Context, opts monitor.Options) (monitor.UptimeChecker, error) {
+	config := p.config
+	for _, s := range p.modules {
+		m, err := ParseModule(s)
+		if err != nil {
+			return nil, err
+		}
+		config.Modules = append(config.Modules, m)
+	}
+	return NewBlackboxUptimeChecker(ctx, config, opts)
+}
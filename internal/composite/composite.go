@@ -0,0 +1,559 @@
+// Package composite implements an UptimeChecker which fans out to the
+// UptimeCheckers of several providers, so that the same hosts may be
+// monitored by more than one of them.
+package composite
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+)
+
+// Member is one of the providers of a CompositeUptimeChecker.
+type Member struct {
+	Name    string
+	Checker monitor.UptimeChecker
+}
+
+// CompositeUptimeChecker manages the checks of its members, each of
+// which runs the checks selected for it by their Providers field.
+//
+// Each operation is performed by every member concurrently, and is
+// idempotent: a member whose check is already as requested is left
+// alone. When some members fail, the others' changes stand and the
+// error returned describes those which failed; if it is retried only
+// they are affected. A host is only reported by UptimeChecks once its
+// check is as requested at every member, so that callers try again.
+//
+// Like the UptimeCheckers it wraps, it is not safe for concurrent use,
+// except for Statuses and Handler.
+type CompositeUptimeChecker struct {
+	members []Member
+
+	// desired records the last definition of each host's check
+	// requested of the composite.
+	desired map[string]*monitor.UptimeCheck
+
+	// checks is the view of the members' checks reported by
+	// UptimeChecks, recomputed after each operation.
+	checks map[string]*monitor.UptimeCheck
+
+	// now returns the time at which errors occur.
+	now func() time.Time
+
+	// mu guards the status of each member, and the members as they are
+	// replaced.
+	mu     sync.Mutex
+	status map[string]*Status
+}
+
+// Status reports the health of one of the members of a
+// CompositeUptimeChecker.
+type Status struct {
+	Provider string `json:"provider"`
+
+	// Checks is the number of checks the provider has.
+	Checks int `json:"checks"`
+
+	// Failing maps the hostnames whose last operation failed at the
+	// provider to its error.
+	Failing map[string]string `json:"failing,omitempty"`
+
+	// LastError is the most recent error returned by the provider,
+	// at LastErrorTime.
+	LastError     string    `json:"lastError,omitempty"`
+	LastErrorTime time.Time `json:"lastErrorTime,omitempty"`
+}
+
+// NewCompositeUptimeChecker returns an UptimeChecker which fans out to
+// members. Their names must be unique.
+func NewCompositeUptimeChecker(members ...Member) (*CompositeUptimeChecker, error) {
+	if len(members) == 0 {
+		return nil, errors.New("composite: no providers")
+	}
+	c := &CompositeUptimeChecker{
+		members: members,
+		desired: make(map[string]*monitor.UptimeCheck),
+		now:     time.Now,
+		status:  make(map[string]*Status),
+	}
+	for _, m := range members {
+		if _, dup := c.status[m.Name]; dup {
+			return nil, fmt.Errorf("composite: provider %q given twice", m.Name)
+		}
+		c.status[m.Name] = &Status{Provider: m.Name, Failing: make(map[string]string)}
+	}
+	c.refresh()
+	return c, nil
+}
+
+// SetMembers replaces the members of c, eg. when their configuration
+// changes. The status of the members which remain is kept, and the
+// checks requested of c are left to be reconciled with the new members.
+// Their names must be unique. The checkers replaced which are io.Closers
+// are closed; errors closing them are ignored, as they are no longer used.
+func (c *CompositeUptimeChecker) SetMembers(members ...Member) error {
+	if len(members) == 0 {
+		return errors.New("composite: no providers")
+	}
+	status := make(map[string]*Status)
+	for _, m := range members {
+		if _, dup := status[m.Name]; dup {
+			return fmt.Errorf("composite: provider %q given twice", m.Name)
+		}
+		status[m.Name] = &Status{Provider: m.Name, Failing: make(map[string]string)}
+	}
+
+	c.mu.Lock()
+	for name := range status {
+		if s, ok := c.status[name]; ok {
+			status[name] = s
+		}
+	}
+	replaced := c.members
+	c.members = members
+	c.status = status
+	c.mu.Unlock()
+
+	Close(replaced, members)
+	c.refresh()
+	return nil
+}
+
+// Close closes the checkers of members which are io.Closers, except
+// those also members of keep.
+func Close(members, keep []Member) {
+	for _, m := range members {
+		if contains(keep, m.Checker) {
+			continue
+		}
+		if closer, ok := m.Checker.(io.Closer); ok {
+			closer.Close()
+		}
+	}
+}
+
+func contains(members []Member, checker monitor.UptimeChecker) bool {
+	for _, m := range members {
+		if m.Checker == checker {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *CompositeUptimeChecker) UptimeChecks() map[string]*monitor.UptimeCheck {
+	return c.checks
+}
+
+// Adopts returns false if any member cannot adopt checks which cruise did
+// not create.
+func (c *CompositeUptimeChecker) Adopts() bool {
+	for _, m := range c.members {
+		if !monitor.Adopts(m.Checker) {
+			return false
+		}
+	}
+	return true
+}
+
+// Defined returns false if any member's check for hostName is only
+// described in part by its UptimeCheck.
+func (c *CompositeUptimeChecker) Defined(hostName string) bool {
+	for _, m := range c.members {
+		if d, ok := m.Checker.(monitor.Definer); ok && !d.Defined(hostName) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *CompositeUptimeChecker) SyncUptimeChecks(ctx context.Context) error {
+	errs := c.fanOut(func(m Member) error {
+		return m.Checker.SyncUptimeChecks(ctx)
+	})
+	c.record("", errs)
+	c.refresh()
+	return c.combine("sync", errs, nil)
+}
+
+func (c *CompositeUptimeChecker) CreateUptimeCheck(ctx context.Context, check *monitor.UptimeCheck) error {
+	return c.apply(ctx, "create", check)
+}
+
+func (c *CompositeUptimeChecker) UpdateUptimeCheck(ctx context.Context, check *monitor.UptimeCheck) error {
+	return c.apply(ctx, "update", check)
+}
+
+// apply brings the check for check.Hostname at each member in line with
+// check: members selected by check.Providers create, update, pause or
+// resume their check as required, the rest delete theirs.
+func (c *CompositeUptimeChecker) apply(ctx context.Context, op string, check *monitor.UptimeCheck) error {
+	selected, unknown := c.selected(check)
+	errs := c.fanOut(func(m Member) error {
+		existing, exists := m.Checker.UptimeChecks()[check.Hostname]
+		if !selected[m.Name] {
+			if !exists {
+				return nil
+			}
+			return ignoreNotFound(m.Checker.DeleteUptimeCheck(ctx, check.Hostname))
+		}
+		mc := memberCheck(check)
+		if !exists {
+			return m.Checker.CreateUptimeCheck(ctx, mc)
+		}
+		if !monitor.SameCheck(existing, monitor.Normalize(m.Checker, mc)) {
+			if u, ok := m.Checker.(monitor.Updater); ok {
+				return u.UpdateUptimeCheck(ctx, mc)
+			}
+			if err := ignoreNotFound(m.Checker.DeleteUptimeCheck(ctx, check.Hostname)); err != nil {
+				return err
+			}
+			return m.Checker.CreateUptimeCheck(ctx, mc)
+		}
+		return setPaused(ctx, m.Checker, existing, check.Paused)
+	})
+
+	desired := *check
+	c.desired[check.Hostname] = &desired
+	c.record(check.Hostname, errs)
+	c.refresh()
+
+	var invalid error
+	if len(unknown) > 0 {
+		invalid = &monitor.Error{
+			Kind: monitor.ValidationFailed,
+			Op:   op,
+			Err:  fmt.Errorf("unknown providers %s for %s", strings.Join(unknown, ", "), check.Hostname),
+		}
+	}
+	return c.combine(op, errs, invalid)
+}
+
+func (c *CompositeUptimeChecker) DeleteUptimeCheck(ctx context.Context, hostName string) error {
+	errs := c.fanOut(func(m Member) error {
+		if _, exists := m.Checker.UptimeChecks()[hostName]; !exists {
+			return nil
+		}
+		return ignoreNotFound(m.Checker.DeleteUptimeCheck(ctx, hostName))
+	})
+	delete(c.desired, hostName)
+	c.record(hostName, errs)
+	c.refresh()
+	return c.combine("delete", errs, nil)
+}
+
+func (c *CompositeUptimeChecker) PauseUptimeCheck(ctx context.Context, hostName string) error {
+	return c.setPaused(ctx, "pause", hostName, true)
+}
+
+func (c *CompositeUptimeChecker) ResumeUptimeCheck(ctx context.Context, hostName string) error {
+	return c.setPaused(ctx, "resume", hostName, false)
+}
+
+// setPaused pauses or resumes the check for hostName at every member
+// which has one.
+func (c *CompositeUptimeChecker) setPaused(ctx context.Context, op, hostName string, paused bool) error {
+	found := false
+	for _, m := range c.members {
+		if _, exists := m.Checker.UptimeChecks()[hostName]; exists {
+			found = true
+		}
+	}
+	if !found {
+		return &monitor.Error{Kind: monitor.NotFound, Op: op, Err: fmt.Errorf("no check for %q", hostName)}
+	}
+
+	errs := c.fanOut(func(m Member) error {
+		existing, exists := m.Checker.UptimeChecks()[hostName]
+		if !exists {
+			return nil
+		}
+		return setPaused(ctx, m.Checker, existing, paused)
+	})
+	if d, ok := c.desired[hostName]; ok {
+		d.Paused = paused
+	}
+	c.record(hostName, errs)
+	c.refresh()
+	return c.combine(op, errs, nil)
+}
+
+func setPaused(ctx context.Context, checker monitor.UptimeChecker, existing *monitor.UptimeCheck, paused bool) error {
+	if existing.Paused == paused {
+		return nil
+	}
+	if paused {
+		return ignoreNotFound(checker.PauseUptimeCheck(ctx, existing.Hostname))
+	}
+	return ignoreNotFound(checker.ResumeUptimeCheck(ctx, existing.Hostname))
+}
+
+func ignoreNotFound(err error) error {
+	if monitor.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// fanOut calls fn for each member concurrently, returning their errors
+// in the order of c.members.
+func (c *CompositeUptimeChecker) fanOut(fn func(Member) error) []error {
+	errs := make([]error, len(c.members))
+	var wg sync.WaitGroup
+	for i, m := range c.members {
+		wg.Add(1)
+		go func(i int, m Member) {
+			defer wg.Done()
+			errs[i] = fn(m)
+		}(i, m)
+	}
+	wg.Wait()
+	return errs
+}
+
+// selected returns the names of the members selected by
+// check.Providers, and any names it gives which are not members.
+func (c *CompositeUptimeChecker) selected(check *monitor.UptimeCheck) (map[string]bool, []string) {
+	selected := make(map[string]bool)
+	if len(check.Providers) == 0 {
+		for _, m := range c.members {
+			selected[m.Name] = true
+		}
+		return selected, nil
+	}
+	var unknown []string
+	for _, name := range check.Providers {
+		if _, ok := c.status[name]; !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		selected[name] = true
+	}
+	return selected, unknown
+}
+
+// memberCheck returns the copy of check given to a member. Each member
+// has its own copy, which it may modify, eg. to set its ID.
+func memberCheck(check *monitor.UptimeCheck) *monitor.UptimeCheck {
+	mc := *check
+	mc.ID = 0
+	mc.Providers = nil
+	return &mc
+}
+
+// refresh recomputes the view of the members' checks. A host for which
+// a definition has been requested is reported, as requested, only if
+// every member's check is as requested. Otherwise, eg. at startup, a
+// host is reported if the members which have a check for it agree on
+// its definition, selecting those members.
+func (c *CompositeUptimeChecker) refresh() {
+	hosts := make(map[string]bool)
+	for _, m := range c.members {
+		for host := range m.Checker.UptimeChecks() {
+			hosts[host] = true
+		}
+	}
+
+	checks := make(map[string]*monitor.UptimeCheck)
+	for host := range hosts {
+		if d, ok := c.desired[host]; ok {
+			if c.inSync(d) {
+				view := *d
+				checks[host] = &view
+			}
+			continue
+		}
+
+		var base *monitor.UptimeCheck
+		var holders []string
+		agree := true
+		for _, m := range c.members {
+			existing, exists := m.Checker.UptimeChecks()[host]
+			if !exists {
+				continue
+			}
+			holders = append(holders, m.Name)
+			if base == nil {
+				base = existing
+				continue
+			}
+			if !monitor.SameCheck(base, existing) || base.Paused != existing.Paused {
+				agree = false
+			}
+		}
+		if !agree {
+			continue
+		}
+		view := *base
+		view.ID = 0
+		view.Providers = nil
+		if len(holders) < len(c.members) {
+			view.Providers = holders
+		}
+		checks[host] = &view
+	}
+	c.checks = checks
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, m := range c.members {
+		n := len(m.Checker.UptimeChecks())
+		c.status[m.Name].Checks = n
+		providerChecks.WithLabelValues(m.Name).Set(float64(n))
+	}
+}
+
+// inSync reports whether each member's check for d.Hostname is as d
+// requests, as the member runs it.
+func (c *CompositeUptimeChecker) inSync(d *monitor.UptimeCheck) bool {
+	selected, _ := c.selected(d)
+	want := memberCheck(d)
+	for _, m := range c.members {
+		existing, exists := m.Checker.UptimeChecks()[d.Hostname]
+		if !selected[m.Name] {
+			if exists {
+				return false
+			}
+			continue
+		}
+		if !exists || !monitor.SameCheck(existing, monitor.Normalize(m.Checker, want)) || existing.Paused != d.Paused {
+			return false
+		}
+	}
+	return true
+}
+
+// record updates the status of each member with its error, errs[i] for
+// c.members[i], from an operation on the check for host, or from a sync
+// if host is empty.
+func (c *CompositeUptimeChecker) record(host string, errs []error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	for i, m := range c.members {
+		s := c.status[m.Name]
+		err := errs[i]
+		if err == nil {
+			if host != "" {
+				delete(s.Failing, host)
+			}
+		} else {
+			if host != "" {
+				s.Failing[host] = err.Error()
+			}
+			s.LastError = err.Error()
+			s.LastErrorTime = now
+			providerErrors.WithLabelValues(m.Name, monitor.KindOf(err).String()).Inc()
+		}
+		failingChecks.WithLabelValues(m.Name).Set(float64(len(s.Failing)))
+	}
+}
+
+// combine returns an error describing errs, the errors of each member
+// from op, and invalid, if any, or nil if there are none. The error is
+// retryable if any of errs are, so that op is retried for the members
+// which may yet succeed; it is RateLimited only if every retryable
+// error is, and then may be retried when the first member's rate limit
+// allows.
+func (c *CompositeUptimeChecker) combine(op string, errs []error, invalid error) error {
+	var (
+		msgs       []string
+		kind       = monitor.KindOf(invalid)
+		retryable  bool
+		limited    = true
+		retryAfter time.Duration
+	)
+	if invalid != nil {
+		msgs = append(msgs, invalid.Error())
+	}
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		msgs = append(msgs, c.members[i].Name+": "+err.Error())
+		if len(msgs) == 1 {
+			kind = monitor.KindOf(err)
+		}
+		if !monitor.IsRetryable(err) {
+			continue
+		}
+		if monitor.KindOf(err) != monitor.RateLimited {
+			limited = false
+		}
+		if d := monitor.RetryAfter(err); !retryable || d < retryAfter {
+			retryAfter = d
+		}
+		retryable = true
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	e := &monitor.Error{Kind: kind, Op: op, Err: errors.New(strings.Join(msgs, "; "))}
+	if retryable {
+		e.Kind = monitor.Transient
+		if limited {
+			e.Kind = monitor.RateLimited
+			e.RetryAfter = retryAfter
+		}
+	}
+	return e
+}
+
+// Statuses returns the status of each member.
+func (c *CompositeUptimeChecker) Statuses() []Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var statuses []Status
+	for _, m := range c.members {
+		s := *c.status[m.Name]
+		s.Failing = make(map[string]string)
+		for host, err := range c.status[m.Name].Failing {
+			s.Failing[host] = err
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses
+}
+
+// pager is implemented by members which serve a status page of their
+// own, such as the prober.
+type pager interface {
+	Handler() http.Handler
+}
+
+// Handler returns an http.Handler which serves the Statuses as JSON at
+// its root, and the page of each member which serves one at /<name>. The
+// pages are those of the current members.
+func (c *CompositeUptimeChecker) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.Trim(r.URL.Path, "/")
+		if name == "" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(c.Statuses())
+			return
+		}
+		c.mu.Lock()
+		var page http.Handler
+		for _, m := range c.members {
+			if p, ok := m.Checker.(pager); ok && m.Name == name {
+				page = p.Handler()
+				break
+			}
+		}
+		c.mu.Unlock()
+		if page == nil {
+			http.NotFound(w, r)
+			return
+		}
+		page.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,411 @@
+package composite
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeChecker is an in memory UptimeChecker which records the calls
+// made to it.
+type fakeChecker struct {
+	checks map[string]*monitor.UptimeCheck
+	calls  map[string]int
+	err    error // returned by every call, if set
+}
+
+func newFakeChecker(checks ...*monitor.UptimeCheck) *fakeChecker {
+	f := &fakeChecker{
+		checks: make(map[string]*monitor.UptimeCheck),
+		calls:  make(map[string]int),
+	}
+	for _, check := range checks {
+		f.checks[check.Hostname] = check
+	}
+	return f
+}
+
+func (f *fakeChecker) UptimeChecks() map[string]*monitor.UptimeCheck { return f.checks }
+
+func (f *fakeChecker) SyncUptimeChecks(ctx context.Context) error {
+	f.calls["sync"]++
+	return f.err
+}
+
+func (f *fakeChecker) CreateUptimeCheck(ctx context.Context, check *monitor.UptimeCheck) error {
+	f.calls["create"]++
+	if f.err != nil {
+		return f.err
+	}
+	f.checks[check.Hostname] = check
+	return nil
+}
+
+func (f *fakeChecker) DeleteUptimeCheck(ctx context.Context, hostName string) error {
+	f.calls["delete"]++
+	if f.err != nil {
+		return f.err
+	}
+	delete(f.checks, hostName)
+	return nil
+}
+
+func (f *fakeChecker) PauseUptimeCheck(ctx context.Context, hostName string) error {
+	f.calls["pause"]++
+	if f.err != nil {
+		return f.err
+	}
+	f.checks[hostName].Paused = true
+	return nil
+}
+
+func (f *fakeChecker) ResumeUptimeCheck(ctx context.Context, hostName string) error {
+	f.calls["resume"]++
+	if f.err != nil {
+		return f.err
+	}
+	f.checks[hostName].Paused = false
+	return nil
+}
+
+// fakeUpdater is a fakeChecker which can update checks in place.
+type fakeUpdater struct {
+	*fakeChecker
+}
+
+func (f fakeUpdater) UpdateUptimeCheck(ctx context.Context, check *monitor.UptimeCheck) error {
+	f.calls["update"]++
+	if f.err != nil {
+		return f.err
+	}
+	f.checks[check.Hostname] = check
+	return nil
+}
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newComposite(t *testing.T, a, b *fakeChecker) *CompositeUptimeChecker {
+	t.Helper()
+	c, err := NewCompositeUptimeChecker(Member{Name: "a", Checker: fakeUpdater{a}}, Member{Name: "b", Checker: b})
+	check(t, err)
+	return c
+}
+
+func TestCompositeFanOut(t *testing.T) {
+	ctx := context.Background()
+	a, b := newFakeChecker(), newFakeChecker()
+	c := newComposite(t, a, b)
+
+	uc := &monitor.UptimeCheck{Hostname: "example.com", Name: "example", CheckIntervalInMinutes: 1}
+	check(t, c.CreateUptimeCheck(ctx, uc))
+	assert.Equal(t, "example", a.checks["example.com"].Name)
+	assert.Equal(t, "example", b.checks["example.com"].Name)
+	assert.False(t, a.checks["example.com"] == b.checks["example.com"], "members share a check")
+	assert.True(t, monitor.SameCheck(uc, c.UptimeChecks()["example.com"]))
+
+	// updates are made in place where possible.
+	updated := &monitor.UptimeCheck{Hostname: "example.com", Name: "example", CheckIntervalInMinutes: 5}
+	check(t, c.UpdateUptimeCheck(ctx, updated))
+	assert.Equal(t, 1, a.calls["update"])
+	assert.Equal(t, 1, b.calls["delete"])
+	assert.Equal(t, 2, b.calls["create"])
+	assert.Equal(t, 5, c.UptimeChecks()["example.com"].CheckIntervalInMinutes)
+
+	check(t, c.PauseUptimeCheck(ctx, "example.com"))
+	assert.True(t, a.checks["example.com"].Paused)
+	assert.True(t, b.checks["example.com"].Paused)
+	assert.True(t, c.UptimeChecks()["example.com"].Paused)
+	check(t, c.ResumeUptimeCheck(ctx, "example.com"))
+	assert.False(t, c.UptimeChecks()["example.com"].Paused)
+
+	check(t, c.DeleteUptimeCheck(ctx, "example.com"))
+	assert.Empty(t, a.checks)
+	assert.Empty(t, b.checks)
+	assert.Empty(t, c.UptimeChecks())
+	assert.True(t, monitor.IsNotFound(c.PauseUptimeCheck(ctx, "example.com")))
+}
+
+// fakeRounding is a fakeUpdater which runs checks only every five
+// minutes.
+type fakeRounding struct {
+	fakeUpdater
+}
+
+func (f fakeRounding) Normalize(check *monitor.UptimeCheck) *monitor.UptimeCheck {
+	n := *check
+	n.CheckIntervalInMinutes = (check.CheckIntervalInMinutes + 4) / 5 * 5
+	return &n
+}
+
+func (f fakeRounding) CreateUptimeCheck(ctx context.Context, check *monitor.UptimeCheck) error {
+	return f.fakeChecker.CreateUptimeCheck(ctx, f.Normalize(check))
+}
+
+func TestCompositeNormalized(t *testing.T) {
+	ctx := context.Background()
+	a, b := newFakeChecker(), newFakeChecker()
+	c, err := NewCompositeUptimeChecker(Member{Name: "a", Checker: fakeRounding{fakeUpdater{a}}}, Member{Name: "b", Checker: b})
+	check(t, err)
+
+	uc := &monitor.UptimeCheck{Hostname: "example.com", Name: "example", CheckIntervalInMinutes: 2}
+	check(t, c.CreateUptimeCheck(ctx, uc))
+	assert.Equal(t, 5, a.checks["example.com"].CheckIntervalInMinutes)
+	assert.Equal(t, 2, b.checks["example.com"].CheckIntervalInMinutes)
+	assert.True(t, monitor.SameCheck(uc, c.UptimeChecks()["example.com"]), "the check is as requested, as each member runs it")
+
+	check(t, c.UpdateUptimeCheck(ctx, uc))
+	assert.Equal(t, 0, a.calls["update"])
+	assert.Equal(t, 1, a.calls["create"])
+}
+
+func TestCompositeSelection(t *testing.T) {
+	ctx := context.Background()
+	a, b := newFakeChecker(), newFakeChecker()
+	c := newComposite(t, a, b)
+
+	uc := &monitor.UptimeCheck{Hostname: "example.com", Name: "example", Providers: []string{"a"}}
+	check(t, c.CreateUptimeCheck(ctx, uc))
+	assert.Contains(t, a.checks, "example.com")
+	assert.NotContains(t, b.checks, "example.com")
+	assert.Equal(t, []string{"a"}, c.UptimeChecks()["example.com"].Providers)
+	assert.Nil(t, a.checks["example.com"].Providers)
+
+	// selecting all providers adds the check to b.
+	all := &monitor.UptimeCheck{Hostname: "example.com", Name: "example"}
+	assert.False(t, monitor.SameCheck(c.UptimeChecks()["example.com"], all))
+	check(t, c.UpdateUptimeCheck(ctx, all))
+	assert.Contains(t, b.checks, "example.com")
+	assert.Equal(t, 0, a.calls["update"])
+	assert.True(t, monitor.SameCheck(c.UptimeChecks()["example.com"], all))
+
+	// deselecting a removes its check.
+	check(t, c.UpdateUptimeCheck(ctx, &monitor.UptimeCheck{Hostname: "example.com", Name: "example", Providers: []string{"b"}}))
+	assert.NotContains(t, a.checks, "example.com")
+	assert.Contains(t, b.checks, "example.com")
+
+	err := c.CreateUptimeCheck(ctx, &monitor.UptimeCheck{Hostname: "other.example.com", Providers: []string{"a", "c"}})
+	assert.Equal(t, monitor.ValidationFailed, monitor.KindOf(err))
+	assert.Contains(t, err.Error(), "unknown providers c")
+	assert.Contains(t, a.checks, "other.example.com")
+	assert.Contains(t, c.UptimeChecks(), "other.example.com")
+}
+
+func TestCompositeIndependentErrors(t *testing.T) {
+	ctx := context.Background()
+	a, b := newFakeChecker(), newFakeChecker()
+	c := newComposite(t, a, b)
+	now := time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	b.err = &monitor.Error{Kind: monitor.Transient, Op: "create", Err: errors.New("timeout")}
+	uc := &monitor.UptimeCheck{Hostname: "example.com", Name: "example"}
+	err := c.CreateUptimeCheck(ctx, uc)
+	assert.True(t, monitor.IsRetryable(err))
+	assert.Equal(t, "create: b: create: timeout", err.Error())
+	assert.Contains(t, a.checks, "example.com")
+
+	// the host is not reported until every provider has its check, so
+	// that it is retried.
+	assert.NotContains(t, c.UptimeChecks(), "example.com")
+	assert.Equal(t, []Status{
+		{Provider: "a", Checks: 1, Failing: map[string]string{}},
+		{Provider: "b", Failing: map[string]string{"example.com": "create: timeout"}, LastError: "create: timeout", LastErrorTime: now},
+	}, c.Statuses())
+
+	// a retry is only made of the providers which failed.
+	b.err = nil
+	check(t, c.CreateUptimeCheck(ctx, uc))
+	assert.Equal(t, 1, a.calls["create"])
+	assert.Equal(t, 2, b.calls["create"])
+	assert.Contains(t, c.UptimeChecks(), "example.com")
+	assert.Empty(t, c.Statuses()[1].Failing)
+	assert.Equal(t, "create: timeout", c.Statuses()[1].LastError)
+
+	// a provider which rejects the check does not prevent the other
+	// from monitoring it, and is not retried.
+	b.err = &monitor.Error{Kind: monitor.ValidationFailed, Op: "create", Err: errors.New("http2 unsupported")}
+	err = c.CreateUptimeCheck(ctx, &monitor.UptimeCheck{Hostname: "h2.example.com", HTTP2: true})
+	assert.Equal(t, monitor.ValidationFailed, monitor.KindOf(err))
+	assert.Contains(t, a.checks, "h2.example.com")
+}
+
+func TestCompositeCombine(t *testing.T) {
+	c := newComposite(t, newFakeChecker(), newFakeChecker())
+	limited := func(d time.Duration) error {
+		return &monitor.Error{Kind: monitor.RateLimited, Err: errors.New("slow down"), RetryAfter: d}
+	}
+	invalid := &monitor.Error{Kind: monitor.ValidationFailed, Op: "create", Err: errors.New("invalid")}
+	transient := &monitor.Error{Kind: monitor.Transient, Err: errors.New("timeout")}
+
+	assert.Nil(t, c.combine("create", []error{nil, nil}, nil))
+
+	err := c.combine("create", []error{limited(time.Hour), limited(time.Minute)}, nil)
+	assert.Equal(t, monitor.RateLimited, monitor.KindOf(err))
+	assert.Equal(t, time.Minute, monitor.RetryAfter(err))
+
+	err = c.combine("create", []error{invalid, limited(time.Minute)}, nil)
+	assert.Equal(t, monitor.RateLimited, monitor.KindOf(err))
+
+	err = c.combine("create", []error{transient, limited(time.Minute)}, nil)
+	assert.Equal(t, monitor.Transient, monitor.KindOf(err))
+	assert.Zero(t, monitor.RetryAfter(err))
+
+	err = c.combine("create", []error{errors.New("boom"), invalid}, nil)
+	assert.Equal(t, monitor.Unknown, monitor.KindOf(err))
+	assert.Equal(t, "create: a: boom; b: create: invalid", err.Error())
+}
+
+func TestCompositeExistingChecks(t *testing.T) {
+	both := func() *monitor.UptimeCheck {
+		return &monitor.UptimeCheck{Hostname: "both.example.com", Name: "both", ID: 7}
+	}
+	a := newFakeChecker(
+		both(),
+		&monitor.UptimeCheck{Hostname: "a.example.com", Name: "a"},
+		&monitor.UptimeCheck{Hostname: "differ.example.com", Name: "a"},
+	)
+	b := newFakeChecker(
+		both(),
+		&monitor.UptimeCheck{Hostname: "differ.example.com", Name: "b"},
+	)
+	c := newComposite(t, a, b)
+
+	checks := c.UptimeChecks()
+	assert.Equal(t, &monitor.UptimeCheck{Hostname: "both.example.com", Name: "both"}, checks["both.example.com"])
+	assert.Equal(t, []string{"a"}, checks["a.example.com"].Providers)
+	assert.NotContains(t, checks, "differ.example.com")
+}
+
+func TestCompositeDuplicate(t *testing.T) {
+	_, err := NewCompositeUptimeChecker(Member{Name: "a", Checker: newFakeChecker()}, Member{Name: "a", Checker: newFakeChecker()})
+	assert.Error(t, err)
+	_, err = NewCompositeUptimeChecker()
+	assert.Error(t, err)
+}
+
+func TestCompositeSetMembers(t *testing.T) {
+	ctx := context.Background()
+	a, b := newFakeChecker(), newFakeChecker()
+	c := newComposite(t, a, b)
+	uc := &monitor.UptimeCheck{Hostname: "example.com", Name: "example"}
+	check(t, c.CreateUptimeCheck(ctx, uc))
+	a.err = errors.New("a failed")
+	assert.Error(t, c.SyncUptimeChecks(ctx))
+	a.err = nil
+
+	// a reconfigured b has none of the checks requested.
+	replacement := newFakeChecker()
+	check(t, c.SetMembers(Member{Name: "a", Checker: a}, Member{Name: "b", Checker: replacement}))
+	assert.NotContains(t, c.UptimeChecks(), "example.com")
+	assert.Equal(t, "a failed", c.Statuses()[0].LastError)
+
+	check(t, c.CreateUptimeCheck(ctx, uc))
+	assert.Contains(t, replacement.checks, "example.com")
+	assert.Contains(t, c.UptimeChecks(), "example.com")
+	assert.Equal(t, 1, b.calls["create"], "the replaced member is not called")
+
+	assert.Error(t, c.SetMembers(Member{Name: "a", Checker: a}, Member{Name: "a", Checker: b}))
+	assert.Error(t, c.SetMembers())
+	assert.Len(t, c.Statuses(), 2)
+}
+
+// fakeCloser is a fakeChecker which records whether it was closed, and
+// serves a status page.
+type fakeCloser struct {
+	*fakeChecker
+	closed bool
+}
+
+func (f *fakeCloser) Close() error {
+	f.closed = true
+	return nil
+}
+
+func (f *fakeCloser) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "page")
+	})
+}
+
+func TestCompositeSetMembersCloses(t *testing.T) {
+	a, b := &fakeCloser{fakeChecker: newFakeChecker()}, &fakeCloser{fakeChecker: newFakeChecker()}
+	c, err := NewCompositeUptimeChecker(Member{Name: "a", Checker: a}, Member{Name: "b", Checker: b})
+	check(t, err)
+
+	replacement := &fakeCloser{fakeChecker: newFakeChecker()}
+	check(t, c.SetMembers(Member{Name: "a", Checker: a}, Member{Name: "b", Checker: replacement}))
+	assert.False(t, a.closed, "a member kept is not closed")
+	assert.True(t, b.closed, "a member replaced is closed")
+	assert.False(t, replacement.closed)
+}
+
+// fakeTagged is a fakeChecker which lists only the checks it created.
+type fakeTagged struct {
+	*fakeChecker
+}
+
+func (fakeTagged) Adopts() bool { return false }
+
+func TestCompositeAdopts(t *testing.T) {
+	c := newComposite(t, newFakeChecker(), newFakeChecker())
+	assert.True(t, c.Adopts())
+	check(t, c.SetMembers(Member{Name: "a", Checker: newFakeChecker()}, Member{Name: "b", Checker: fakeTagged{newFakeChecker()}}))
+	assert.False(t, c.Adopts(), "a check one member cannot list would be duplicated there")
+}
+
+// fakePartial describes its checks for the hosts in undefined in part.
+type fakePartial struct {
+	*fakeChecker
+	undefined map[string]bool
+}
+
+func (f fakePartial) Defined(hostName string) bool { return !f.undefined[hostName] }
+
+func TestCompositeDefined(t *testing.T) {
+	c := newComposite(t, newFakeChecker(), newFakeChecker())
+	assert.True(t, c.Defined("example.com"))
+	check(t, c.SetMembers(Member{Name: "a", Checker: newFakeChecker()}, Member{Name: "b", Checker: fakePartial{newFakeChecker(), map[string]bool{"example.com": true}}}))
+	assert.False(t, c.Defined("example.com"))
+	assert.True(t, c.Defined("other.example.com"))
+}
+
+func TestCompositeHandler(t *testing.T) {
+	a, b := newFakeChecker(&monitor.UptimeCheck{Hostname: "example.com"}), newFakeChecker()
+	c := newComposite(t, a, b)
+
+	w := httptest.NewRecorder()
+	c.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var statuses []map[string]interface{}
+	check(t, json.NewDecoder(w.Body).Decode(&statuses))
+	if assert.Len(t, statuses, 2) {
+		assert.Equal(t, "a", statuses[0]["provider"])
+		assert.Equal(t, float64(1), statuses[0]["checks"])
+	}
+}
+
+func TestCompositeHandlerPages(t *testing.T) {
+	c, err := NewCompositeUptimeChecker(Member{Name: "a", Checker: newFakeChecker()}, Member{Name: "prober", Checker: &fakeCloser{fakeChecker: newFakeChecker()}})
+	check(t, err)
+
+	w := httptest.NewRecorder()
+	c.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/prober", nil))
+	assert.Equal(t, "page", w.Body.String())
+
+	w = httptest.NewRecorder()
+	c.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/a", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code, "a member without a page")
+}
@@ -0,0 +1,27 @@
+package composite
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	providerChecks = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "cruise",
+		Name:      "provider_checks",
+		Help:      "Number of checks each provider has.",
+	}, []string{"provider"})
+
+	failingChecks = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "cruise",
+		Name:      "provider_failing_checks",
+		Help:      "Number of checks whose last operation failed at each provider.",
+	}, []string{"provider"})
+
+	providerErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cruise",
+		Name:      "provider_errors_total",
+		Help:      "Number of errors returned by each provider, by kind.",
+	}, []string{"provider", "kind"})
+)
+
+func init() {
+	prometheus.MustRegister(providerChecks, failingChecks, providerErrors)
+}
@@ -0,0 +1,341 @@
+// Package config loads the configuration file of cruise serve, which
+// holds the settings otherwise given by flags along with those, such as
+// contact mappings and filters, which can only be given in the file.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/api/extensions/v1beta1"
+
+	"github.com/heptiolabs/cruise/internal/cruise"
+)
+
+// Version is the version of the configuration file format.
+const Version = "cruise.heptio.com/v1"
+
+// Config is the configuration of cruise serve.
+type Config struct {
+	Version string `json:"version"`
+
+	// Cluster is the name of the cluster, as --cluster-name.
+	Cluster string `json:"cluster,omitempty"`
+
+	// Providers holds the settings of each provider used, keyed by the
+	// names of their flags without the provider's prefix, eg. the
+	// pingdom provider's username is its --pingdom-username flag.
+	Providers map[string]map[string]Setting `json:"providers,omitempty"`
+
+	// Defaults are the values of the cruise.heptio.com/ annotations for
+	// Ingresses which do not set them, keyed by their names with or
+	// without the prefix.
+	Defaults map[string]Scalar `json:"defaults,omitempty"`
+
+	// Contacts maps names, which may be given in the contacts
+	// annotation, to the provider specific contacts they stand for.
+	Contacts map[string][]Scalar `json:"contacts,omitempty"`
+
+	Filters Filters `json:"filters"`
+	Naming  Naming  `json:"naming"`
+	Budgets Budgets `json:"budgets"`
+}
+
+// Scalar is a string which may be given in the file as a number or
+// boolean, eg. a contact ID or paused: true.
+type Scalar string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *Scalar) UnmarshalJSON(data []byte) error {
+	v, err := scalar(data)
+	*s = Scalar(v)
+	return err
+}
+
+// Filters select the Ingresses and hosts which are checked.
+type Filters struct {
+	Namespaces        []string `json:"namespaces,omitempty"`
+	ExcludeNamespaces []string `json:"excludeNamespaces,omitempty"`
+	ExcludeHosts      []string `json:"excludeHosts,omitempty"`
+}
+
+// Naming names checks.
+type Naming struct {
+	// Template is a text/template, as parsed by
+	// cruise.ParseNameTemplate.
+	Template string `json:"template,omitempty"`
+}
+
+// Budgets limit the number of checks, as --max-checks and
+// --max-checks-per-namespace.
+type Budgets struct {
+	MaxChecks             int `json:"maxChecks,omitempty"`
+	MaxChecksPerNamespace int `json:"maxChecksPerNamespace,omitempty"`
+}
+
+// Setting is the value of a provider setting: a string, number or
+// boolean, a list of them for settings which may be repeated, or a
+// reference to a credential held in a file or environment variable:
+//
+//	password: {file: /etc/cruise/pingdom/password}
+//	apikey: {env: PINGDOM_APIKEY}
+type Setting struct {
+	Values []string
+	File   string
+	Env    string
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *Setting) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(data, []byte("{")):
+		var ref struct {
+			File string `json:"file"`
+			Env  string `json:"env"`
+		}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&ref); err != nil || (ref.File == "") == (ref.Env == "") {
+			return fmt.Errorf("invalid reference %s, expected {file: path} or {env: name}", data)
+		}
+		s.File, s.Env = ref.File, ref.Env
+		return nil
+	case bytes.HasPrefix(data, []byte("[")):
+		var values []json.RawMessage
+		if err := json.Unmarshal(data, &values); err != nil {
+			return err
+		}
+		for _, data := range values {
+			v, err := scalar(data)
+			if err != nil {
+				return err
+			}
+			s.Values = append(s.Values, v)
+		}
+		return nil
+	default:
+		v, err := scalar(data)
+		if err != nil {
+			return err
+		}
+		s.Values = []string{v}
+		return nil
+	}
+}
+
+// scalar returns the string, number or boolean data as a string.
+func scalar(data json.RawMessage) (string, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return "", err
+	}
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	default:
+		return "", fmt.Errorf("expected a string, number or boolean, not %s", data)
+	}
+}
+
+// IsReference returns true if the value of s is held elsewhere.
+func (s *Setting) IsReference() bool {
+	return s.File != "" || s.Env != ""
+}
+
+// Resolve returns the values of s, reading those held elsewhere. The
+// trailing newline of a file is ignored.
+func (s *Setting) Resolve() ([]string, error) {
+	switch {
+	case s.File != "":
+		data, err := ioutil.ReadFile(s.File)
+		if err != nil {
+			return nil, err
+		}
+		return []string{strings.TrimRight(string(data), "\r\n")}, nil
+	case s.Env != "":
+		v, ok := os.LookupEnv(s.Env)
+		if !ok {
+			return nil, fmt.Errorf("environment variable %s is not set", s.Env)
+		}
+		return []string{v}, nil
+	default:
+		return s.Values, nil
+	}
+}
+
+// Load reads and validates the configuration file path.
+func Load(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return c, nil
+}
+
+// Parse parses and validates a configuration file.
+func Parse(data []byte) (*Config, error) {
+	data, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	var c Config
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return nil, err
+	}
+	c.normalise()
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// normalise gives the Defaults their full annotation names.
+func (c *Config) normalise() {
+	defaults := make(map[string]Scalar)
+	for key, v := range c.Defaults {
+		if !strings.Contains(key, "/") {
+			key = "cruise.heptio.com/" + key
+		}
+		defaults[key] = v
+	}
+	c.Defaults = defaults
+}
+
+// Annotations returns the Defaults as annotations.
+func (c *Config) Annotations() map[string]string {
+	annotations := make(map[string]string)
+	for key, v := range c.Defaults {
+		annotations[key] = string(v)
+	}
+	return annotations
+}
+
+// ContactMap returns the Contacts as strings.
+func (c *Config) ContactMap() map[string][]string {
+	contacts := make(map[string][]string)
+	for name, values := range c.Contacts {
+		for _, v := range values {
+			contacts[name] = append(contacts[name], string(v))
+		}
+	}
+	return contacts
+}
+
+// Errors are the problems found in a configuration.
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Validate returns Errors describing each of the problems with c.
+func (c *Config) Validate() error {
+	var errs Errors
+	invalid := func(field, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+	}
+
+	if c.Version != Version {
+		invalid("version", "%q is not supported, use %q", c.Version, Version)
+	}
+
+	for _, name := range sortedKeys(c.Providers) {
+		settings := c.Providers[name]
+		var keys []string
+		for key := range settings {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s := settings[key]
+			if _, err := s.Resolve(); err != nil {
+				invalid("providers."+name+"."+key, "%v", err)
+			}
+		}
+	}
+
+	ing := &v1beta1.Ingress{}
+	ing.Annotations = c.Annotations()
+	for _, err := range cruise.ValidateAnnotations(ing, nil) {
+		invalid("defaults", "%v", err)
+	}
+
+	var names []string
+	for name := range c.Contacts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if len(c.Contacts[name]) == 0 {
+			invalid("contacts."+name, "no contacts given")
+		}
+	}
+
+	for _, pattern := range c.Filters.ExcludeHosts {
+		if _, err := path.Match(pattern, ""); err != nil {
+			invalid("filters.excludeHosts", "invalid pattern %q", pattern)
+		}
+	}
+	for _, ns := range c.Filters.Namespaces {
+		for _, excluded := range c.Filters.ExcludeNamespaces {
+			if ns == excluded {
+				invalid("filters", "namespace %q is both selected and excluded", ns)
+			}
+		}
+	}
+
+	if c.Naming.Template != "" {
+		if _, err := cruise.ParseNameTemplate(c.Naming.Template); err != nil {
+			invalid("naming.template", "%v", err)
+		}
+	}
+
+	if c.Budgets.MaxChecks < 0 {
+		invalid("budgets.maxChecks", "must not be negative")
+	}
+	if c.Budgets.MaxChecksPerNamespace < 0 {
+		invalid("budgets.maxChecksPerNamespace", "must not be negative")
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// ProviderNames returns the sorted names of the configured providers.
+func (c *Config) ProviderNames() []string {
+	return sortedKeys(c.Providers)
+}
+
+func sortedKeys(m map[string]map[string]Setting) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	check(t, err)
+	defer os.RemoveAll(dir)
+	password := filepath.Join(dir, "password")
+	check(t, ioutil.WriteFile(password, []byte("s3cret\n"), 0600))
+	os.Setenv("CONFIG_TEST_APIKEY", "abc123")
+	defer os.Unsetenv("CONFIG_TEST_APIKEY")
+
+	c, err := Parse([]byte(`
+version: cruise.heptio.com/v1
+cluster: production
+providers:
+  pingdom:
+    username: ops@example.com
+    password: {file: ` + password + `}
+    apikey: {env: CONFIG_TEST_APIKEY}
+  uptimerobot:
+    alert-contact: [ops, 1234]
+defaults:
+  interval: 5m
+  cruise.heptio.com/paused: false
+contacts:
+  ops: [1234, ops@example.com]
+filters:
+  excludeNamespaces: [kube-system]
+  excludeHosts: ["*.internal.example.com"]
+naming:
+  template: "[production] {{.DefaultName}}"
+budgets:
+  maxChecks: 100
+`))
+	check(t, err)
+
+	assert.Equal(t, "production", c.Cluster)
+	assert.Equal(t, []string{"pingdom", "uptimerobot"}, c.ProviderNames())
+	for key, want := range map[string]string{"username": "ops@example.com", "password": "s3cret", "apikey": "abc123"} {
+		s := c.Providers["pingdom"][key]
+		values, err := s.Resolve()
+		check(t, err)
+		assert.Equal(t, []string{want}, values, key)
+	}
+	assert.Equal(t, []string{"ops", "1234"}, c.Providers["uptimerobot"]["alert-contact"].Values)
+	assert.Equal(t, map[string]string{
+		"cruise.heptio.com/interval": "5m",
+		"cruise.heptio.com/paused":   "false",
+	}, c.Annotations())
+	assert.Equal(t, map[string][]string{"ops": {"1234", "ops@example.com"}}, c.ContactMap())
+	assert.Equal(t, []string{"kube-system"}, c.Filters.ExcludeNamespaces)
+	assert.Equal(t, 100, c.Budgets.MaxChecks)
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]string{
+		"version: v0": `version: "v0" is not supported, use "cruise.heptio.com/v1"`,
+
+		"version: cruise.heptio.com/v1\nprovider: pingdom": `json: unknown field "provider"`,
+
+		"version: cruise.heptio.com/v1\nproviders: {pingdom: {password: {path: /x}}}": `invalid reference {"path":"/x"}, expected {file: path} or {env: name}`,
+
+		"version: cruise.heptio.com/v1\nproviders: {pingdom: {apikey: {env: CONFIG_TEST_UNSET}}}": `providers.pingdom.apikey: environment variable CONFIG_TEST_UNSET is not set`,
+
+		`version: cruise.heptio.com/v1
+defaults: {interval: soon, colour: blue}
+contacts: {ops: []}
+filters: {namespaces: [web], excludeNamespaces: [web], excludeHosts: ["[a"]}
+naming: {template: "{{.Host}}"}
+budgets: {maxChecks: -1}`: `defaults: unknown annotation cruise.heptio.com/colour; ` +
+			`defaults: invalid cruise.heptio.com/interval "soon"; ` +
+			`contacts.ops: no contacts given; ` +
+			`filters.excludeHosts: invalid pattern "[a"; ` +
+			`filters: namespace "web" is both selected and excluded; ` +
+			`naming.template: names checks eg. "www.example.com", which do not end with a space and {{.DefaultName}}, "default/www (www.example.com:443)"; ` +
+			`budgets.maxChecks: must not be negative`,
+	}
+	for data, want := range tests {
+		_, err := Parse([]byte(data))
+		if assert.Error(t, err, data) {
+			assert.Equal(t, want, err.Error(), data)
+		}
+	}
+}
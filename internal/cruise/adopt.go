@@ -0,0 +1,52 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cruise
+
+import (
+	"strconv"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+	"k8s.io/api/extensions/v1beta1"
+)
+
+// AdoptAnnotation, if "true", allows cruise to take over existing checks
+// for an Ingress' hosts which it did not create. Adopted checks are
+// reconciled in place, where the provider allows, and are thereafter
+// managed by cruise as if it had created them. Without it such checks
+// are neither modified nor deleted. A provider which lists only the
+// checks cruise created, see monitor.Adopter, cannot adopt, so no check
+// is created for a host whose Ingress asks to adopt one there. Checks
+// which cruise cannot describe, see monitor.Definer, are never adopted.
+const AdoptAnnotation = "cruise.heptio.com/adopt"
+
+// adopt returns true if ing allows cruise to adopt existing checks for
+// its hosts.
+func adopt(ing *v1beta1.Ingress) bool {
+	a, _ := strconv.ParseBool(ing.Annotations[AdoptAnnotation])
+	return a
+}
+
+// owned returns true if check was created, or has been adopted, by
+// cruise.
+func owned(check *monitor.UptimeCheck) bool {
+	_, _, ok := Owner(check)
+	return ok
+}
+
+// defined returns true unless checker is a monitor.Definer which only
+// describes its check for host in part.
+func defined(checker monitor.UptimeChecker, host string) bool {
+	d, ok := checker.(monitor.Definer)
+	return !ok || d.Defined(host)
+}
@@ -0,0 +1,101 @@
+package cruise
+
+import (
+	"testing"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExistingCheckNotAdopted(t *testing.T) {
+	manual := &monitor.UptimeCheck{Hostname: "example.com", Name: "Example homepage", CheckIntervalInMinutes: 5}
+	f := &fakeUpdater{fakeUptimeChecker: newFakeUptimeChecker()}
+	f.checks["example.com"] = manual
+	c, _ := newCruise(f)
+
+	i := ingress("mynamespace", "example", "", "example.com")
+	c.OnAdd(i)
+	updated := ingress("mynamespace", "example", "", "example.com")
+	updated.Annotations = map[string]string{PathAnnotation: "/healthz"}
+	c.OnUpdate(i, updated)
+	assert.False(t, f.UpdateUptimeCheckCalled)
+	assert.False(t, f.CreateUptimeCheckCalled)
+	assert.True(t, f.UptimeChecks()["example.com"] == manual)
+
+	// the check is not deleted with the Ingress.
+	c.OnDelete(updated)
+	assert.False(t, f.DeleteUptimeCheckCalled)
+	assert.Contains(t, f.UptimeChecks(), "example.com")
+	assert.NotContains(t, c.hosts, "example.com")
+}
+
+func TestAdoptAnnotation(t *testing.T) {
+	f := &fakeUpdater{fakeUptimeChecker: newFakeUptimeChecker()}
+	f.checks["example.com"] = &monitor.UptimeCheck{Hostname: "example.com", Name: "Example homepage", CheckIntervalInMinutes: 5}
+	c, _ := newCruise(f)
+
+	i := ingress("mynamespace", "example", "", "example.com")
+	i.Annotations = map[string]string{AdoptAnnotation: "true"}
+	c.OnAdd(i)
+	assert.True(t, f.UpdateUptimeCheckCalled)
+	assert.False(t, f.CreateUptimeCheckCalled)
+	adopted := f.UptimeChecks()["example.com"]
+	assert.Equal(t, "mynamespace/example (example.com:80)", adopted.Name)
+	assert.Equal(t, 1, adopted.CheckIntervalInMinutes)
+	assert.True(t, owned(adopted))
+	assert.True(t, c.hosts["example.com"].monitored)
+
+	// once adopted the check is managed as any other.
+	c.OnDelete(i)
+	assert.True(t, f.DeleteUptimeCheckCalled)
+	assert.Empty(t, f.UptimeChecks())
+}
+
+// tagged is an UptimeChecker which lists only the checks it created.
+type tagged struct {
+	*fakeUptimeChecker
+}
+
+func (tagged) Adopts() bool { return false }
+
+func TestAdoptUnsupported(t *testing.T) {
+	f := tagged{newFakeUptimeChecker()}
+	c, hook := newCruise(f)
+
+	i := ingress("mynamespace", "example", "", "example.com")
+	i.Annotations = map[string]string{AdoptAnnotation: "true"}
+	c.OnAdd(i)
+	assert.False(t, f.CreateUptimeCheckCalled, "a check the provider cannot list may already exist")
+	assert.Equal(t, logrus.WarnLevel, hook.LastEntry().Level)
+
+	// without the annotation the check is created.
+	c.OnUpdate(i, ingress("mynamespace", "example", "", "example.com"))
+	assert.True(t, f.CreateUptimeCheckCalled)
+}
+
+// partial is an UptimeChecker whose checks for the hosts in undefined
+// are only described in part.
+type partial struct {
+	*fakeUpdater
+	undefined map[string]bool
+}
+
+func (p partial) Defined(hostName string) bool { return !p.undefined[hostName] }
+
+func TestAdoptUndefined(t *testing.T) {
+	f := partial{&fakeUpdater{fakeUptimeChecker: newFakeUptimeChecker()}, map[string]bool{"example.com": true}}
+	manual := &monitor.UptimeCheck{Hostname: "example.com", Name: "Example DNS", CheckIntervalInMinutes: 5}
+	f.checks["example.com"] = manual
+	c, hook := newCruise(f)
+
+	i := ingress("mynamespace", "example", "", "example.com")
+	i.Annotations = map[string]string{AdoptAnnotation: "true"}
+	c.OnAdd(i)
+	assert.False(t, f.UpdateUptimeCheckCalled)
+	assert.False(t, f.CreateUptimeCheckCalled)
+	assert.False(t, f.DeleteUptimeCheckCalled)
+	assert.True(t, f.UptimeChecks()["example.com"] == manual)
+	assert.Equal(t, logrus.WarnLevel, hook.LastEntry().Level)
+	assert.False(t, c.hosts["example.com"].monitored)
+}
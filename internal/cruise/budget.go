@@ -0,0 +1,249 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cruise
+
+import (
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/api/core/v1"
+	"k8s.io/api/extensions/v1beta1"
+)
+
+// PriorityClassAnnotation selects the priority of the checks for an
+// Ingress' hosts when the Budget is exhausted. Valid values are the keys
+// of PriorityClasses.
+const PriorityClassAnnotation = "cruise.heptio.com/priority-class"
+
+// PriorityClasses maps the values of PriorityClassAnnotation to their
+// priority. Hosts of a higher priority displace those of a lower priority
+// when the Budget is exhausted.
+var PriorityClasses = map[string]int{
+	"critical": 300,
+	"high":     200,
+	"normal":   100,
+	"low":      0,
+}
+
+const defaultPriorityClass = "normal"
+
+// Budget limits the number of checks managed by cruise, eg. to stay
+// within the quota of the provider's plan.
+type Budget struct {
+	// Max is the maximum number of checks managed across all
+	// namespaces. Zero means unlimited.
+	Max int
+
+	// MaxPerNamespace is the maximum number of checks managed for
+	// the Ingresses of any one namespace. Zero means unlimited.
+	MaxPerNamespace int
+}
+
+var (
+	managedChecks = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "cruise",
+		Name:      "managed_checks",
+		Help:      "Number of checks managed by cruise.",
+	}, []string{"provider", "namespace"})
+
+	unmonitoredHosts = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "cruise",
+		Name:      "unmonitored_hosts",
+		Help:      "Number of Ingress hosts without a check because the managed check budget is exhausted.",
+	}, []string{"provider", "namespace"})
+)
+
+func init() {
+	prometheus.MustRegister(managedChecks, unmonitoredHosts)
+}
+
+func (c *Cruise) priority(ing *v1beta1.Ingress) int {
+	class, ok := ing.Annotations[PriorityClassAnnotation]
+	if !ok {
+		class = defaultPriorityClass
+	}
+	p, ok := PriorityClasses[class]
+	if !ok {
+		c.logger.WithField("ingress", ing.Namespace+"/"+ing.Name).Warnf("unknown %s %q, using %q", PriorityClassAnnotation, class, defaultPriorityClass)
+		p = PriorityClasses[defaultPriorityClass]
+	}
+	return p
+}
+
+// admit reports whether a check may be created, or kept, for hostname
+// without exceeding the Budget. If the Budget is exhausted, checks for
+// hosts of a lower priority are deleted to make room. If hostname cannot
+// be admitted an event is recorded against its Ingress, and any check
+// cruise created for it before it started is deleted. An error is
+// returned if a check could not be deleted, in which case hostname may
+// be admitted later.
+func (c *Cruise) admit(hostname string) (bool, error) {
+	h, ok := c.hosts[hostname]
+	if !ok || h.monitored {
+		return true, nil
+	}
+	h.overBudget = false
+
+	for {
+		total, inNamespace := c.usage(h.ingress.Namespace)
+		overGlobal := c.Budget.Max > 0 && total >= c.Budget.Max
+		overNamespace := c.Budget.MaxPerNamespace > 0 && inNamespace >= c.Budget.MaxPerNamespace
+		if !overGlobal && !overNamespace {
+			return true, nil
+		}
+
+		// if the namespace is over budget only a host from the same
+		// namespace can make room.
+		namespace := ""
+		limit := c.Budget.Max
+		if overNamespace {
+			namespace = h.ingress.Namespace
+			limit = c.Budget.MaxPerNamespace
+		}
+
+		victim := c.lowestPriority(namespace, h.priority)
+		if victim == nil {
+			if existing, ok := c.checker.UptimeChecks()[hostname]; ok && owned(existing) {
+				// the check was found when cruise started.
+				if err := c.deleteUptimeCheck(hostname); err != nil {
+					return false, err
+				}
+			}
+			c.logger.WithField("hostname", hostname).Warn("managed check budget exhausted, host will not be monitored")
+			c.event(h.ingress, v1.EventTypeWarning, "BudgetExceeded", "check for %s not created: managed check budget of %d exhausted", hostname, limit)
+			h.overBudget = true
+			return false, nil
+		}
+
+		if err := c.deleteUptimeCheck(victim.name); err != nil {
+			return false, err
+		}
+		victim.monitored = false
+		victim.overBudget = true
+		c.logger.WithField("hostname", victim.name).Warnf("check deleted to make room for higher priority host %s", hostname)
+		c.event(victim.ingress, v1.EventTypeWarning, "BudgetExceeded", "check for %s deleted to make room for higher priority host %s", victim.name, hostname)
+	}
+}
+
+// usage returns the number of monitored hosts in total and in namespace.
+func (c *Cruise) usage(namespace string) (total, inNamespace int) {
+	for _, h := range c.hosts {
+		if !h.monitored {
+			continue
+		}
+		total++
+		if h.ingress.Namespace == namespace {
+			inNamespace++
+		}
+	}
+	return total, inNamespace
+}
+
+// lowestPriority returns the monitored host with the lowest priority
+// below priority, optionally restricted to namespace, or nil if there is
+// none.
+func (c *Cruise) lowestPriority(namespace string, priority int) *host {
+	var candidates []*host
+	for _, h := range c.hosts {
+		if !h.monitored || h.priority >= priority {
+			continue
+		}
+		if namespace != "" && h.ingress.Namespace != namespace {
+			continue
+		}
+		candidates = append(candidates, h)
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].priority != candidates[j].priority {
+			return candidates[i].priority < candidates[j].priority
+		}
+		return candidates[i].name > candidates[j].name
+	})
+	return candidates[0]
+}
+
+// admitWaiting creates checks, in priority order, for hosts left
+// unmonitored while the Budget was exhausted, for as long as the Budget
+// permits.
+func (c *Cruise) admitWaiting() {
+	var waiting []*host
+	for _, h := range c.hosts {
+		if h.overBudget {
+			waiting = append(waiting, h)
+		}
+	}
+	sort.Slice(waiting, func(i, j int) bool {
+		if waiting[i].priority != waiting[j].priority {
+			return waiting[i].priority > waiting[j].priority
+		}
+		return waiting[i].name < waiting[j].name
+	})
+
+	for _, h := range waiting {
+		if c.ctx.Err() != nil {
+			return
+		}
+		total, inNamespace := c.usage(h.ingress.Namespace)
+		if (c.Budget.Max > 0 && total >= c.Budget.Max) ||
+			(c.Budget.MaxPerNamespace > 0 && inNamespace >= c.Budget.MaxPerNamespace) {
+			continue
+		}
+		check := c.uptimeCheck(h.ingress, h.name)
+		if err := c.replaceUptimeCheck(&check); err != nil {
+			c.handleError(h.name, pendingOp{op: createCheck, check: &check}, err)
+			continue
+		}
+		h.monitored = true
+		h.overBudget = false
+		c.logger.WithField("hostname", h.name).Info("check created")
+	}
+}
+
+// updateMetrics refreshes the budget gauges from the tracked hosts.
+func (c *Cruise) updateMetrics() {
+	managed := make(map[string]int)
+	unmonitored := make(map[string]int)
+	namespaces := make(map[string]bool)
+	for _, h := range c.hosts {
+		switch {
+		case h.monitored:
+			managed[h.ingress.Namespace]++
+		case h.overBudget:
+			unmonitored[h.ingress.Namespace]++
+		}
+		namespaces[h.ingress.Namespace] = true
+	}
+	for ns := range c.namespaces {
+		if !namespaces[ns] {
+			managedChecks.DeleteLabelValues(c.Provider, ns)
+			unmonitoredHosts.DeleteLabelValues(c.Provider, ns)
+		}
+	}
+	for ns := range namespaces {
+		managedChecks.WithLabelValues(c.Provider, ns).Set(float64(managed[ns]))
+		unmonitoredHosts.WithLabelValues(c.Provider, ns).Set(float64(unmonitored[ns]))
+	}
+	c.namespaces = namespaces
+}
+
+// event records an event against ing, if the Cruise has a Recorder.
+func (c *Cruise) event(ing *v1beta1.Ingress, eventtype, reason, messageFmt string, args ...interface{}) {
+	if c.Recorder == nil || ing == nil {
+		return
+	}
+	c.Recorder.Eventf(ing, eventtype, reason, messageFmt, args...)
+}
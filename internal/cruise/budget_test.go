@@ -0,0 +1,167 @@
+package cruise
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func ingress(namespace, name, class string, hosts ...string) *v1beta1.Ingress {
+	i := &v1beta1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+		},
+	}
+	if class != "" {
+		i.Annotations = map[string]string{PriorityClassAnnotation: class}
+	}
+	for _, h := range hosts {
+		i.Spec.Rules = append(i.Spec.Rules, v1beta1.IngressRule{Host: h})
+	}
+	return i
+}
+
+func newBudgetCruise(budget Budget) (*Cruise, *fakeUptimeChecker, *record.FakeRecorder) {
+	f := newFakeUptimeChecker()
+	c, _ := newCruise(f)
+	c.Budget = budget
+	recorder := record.NewFakeRecorder(10)
+	c.Recorder = recorder
+	return c, f, recorder
+}
+
+func nextEvent(t *testing.T, r *record.FakeRecorder) string {
+	t.Helper()
+	select {
+	case e := <-r.Events:
+		return e
+	default:
+		t.Fatal("expected an event")
+		return ""
+	}
+}
+
+func TestBudgetExhausted(t *testing.T) {
+	c, f, events := newBudgetCruise(Budget{Max: 1})
+
+	c.OnAdd(ingress("ns1", "a", "", "a.example.com"))
+	c.OnAdd(ingress("ns2", "b", "", "b.example.com"))
+
+	assert.Contains(t, f.UptimeChecks(), "a.example.com")
+	assert.NotContains(t, f.UptimeChecks(), "b.example.com")
+	assert.Equal(t, "Warning BudgetExceeded check for b.example.com not created: managed check budget of 1 exhausted", nextEvent(t, events))
+	assert.True(t, c.hosts["b.example.com"].overBudget)
+}
+
+func TestBudgetPerNamespace(t *testing.T) {
+	c, f, events := newBudgetCruise(Budget{MaxPerNamespace: 1})
+
+	c.OnAdd(ingress("ns1", "a", "", "a.example.com", "b.example.com"))
+	c.OnAdd(ingress("ns2", "c", "", "c.example.com"))
+
+	assert.Contains(t, f.UptimeChecks(), "a.example.com")
+	assert.NotContains(t, f.UptimeChecks(), "b.example.com")
+	assert.Contains(t, f.UptimeChecks(), "c.example.com")
+	assert.Contains(t, nextEvent(t, events), "check for b.example.com not created")
+}
+
+func TestBudgetEvictsLowerPriority(t *testing.T) {
+	c, f, events := newBudgetCruise(Budget{Max: 1})
+
+	c.OnAdd(ingress("ns1", "a", "low", "a.example.com"))
+	c.OnAdd(ingress("ns2", "b", "critical", "b.example.com"))
+
+	assert.NotContains(t, f.UptimeChecks(), "a.example.com")
+	assert.Contains(t, f.UptimeChecks(), "b.example.com")
+	assert.Equal(t, "Warning BudgetExceeded check for a.example.com deleted to make room for higher priority host b.example.com", nextEvent(t, events))
+
+	// an equal priority host does not displace another.
+	c.OnAdd(ingress("ns3", "c", "critical", "c.example.com"))
+	assert.Contains(t, f.UptimeChecks(), "b.example.com")
+	assert.NotContains(t, f.UptimeChecks(), "c.example.com")
+}
+
+func TestBudgetReleasedOnDelete(t *testing.T) {
+	c, f, _ := newBudgetCruise(Budget{Max: 1})
+
+	a := ingress("ns1", "a", "critical", "a.example.com")
+	c.OnAdd(a)
+	c.OnAdd(ingress("ns1", "b", "low", "b.example.com"))
+	c.OnAdd(ingress("ns1", "c", "high", "c.example.com"))
+	assert.NotContains(t, f.UptimeChecks(), "b.example.com")
+	assert.NotContains(t, f.UptimeChecks(), "c.example.com")
+
+	// once a is deleted, c is preferred to b.
+	c.OnDelete(a)
+	assert.NotContains(t, f.UptimeChecks(), "a.example.com")
+	assert.NotContains(t, f.UptimeChecks(), "b.example.com")
+	assert.Contains(t, f.UptimeChecks(), "c.example.com")
+	assert.False(t, c.hosts["c.example.com"].overBudget)
+	assert.True(t, c.hosts["b.example.com"].overBudget)
+}
+
+func TestBudgetExistingChecks(t *testing.T) {
+	c, f, events := newBudgetCruise(Budget{Max: 1})
+	ingresses := []*v1beta1.Ingress{
+		ingress("ns1", "a", "low", "a.example.com"),
+		ingress("ns1", "b", "critical", "b.example.com"),
+		ingress("ns1", "c", "normal", "c.example.com"),
+	}
+	for _, i := range ingresses {
+		host := i.Spec.Rules[0].Host
+		check := c.uptimeCheck(i, host)
+		f.checks[host] = &check
+	}
+
+	// checks found when cruise starts are kept only as the budget allows.
+	for _, i := range ingresses {
+		c.OnAdd(i)
+	}
+
+	assert.NotContains(t, f.UptimeChecks(), "a.example.com")
+	assert.Contains(t, f.UptimeChecks(), "b.example.com")
+	assert.NotContains(t, f.UptimeChecks(), "c.example.com")
+	assert.False(t, f.CreateUptimeCheckCalled)
+	assert.Equal(t, "Warning BudgetExceeded check for a.example.com deleted to make room for higher priority host b.example.com", nextEvent(t, events))
+	assert.Contains(t, nextEvent(t, events), "check for c.example.com not created")
+	assert.True(t, c.hosts["a.example.com"].overBudget)
+	assert.True(t, c.hosts["b.example.com"].monitored)
+	assert.True(t, c.hosts["c.example.com"].overBudget)
+}
+
+func TestBudgetEvictionFails(t *testing.T) {
+	c, f, _ := newBudgetCruise(Budget{Max: 1})
+
+	c.OnAdd(ingress("ns1", "a", "low", "a.example.com"))
+	f.DeleteUptimeCheckInError = true
+	f.Error = &monitor.Error{Kind: monitor.Transient, Op: "delete", Err: fmt.Errorf("timeout")}
+	c.OnAdd(ingress("ns1", "b", "critical", "b.example.com"))
+
+	assert.Contains(t, f.UptimeChecks(), "a.example.com")
+	assert.NotContains(t, f.UptimeChecks(), "b.example.com")
+
+	// the host is retried, not forgotten.
+	if assert.Contains(t, c.pending, "b.example.com") {
+		assert.Equal(t, createCheck, c.pending["b.example.com"].op)
+	}
+	f.DeleteUptimeCheckInError = false
+	c.queue.Add("b.example.com")
+	c.processNextItem()
+
+	assert.NotContains(t, f.UptimeChecks(), "a.example.com")
+	assert.Contains(t, f.UptimeChecks(), "b.example.com")
+	assert.Empty(t, c.pending)
+}
+
+func TestUnknownPriorityClass(t *testing.T) {
+	c, _, _ := newBudgetCruise(Budget{})
+	assert.Equal(t, PriorityClasses["normal"], c.priority(ingress("ns1", "a", "bogus")))
+	assert.Equal(t, PriorityClasses["critical"], c.priority(ingress("ns1", "a", "critical")))
+}
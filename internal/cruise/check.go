@@ -0,0 +1,190 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cruise
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+	"k8s.io/api/extensions/v1beta1"
+)
+
+const (
+	// IntervalAnnotation sets how often an Ingress' hosts are checked,
+	// as a duration rounded up to the nearest minute, eg. "5m".
+	IntervalAnnotation = "cruise.heptio.com/interval"
+
+	// PathAnnotation sets the path requested by the checks for an
+	// Ingress' hosts, eg. "/healthz".
+	PathAnnotation = "cruise.heptio.com/path"
+
+	// ContactsAnnotation is a comma separated list of the provider
+	// specific contacts, or contact groups, alerted when an Ingress'
+	// hosts are down.
+	ContactsAnnotation = "cruise.heptio.com/contacts"
+
+	// RegionsAnnotation is a comma separated list of the provider
+	// specific regions from which an Ingress' hosts are checked.
+	RegionsAnnotation = "cruise.heptio.com/regions"
+
+	// KeywordAnnotation sets a keyword which must appear in the
+	// responses for an Ingress' hosts.
+	KeywordAnnotation = "cruise.heptio.com/keyword"
+
+	// HTTP2Annotation, if "true", requires an Ingress' hosts to be
+	// served over HTTP/2.
+	HTTP2Annotation = "cruise.heptio.com/http2"
+
+	// StatusCodesAnnotation is a comma separated list of the HTTP status
+	// codes expected from an Ingress' hosts, eg. "200,301".
+	StatusCodesAnnotation = "cruise.heptio.com/expected-status-codes"
+
+	// ProvidersAnnotation is a comma separated list of the providers
+	// which check an Ingress' hosts when cruise manages checks with
+	// several. If unset all of them do.
+	ProvidersAnnotation = "cruise.heptio.com/providers"
+
+	// TeamAnnotation names the team responsible for an Ingress' hosts,
+	// by which their availability may be reported.
+	TeamAnnotation = "cruise.heptio.com/team"
+)
+
+const defaultInterval = time.Minute
+
+// interval returns the check interval, in minutes, for ing.
+func (c *Cruise) interval(ing *v1beta1.Ingress) int {
+	v, ok := ing.Annotations[IntervalAnnotation]
+	if !ok {
+		return int(defaultInterval / time.Minute)
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		c.logger.WithField("ingress", ing.Namespace+"/"+ing.Name).Warnf("invalid %s %q, using %v", IntervalAnnotation, v, defaultInterval)
+		d = defaultInterval
+	}
+	return int((d + time.Minute - 1) / time.Minute)
+}
+
+// statusCodes returns the status codes expected for the hosts of ing.
+func (c *Cruise) statusCodes(ing *v1beta1.Ingress) []int {
+	var codes []int
+	for _, v := range list(ing, StatusCodesAnnotation) {
+		code, err := strconv.Atoi(v)
+		if err != nil || code < 100 || code > 599 {
+			c.logger.WithField("ingress", ing.Namespace+"/"+ing.Name).Warnf("invalid %s %q, ignoring", StatusCodesAnnotation, v)
+			continue
+		}
+		codes = append(codes, code)
+	}
+	return codes
+}
+
+// list returns the elements of the comma separated annotation key of
+// ing, or nil if it is not set.
+func list(ing *v1beta1.Ingress, key string) []string {
+	var values []string
+	for _, v := range strings.Split(ing.Annotations[key], ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// nameRE matches the names cruise gives checks, "namespace/name
+// (host:port)", optionally following a prefix which ends in a space,
+// capturing the namespace and name of the Ingress.
+var nameRE = regexp.MustCompile(`(?:^|\s)([^/\s]+)/([^/\s]+) \(\S+:\d+\)$`)
+
+// CheckName holds the fields from which a NameTemplate names a check.
+type CheckName struct {
+	Namespace, Name string // of the Ingress
+	Host            string
+	Port            int
+}
+
+// DefaultName returns the default name of the check for n,
+// "namespace/name (host:port)".
+func (n CheckName) DefaultName() string {
+	return fmt.Sprintf("%s/%s (%s:%d)", n.Namespace, n.Name, n.Host, n.Port)
+}
+
+// ParseNameTemplate parses text as a text/template which names checks
+// from a CheckName. So that cruise still recognises the checks it
+// created at providers which do not record their Ingress, the names must
+// end in the default name, eg. "[production] {{.DefaultName}}".
+func ParseNameTemplate(text string) (*template.Template, error) {
+	t, err := template.New("name").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	sample := CheckName{Namespace: "default", Name: "www", Host: "www.example.com", Port: 443}
+	var b strings.Builder
+	if err := t.Execute(&b, sample); err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(b.String(), " "+sample.DefaultName()) && b.String() != sample.DefaultName() {
+		return nil, fmt.Errorf("names checks eg. %q, which do not end with a space and {{.DefaultName}}, %q", b.String(), sample.DefaultName())
+	}
+	return t, nil
+}
+
+// checkName returns the name of the check for host, one of the hosts of
+// ing, on port.
+func (c *Cruise) checkName(ing *v1beta1.Ingress, host string, port int) string {
+	n := CheckName{Namespace: ing.Namespace, Name: ing.Name, Host: host, Port: port}
+	if c.NameTemplate == nil {
+		return n.DefaultName()
+	}
+	var b strings.Builder
+	if err := c.NameTemplate.Execute(&b, n); err != nil {
+		c.logger.WithField("hostname", host).Warnf("naming check: %v, using the default name", err)
+		return n.DefaultName()
+	}
+	return b.String()
+}
+
+// contacts returns the contacts for the hosts of ing, replacing those
+// named in Contacts with the contacts for which they stand.
+func (c *Cruise) contacts(ing *v1beta1.Ingress) []string {
+	var contacts []string
+	for _, contact := range list(ing, ContactsAnnotation) {
+		if mapped, ok := c.Contacts[contact]; ok {
+			contacts = append(contacts, mapped...)
+			continue
+		}
+		contacts = append(contacts, contact)
+	}
+	return contacts
+}
+
+// Owner returns the namespace and name of the Ingress for whose host
+// check was created, and whether it was created by cruise at all. The
+// Ingress is taken from the check if the provider records it, otherwise
+// from the name cruise gave the check.
+func Owner(check *monitor.UptimeCheck) (namespace, name string, ok bool) {
+	if check.Ingress != "" {
+		return check.Namespace, check.Ingress, true
+	}
+	m := nameRE.FindStringSubmatch(check.Name)
+	if m == nil {
+		return "", "", false
+	}
+	return m[1], m[2], true
+}
@@ -0,0 +1,126 @@
+package cruise
+
+import (
+	"context"
+	"testing"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeUpdater is a fakeUptimeChecker which can update checks in place.
+type fakeUpdater struct {
+	*fakeUptimeChecker
+	UpdateUptimeCheckCalled bool
+}
+
+func (f *fakeUpdater) UpdateUptimeCheck(ctx context.Context, check *monitor.UptimeCheck) error {
+	f.UpdateUptimeCheckCalled = true
+	f.checks[check.Hostname] = check
+	return nil
+}
+
+func TestCheckAnnotations(t *testing.T) {
+	f := newFakeUptimeChecker()
+	c, _ := newCruise(f)
+
+	i := ingress("mynamespace", "example", "", "example.com")
+	i.Annotations = map[string]string{
+		IntervalAnnotation:    "90s",
+		PathAnnotation:        "/healthz",
+		ContactsAnnotation:    "ops, dev,",
+		RegionsAnnotation:     "eu",
+		KeywordAnnotation:     "ok",
+		HTTP2Annotation:       "true",
+		StatusCodesAnnotation: "200, 301, 999",
+		ProvidersAnnotation:   "pingdom, prober",
+	}
+	c.OnAdd(i)
+
+	check := f.UptimeChecks()["example.com"]
+	assert.Equal(t, 2, check.CheckIntervalInMinutes)
+	assert.Equal(t, "/healthz", check.Path)
+	assert.Equal(t, []string{"ops", "dev"}, check.Contacts)
+	assert.Equal(t, []string{"eu"}, check.Regions)
+	assert.Equal(t, "ok", check.Keyword)
+	assert.True(t, check.HTTP2)
+	assert.Equal(t, []int{200, 301}, check.StatusCodes)
+	assert.Equal(t, []string{"pingdom", "prober"}, check.Providers)
+
+	i.Annotations[IntervalAnnotation] = "bogus"
+	assert.Equal(t, 1, c.interval(i))
+}
+
+func TestUpdateInPlace(t *testing.T) {
+	f := &fakeUpdater{fakeUptimeChecker: newFakeUptimeChecker()}
+	c, _ := newCruise(f)
+
+	i := ingress("mynamespace", "example", "", "example.com")
+	c.OnAdd(i)
+
+	updated := ingress("mynamespace", "example", "", "example.com")
+	updated.Annotations = map[string]string{PathAnnotation: "/healthz"}
+	c.OnUpdate(i, updated)
+	assert.True(t, f.UpdateUptimeCheckCalled)
+	assert.False(t, f.DeleteUptimeCheckCalled)
+	assert.Equal(t, "/healthz", f.UptimeChecks()["example.com"].Path)
+}
+
+func TestOwner(t *testing.T) {
+	tests := []struct {
+		check              monitor.UptimeCheck
+		namespace, ingress string
+		ok                 bool
+	}{
+		{monitor.UptimeCheck{Name: "mynamespace/example (example.com:443)"}, "mynamespace", "example", true},
+		{monitor.UptimeCheck{Name: "renamed", Namespace: "web", Ingress: "www"}, "web", "www", true},
+		{monitor.UptimeCheck{Name: "example.com"}, "", "", false},
+		{monitor.UptimeCheck{Name: "a/b/c (example.com:80)"}, "", "", false},
+		{monitor.UptimeCheck{Name: "[production] mynamespace/example (example.com:443)"}, "mynamespace", "example", true},
+		{monitor.UptimeCheck{Name: "production-mynamespace/example (example.com:443)"}, "production-mynamespace", "example", true},
+	}
+	for _, tt := range tests {
+		namespace, ingress, ok := Owner(&tt.check)
+		assert.Equal(t, tt.namespace, namespace, tt.check.Name)
+		assert.Equal(t, tt.ingress, ingress, tt.check.Name)
+		assert.Equal(t, tt.ok, ok, tt.check.Name)
+	}
+}
+
+func TestNameTemplate(t *testing.T) {
+	f := newFakeUptimeChecker()
+	c, _ := newCruise(f)
+	tmpl, err := ParseNameTemplate("[production] {{.DefaultName}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.NameTemplate = tmpl
+
+	c.OnAdd(ingress("mynamespace", "example", "", "example.com"))
+	created := f.UptimeChecks()["example.com"]
+	assert.Equal(t, "[production] mynamespace/example (example.com:80)", created.Name)
+	namespace, name, ok := Owner(created)
+	assert.True(t, ok)
+	assert.Equal(t, "mynamespace/example", namespace+"/"+name)
+
+	for _, text := range []string{
+		"{{.Host}}",
+		"production-{{.DefaultName}}",
+		"{{.Cluster}} {{.DefaultName}}",
+		"{{.DefaultName",
+	} {
+		_, err := ParseNameTemplate(text)
+		assert.Error(t, err, text)
+	}
+}
+
+func TestContactsMapping(t *testing.T) {
+	f := newFakeUptimeChecker()
+	c, _ := newCruise(f)
+	c.Contacts = map[string][]string{"ops": {"1234", "5678"}}
+
+	i := ingress("mynamespace", "example", "", "example.com")
+	i.Annotations = map[string]string{ContactsAnnotation: "ops,dev"}
+	c.OnAdd(i)
+	assert.Equal(t, []string{"1234", "5678", "dev"}, f.UptimeChecks()["example.com"].Contacts)
+}
@@ -12,27 +12,105 @@
 // limitations under the License.
 
 // Package cruise contains the business logic that listens for ingress
-// objects and translates those into calls to the pingdom api.
+// objects and translates those into calls to an uptime monitoring provider.
 package cruise
 
 import (
+	"context"
 	"fmt"
 	"reflect"
+	"sync"
+	"text/template"
+	"time"
 
-	"github.com/heptiolabs/cruise/internal/pingdom"
+	"github.com/heptiolabs/cruise/internal/monitor"
 	"github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
 	"k8s.io/api/extensions/v1beta1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 )
 
 type Cruise struct {
+	// RequestTimeout bounds each call to the UptimeChecker. If zero,
+	// calls are bounded only by the Cruise's context.
+	RequestTimeout time.Duration
+
+	// Budget limits the number of checks created. The zero value
+	// permits an unlimited number of checks.
+	Budget Budget
+
+	// GracePeriod delays the deletion of checks for hosts which are no
+	// longer referenced by any Ingress. If the host reappears before the
+	// GracePeriod expires the check is kept. Zero deletes immediately.
+	GracePeriod time.Duration
+
+	// PauseDuringGrace pauses checks awaiting deletion.
+	PauseDuringGrace bool
+
+	// RemovalPolicy selects what happens to the check for a host which
+	// is no longer referenced by any Ingress. It may be overridden by an
+	// Ingress' RemovalPolicyAnnotation. The zero value deletes checks.
+	RemovalPolicy RemovalPolicy
+
+	// Recorder, if set, receives events for Ingresses whose hosts
+	// are left unmonitored.
+	Recorder record.EventRecorder
+
+	// Provider names the monitoring providers in metrics.
+	Provider string
+
+	// Filter selects the Ingresses and hosts which are checked.
+	Filter Filter
+
+	// Defaults are the values of the annotations, keyed by their full
+	// names, used for Ingresses which do not set them.
+	Defaults map[string]string
+
+	// Contacts maps names which may be given in the ContactsAnnotation
+	// to the provider specific contacts for which they stand.
+	Contacts map[string][]string
+
+	// NameTemplate, if set, names checks in place of the default
+	// "namespace/name (host:port)". See ParseNameTemplate.
+	NameTemplate *template.Template
+
+	ctx     context.Context
 	logger  logrus.FieldLogger
-	checker pingdom.UptimeChecker
+	checker monitor.UptimeChecker
+
+	// mu serialises calls to checker between the informer's event
+	// handlers and the retry worker.
+	mu sync.Mutex
+
+	// queue holds the hostnames of operations which failed with a
+	// retryable error, or are scheduled for later; pending holds the
+	// operation to perform for each hostname.
+	queue   workqueue.RateLimitingInterface
+	pending map[string]pendingOp
+
+	// hosts records the hosts of the Ingresses seen so far.
+	hosts map[string]*host
+
+	// ingresses records the Ingresses seen so far, as received, by
+	// namespace/name.
+	ingresses map[string]*v1beta1.Ingress
+
+	// namespaces records the namespaces last reported in metrics.
+	namespaces map[string]bool
 }
 
-func NewCruise(checker pingdom.UptimeChecker, logger logrus.FieldLogger) *Cruise {
+// NewCruise returns a Cruise which manages checks via checker. Calls to
+// checker are cancelled when ctx is done.
+func NewCruise(ctx context.Context, checker monitor.UptimeChecker, logger logrus.FieldLogger) *Cruise {
 	return &Cruise{
-		logger:  logger,
-		checker: checker,
+		ctx:       ctx,
+		logger:    logger,
+		checker:   checker,
+		queue:     workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "cruise"),
+		pending:   make(map[string]pendingOp),
+		hosts:     make(map[string]*host),
+		ingresses: make(map[string]*v1beta1.Ingress),
 	}
 }
 
@@ -75,6 +153,26 @@ func (c *Cruise) recompute(olding, newing *v1beta1.Ingress) {
 		return
 	}
 
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer c.updateMetrics()
+
+	if newing != nil {
+		c.ingresses[key(newing)] = newing
+	} else {
+		delete(c.ingresses, key(olding))
+	}
+	c.reconcile(c.prepare(olding), c.prepare(newing))
+}
+
+// reconcile makes the checks of olding, as cruise last managed them,
+// those of newing, as it manages them now. Either may be nil.
+func (c *Cruise) reconcile(olding, newing *v1beta1.Ingress) {
+	if olding == nil && newing == nil {
+		// neither is selected by the Filter
+		return
+	}
+
 	// normalise old and new ingress objects; a nil object becomes a blank object of the same name
 	if olding == nil {
 		olding = &v1beta1.Ingress{
@@ -92,49 +190,91 @@ func (c *Cruise) recompute(olding, newing *v1beta1.Ingress) {
 	// newing will be removed.
 	active := make(map[string]bool)
 
-	for _, r := range newing.Spec.Rules {
+	for i, r := range newing.Spec.Rules {
+		if c.ctx.Err() != nil {
+			return
+		}
+
 		host := r.Host
 		if host == "" {
-			c.logger.WithField("ingress", fmt.Sprintf("%s/%s", newing.Namespace, newing.Name)).Debugf("skipping rule %d, missing Host field", r.IngressRuleValue)
+			c.logger.WithField("ingress", fmt.Sprintf("%s/%s", newing.Namespace, newing.Name)).Debugf("skipping rule %d, missing Host field", i)
 			continue
 		}
 
 		active[host] = true // mark this host as active even if we end up skipping it
+		h := c.track(host, newing)
+		c.reclaim(h)
+
+		existing, exists := c.checker.UptimeChecks()[host]
+		if !exists && adopt(newing) && !monitor.Adopts(c.checker) {
+			// the provider does not list the checks cruise did not
+			// create, so one may exist which would be duplicated.
+			c.logger.WithField("hostname", host).Warnf("the provider cannot adopt existing checks, skipping; remove %s to create a check", AdoptAnnotation)
+			c.event(newing, v1.EventTypeWarning, "AdoptUnsupported", "Cannot adopt an existing check for %s, as the provider only lists the checks created by cruise; remove %s to create one", host, AdoptAnnotation)
+			c.forget(host)
+			continue
+		}
+		adopting := exists && !owned(existing)
+		if adopting && !adopt(newing) {
+			c.logger.WithField("hostname", host).Infof("check not created by cruise, skipping; set %s to adopt it", AdoptAnnotation)
+			c.event(newing, v1.EventTypeNormal, "CheckNotOwned", "Check for %s was not created by cruise and is left alone; set %s to adopt it", host, AdoptAnnotation)
+			c.forget(host)
+			continue
+		}
+		if adopting && !defined(c.checker, host) {
+			// adopting the check would replace what cruise cannot
+			// describe, eg. a check of another protocol.
+			c.logger.WithField("hostname", host).Warn("existing check is of a kind cruise cannot describe, not adopting it")
+			c.event(newing, v1.EventTypeWarning, "AdoptUndefined", "Cannot adopt the existing check for %s, as it is of a kind cruise cannot describe", host)
+			c.forget(host)
+			continue
+		}
+		check := c.uptimeCheck(newing, host)
+		admitted, err := c.admit(host)
+		if err != nil {
+			c.handleError(host, pendingOp{op: createCheck, check: &check}, err)
+			continue
+		}
+		if !admitted {
+			c.forget(host)
+			continue
+		}
 
-		if _, ok := c.checker.UptimeChecks()[host]; ok {
+		if exists && !adopting {
 			if olding.ObjectMeta.Name == "" ||
 				(reflect.DeepEqual(olding.Spec.Rules, newing.Spec.Rules) && reflect.DeepEqual(olding.Spec.TLS, newing.Spec.Rules)) {
 				c.logger.WithField("hostname", host).Info("check already exists, skipping")
+				h.monitored = true
+				c.forget(host)
+				c.syncPaused(host, paused(newing))
 				continue
-			} else {
-				c.checker.DeleteUptimeCheck(host)
 			}
 		}
 
-		port := 80
-		if newing.Spec.TLS != nil {
-			port = 443
-		}
-
-		check := pingdom.UptimeCheck{
-			Name:                   fmt.Sprintf("%s/%s (%s:%d)", newing.Namespace, newing.Name, host, port),
-			Hostname:               host,
-			CheckIntervalInMinutes: 1,
-			EnableTLS:              port == 443,
-		}
-
-		err := c.checker.CreateUptimeCheck(&check)
+		err = c.replaceUptimeCheck(&check)
 		if err != nil {
-			c.logger.Error(err)
+			c.handleError(host, pendingOp{op: createCheck, check: &check}, err)
+			continue
+		}
+		h.monitored = true
+		c.forget(host)
+		if adopting {
+			c.logger.WithField("hostname", host).Info("check adopted")
+			c.event(newing, v1.EventTypeNormal, "CheckAdopted", "Adopted existing check for %s", host)
 			continue
 		}
 		c.logger.Info("check created")
 	}
 
-	for _, r := range olding.Spec.Rules {
+	freed := false
+	for i, r := range olding.Spec.Rules {
+		if c.ctx.Err() != nil {
+			return
+		}
+
 		host := r.Host
 		if host == "" {
-			c.logger.Debugf("skipping rule %d, missing Host field", r.IngressRuleValue)
+			c.logger.Debugf("skipping rule %d, missing Host field", i)
 			continue
 		}
 
@@ -143,12 +283,147 @@ func (c *Cruise) recompute(olding, newing *v1beta1.Ingress) {
 			continue
 		}
 
-		err := c.checker.DeleteUptimeCheck(host)
+		if h, ok := c.hosts[host]; ok {
+			delete(h.owners, key(olding))
+			if len(h.owners) > 0 {
+				c.logger.WithField("hostname", host).Debug("host referenced by another ingress, not removing check")
+				continue
+			}
+		}
+
+		if existing, ok := c.checker.UptimeChecks()[host]; ok && !owned(existing) {
+			c.logger.WithField("hostname", host).Info("check not created by cruise, not removing")
+			c.forget(host)
+			delete(c.hosts, host)
+			continue
+		}
+
+		if c.removalPolicy(olding) == RemovalPolicyPause {
+			c.pauseOnRemoval(host)
+			freed = true
+			continue
+		}
+
+		if h, ok := c.hosts[host]; ok && c.GracePeriod > 0 && h.monitored {
+			c.scheduleDeletion(h)
+			continue
+		}
+
+		err := c.deleteUptimeCheck(host)
 		if err != nil {
-			c.logger.WithField("hostname", host).Error(err)
+			c.handleError(host, pendingOp{op: deleteCheck}, err)
 			continue
 		}
+		c.forget(host)
+		delete(c.hosts, host)
+		freed = true
 
 		c.logger.Info("check deleted")
 	}
+
+	if freed {
+		c.admitWaiting()
+	}
+}
+
+// uptimeCheck returns the check for host, one of the hosts of ing.
+func (c *Cruise) uptimeCheck(ing *v1beta1.Ingress, host string) monitor.UptimeCheck {
+	port := 80
+	if ing.Spec.TLS != nil {
+		port = 443
+	}
+
+	return monitor.UptimeCheck{
+		Name:                   c.checkName(ing, host, port),
+		Hostname:               host,
+		CheckIntervalInMinutes: c.interval(ing),
+		EnableTLS:              port == 443,
+		Paused:                 paused(ing),
+		Path:                   ing.Annotations[PathAnnotation],
+		Contacts:               c.contacts(ing),
+		Regions:                list(ing, RegionsAnnotation),
+		Keyword:                ing.Annotations[KeywordAnnotation],
+		HTTP2:                  ing.Annotations[HTTP2Annotation] == "true",
+		StatusCodes:            c.statusCodes(ing),
+		Namespace:              ing.Namespace,
+		Ingress:                ing.Name,
+		Providers:              list(ing, ProvidersAnnotation),
+	}
+}
+
+// replaceUptimeCheck creates check, first deleting any existing check
+// for the same hostname which does not match it. If the UptimeChecker
+// can update checks in place the existing check is updated instead.
+func (c *Cruise) replaceUptimeCheck(check *monitor.UptimeCheck) error {
+	if existing, ok := c.checker.UptimeChecks()[check.Hostname]; ok {
+		if monitor.SameCheck(existing, monitor.Normalize(c.checker, check)) {
+			return c.setPaused(check.Hostname, check.Paused)
+		}
+		if u, ok := c.checker.(monitor.Updater); ok {
+			ctx, cancel := c.requestContext()
+			defer cancel()
+			return u.UpdateUptimeCheck(ctx, check)
+		}
+		if err := c.deleteUptimeCheck(check.Hostname); err != nil {
+			return err
+		}
+	}
+	ctx, cancel := c.requestContext()
+	defer cancel()
+	return c.checker.CreateUptimeCheck(ctx, check)
+}
+
+// deleteUptimeCheck removes the check for host. A check which has already
+// been removed at the provider is not an error.
+func (c *Cruise) deleteUptimeCheck(host string) error {
+	ctx, cancel := c.requestContext()
+	defer cancel()
+	err := c.checker.DeleteUptimeCheck(ctx, host)
+	if monitor.IsNotFound(err) {
+		c.logger.WithField("hostname", host).Debug("check already deleted")
+		return nil
+	}
+	return err
+}
+
+// setPaused pauses or resumes the check for host. It is not an error if
+// there is no check for host.
+func (c *Cruise) setPaused(host string, paused bool) error {
+	existing, ok := c.checker.UptimeChecks()[host]
+	if !ok || existing.Paused == paused {
+		return nil
+	}
+	ctx, cancel := c.requestContext()
+	defer cancel()
+	var err error
+	if paused {
+		err = c.checker.PauseUptimeCheck(ctx, host)
+	} else {
+		err = c.checker.ResumeUptimeCheck(ctx, host)
+	}
+	if monitor.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (c *Cruise) requestContext() (context.Context, context.CancelFunc) {
+	if c.RequestTimeout > 0 {
+		return context.WithTimeout(c.ctx, c.RequestTimeout)
+	}
+	return context.WithCancel(c.ctx)
+}
+
+// logError logs an error returned by the UptimeChecker for host at a
+// level matching its kind.
+func (c *Cruise) logError(host string, err error) {
+	log := c.logger.WithField("hostname", host)
+	switch kind := monitor.KindOf(err); kind {
+	case monitor.RateLimited, monitor.Transient:
+		log.WithField("kind", kind).Warn(err)
+	case monitor.Unknown:
+		log.Error(err)
+	default:
+		log.WithField("kind", kind).Error(err)
+	}
 }
@@ -1,14 +1,16 @@
 package cruise
 
 import (
+	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
 
-	"github.com/heptiolabs/cruise/internal/pingdom"
+	"github.com/heptiolabs/cruise/internal/monitor"
 	"k8s.io/api/extensions/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -18,45 +20,74 @@ type fakeUptimeChecker struct {
 	CreateUptimeCheckInError bool
 	DeleteUptimeCheckCalled  bool
 	DeleteUptimeCheckInError bool
-	checks                   map[string]*pingdom.UptimeCheck
+	PauseUptimeCheckCalled   bool
+	ResumeUptimeCheckCalled  bool
+	checks                   map[string]*monitor.UptimeCheck
+
+	// Error, if set, is returned in place of the generic error by
+	// calls which are in error.
+	Error error
+}
+
+func (f *fakeUptimeChecker) err() error {
+	if f.Error != nil {
+		return f.Error
+	}
+	return fmt.Errorf("Something went wrong")
 }
 
-func (f *fakeUptimeChecker) CreateUptimeCheck(check *pingdom.UptimeCheck) error {
+func (f *fakeUptimeChecker) CreateUptimeCheck(ctx context.Context, check *monitor.UptimeCheck) error {
 	f.CreateUptimeCheckCalled = true
 	if f.CreateUptimeCheckInError {
-		return fmt.Errorf("Something went wrong")
+		return f.err()
 	}
 	f.checks[check.Hostname] = check
 	return nil
 }
 
-func (f *fakeUptimeChecker) DeleteUptimeCheck(hostname string) error {
+func (f *fakeUptimeChecker) DeleteUptimeCheck(ctx context.Context, hostname string) error {
 	f.DeleteUptimeCheckCalled = true
 	if f.DeleteUptimeCheckInError {
-		return fmt.Errorf("Something went wrong")
+		return f.err()
 	}
 	delete(f.checks, hostname)
 	return nil
 }
 
-func (f *fakeUptimeChecker) SyncUptimeChecks() error {
+func (f *fakeUptimeChecker) PauseUptimeCheck(ctx context.Context, hostname string) error {
+	f.PauseUptimeCheckCalled = true
+	if check, ok := f.checks[hostname]; ok {
+		check.Paused = true
+	}
 	return nil
 }
 
-func (f *fakeUptimeChecker) UptimeChecks() map[string]*pingdom.UptimeCheck {
+func (f *fakeUptimeChecker) ResumeUptimeCheck(ctx context.Context, hostname string) error {
+	f.ResumeUptimeCheckCalled = true
+	if check, ok := f.checks[hostname]; ok {
+		check.Paused = false
+	}
+	return nil
+}
+
+func (f *fakeUptimeChecker) SyncUptimeChecks(ctx context.Context) error {
+	return nil
+}
+
+func (f *fakeUptimeChecker) UptimeChecks() map[string]*monitor.UptimeCheck {
 	return f.checks
 }
 
 func newFakeUptimeChecker() *fakeUptimeChecker {
 	return &fakeUptimeChecker{
-		checks: map[string]*pingdom.UptimeCheck{},
+		checks: map[string]*monitor.UptimeCheck{},
 	}
 }
 
-func newCruise(checker pingdom.UptimeChecker) (*Cruise, *test.Hook) {
+func newCruise(checker monitor.UptimeChecker) (*Cruise, *test.Hook) {
 	logger, hook := test.NewNullLogger()
 	logger.SetLevel(logrus.DebugLevel)
-	return NewCruise(checker, logger), hook
+	return NewCruise(context.Background(), checker, logger), hook
 }
 
 func TestOnAddNonIngress(t *testing.T) {
@@ -120,11 +151,13 @@ func TestOnAddIngressWithNonExistingUptimeCheck(t *testing.T) {
 	c.OnAdd(i)
 	assert.True(t, f.CreateUptimeCheckCalled)
 
-	check := &pingdom.UptimeCheck{
+	check := &monitor.UptimeCheck{
 		Hostname:               "example.com",
 		Name:                   "mynamespace/example (example.com:80)",
 		EnableTLS:              false,
 		CheckIntervalInMinutes: 1,
+		Namespace:              "mynamespace",
+		Ingress:                "example",
 	}
 
 	assert.Equal(t, f.UptimeChecks()["example.com"], check)
@@ -205,11 +238,13 @@ func TestOnAddIngressWithNonExistingUptimeCheckTLS(t *testing.T) {
 	c.OnAdd(i)
 	assert.True(t, f.CreateUptimeCheckCalled)
 
-	check := &pingdom.UptimeCheck{
+	check := &monitor.UptimeCheck{
 		Hostname:               "example.com",
 		Name:                   "mynamespace/example (example.com:443)",
 		EnableTLS:              true,
 		CheckIntervalInMinutes: 1,
+		Namespace:              "mynamespace",
+		Ingress:                "example",
 	}
 
 	assert.Equal(t, f.UptimeChecks()["example.com"], check)
@@ -233,8 +268,8 @@ func TestOnAddIngressWithoutHost(t *testing.T) {
 
 func TestOnAddIngressWithExistingUptimeCheck(t *testing.T) {
 	f := &fakeUptimeChecker{
-		checks: map[string]*pingdom.UptimeCheck{
-			"example.com": &pingdom.UptimeCheck{},
+		checks: map[string]*monitor.UptimeCheck{
+			"example.com": &monitor.UptimeCheck{Name: "mynamespace/example (example.com:80)"},
 		},
 	}
 
@@ -256,8 +291,8 @@ func TestOnAddIngressWithExistingUptimeCheck(t *testing.T) {
 
 func TestOnDeleteIngress(t *testing.T) {
 	f := &fakeUptimeChecker{
-		checks: map[string]*pingdom.UptimeCheck{
-			"example.com": &pingdom.UptimeCheck{},
+		checks: map[string]*monitor.UptimeCheck{
+			"example.com": &monitor.UptimeCheck{Name: "mynamespace/example (example.com:80)"},
 		},
 	}
 
@@ -280,8 +315,8 @@ func TestOnDeleteIngress(t *testing.T) {
 
 func TestOnUpdateIngressUptimeCheck(t *testing.T) {
 	f := &fakeUptimeChecker{
-		checks: map[string]*pingdom.UptimeCheck{
-			"example.com": &pingdom.UptimeCheck{},
+		checks: map[string]*monitor.UptimeCheck{
+			"example.com": &monitor.UptimeCheck{Name: "mynamespace/example (example.com:80)"},
 		},
 	}
 
@@ -325,11 +360,13 @@ func TestOnUpdateIngressUptimeCheck(t *testing.T) {
 	assert.True(t, f.DeleteUptimeCheckCalled)
 	assert.True(t, f.CreateUptimeCheckCalled)
 
-	check := &pingdom.UptimeCheck{
+	check := &monitor.UptimeCheck{
 		Hostname:               "example.com",
 		Name:                   "mynamespace/example (example.com:443)",
 		EnableTLS:              true,
 		CheckIntervalInMinutes: 1,
+		Namespace:              "mynamespace",
+		Ingress:                "example",
 	}
 
 	assert.Equal(t, f.UptimeChecks()["example.com"], check)
@@ -337,8 +374,8 @@ func TestOnUpdateIngressUptimeCheck(t *testing.T) {
 
 func TestOnUpdateIngressWithNoOldHost(t *testing.T) {
 	f := &fakeUptimeChecker{
-		checks: map[string]*pingdom.UptimeCheck{
-			"example.com": &pingdom.UptimeCheck{},
+		checks: map[string]*monitor.UptimeCheck{
+			"example.com": &monitor.UptimeCheck{Name: "mynamespace/example (example.com:80)"},
 		},
 	}
 
@@ -380,12 +417,167 @@ func TestOnUpdateIngressWithNoOldHost(t *testing.T) {
 	assert.True(t, f.DeleteUptimeCheckCalled)
 	assert.True(t, f.CreateUptimeCheckCalled)
 
-	check := &pingdom.UptimeCheck{
+	check := &monitor.UptimeCheck{
 		Hostname:               "example.com",
 		Name:                   "mynamespace/example (example.com:443)",
 		EnableTLS:              true,
 		CheckIntervalInMinutes: 1,
+		Namespace:              "mynamespace",
+		Ingress:                "example",
 	}
 
 	assert.Equal(t, f.UptimeChecks()["example.com"], check)
 }
+
+func TestOnDeleteIngressWithAlreadyDeletedUptimeCheck(t *testing.T) {
+	f := &fakeUptimeChecker{
+		checks: map[string]*monitor.UptimeCheck{
+			"example.com": &monitor.UptimeCheck{Name: "mynamespace/example (example.com:80)"},
+		},
+		DeleteUptimeCheckInError: true,
+		Error:                    &monitor.Error{Kind: monitor.NotFound, Op: "delete", Err: fmt.Errorf("gone")},
+	}
+
+	i := &v1beta1.Ingress{
+		Spec: v1beta1.IngressSpec{
+			Rules: []v1beta1.IngressRule{
+				v1beta1.IngressRule{
+					Host: "example.com",
+				},
+			},
+		},
+	}
+
+	c, log := newCruise(f)
+
+	c.OnDelete(i)
+	assert.True(t, f.DeleteUptimeCheckCalled)
+	assert.Equal(t, logrus.InfoLevel, log.LastEntry().Level)
+	assert.Equal(t, "check deleted", log.LastEntry().Message)
+}
+
+func TestOnAddIngressWithTransientErrorWhenCreatingUptimeCheck(t *testing.T) {
+	f := newFakeUptimeChecker()
+	f.CreateUptimeCheckInError = true
+	f.Error = &monitor.Error{Kind: monitor.Transient, Op: "create", Err: fmt.Errorf("timeout")}
+
+	i := &v1beta1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "mynamespace",
+			Name:      "example",
+		},
+		Spec: v1beta1.IngressSpec{
+			Rules: []v1beta1.IngressRule{
+				v1beta1.IngressRule{
+					Host: "example.com",
+				},
+			},
+		},
+	}
+
+	c, log := newCruise(f)
+	c.OnAdd(i)
+	assert.Equal(t, logrus.WarnLevel, log.LastEntry().Level)
+	assert.Equal(t, "create: timeout", log.LastEntry().Message)
+	assert.Equal(t, monitor.Transient, log.LastEntry().Data["kind"])
+}
+
+func TestOnAddIngressWithCancelledContext(t *testing.T) {
+	f := newFakeUptimeChecker()
+	i := &v1beta1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "mynamespace",
+			Name:      "example",
+		},
+		Spec: v1beta1.IngressSpec{
+			Rules: []v1beta1.IngressRule{
+				v1beta1.IngressRule{
+					Host: "example.com",
+				},
+			},
+		},
+	}
+
+	logger, _ := test.NewNullLogger()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c := NewCruise(ctx, f, logger)
+	c.OnAdd(i)
+	assert.False(t, f.CreateUptimeCheckCalled)
+}
+
+func TestOnAddIngressRetriesRateLimitedUptimeCheck(t *testing.T) {
+	f := newFakeUptimeChecker()
+	f.CreateUptimeCheckInError = true
+	f.Error = &monitor.Error{Kind: monitor.RateLimited, Op: "create", Err: fmt.Errorf("slow down"), RetryAfter: 10 * time.Millisecond}
+
+	i := &v1beta1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "mynamespace",
+			Name:      "example",
+		},
+		Spec: v1beta1.IngressSpec{
+			Rules: []v1beta1.IngressRule{
+				v1beta1.IngressRule{
+					Host: "example.com",
+				},
+			},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	logger, _ := test.NewNullLogger()
+	c := NewCruise(ctx, f, logger)
+	c.OnAdd(i)
+	assert.Empty(t, f.UptimeChecks())
+	assert.Contains(t, c.pending, "example.com")
+
+	f.CreateUptimeCheckInError = false
+	go c.Run()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		c.mu.Lock()
+		created := f.UptimeChecks()["example.com"]
+		c.mu.Unlock()
+		if created != nil {
+			assert.Equal(t, "mynamespace/example (example.com:80)", created.Name)
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for check to be created")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	c.mu.Lock()
+	assert.Empty(t, c.pending)
+	c.mu.Unlock()
+}
+
+func TestOnDeleteIngressDoesNotRetryValidationFailure(t *testing.T) {
+	f := &fakeUptimeChecker{
+		checks: map[string]*monitor.UptimeCheck{
+			"example.com": &monitor.UptimeCheck{Name: "mynamespace/example (example.com:80)"},
+		},
+		DeleteUptimeCheckInError: true,
+		Error:                    &monitor.Error{Kind: monitor.ValidationFailed, Op: "delete", Err: fmt.Errorf("bad request")},
+	}
+
+	i := &v1beta1.Ingress{
+		Spec: v1beta1.IngressSpec{
+			Rules: []v1beta1.IngressRule{
+				v1beta1.IngressRule{
+					Host: "example.com",
+				},
+			},
+		},
+	}
+
+	c, log := newCruise(f)
+	c.OnDelete(i)
+	assert.Equal(t, logrus.ErrorLevel, log.LastEntry().Level)
+	assert.Empty(t, c.pending)
+	assert.Equal(t, 0, c.queue.Len())
+}
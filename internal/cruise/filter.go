@@ -0,0 +1,97 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cruise
+
+import (
+	"path"
+
+	"k8s.io/api/extensions/v1beta1"
+)
+
+// Filter selects the Ingresses, and the hosts, for which cruise manages
+// checks. The zero value selects all of them.
+type Filter struct {
+	// Namespaces, if not empty, are the only namespaces whose
+	// Ingresses are selected.
+	Namespaces []string
+
+	// ExcludeNamespaces are namespaces whose Ingresses are not
+	// selected.
+	ExcludeNamespaces []string
+
+	// ExcludeHosts are patterns, as matched by path.Match, of the hosts
+	// which are not checked, eg. "*.internal.example.com".
+	ExcludeHosts []string
+}
+
+// selects returns true if the hosts of ing may be checked.
+func (f *Filter) selects(ing *v1beta1.Ingress) bool {
+	if len(f.Namespaces) > 0 && !contains(f.Namespaces, ing.Namespace) {
+		return false
+	}
+	return !contains(f.ExcludeNamespaces, ing.Namespace)
+}
+
+// excludes returns true if host may not be checked.
+func (f *Filter) excludes(host string) bool {
+	for _, pattern := range f.ExcludeHosts {
+		if ok, _ := path.Match(pattern, host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// prepare returns ing as cruise manages it: nil if the Filter does not
+// select it, otherwise without the rules for excluded hosts and with the
+// Defaults for the annotations it does not set. ing is not modified.
+func (c *Cruise) prepare(ing *v1beta1.Ingress) *v1beta1.Ingress {
+	if ing == nil || !c.Filter.selects(ing) {
+		return nil
+	}
+	excluded := false
+	for _, r := range ing.Spec.Rules {
+		excluded = excluded || c.Filter.excludes(r.Host)
+	}
+	defaulted := false
+	for key := range c.Defaults {
+		_, ok := ing.Annotations[key]
+		defaulted = defaulted || !ok
+	}
+	if !excluded && !defaulted {
+		return ing
+	}
+
+	ing = ing.DeepCopy()
+	if excluded {
+		var rules []v1beta1.IngressRule
+		for _, r := range ing.Spec.Rules {
+			if !c.Filter.excludes(r.Host) {
+				rules = append(rules, r)
+			}
+		}
+		ing.Spec.Rules = rules
+	}
+	if defaulted {
+		if ing.Annotations == nil {
+			ing.Annotations = make(map[string]string)
+		}
+		for key, v := range c.Defaults {
+			if _, ok := ing.Annotations[key]; !ok {
+				ing.Annotations[key] = v
+			}
+		}
+	}
+	return ing
+}
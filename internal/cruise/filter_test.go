@@ -0,0 +1,46 @@
+package cruise
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilter(t *testing.T) {
+	f := newFakeUptimeChecker()
+	c, _ := newCruise(f)
+	c.Filter = Filter{
+		ExcludeNamespaces: []string{"kube-system"},
+		ExcludeHosts:      []string{"*.internal.example.com"},
+	}
+
+	c.OnAdd(ingress("kube-system", "dashboard", "", "dashboard.example.com"))
+	assert.False(t, f.CreateUptimeCheckCalled)
+
+	i := ingress("mynamespace", "example", "", "example.com", "api.internal.example.com")
+	c.OnAdd(i)
+	assert.Len(t, f.UptimeChecks(), 1)
+	assert.Contains(t, f.UptimeChecks(), "example.com")
+	assert.Len(t, i.Spec.Rules, 2, "the Ingress must not be modified")
+
+	c.Filter.Namespaces = []string{"other"}
+	assert.Nil(t, c.prepare(i))
+}
+
+func TestDefaults(t *testing.T) {
+	f := newFakeUptimeChecker()
+	c, _ := newCruise(f)
+	c.Defaults = map[string]string{
+		PathAnnotation:     "/healthz",
+		IntervalAnnotation: "5m",
+	}
+
+	i := ingress("mynamespace", "example", "", "example.com")
+	i.Annotations = map[string]string{PathAnnotation: "/status"}
+	c.OnAdd(i)
+
+	check := f.UptimeChecks()["example.com"]
+	assert.Equal(t, "/status", check.Path)
+	assert.Equal(t, 5, check.CheckIntervalInMinutes)
+	assert.Len(t, i.Annotations, 1, "the Ingress must not be modified")
+}
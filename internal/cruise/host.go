@@ -0,0 +1,83 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cruise
+
+import (
+	"time"
+
+	"k8s.io/api/extensions/v1beta1"
+)
+
+// host records the Ingresses which requested a check for a hostname.
+type host struct {
+	name       string
+	ingress    *v1beta1.Ingress // the Ingress which most recently requested the check
+	owners     map[string]bool  // the namespace/name of each Ingress referencing the host
+	priority   int
+	monitored  bool      // true if a check exists for this host
+	overBudget bool      // true if the host was refused a check by the Budget
+	deleteAt   time.Time // if non zero, when the check will be deleted
+}
+
+// track records that ing requests a check for hostname.
+func (c *Cruise) track(hostname string, ing *v1beta1.Ingress) *host {
+	h, ok := c.hosts[hostname]
+	if !ok {
+		h = &host{
+			name:   hostname,
+			owners: make(map[string]bool),
+		}
+		c.hosts[hostname] = h
+	}
+	h.ingress = ing
+	h.owners[key(ing)] = true
+	h.priority = c.priority(ing)
+	return h
+}
+
+func key(ing *v1beta1.Ingress) string {
+	return ing.Namespace + "/" + ing.Name
+}
+
+// scheduleDeletion arranges for the check for h to be deleted once the
+// GracePeriod expires, unless h is requested by an Ingress before then.
+func (c *Cruise) scheduleDeletion(h *host) {
+	if !h.deleteAt.IsZero() {
+		// already scheduled.
+		return
+	}
+	h.deleteAt = time.Now().Add(c.GracePeriod)
+
+	if c.PauseDuringGrace {
+		if err := c.setPaused(h.name, true); err != nil {
+			c.logError(h.name, err)
+		}
+	}
+
+	c.pending[h.name] = pendingOp{op: deleteCheck}
+	c.queue.AddAfter(h.name, c.GracePeriod)
+	c.logger.WithField("hostname", h.name).WithField("deleteAt", h.deleteAt).Info("check scheduled for deletion")
+}
+
+// reclaim cancels any scheduled deletion of the check for h. A check
+// paused during the grace period is resumed by the caller once the
+// desired state of the check is known.
+func (c *Cruise) reclaim(h *host) {
+	if h.deleteAt.IsZero() {
+		return
+	}
+	h.deleteAt = time.Time{}
+	c.forget(h.name)
+	c.logger.WithField("hostname", h.name).Info("host reappeared, check will not be deleted")
+}
@@ -0,0 +1,103 @@
+package cruise
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGracePeriodHostReappears(t *testing.T) {
+	f := newFakeUptimeChecker()
+	c, _ := newCruise(f)
+	c.GracePeriod = time.Hour
+
+	i := ingress("mynamespace", "example", "", "example.com")
+	c.OnAdd(i)
+	created := f.UptimeChecks()["example.com"]
+	assert.NotNil(t, created)
+
+	c.OnDelete(i)
+	assert.False(t, f.DeleteUptimeCheckCalled)
+	assert.Contains(t, c.pending, "example.com")
+	assert.False(t, c.hosts["example.com"].deleteAt.IsZero())
+
+	// recreating the Ingress keeps the original check.
+	c.OnAdd(ingress("mynamespace", "example", "", "example.com"))
+	assert.False(t, f.DeleteUptimeCheckCalled)
+	assert.NotContains(t, c.pending, "example.com")
+	assert.True(t, c.hosts["example.com"].deleteAt.IsZero())
+	assert.True(t, created == f.UptimeChecks()["example.com"])
+}
+
+func TestGracePeriodExpires(t *testing.T) {
+	f := newFakeUptimeChecker()
+	logger, _ := test.NewNullLogger()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := NewCruise(ctx, f, logger)
+	c.GracePeriod = 10 * time.Millisecond
+
+	i := ingress("mynamespace", "example", "", "example.com")
+	c.OnAdd(i)
+	c.OnDelete(i)
+	go c.Run()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		c.mu.Lock()
+		_, exists := f.UptimeChecks()["example.com"]
+		c.mu.Unlock()
+		if !exists {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for check to be deleted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	assert.NotContains(t, c.hosts, "example.com")
+	assert.Empty(t, c.pending)
+}
+
+func TestGracePeriodPausesCheck(t *testing.T) {
+	f := newFakeUptimeChecker()
+	c, _ := newCruise(f)
+	c.GracePeriod = time.Hour
+	c.PauseDuringGrace = true
+
+	i := ingress("mynamespace", "example", "", "example.com")
+	c.OnAdd(i)
+	c.OnDelete(i)
+	assert.True(t, f.PauseUptimeCheckCalled)
+	assert.True(t, f.UptimeChecks()["example.com"].Paused)
+
+	c.OnAdd(ingress("mynamespace", "example", "", "example.com"))
+	assert.True(t, f.ResumeUptimeCheckCalled)
+	assert.False(t, f.UptimeChecks()["example.com"].Paused)
+}
+
+func TestHostSharedBetweenIngresses(t *testing.T) {
+	f := newFakeUptimeChecker()
+	c, _ := newCruise(f)
+
+	blue := ingress("mynamespace", "blue", "", "example.com")
+	green := ingress("mynamespace", "green", "", "example.com")
+	c.OnAdd(blue)
+	c.OnAdd(green)
+	f.DeleteUptimeCheckCalled = false
+
+	// example.com is still referenced by green.
+	c.OnDelete(blue)
+	assert.False(t, f.DeleteUptimeCheckCalled)
+	assert.Contains(t, f.UptimeChecks(), "example.com")
+
+	c.OnDelete(green)
+	assert.True(t, f.DeleteUptimeCheckCalled)
+	assert.Empty(t, f.UptimeChecks())
+}
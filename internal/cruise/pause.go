@@ -0,0 +1,89 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cruise
+
+import (
+	"strconv"
+
+	"k8s.io/api/extensions/v1beta1"
+)
+
+// PausedAnnotation, if "true", pauses the checks for an Ingress' hosts
+// while preserving their history, eg. while the Ingress' backends are
+// scaled down.
+const PausedAnnotation = "cruise.heptio.com/paused"
+
+// RemovalPolicyAnnotation overrides the Cruise's RemovalPolicy for the
+// hosts of an Ingress.
+const RemovalPolicyAnnotation = "cruise.heptio.com/removal-policy"
+
+// RemovalPolicy selects what happens to the check for a host once it is
+// no longer referenced by any Ingress.
+type RemovalPolicy string
+
+const (
+	// RemovalPolicyDelete deletes the check, after the GracePeriod.
+	RemovalPolicyDelete RemovalPolicy = "delete"
+
+	// RemovalPolicyPause pauses the check, preserving its history.
+	// Paused checks are no longer managed by cruise and do not count
+	// towards the Budget.
+	RemovalPolicyPause RemovalPolicy = "pause"
+)
+
+// paused returns true if ing requests its checks be paused.
+func paused(ing *v1beta1.Ingress) bool {
+	p, _ := strconv.ParseBool(ing.Annotations[PausedAnnotation])
+	return p
+}
+
+// removalPolicy returns the RemovalPolicy for the hosts of ing.
+func (c *Cruise) removalPolicy(ing *v1beta1.Ingress) RemovalPolicy {
+	policy := c.RemovalPolicy
+	if v, ok := ing.Annotations[RemovalPolicyAnnotation]; ok {
+		switch p := RemovalPolicy(v); p {
+		case RemovalPolicyDelete, RemovalPolicyPause:
+			policy = p
+		default:
+			c.logger.WithField("ingress", key(ing)).Warnf("unknown %s %q, ignoring", RemovalPolicyAnnotation, v)
+		}
+	}
+	if policy == "" {
+		return RemovalPolicyDelete
+	}
+	return policy
+}
+
+// syncPaused pauses or resumes the existing check for host.
+func (c *Cruise) syncPaused(host string, paused bool) {
+	if err := c.setPaused(host, paused); err != nil {
+		op := resumeCheck
+		if paused {
+			op = pauseCheck
+		}
+		c.handleError(host, pendingOp{op: op}, err)
+	}
+}
+
+// pauseOnRemoval pauses the check for host, which is no longer referenced
+// by any Ingress, and stops managing it.
+func (c *Cruise) pauseOnRemoval(host string) {
+	c.forget(host)
+	delete(c.hosts, host)
+	if err := c.setPaused(host, true); err != nil {
+		c.handleError(host, pendingOp{op: pauseCheck}, err)
+		return
+	}
+	c.logger.WithField("hostname", host).Info("check paused")
+}
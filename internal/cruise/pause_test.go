@@ -0,0 +1,59 @@
+package cruise
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPausedAnnotation(t *testing.T) {
+	f := newFakeUptimeChecker()
+	c, _ := newCruise(f)
+
+	i := ingress("mynamespace", "example", "", "example.com")
+	i.Annotations = map[string]string{PausedAnnotation: "true"}
+	c.OnAdd(i)
+	assert.True(t, f.UptimeChecks()["example.com"].Paused)
+
+	// removing the annotation resumes the check.
+	updated := ingress("mynamespace", "example", "", "example.com")
+	c.OnUpdate(i, updated)
+	assert.True(t, f.ResumeUptimeCheckCalled)
+	assert.False(t, f.DeleteUptimeCheckCalled)
+	assert.False(t, f.UptimeChecks()["example.com"].Paused)
+}
+
+func TestRemovalPolicyPause(t *testing.T) {
+	f := newFakeUptimeChecker()
+	c, _ := newCruise(f)
+	c.RemovalPolicy = RemovalPolicyPause
+
+	i := ingress("mynamespace", "example", "", "example.com")
+	c.OnAdd(i)
+	c.OnDelete(i)
+	assert.False(t, f.DeleteUptimeCheckCalled)
+	assert.True(t, f.UptimeChecks()["example.com"].Paused)
+	assert.NotContains(t, c.hosts, "example.com")
+
+	// the paused check is resumed if the host reappears.
+	c.OnAdd(ingress("mynamespace", "example", "", "example.com"))
+	assert.False(t, f.UptimeChecks()["example.com"].Paused)
+	assert.Contains(t, c.hosts, "example.com")
+}
+
+func TestRemovalPolicyAnnotation(t *testing.T) {
+	f := newFakeUptimeChecker()
+	c, _ := newCruise(f)
+	c.RemovalPolicy = RemovalPolicyPause
+
+	i := ingress("mynamespace", "example", "", "example.com")
+	i.Annotations = map[string]string{RemovalPolicyAnnotation: "delete"}
+	c.OnAdd(i)
+	c.OnDelete(i)
+	assert.True(t, f.DeleteUptimeCheckCalled)
+	assert.False(t, f.PauseUptimeCheckCalled)
+	assert.Empty(t, f.UptimeChecks())
+
+	i.Annotations[RemovalPolicyAnnotation] = "bogus"
+	assert.Equal(t, RemovalPolicyPause, c.removalPolicy(i))
+}
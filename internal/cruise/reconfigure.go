@@ -0,0 +1,49 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cruise
+
+import (
+	"sort"
+
+	"k8s.io/api/extensions/v1beta1"
+)
+
+// Reconfigure calls fn, which may change the settings of the Cruise,
+// such as its Filter, Defaults, Contacts, NameTemplate and Budget, and
+// the configuration of its UptimeChecker. fn is called once any
+// reconcile in progress is complete, and none starts until it returns.
+// The checks of the Ingresses seen so far are then reconciled with the
+// new settings. If fn returns an error it must leave the settings as
+// they were; the error is returned and nothing is reconciled.
+func (c *Cruise) Reconfigure(fn func() error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer c.updateMetrics()
+
+	var keys []string
+	before := make(map[string]*v1beta1.Ingress)
+	for k, ing := range c.ingresses {
+		keys = append(keys, k)
+		before[k] = c.prepare(ing)
+	}
+	sort.Strings(keys)
+
+	if err := fn(); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		c.reconcile(before[k], c.prepare(c.ingresses[k]))
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package cruise
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconfigure(t *testing.T) {
+	f := &fakeUpdater{fakeUptimeChecker: newFakeUptimeChecker()}
+	c, _ := newCruise(f)
+	c.Filter = Filter{ExcludeNamespaces: []string{"staging"}}
+	c.OnAdd(ingress("mynamespace", "example", "", "example.com"))
+	c.OnAdd(ingress("kube-system", "dashboard", "", "dashboard.example.com"))
+	c.OnAdd(ingress("staging", "example", "", "staging.example.com"))
+	assert.Len(t, f.UptimeChecks(), 2)
+
+	err := c.Reconfigure(func() error {
+		return errors.New("invalid configuration")
+	})
+	assert.EqualError(t, err, "invalid configuration")
+	assert.Len(t, f.UptimeChecks(), 2)
+	assert.False(t, f.UpdateUptimeCheckCalled)
+
+	err = c.Reconfigure(func() error {
+		c.Filter = Filter{ExcludeNamespaces: []string{"kube-system"}}
+		c.Defaults = map[string]string{PathAnnotation: "/healthz"}
+		return nil
+	})
+	check(t, err)
+	assert.NotContains(t, f.UptimeChecks(), "dashboard.example.com")
+	assert.Contains(t, f.UptimeChecks(), "staging.example.com")
+	assert.Equal(t, "/healthz", f.UptimeChecks()["example.com"].Path)
+	assert.True(t, f.UpdateUptimeCheckCalled)
+}
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
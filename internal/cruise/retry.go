@@ -0,0 +1,139 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cruise
+
+import (
+	"github.com/heptiolabs/cruise/internal/monitor"
+)
+
+// operation is an action on the check for a host.
+type operation int
+
+const (
+	createCheck operation = iota
+	deleteCheck
+	pauseCheck
+	resumeCheck
+)
+
+// pendingOp is an operation awaiting retry.
+type pendingOp struct {
+	op    operation
+	check *monitor.UptimeCheck // the check to create, for createCheck
+}
+
+// Run retries operations which failed with a retryable error, such as
+// being rate limited by the provider, until the Cruise's context is
+// cancelled.
+func (c *Cruise) Run() {
+	go func() {
+		<-c.ctx.Done()
+		c.queue.ShutDown()
+	}()
+	for c.processNextItem() {
+	}
+}
+
+func (c *Cruise) processNextItem() bool {
+	item, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(item)
+	host := item.(string)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p, ok := c.pending[host]
+	if !ok {
+		// superseded by a later event for the same host.
+		c.queue.Forget(host)
+		return true
+	}
+
+	defer c.updateMetrics()
+
+	log := c.logger.WithField("hostname", host).WithField("retries", c.queue.NumRequeues(host))
+	switch p.op {
+	case deleteCheck:
+		h, tracked := c.hosts[host]
+		if tracked && len(h.owners) > 0 {
+			// the host is referenced by an Ingress once more.
+			c.forget(host)
+			return true
+		}
+		if err := c.deleteUptimeCheck(host); err != nil {
+			c.handleError(host, p, err)
+			return true
+		}
+		if tracked && !h.deleteAt.IsZero() {
+			log.Info("grace period expired, check deleted")
+		} else {
+			log.Info("retry succeeded")
+		}
+		c.forget(host)
+		delete(c.hosts, host)
+		c.admitWaiting()
+		return true
+	case createCheck:
+		admitted, err := c.admit(host)
+		if err != nil {
+			c.handleError(host, p, err)
+			return true
+		}
+		if !admitted {
+			c.forget(host)
+			return true
+		}
+		if err := c.replaceUptimeCheck(p.check); err != nil {
+			c.handleError(host, p, err)
+			return true
+		}
+		if h, ok := c.hosts[host]; ok {
+			h.monitored = true
+		}
+	case pauseCheck, resumeCheck:
+		if err := c.setPaused(host, p.op == pauseCheck); err != nil {
+			c.handleError(host, p, err)
+			return true
+		}
+	}
+	log.Info("retry succeeded")
+	c.forget(host)
+	return true
+}
+
+// handleError logs err, returned while performing p on the check for
+// host, and requeues p if it may succeed later.
+func (c *Cruise) handleError(host string, p pendingOp, err error) {
+	c.logError(host, err)
+	if !monitor.IsRetryable(err) {
+		c.forget(host)
+		return
+	}
+
+	c.pending[host] = p
+	if d := monitor.RetryAfter(err); d > 0 {
+		c.queue.AddAfter(host, d)
+	} else {
+		c.queue.AddRateLimited(host)
+	}
+}
+
+// forget discards any pending retry for host.
+func (c *Cruise) forget(host string) {
+	delete(c.pending, host)
+	c.queue.Forget(host)
+}
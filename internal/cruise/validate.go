@@ -0,0 +1,112 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cruise
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/api/extensions/v1beta1"
+)
+
+// annotationPrefix is the prefix of the annotations cruise reads.
+const annotationPrefix = "cruise.heptio.com/"
+
+// annotations are the annotations cruise reads.
+var annotations = map[string]bool{
+	IntervalAnnotation:      true,
+	PathAnnotation:          true,
+	ContactsAnnotation:      true,
+	RegionsAnnotation:       true,
+	KeywordAnnotation:       true,
+	HTTP2Annotation:         true,
+	StatusCodesAnnotation:   true,
+	ProvidersAnnotation:     true,
+	PriorityClassAnnotation: true,
+	PausedAnnotation:        true,
+	RemovalPolicyAnnotation: true,
+	TeamAnnotation:          true,
+	AdoptAnnotation:         true,
+}
+
+// ValidateAnnotations returns an error for each of the annotations of
+// ing which cruise would ignore, in whole or in part, when managing the
+// checks for its hosts. If providers is not nil, the providers
+// annotation must only name them.
+func ValidateAnnotations(ing *v1beta1.Ingress, providers []string) []error {
+	var errs []error
+	invalid := func(key, v string) {
+		errs = append(errs, fmt.Errorf("invalid %s %q", key, v))
+	}
+	var keys []string
+	for key := range ing.Annotations {
+		if strings.HasPrefix(key, annotationPrefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		v := ing.Annotations[key]
+		switch key {
+		case IntervalAnnotation:
+			if d, err := time.ParseDuration(v); err != nil || d <= 0 {
+				invalid(key, v)
+			}
+		case HTTP2Annotation, PausedAnnotation, AdoptAnnotation:
+			if _, err := strconv.ParseBool(v); err != nil {
+				invalid(key, v)
+			}
+		case StatusCodesAnnotation:
+			for _, s := range list(ing, key) {
+				if code, err := strconv.Atoi(s); err != nil || code < 100 || code > 599 {
+					invalid(key, s)
+				}
+			}
+		case PriorityClassAnnotation:
+			if _, ok := PriorityClasses[v]; !ok {
+				invalid(key, v)
+			}
+		case RemovalPolicyAnnotation:
+			if p := RemovalPolicy(v); p != RemovalPolicyDelete && p != RemovalPolicyPause {
+				invalid(key, v)
+			}
+		case ProvidersAnnotation:
+			if providers == nil {
+				continue
+			}
+			for _, p := range list(ing, key) {
+				if !contains(providers, p) {
+					errs = append(errs, fmt.Errorf("%s names unknown provider %q", key, p))
+				}
+			}
+		default:
+			if !annotations[key] {
+				errs = append(errs, fmt.Errorf("unknown annotation %s", key))
+			}
+		}
+	}
+	return errs
+}
+
+func contains(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
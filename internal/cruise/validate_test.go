@@ -0,0 +1,50 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cruise
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidateAnnotations(t *testing.T) {
+	ing := &v1beta1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				IntervalAnnotation:            "5m",
+				HTTP2Annotation:               "yes please",
+				StatusCodesAnnotation:         "200, 999",
+				PriorityClassAnnotation:       "high",
+				ProvidersAnnotation:           "pingdom,nagios",
+				"cruise.heptio.com/intervall": "1m",
+				"kubernetes.io/ingress.class": "nginx",
+			},
+		},
+	}
+	var msgs []string
+	for _, err := range ValidateAnnotations(ing, []string{"pingdom"}) {
+		msgs = append(msgs, err.Error())
+	}
+	assert.Equal(t, []string{
+		`invalid cruise.heptio.com/expected-status-codes "999"`,
+		`invalid cruise.heptio.com/http2 "yes please"`,
+		"unknown annotation cruise.heptio.com/intervall",
+		`cruise.heptio.com/providers names unknown provider "nagios"`,
+	}, msgs)
+
+	assert.Len(t, ValidateAnnotations(ing, nil), 3)
+}
@@ -0,0 +1,603 @@
+// Package datadog implements an UptimeChecker backed by Datadog Synthetics
+// HTTP API tests.
+package datadog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+)
+
+// DefaultBaseURL is the address of the Datadog API in the US1 site.
+const DefaultBaseURL = "https://api.datadoghq.com"
+
+// DefaultMessage is the default template of the notification message of
+// a test.
+const DefaultMessage = `{{.Name}} is down: {{.URL}} failed its uptime check.{{range .Contacts}} @{{.}}{{end}}`
+
+// pageSize is the number of tests requested per page when listing.
+const pageSize = 100
+
+// Tag keys recorded on each test.
+const (
+	clusterTag   = "cluster"
+	namespaceTag = "kube_namespace"
+	ingressTag   = "kube_ingress"
+	contactTag   = "cruise_contact"
+)
+
+// anyOK is the status code assertion of checks which accept any 2xx
+// status.
+const anyOK = `^2\d\d$`
+
+// Config configures a DatadogUptimeChecker.
+type Config struct {
+	// APIKey and AppKey are the Datadog API and application keys.
+	APIKey string
+	AppKey string
+
+	// Tag marks the tests owned by cruise. Tests without it are
+	// ignored, and never modified.
+	Tag string
+
+	// Cluster, if set, is recorded in each test's tags.
+	Cluster string
+
+	// Locations are the locations from which tests are run when a
+	// check does not specify its own regions, eg. "aws:us-east-1".
+	Locations []string
+
+	// Notify are the handles, without the leading "@", mentioned in the
+	// message of tests which do not specify their own contacts.
+	Notify []string
+
+	// Message is a text/template for the notification message of each
+	// test. It is executed with a MessageData. If empty DefaultMessage is
+	// used.
+	Message string
+
+	// MaxResponseTime, if positive, fails tests which take longer to
+	// respond.
+	MaxResponseTime time.Duration
+
+	// BaseURL, if set, overrides DefaultBaseURL.
+	BaseURL string
+}
+
+// MessageData is the data with which Config.Message is executed.
+type MessageData struct {
+	Name      string
+	Hostname  string
+	URL       string
+	Namespace string
+	Ingress   string
+	Cluster   string
+
+	// Contacts are the handles to notify, without the leading "@".
+	Contacts []string
+}
+
+type DatadogUptimeChecker struct {
+	config   Config
+	message  *template.Template
+	client   *http.Client
+	throttle *monitor.Throttle
+
+	uptimeChecks map[string]*monitor.UptimeCheck
+
+	// publicIDs maps hostnames to the public ID of their test.
+	publicIDs map[string]string
+}
+
+// NewDatadogUptimeChecker returns an UptimeChecker which manages the
+// Datadog Synthetics API tests tagged with config.Tag. Calls to the
+// Datadog API are limited to the rate given by limit.
+func NewDatadogUptimeChecker(ctx context.Context, config Config, limit monitor.RateLimit) (monitor.UptimeChecker, error) {
+	return newDatadogUptimeChecker(ctx, http.DefaultClient, config, limit)
+}
+
+func newDatadogUptimeChecker(ctx context.Context, client *http.Client, config Config, limit monitor.RateLimit) (*DatadogUptimeChecker, error) {
+	if config.BaseURL == "" {
+		config.BaseURL = DefaultBaseURL
+	}
+	if config.Tag == "" {
+		return nil, fmt.Errorf("datadog: an ownership tag is required")
+	}
+	if len(config.Locations) == 0 {
+		return nil, fmt.Errorf("datadog: at least one location is required")
+	}
+	if config.Message == "" {
+		config.Message = DefaultMessage
+	}
+	message, err := template.New("message").Parse(config.Message)
+	if err != nil {
+		return nil, fmt.Errorf("datadog: invalid message template: %v", err)
+	}
+	c := &DatadogUptimeChecker{
+		config:       config,
+		message:      message,
+		client:       client,
+		throttle:     monitor.NewThrottle(limit),
+		uptimeChecks: make(map[string]*monitor.UptimeCheck),
+		publicIDs:    make(map[string]string),
+	}
+	return c, c.SyncUptimeChecks(ctx)
+}
+
+func (c *DatadogUptimeChecker) UptimeChecks() map[string]*monitor.UptimeCheck {
+	return c.uptimeChecks
+}
+
+// test is a Synthetics API test as sent to and returned by the Datadog
+// API.
+type test struct {
+	PublicID  string      `json:"public_id,omitempty"`
+	Name      string      `json:"name"`
+	Type      string      `json:"type"`
+	Subtype   string      `json:"subtype"`
+	Status    string      `json:"status,omitempty"`
+	Message   string      `json:"message"`
+	Tags      []string    `json:"tags"`
+	Locations []string    `json:"locations"`
+	Config    testConfig  `json:"config"`
+	Options   testOptions `json:"options"`
+}
+
+type testConfig struct {
+	Request    request     `json:"request"`
+	Assertions []assertion `json:"assertions"`
+}
+
+type request struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+}
+
+type assertion struct {
+	Type     string      `json:"type"`
+	Operator string      `json:"operator"`
+	Target   interface{} `json:"target"`
+}
+
+type testOptions struct {
+	TickEvery   int    `json:"tick_every"`
+	HTTPVersion string `json:"http_version,omitempty"`
+}
+
+// Test statuses.
+const (
+	statusLive   = "live"
+	statusPaused = "paused"
+)
+
+func (c *DatadogUptimeChecker) SyncUptimeChecks(ctx context.Context) error {
+	checks := make(map[string]*monitor.UptimeCheck)
+	ids := make(map[string]string)
+	for page := 0; ; page++ {
+		var list struct {
+			Tests []test `json:"tests"`
+		}
+		query := url.Values{
+			"page_size":   {strconv.Itoa(pageSize)},
+			"page_number": {strconv.Itoa(page)},
+		}
+		if err := c.do(ctx, "list", "GET", "/api/v1/synthetics/tests?"+query.Encode(), nil, &list); err != nil {
+			return err
+		}
+		for _, t := range list.Tests {
+			if !c.owns(t) {
+				continue
+			}
+			if check := c.toUptimeCheck(t); check != nil {
+				checks[check.Hostname] = check
+				ids[check.Hostname] = t.PublicID
+			}
+		}
+		if len(list.Tests) < pageSize {
+			break
+		}
+	}
+	c.uptimeChecks = checks
+	c.publicIDs = ids
+	return nil
+}
+
+// owns reports whether t is an HTTP test tagged as being managed by
+// cruise.
+func (c *DatadogUptimeChecker) owns(t test) bool {
+	if t.Type != "api" || t.Subtype != "http" {
+		return false
+	}
+	for _, tag := range t.Tags {
+		if tag == c.config.Tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *DatadogUptimeChecker) CreateUptimeCheck(ctx context.Context, check *monitor.UptimeCheck) error {
+	t, err := c.test(check)
+	if err != nil {
+		return &monitor.Error{Kind: monitor.ValidationFailed, Op: "create", Err: err}
+	}
+	var created test
+	if err := c.do(ctx, "create", "POST", "/api/v1/synthetics/tests/api", t, &created); err != nil {
+		return err
+	}
+	if created.PublicID == "" {
+		return &monitor.Error{Kind: monitor.Unknown, Op: "create", Err: fmt.Errorf("no public id for created test")}
+	}
+	check.Cluster = c.config.Cluster
+	c.uptimeChecks[check.Hostname] = check
+	c.publicIDs[check.Hostname] = created.PublicID
+	return nil
+}
+
+// UpdateUptimeCheck modifies the existing test for check.Hostname to
+// match check.
+func (c *DatadogUptimeChecker) UpdateUptimeCheck(ctx context.Context, check *monitor.UptimeCheck) error {
+	id, exists := c.publicIDs[check.Hostname]
+	if !exists {
+		return &monitor.Error{Kind: monitor.NotFound, Op: "update", Err: fmt.Errorf("no check for %q", check.Hostname)}
+	}
+	t, err := c.test(check)
+	if err != nil {
+		return &monitor.Error{Kind: monitor.ValidationFailed, Op: "update", Err: err}
+	}
+	if err := c.do(ctx, "update", "PUT", "/api/v1/synthetics/tests/api/"+url.PathEscape(id), t, nil); err != nil {
+		return err
+	}
+	check.Cluster = c.config.Cluster
+	c.uptimeChecks[check.Hostname] = check
+	return nil
+}
+
+// Adopts returns false: only the tests tagged config.Tag are listed.
+func (c *DatadogUptimeChecker) Adopts() bool { return false }
+
+// CheckID returns the public ID of the test for hostName.
+func (c *DatadogUptimeChecker) CheckID(hostName string) string {
+	return c.publicIDs[hostName]
+}
+
+func (c *DatadogUptimeChecker) DeleteUptimeCheck(ctx context.Context, hostName string) error {
+	id, exists := c.publicIDs[hostName]
+	if !exists {
+		return nil
+	}
+
+	body := struct {
+		PublicIDs []string `json:"public_ids"`
+	}{[]string{id}}
+	err := c.do(ctx, "delete", "POST", "/api/v1/synthetics/tests/delete", body, nil)
+	if err != nil && !monitor.IsNotFound(err) {
+		return err
+	}
+
+	delete(c.uptimeChecks, hostName)
+	delete(c.publicIDs, hostName)
+	return nil
+}
+
+func (c *DatadogUptimeChecker) PauseUptimeCheck(ctx context.Context, hostName string) error {
+	return c.setPaused(ctx, "pause", hostName, true)
+}
+
+func (c *DatadogUptimeChecker) ResumeUptimeCheck(ctx context.Context, hostName string) error {
+	return c.setPaused(ctx, "resume", hostName, false)
+}
+
+func (c *DatadogUptimeChecker) setPaused(ctx context.Context, op, hostName string, paused bool) error {
+	check, exists := c.uptimeChecks[hostName]
+	if !exists {
+		return &monitor.Error{Kind: monitor.NotFound, Op: op, Err: fmt.Errorf("no check for %q", hostName)}
+	}
+	if check.Paused == paused {
+		return nil
+	}
+
+	body := struct {
+		NewStatus string `json:"new_status"`
+	}{statusLive}
+	if paused {
+		body.NewStatus = statusPaused
+	}
+	rsc := "/api/v1/synthetics/tests/" + url.PathEscape(c.publicIDs[hostName]) + "/status"
+	if err := c.do(ctx, op, "PUT", rsc, body, nil); err != nil {
+		return err
+	}
+	check.Paused = paused
+	return nil
+}
+
+// test returns the Datadog test which implements check.
+func (c *DatadogUptimeChecker) test(check *monitor.UptimeCheck) (*test, error) {
+	contacts := check.Contacts
+	if len(contacts) == 0 {
+		contacts = c.config.Notify
+	}
+	var message bytes.Buffer
+	err := c.message.Execute(&message, &MessageData{
+		Name:      check.Name,
+		Hostname:  check.Hostname,
+		URL:       testURL(check),
+		Namespace: check.Namespace,
+		Ingress:   check.Ingress,
+		Cluster:   c.config.Cluster,
+		Contacts:  contacts,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("message template: %v", err)
+	}
+
+	t := &test{
+		Name:      check.Name,
+		Type:      "api",
+		Subtype:   "http",
+		Status:    statusLive,
+		Message:   message.String(),
+		Tags:      c.tags(check),
+		Locations: check.Regions,
+		Config: testConfig{
+			Request: request{
+				Method: "GET",
+				URL:    testURL(check),
+			},
+			Assertions: c.assertions(check),
+		},
+		Options: testOptions{
+			TickEvery: tickEvery(check.CheckIntervalInMinutes),
+		},
+	}
+	if check.Paused {
+		t.Status = statusPaused
+	}
+	if len(t.Locations) == 0 {
+		t.Locations = c.config.Locations
+	}
+	if check.HTTP2 {
+		t.Options.HTTPVersion = "http2"
+	}
+	return t, nil
+}
+
+// tags returns the tags of the test for check. Explicit contacts are
+// recorded so that they can be recovered from the test.
+func (c *DatadogUptimeChecker) tags(check *monitor.UptimeCheck) []string {
+	tags := []string{c.config.Tag}
+	if c.config.Cluster != "" {
+		tags = append(tags, clusterTag+":"+c.config.Cluster)
+	}
+	if check.Namespace != "" {
+		tags = append(tags, namespaceTag+":"+check.Namespace)
+	}
+	if check.Ingress != "" {
+		tags = append(tags, ingressTag+":"+check.Ingress)
+	}
+	for _, contact := range check.Contacts {
+		tags = append(tags, contactTag+":"+contact)
+	}
+	return tags
+}
+
+func (c *DatadogUptimeChecker) assertions(check *monitor.UptimeCheck) []assertion {
+	var as []assertion
+	switch len(check.StatusCodes) {
+	case 0:
+		as = append(as, assertion{Type: "statusCode", Operator: "matches", Target: anyOK})
+	case 1:
+		as = append(as, assertion{Type: "statusCode", Operator: "is", Target: check.StatusCodes[0]})
+	default:
+		var codes []string
+		for _, code := range check.StatusCodes {
+			codes = append(codes, strconv.Itoa(code))
+		}
+		as = append(as, assertion{Type: "statusCode", Operator: "matches", Target: "^(" + strings.Join(codes, "|") + ")$"})
+	}
+	if c.config.MaxResponseTime > 0 {
+		ms := int(c.config.MaxResponseTime / time.Millisecond)
+		as = append(as, assertion{Type: "responseTime", Operator: "lessThan", Target: ms})
+	}
+	if check.Keyword != "" {
+		as = append(as, assertion{Type: "body", Operator: "contains", Target: check.Keyword})
+	}
+	return as
+}
+
+func testURL(check *monitor.UptimeCheck) string {
+	u := url.URL{
+		Scheme: "http",
+		Host:   check.Hostname,
+		Path:   check.Path,
+	}
+	if check.EnableTLS {
+		u.Scheme = "https"
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return u.String()
+}
+
+// tickEvery returns the interval, in seconds, of a test run every
+// minutes.
+func tickEvery(minutes int) int {
+	if minutes < 1 {
+		minutes = 1
+	}
+	return minutes * 60
+}
+
+var codesPattern = regexp.MustCompile(`^\^\(([0-9|]+)\)\$$`)
+
+// toUptimeCheck converts t to an UptimeCheck, or returns nil if t is not
+// a GET request for an HTTP(S) URL.
+func (c *DatadogUptimeChecker) toUptimeCheck(t test) *monitor.UptimeCheck {
+	if t.Config.Request.Method != "GET" {
+		return nil
+	}
+	u, err := url.Parse(t.Config.Request.URL)
+	if err != nil || u.Hostname() == "" {
+		return nil
+	}
+	path := u.Path
+	if path == "/" {
+		path = ""
+	}
+	minutes := t.Options.TickEvery / 60
+	if minutes < 1 {
+		minutes = 1
+	}
+	check := &monitor.UptimeCheck{
+		Hostname:               u.Hostname(),
+		Name:                   t.Name,
+		CheckIntervalInMinutes: minutes,
+		EnableTLS:              u.Scheme == "https",
+		Paused:                 t.Status == statusPaused,
+		Path:                   path,
+		HTTP2:                  t.Options.HTTPVersion == "http2",
+	}
+	if !sameStrings(t.Locations, c.config.Locations) {
+		check.Regions = t.Locations
+	}
+	for _, tag := range t.Tags {
+		parts := strings.SplitN(tag, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		switch parts[0] {
+		case clusterTag:
+			check.Cluster = parts[1]
+		case namespaceTag:
+			check.Namespace = parts[1]
+		case ingressTag:
+			check.Ingress = parts[1]
+		case contactTag:
+			check.Contacts = append(check.Contacts, parts[1])
+		}
+	}
+	for _, a := range t.Config.Assertions {
+		switch {
+		case a.Type == "statusCode" && a.Operator == "is":
+			if code, ok := a.Target.(float64); ok {
+				check.StatusCodes = []int{int(code)}
+			}
+		case a.Type == "statusCode" && a.Operator == "matches":
+			s, _ := a.Target.(string)
+			if m := codesPattern.FindStringSubmatch(s); m != nil {
+				check.StatusCodes = nil
+				for _, v := range strings.Split(m[1], "|") {
+					code, _ := strconv.Atoi(v)
+					check.StatusCodes = append(check.StatusCodes, code)
+				}
+			}
+		case a.Type == "body" && a.Operator == "contains":
+			check.Keyword, _ = a.Target.(string)
+		}
+	}
+	return check
+}
+
+func sameStrings(a, b []string) bool {
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	return len(a) == len(b) && (len(a) == 0 || reflect.DeepEqual(a, b))
+}
+
+// apiError is the body of an unsuccessful Datadog API response.
+type apiError struct {
+	StatusCode int
+	Errors     []string `json:"errors"`
+}
+
+func (e *apiError) Error() string {
+	msg := http.StatusText(e.StatusCode)
+	if len(e.Errors) > 0 {
+		msg = strings.Join(e.Errors, "; ")
+	}
+	return fmt.Sprintf("datadog: %d %s", e.StatusCode, msg)
+}
+
+// do performs a single Datadog API request bounded by ctx, sending body,
+// if any, as JSON and decoding the response into v. Any error is returned
+// as a *monitor.Error.
+func (c *DatadogUptimeChecker) do(ctx context.Context, op, method, rsc string, body, v interface{}) error {
+	if err := c.throttle.Wait(ctx, op); err != nil {
+		return err
+	}
+
+	var r io.Reader
+	if body != nil {
+		buf, err := json.Marshal(body)
+		if err != nil {
+			return &monitor.Error{Kind: monitor.Unknown, Op: op, Err: err}
+		}
+		r = bytes.NewReader(buf)
+	}
+	req, err := http.NewRequest(method, c.config.BaseURL+rsc, r)
+	if err != nil {
+		return &monitor.Error{Kind: monitor.Unknown, Op: op, Err: err}
+	}
+	req.Header.Set("DD-API-KEY", c.config.APIKey)
+	req.Header.Set("DD-APPLICATION-KEY", c.config.AppKey)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return monitor.Wrap(ctx, op, err)
+	}
+	defer resp.Body.Close()
+	c.throttle.Delay(retryAfter(resp))
+
+	if resp.StatusCode >= 300 {
+		e := &apiError{StatusCode: resp.StatusCode}
+		json.NewDecoder(resp.Body).Decode(e)
+		err := &monitor.Error{Kind: monitor.KindForStatus(resp.StatusCode), Op: op, Err: e}
+		if err.Kind == monitor.RateLimited {
+			err.RetryAfter = c.throttle.Backoff()
+		}
+		return err
+	}
+	if v == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return monitor.Wrap(ctx, op, err)
+	}
+	return nil
+}
+
+// retryAfter returns how long to wait before calling the API again
+// after Datadog rejected a call with 429 Too Many Requests: the number
+// of seconds until the current rate limit period ends, given by the
+// X-RateLimit-Reset header, or else by Retry-After. A successful call
+// which exhausts the limit does not back off, as the next call may
+// still be allowed once the period has ended.
+func retryAfter(resp *http.Response) time.Duration {
+	if resp.StatusCode != http.StatusTooManyRequests {
+		return 0
+	}
+	if reset, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Reset")); err == nil && reset > 0 {
+		return time.Duration(reset) * time.Second
+	}
+	return monitor.RetryAfterHeader(resp)
+}
@@ -0,0 +1,417 @@
+package datadog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+	"github.com/heptiolabs/cruise/internal/monitor/monitortest"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDatadog is an in memory stand in for the Datadog Synthetics API.
+type fakeDatadog struct {
+	mu      sync.Mutex
+	nextID  int
+	tests   map[string]test
+	perPage int
+	fail    func(*http.Request) int
+	header  http.Header
+	pages   int // number of list requests
+}
+
+func newFakeDatadog() *fakeDatadog {
+	return &fakeDatadog{
+		nextID:  1,
+		tests:   make(map[string]test),
+		perPage: 2,
+	}
+}
+
+func (f *fakeDatadog) add(t test) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t.PublicID = f.publicID()
+	f.tests[t.PublicID] = t
+}
+
+func (f *fakeDatadog) publicID() string {
+	id := fmt.Sprintf("abc-def-%03d", f.nextID)
+	f.nextID++
+	return id
+}
+
+const testsPath = "/api/v1/synthetics/tests"
+
+func (f *fakeDatadog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for k, v := range f.header {
+		w.Header()[k] = v
+	}
+	if r.Header.Get("DD-API-KEY") != "key" || r.Header.Get("DD-APPLICATION-KEY") != "app" {
+		writeError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+	if f.fail != nil {
+		if status := f.fail(r); status != 0 {
+			writeError(w, status, "fake error")
+			return
+		}
+	}
+
+	switch {
+	case r.Method == "GET" && r.URL.Path == testsPath:
+		f.pages++
+		var ids []string
+		for id := range f.tests {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		size, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+		if size > f.perPage {
+			size = f.perPage
+		}
+		page, _ := strconv.Atoi(r.URL.Query().Get("page_number"))
+		tests := []test{}
+		for i, id := range ids {
+			if i/size == page {
+				tests = append(tests, f.tests[id])
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"tests": tests})
+	case r.Method == "POST" && r.URL.Path == testsPath+"/api":
+		var t test
+		if err := json.NewDecoder(r.Body).Decode(&t); err != nil || t.Config.Request.URL == "" || len(t.Locations) == 0 {
+			writeError(w, http.StatusBadRequest, "invalid test")
+			return
+		}
+		t.PublicID = f.publicID()
+		f.tests[t.PublicID] = t
+		writeJSON(w, http.StatusOK, t)
+	case r.Method == "PUT" && strings.HasPrefix(r.URL.Path, testsPath+"/api/"):
+		id := strings.TrimPrefix(r.URL.Path, testsPath+"/api/")
+		if _, ok := f.tests[id]; !ok {
+			writeError(w, http.StatusNotFound, "Synthetics test not found")
+			return
+		}
+		var t test
+		if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid test")
+			return
+		}
+		t.PublicID = id
+		f.tests[id] = t
+		writeJSON(w, http.StatusOK, t)
+	case r.Method == "PUT" && strings.HasSuffix(r.URL.Path, "/status"):
+		id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, testsPath+"/"), "/status")
+		t, ok := f.tests[id]
+		if !ok {
+			writeError(w, http.StatusNotFound, "Synthetics test not found")
+			return
+		}
+		var body struct {
+			NewStatus string `json:"new_status"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		t.Status = body.NewStatus
+		f.tests[id] = t
+		writeJSON(w, http.StatusOK, true)
+	case r.Method == "POST" && r.URL.Path == testsPath+"/delete":
+		var body struct {
+			PublicIDs []string `json:"public_ids"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		for _, id := range body.PublicIDs {
+			if _, ok := f.tests[id]; !ok {
+				writeError(w, http.StatusNotFound, "Synthetics test not found")
+				return
+			}
+		}
+		for _, id := range body.PublicIDs {
+			delete(f.tests, id)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{})
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]interface{}{"errors": []string{msg}})
+}
+
+func newFakeChecker(t *testing.T, f *fakeDatadog, config Config) (*DatadogUptimeChecker, *httptest.Server) {
+	t.Helper()
+	srv := httptest.NewServer(f)
+	config.BaseURL = srv.URL
+	if config.APIKey == "" {
+		config.APIKey = "key"
+	}
+	if config.AppKey == "" {
+		config.AppKey = "app"
+	}
+	if config.Tag == "" {
+		config.Tag = "managed-by:cruise"
+	}
+	if len(config.Locations) == 0 {
+		config.Locations = []string{"aws:us-east-1"}
+	}
+	c, err := newDatadogUptimeChecker(context.Background(), srv.Client(), config, monitor.RateLimit{})
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	return c, srv
+}
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDatadogUptimeChecker(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeDatadog()
+	config := Config{
+		Cluster:         "prod",
+		Notify:          []string{"slack-ops"},
+		MaxResponseTime: 2 * time.Second,
+	}
+	c, srv := newFakeChecker(t, f, config)
+	defer srv.Close()
+
+	uc := &monitor.UptimeCheck{
+		Hostname:               "example.com",
+		Name:                   "mynamespace/example (example.com:443)",
+		EnableTLS:              true,
+		CheckIntervalInMinutes: 5,
+		Path:                   "/healthz",
+		Keyword:                "ok",
+		HTTP2:                  true,
+		Namespace:              "mynamespace",
+		Ingress:                "example",
+	}
+	check(t, c.CreateUptimeCheck(ctx, uc))
+	assert.Equal(t, "abc-def-001", c.CheckID("example.com"))
+	assert.Equal(t, "prod", uc.Cluster)
+
+	created := f.tests["abc-def-001"]
+	assert.Equal(t, "api", created.Type)
+	assert.Equal(t, "http", created.Subtype)
+	assert.Equal(t, "live", created.Status)
+	assert.Equal(t, "https://example.com/healthz", created.Config.Request.URL)
+	assert.Equal(t, 300, created.Options.TickEvery)
+	assert.Equal(t, "http2", created.Options.HTTPVersion)
+	assert.Equal(t, []string{"aws:us-east-1"}, created.Locations)
+	assert.Equal(t, []string{"managed-by:cruise", "cluster:prod", "kube_namespace:mynamespace", "kube_ingress:example"}, created.Tags)
+	assert.Equal(t, "mynamespace/example (example.com:443) is down: https://example.com/healthz failed its uptime check. @slack-ops", created.Message)
+	assert.Equal(t, []assertion{
+		{Type: "statusCode", Operator: "matches", Target: anyOK},
+		{Type: "responseTime", Operator: "lessThan", Target: float64(2000)},
+		{Type: "body", Operator: "contains", Target: "ok"},
+	}, created.Config.Assertions)
+
+	n, srv2 := newFakeChecker(t, f, config)
+	defer srv2.Close()
+	synced := n.UptimeChecks()["example.com"]
+	assert.Equal(t, uc, synced)
+
+	updated := &monitor.UptimeCheck{
+		Hostname:               "example.com",
+		Name:                   "renamed",
+		CheckIntervalInMinutes: 1,
+		Contacts:               []string{"pagerduty-web"},
+		Regions:                []string{"aws:eu-west-1"},
+		StatusCodes:            []int{301, 302},
+	}
+	check(t, n.UpdateUptimeCheck(ctx, updated))
+	test := f.tests["abc-def-001"]
+	assert.Equal(t, "renamed", test.Name)
+	assert.Equal(t, "http://example.com/", test.Config.Request.URL)
+	assert.Equal(t, 60, test.Options.TickEvery)
+	assert.Equal(t, []string{"aws:eu-west-1"}, test.Locations)
+	assert.Contains(t, test.Tags, "cruise_contact:pagerduty-web")
+	assert.True(t, strings.HasSuffix(test.Message, " @pagerduty-web"), test.Message)
+
+	n, srv3 := newFakeChecker(t, f, config)
+	defer srv3.Close()
+	assert.Equal(t, updated, n.UptimeChecks()["example.com"])
+
+	check(t, n.PauseUptimeCheck(ctx, "example.com"))
+	assert.Equal(t, "paused", f.tests["abc-def-001"].Status)
+	check(t, n.ResumeUptimeCheck(ctx, "example.com"))
+	assert.Equal(t, "live", f.tests["abc-def-001"].Status)
+
+	check(t, n.DeleteUptimeCheck(ctx, "example.com"))
+	assert.Empty(t, f.tests)
+	assert.Nil(t, n.UptimeChecks()["example.com"])
+}
+
+func TestDatadogStatusCodes(t *testing.T) {
+	f := newFakeDatadog()
+	c, srv := newFakeChecker(t, f, Config{})
+	defer srv.Close()
+
+	for _, codes := range [][]int{nil, {200}, {301, 302}} {
+		uc := &monitor.UptimeCheck{Hostname: "example.com", Name: "example", CheckIntervalInMinutes: 1, StatusCodes: codes}
+		check(t, c.CreateUptimeCheck(context.Background(), uc))
+		n, srv := newFakeChecker(t, f, Config{})
+		assert.Equal(t, codes, n.UptimeChecks()["example.com"].StatusCodes)
+		srv.Close()
+		check(t, c.DeleteUptimeCheck(context.Background(), "example.com"))
+	}
+}
+
+func TestDatadogMessage(t *testing.T) {
+	f := newFakeDatadog()
+	c, srv := newFakeChecker(t, f, Config{
+		Cluster: "prod",
+		Message: "{{.Hostname}} in {{.Cluster}}/{{.Namespace}}/{{.Ingress}} is down",
+	})
+	defer srv.Close()
+
+	check(t, c.CreateUptimeCheck(context.Background(), &monitor.UptimeCheck{Hostname: "example.com", Namespace: "ns", Ingress: "web"}))
+	assert.Equal(t, "example.com in prod/ns/web is down", f.tests["abc-def-001"].Message)
+
+	_, err := newDatadogUptimeChecker(context.Background(), srv.Client(), Config{Tag: "t", Locations: []string{"l"}, Message: "{{.Bogus"}, monitor.RateLimit{})
+	assert.Error(t, err)
+}
+
+func TestDatadogOwnership(t *testing.T) {
+	f := newFakeDatadog()
+	ours := test{
+		Name:      "ours",
+		Type:      "api",
+		Subtype:   "http",
+		Tags:      []string{"team:web", "managed-by:cruise"},
+		Locations: []string{"aws:us-east-1"},
+		Config:    testConfig{Request: request{Method: "GET", URL: "https://ours.example.com/"}},
+		Options:   testOptions{TickEvery: 300},
+	}
+	f.add(ours)
+	theirs := ours
+	theirs.Config.Request.URL = "https://theirs.example.com/"
+	theirs.Tags = []string{"team:web"}
+	f.add(theirs)
+	browser := ours
+	browser.Type = "browser"
+	browser.Config.Request.URL = "https://browser.example.com/"
+	f.add(browser)
+
+	c, srv := newFakeChecker(t, f, Config{})
+	defer srv.Close()
+
+	assert.Len(t, c.UptimeChecks(), 1)
+	assert.Contains(t, c.UptimeChecks(), "ours.example.com")
+}
+
+func TestDatadogPagination(t *testing.T) {
+	f := newFakeDatadog()
+	for _, h := range []string{"a", "b", "c", "d", "e"} {
+		f.add(test{
+			Name:      h,
+			Type:      "api",
+			Subtype:   "http",
+			Tags:      []string{"managed-by:cruise"},
+			Locations: []string{"aws:us-east-1"},
+			Config:    testConfig{Request: request{Method: "GET", URL: "http://" + h + ".example.com/"}},
+			Options:   testOptions{TickEvery: 60},
+		})
+	}
+
+	c, srv := newFakeChecker(t, f, Config{})
+	defer srv.Close()
+
+	// the fake returns pages of two tests whatever the requested size,
+	// so listing stops at the first short page.
+	assert.Equal(t, 1, f.pages)
+	assert.Len(t, c.UptimeChecks(), 2)
+}
+
+func TestDatadogErrorKinds(t *testing.T) {
+	tests := map[int]monitor.ErrorKind{
+		http.StatusForbidden:           monitor.AuthFailed,
+		http.StatusTooManyRequests:     monitor.RateLimited,
+		http.StatusBadRequest:          monitor.ValidationFailed,
+		http.StatusInternalServerError: monitor.Transient,
+	}
+
+	for status, want := range tests {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			f := newFakeDatadog()
+			c, srv := newFakeChecker(t, f, Config{})
+			defer srv.Close()
+
+			f.fail = func(r *http.Request) int {
+				if r.Method == "POST" {
+					return status
+				}
+				return 0
+			}
+			err := c.CreateUptimeCheck(context.Background(), &monitor.UptimeCheck{Hostname: "example.com", Name: "example"})
+			assert.Equal(t, want, monitor.KindOf(err))
+			assert.Contains(t, err.Error(), "fake error")
+		})
+	}
+}
+
+func TestDatadogContract(t *testing.T) {
+	monitortest.Run(t, func() monitortest.Backend {
+		f := newFakeDatadog()
+		return monitortest.Backend{
+			New: func(t *testing.T) (monitor.UptimeChecker, *httptest.Server) {
+				return newFakeChecker(t, f, Config{})
+			},
+			Len: func() int { return len(f.tests) },
+			AddUnowned: func(hostname string) {
+				f.add(test{
+					Name:      hostname,
+					Type:      "api",
+					Subtype:   "http",
+					Tags:      []string{"team:web"},
+					Locations: []string{"aws:us-east-1"},
+					Config:    testConfig{Request: request{Method: "GET", URL: "https://" + hostname + "/"}},
+					Options:   testOptions{TickEvery: 300},
+				})
+			},
+			RateLimit: func() {
+				f.header = http.Header{"X-Ratelimit-Reset": []string{"120"}}
+				f.fail = func(r *http.Request) int { return http.StatusTooManyRequests }
+			},
+		}
+	})
+}
+
+func TestDatadogLimitExhausted(t *testing.T) {
+	f := newFakeDatadog()
+	c, srv := newFakeChecker(t, f, Config{})
+	defer srv.Close()
+
+	// the last call allowed in this period succeeds; the next is not
+	// refused by cruise, only by Datadog if the period has not ended.
+	f.header = http.Header{
+		"X-Ratelimit-Remaining": []string{"0"},
+		"X-Ratelimit-Reset":     []string{"120"},
+	}
+	check(t, c.CreateUptimeCheck(context.Background(), &monitor.UptimeCheck{Hostname: "example.com", Name: "example"}))
+	check(t, c.SyncUptimeChecks(context.Background()))
+}
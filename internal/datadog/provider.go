@@ -0,0 +1,36 @@
+package datadog
+
+import (
+	"context"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+	"github.com/heptiolabs/cruise/internal/secret"
+)
+
+func init() {
+	monitor.Register("datadog", func() monitor.Provider { return new(provider) })
+}
+
+// provider configures a DatadogUptimeChecker from command line flags.
+type provider struct {
+	config         Config
+	apikey, appkey secret.Value
+}
+
+func (p *provider) Flags(fs monitor.FlagSet) {
+	p.apikey.Flags(fs, "datadog-apikey", "Datadog API key", "DATADOG_APIKEY")
+	p.appkey.Flags(fs, "datadog-appkey", "Datadog application key", "DATADOG_APPKEY")
+	fs.Flag("datadog-tag", "tag marking the Datadog Synthetics tests managed by cruise").Default("managed-by:cruise").StringVar(&p.config.Tag)
+	fs.Flag("datadog-location", "location from which tests are run by default, may be repeated").Default("aws:us-east-1").StringsVar(&p.config.Locations)
+	fs.Flag("datadog-notify", "handle, without the leading @, notified by default when a test fails, may be repeated").StringsVar(&p.config.Notify)
+	fs.Flag("datadog-message", "text/template for the notification message of each test").Default(DefaultMessage).StringVar(&p.config.Message)
+	fs.Flag("datadog-max-response-time", "fail tests which take longer to respond, 0 to disable").Default("10s").DurationVar(&p.config.MaxResponseTime)
+	fs.Flag("datadog-url", "Datadog API base URL, eg. https://api.datadoghq.eu for the EU site").Default(DefaultBaseURL).StringVar(&p.config.BaseURL)
+}
+
+func (p *provider) New(ctx context.Context, opts monitor.Options) (monitor.UptimeChecker, error) {
+	config := p.config
+	config.APIKey, config.AppKey = p.apikey.Secret(), p.appkey.Secret()
+	config.Cluster = opts.Cluster
+	return NewDatadogUptimeChecker(ctx, config, opts.RateLimit)
+}
@@ -0,0 +1,390 @@
+// Package gatus implements an UptimeChecker which renders checks as the
+// endpoints of a Gatus configuration file stored in a ConfigMap.
+package gatus
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/heptiolabs/cruise/internal/monitor"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// header is written at the top of the configuration file.
+const header = "# Generated by cruise from the cluster's Ingresses; changes are overwritten.\n"
+
+// Config configures a GatusUptimeChecker.
+type Config struct {
+	// Namespace and ConfigMap name the ConfigMap which holds the
+	// configuration file, under Key. Cruise owns the whole file; other
+	// Gatus configuration belongs in a separate file.
+	Namespace string
+	ConfigMap string
+	Key       string
+
+	// Conditions are added to the conditions of every endpoint, eg.
+	// "[RESPONSE_TIME] < 1000".
+	Conditions []string
+
+	// CertificateExpiry, if positive, fails TLS endpoints whose
+	// certificate expires sooner.
+	CertificateExpiry time.Duration
+
+	// Alerts are the types of the alerts, eg. "slack", raised for
+	// endpoints which do not specify their own contacts.
+	Alerts []string
+}
+
+// config is the part of a Gatus configuration file written by cruise.
+type config struct {
+	Endpoints []endpoint `json:"endpoints"`
+}
+
+type endpoint struct {
+	Name       string   `json:"name"`
+	Group      string   `json:"group,omitempty"`
+	URL        string   `json:"url"`
+	Enabled    *bool    `json:"enabled,omitempty"`
+	Interval   string   `json:"interval,omitempty"`
+	Conditions []string `json:"conditions"`
+	Alerts     []alert  `json:"alerts,omitempty"`
+}
+
+type alert struct {
+	Type string `json:"type"`
+}
+
+type GatusUptimeChecker struct {
+	config       Config
+	client       corev1.ConfigMapInterface
+	throttle     *monitor.Throttle
+	uptimeChecks map[string]*monitor.UptimeCheck
+}
+
+// NewGatusUptimeChecker returns an UptimeChecker which renders checks as
+// Gatus endpoints in the ConfigMap described by config, using the
+// Kubernetes API described by opts.
+func NewGatusUptimeChecker(ctx context.Context, config Config, opts monitor.Options) (monitor.UptimeChecker, error) {
+	if opts.KubeConfig == nil {
+		return nil, fmt.Errorf("gatus: access to a cluster is required")
+	}
+	client, err := corev1.NewForConfig(opts.KubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	return newGatusUptimeChecker(ctx, client.ConfigMaps(config.Namespace), config, opts.RateLimit)
+}
+
+func newGatusUptimeChecker(ctx context.Context, client corev1.ConfigMapInterface, config Config, limit monitor.RateLimit) (*GatusUptimeChecker, error) {
+	if config.ConfigMap == "" {
+		return nil, fmt.Errorf("gatus: a ConfigMap is required")
+	}
+	if config.Key == "" {
+		config.Key = "cruise.yaml"
+	}
+	c := &GatusUptimeChecker{
+		config:       config,
+		client:       client,
+		throttle:     monitor.NewThrottle(limit),
+		uptimeChecks: make(map[string]*monitor.UptimeCheck),
+	}
+	return c, c.SyncUptimeChecks(ctx)
+}
+
+func (c *GatusUptimeChecker) UptimeChecks() map[string]*monitor.UptimeCheck {
+	return c.uptimeChecks
+}
+
+func (c *GatusUptimeChecker) SyncUptimeChecks(ctx context.Context) error {
+	cm, err := c.get(ctx)
+	if err != nil || cm == nil {
+		return err
+	}
+	var conf config
+	if err := yaml.Unmarshal([]byte(cm.Data[c.config.Key]), &conf); err != nil {
+		return &monitor.Error{Kind: monitor.ValidationFailed, Op: "list", Err: fmt.Errorf("%s/%s: %v", c.config.Namespace, c.config.ConfigMap, err)}
+	}
+	checks := make(map[string]*monitor.UptimeCheck)
+	for _, e := range conf.Endpoints {
+		if check := c.toUptimeCheck(e); check != nil {
+			checks[check.Hostname] = check
+		}
+	}
+	c.uptimeChecks = checks
+	return nil
+}
+
+func (c *GatusUptimeChecker) CreateUptimeCheck(ctx context.Context, check *monitor.UptimeCheck) error {
+	return c.put(ctx, "create", check)
+}
+
+// UpdateUptimeCheck replaces the endpoint for check.Hostname with check.
+func (c *GatusUptimeChecker) UpdateUptimeCheck(ctx context.Context, check *monitor.UptimeCheck) error {
+	if _, exists := c.uptimeChecks[check.Hostname]; !exists {
+		return &monitor.Error{Kind: monitor.NotFound, Op: "update", Err: fmt.Errorf("no check for %q", check.Hostname)}
+	}
+	return c.put(ctx, "update", check)
+}
+
+func (c *GatusUptimeChecker) DeleteUptimeCheck(ctx context.Context, hostName string) error {
+	if _, exists := c.uptimeChecks[hostName]; !exists {
+		return nil
+	}
+	checks := c.copyChecks()
+	delete(checks, hostName)
+	return c.apply(ctx, "delete", checks)
+}
+
+func (c *GatusUptimeChecker) PauseUptimeCheck(ctx context.Context, hostName string) error {
+	return c.setPaused(ctx, "pause", hostName, true)
+}
+
+func (c *GatusUptimeChecker) ResumeUptimeCheck(ctx context.Context, hostName string) error {
+	return c.setPaused(ctx, "resume", hostName, false)
+}
+
+func (c *GatusUptimeChecker) setPaused(ctx context.Context, op, hostName string, paused bool) error {
+	existing, exists := c.uptimeChecks[hostName]
+	if !exists {
+		return &monitor.Error{Kind: monitor.NotFound, Op: op, Err: fmt.Errorf("no check for %q", hostName)}
+	}
+	if existing.Paused == paused {
+		return nil
+	}
+	check := *existing
+	check.Paused = paused
+	return c.put(ctx, op, &check)
+}
+
+// put stores check, replacing any existing check for its hostname.
+func (c *GatusUptimeChecker) put(ctx context.Context, op string, check *monitor.UptimeCheck) error {
+	if check.HTTP2 {
+		return &monitor.Error{Kind: monitor.ValidationFailed, Op: op, Err: fmt.Errorf("gatus cannot require HTTP/2 for %s", check.Hostname)}
+	}
+	checks := c.copyChecks()
+	checks[check.Hostname] = check
+	return c.apply(ctx, op, checks)
+}
+
+// apply renders checks into the ConfigMap and, if it is stored
+// successfully, adopts them as the current set of checks.
+func (c *GatusUptimeChecker) apply(ctx context.Context, op string, checks map[string]*monitor.UptimeCheck) error {
+	var hosts []string
+	for host := range checks {
+		hosts = append(hosts, host)
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		a, b := checks[hosts[i]], checks[hosts[j]]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return hosts[i] < hosts[j]
+	})
+	conf := config{Endpoints: []endpoint{}}
+	for _, host := range hosts {
+		conf.Endpoints = append(conf.Endpoints, c.endpoint(checks[host]))
+	}
+	buf, err := yaml.Marshal(&conf)
+	if err != nil {
+		return &monitor.Error{Kind: monitor.Unknown, Op: op, Err: err}
+	}
+
+	cm, err := c.get(ctx)
+	if err != nil {
+		return err
+	}
+	if cm == nil {
+		cm = &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      c.config.ConfigMap,
+				Namespace: c.config.Namespace,
+				Labels:    map[string]string{"app.kubernetes.io/managed-by": "cruise"},
+			},
+		}
+	}
+	if cm.Data == nil {
+		cm.Data = make(map[string]string)
+	}
+	cm.Data[c.config.Key] = header + string(buf)
+
+	if err := c.throttle.Wait(ctx, op); err != nil {
+		return err
+	}
+	if cm.ResourceVersion == "" {
+		_, err = c.client.Create(cm)
+	} else {
+		_, err = c.client.Update(cm)
+	}
+	if err != nil {
+		return monitor.WrapKube(ctx, op, err)
+	}
+	c.uptimeChecks = checks
+	return nil
+}
+
+// get returns the ConfigMap, or nil if it does not exist.
+func (c *GatusUptimeChecker) get(ctx context.Context) (*v1.ConfigMap, error) {
+	if err := c.throttle.Wait(ctx, "get"); err != nil {
+		return nil, err
+	}
+	cm, err := c.client.Get(c.config.ConfigMap, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, monitor.WrapKube(ctx, "get", err)
+	}
+	return cm, nil
+}
+
+func (c *GatusUptimeChecker) copyChecks() map[string]*monitor.UptimeCheck {
+	checks := make(map[string]*monitor.UptimeCheck, len(c.uptimeChecks))
+	for host, check := range c.uptimeChecks {
+		checks[host] = check
+	}
+	return checks
+}
+
+// endpoint returns the Gatus endpoint for check. Endpoints are grouped
+// by the namespace of their Ingress.
+func (c *GatusUptimeChecker) endpoint(check *monitor.UptimeCheck) endpoint {
+	e := endpoint{
+		Name:       check.Name,
+		Group:      check.Namespace,
+		URL:        endpointURL(check),
+		Interval:   formatDuration(time.Duration(interval(check)) * time.Minute),
+		Conditions: []string{statusCondition(check.StatusCodes)},
+	}
+	if check.Paused {
+		disabled := false
+		e.Enabled = &disabled
+	}
+	if check.Keyword != "" {
+		e.Conditions = append(e.Conditions, "[BODY] == pat(*"+check.Keyword+"*)")
+	}
+	if check.EnableTLS && c.config.CertificateExpiry > 0 {
+		e.Conditions = append(e.Conditions, "[CERTIFICATE_EXPIRATION] > "+formatDuration(c.config.CertificateExpiry))
+	}
+	e.Conditions = append(e.Conditions, c.config.Conditions...)
+
+	contacts := check.Contacts
+	if len(contacts) == 0 {
+		contacts = c.config.Alerts
+	}
+	for _, t := range contacts {
+		e.Alerts = append(e.Alerts, alert{Type: t})
+	}
+	return e
+}
+
+// statusCondition returns the condition on the status of the response
+// which passes for codes, or any 2xx status if codes is empty.
+func statusCondition(codes []int) string {
+	switch len(codes) {
+	case 0:
+		return "[STATUS] < 300"
+	case 1:
+		return "[STATUS] == " + strconv.Itoa(codes[0])
+	}
+	var s []string
+	for _, code := range codes {
+		s = append(s, strconv.Itoa(code))
+	}
+	return "[STATUS] == any(" + strings.Join(s, ", ") + ")"
+}
+
+var (
+	statusPattern  = regexp.MustCompile(`^\[STATUS\] == (?:(\d+)|any\(([\d, ]+)\))$`)
+	keywordPattern = regexp.MustCompile(`^\[BODY\] == pat\(\*(.*)\*\)$`)
+)
+
+// toUptimeCheck converts e to an UptimeCheck, or returns nil if e is not
+// for an HTTP(S) URL.
+func (c *GatusUptimeChecker) toUptimeCheck(e endpoint) *monitor.UptimeCheck {
+	u, err := url.Parse(e.URL)
+	if err != nil || u.Hostname() == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil
+	}
+	path := u.Path
+	if path == "/" {
+		path = ""
+	}
+	minutes := 1
+	if d, err := time.ParseDuration(e.Interval); err == nil && d >= time.Minute {
+		minutes = int(d / time.Minute)
+	}
+	check := &monitor.UptimeCheck{
+		Hostname:               u.Hostname(),
+		Name:                   e.Name,
+		CheckIntervalInMinutes: minutes,
+		EnableTLS:              u.Scheme == "https",
+		Paused:                 e.Enabled != nil && !*e.Enabled,
+		Path:                   path,
+		Namespace:              e.Group,
+	}
+	for _, cond := range e.Conditions {
+		if m := statusPattern.FindStringSubmatch(cond); m != nil {
+			for _, v := range strings.Split(m[1]+m[2], ",") {
+				code, _ := strconv.Atoi(strings.TrimSpace(v))
+				check.StatusCodes = append(check.StatusCodes, code)
+			}
+		}
+		if m := keywordPattern.FindStringSubmatch(cond); m != nil {
+			check.Keyword = m[1]
+		}
+	}
+	var types []string
+	for _, a := range e.Alerts {
+		types = append(types, a.Type)
+	}
+	if !reflect.DeepEqual(types, c.config.Alerts) && len(types)+len(c.config.Alerts) > 0 {
+		check.Contacts = types
+	}
+	return check
+}
+
+func endpointURL(check *monitor.UptimeCheck) string {
+	u := url.URL{
+		Scheme: "http",
+		Host:   check.Hostname,
+		Path:   check.Path,
+	}
+	if check.EnableTLS {
+		u.Scheme = "https"
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return u.String()
+}
+
+func interval(check *monitor.UptimeCheck) int {
+	if check.CheckIntervalInMinutes < 1 {
+		return 1
+	}
+	return check.CheckIntervalInMinutes
+}
+
+// formatDuration formats d without trailing zero units, eg. "5m" rather
+// than "5m0s".
+func formatDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = s[:len(s)-2]
+	}
+	return s
+}
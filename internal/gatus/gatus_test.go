@@ -0,0 +1,240 @@
+package gatus
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/heptiolabs/cruise/internal/monitor"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fakeConfigMaps is an in memory corev1.ConfigMapInterface.
+type fakeConfigMaps struct {
+	corev1.ConfigMapInterface // unused methods panic
+	configMaps                map[string]*v1.ConfigMap
+	version                   int
+	err                       error
+}
+
+func newFakeConfigMaps() *fakeConfigMaps {
+	return &fakeConfigMaps{configMaps: make(map[string]*v1.ConfigMap)}
+}
+
+var configMapGR = schema.GroupResource{Resource: "configmaps"}
+
+func (f *fakeConfigMaps) Get(name string, opts metav1.GetOptions) (*v1.ConfigMap, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	cm, ok := f.configMaps[name]
+	if !ok {
+		return nil, apierrors.NewNotFound(configMapGR, name)
+	}
+	return cm.DeepCopy(), nil
+}
+
+func (f *fakeConfigMaps) Create(cm *v1.ConfigMap) (*v1.ConfigMap, error) {
+	if _, ok := f.configMaps[cm.Name]; ok {
+		return nil, apierrors.NewAlreadyExists(configMapGR, cm.Name)
+	}
+	f.version++
+	cm.ResourceVersion = strconv.Itoa(f.version)
+	f.configMaps[cm.Name] = cm.DeepCopy()
+	return cm, nil
+}
+
+func (f *fakeConfigMaps) Update(cm *v1.ConfigMap) (*v1.ConfigMap, error) {
+	existing, ok := f.configMaps[cm.Name]
+	if !ok {
+		return nil, apierrors.NewNotFound(configMapGR, cm.Name)
+	}
+	if existing.ResourceVersion != cm.ResourceVersion {
+		return nil, apierrors.NewConflict(configMapGR, cm.Name, nil)
+	}
+	f.version++
+	cm.ResourceVersion = strconv.Itoa(f.version)
+	f.configMaps[cm.Name] = cm.DeepCopy()
+	return cm, nil
+}
+
+func newFakeChecker(t *testing.T, f *fakeConfigMaps, config Config) *GatusUptimeChecker {
+	t.Helper()
+	config.Namespace = "monitoring"
+	config.ConfigMap = "gatus"
+	c, err := newGatusUptimeChecker(context.Background(), f, config, monitor.RateLimit{})
+	check(t, err)
+	return c
+}
+
+func endpoints(t *testing.T, f *fakeConfigMaps) []endpoint {
+	t.Helper()
+	data := f.configMaps["gatus"].Data["cruise.yaml"]
+	assert.True(t, strings.HasPrefix(data, header))
+	var conf config
+	check(t, yaml.Unmarshal([]byte(data), &conf))
+	return conf.Endpoints
+}
+
+func TestGatusUptimeChecker(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeConfigMaps()
+	config := Config{
+		Conditions:        []string{"[RESPONSE_TIME] < 1000"},
+		CertificateExpiry: 48 * time.Hour,
+		Alerts:            []string{"slack"},
+	}
+	c := newFakeChecker(t, f, config)
+	assert.Empty(t, c.UptimeChecks())
+
+	b := &monitor.UptimeCheck{
+		Hostname:               "b.example.com",
+		Name:                   "web/b (b.example.com:443)",
+		EnableTLS:              true,
+		CheckIntervalInMinutes: 5,
+		Path:                   "/healthz",
+		Keyword:                "ok",
+		StatusCodes:            []int{200, 301},
+		Namespace:              "web",
+	}
+	check(t, c.CreateUptimeCheck(ctx, b))
+	a := &monitor.UptimeCheck{
+		Hostname:               "a.example.com",
+		Name:                   "web/a (a.example.com:80)",
+		CheckIntervalInMinutes: 1,
+		Contacts:               []string{"pagerduty"},
+		Namespace:              "web",
+	}
+	check(t, c.CreateUptimeCheck(ctx, a))
+	z := &monitor.UptimeCheck{
+		Hostname:               "z.example.com",
+		Name:                   "api/z (z.example.com:80)",
+		CheckIntervalInMinutes: 60,
+		Namespace:              "api",
+	}
+	check(t, c.CreateUptimeCheck(ctx, z))
+
+	cm := f.configMaps["gatus"]
+	assert.Equal(t, "monitoring", cm.Namespace)
+	assert.Equal(t, "cruise", cm.Labels["app.kubernetes.io/managed-by"])
+
+	es := endpoints(t, f)
+	if assert.Len(t, es, 3) {
+		assert.Equal(t, endpoint{
+			Name:       "api/z (z.example.com:80)",
+			Group:      "api",
+			URL:        "http://z.example.com/",
+			Interval:   "1h",
+			Conditions: []string{"[STATUS] < 300", "[RESPONSE_TIME] < 1000"},
+			Alerts:     []alert{{Type: "slack"}},
+		}, es[0])
+		assert.Equal(t, "web", es[1].Group)
+		assert.Equal(t, []alert{{Type: "pagerduty"}}, es[1].Alerts)
+		assert.Equal(t, endpoint{
+			Name:     "web/b (b.example.com:443)",
+			Group:    "web",
+			URL:      "https://b.example.com/healthz",
+			Interval: "5m",
+			Conditions: []string{
+				"[STATUS] == any(200, 301)",
+				"[BODY] == pat(*ok*)",
+				"[CERTIFICATE_EXPIRATION] > 48h",
+				"[RESPONSE_TIME] < 1000",
+			},
+			Alerts: []alert{{Type: "slack"}},
+		}, es[2])
+	}
+
+	// the ConfigMap is the source of truth for a new checker.
+	n := newFakeChecker(t, f, config)
+	assert.Equal(t, map[string]*monitor.UptimeCheck{
+		"a.example.com": a,
+		"b.example.com": b,
+		"z.example.com": z,
+	}, n.UptimeChecks())
+
+	check(t, n.PauseUptimeCheck(ctx, "b.example.com"))
+	es = endpoints(t, f)
+	if assert.NotNil(t, es[2].Enabled) {
+		assert.False(t, *es[2].Enabled)
+	}
+	assert.True(t, newFakeChecker(t, f, config).UptimeChecks()["b.example.com"].Paused)
+	check(t, n.ResumeUptimeCheck(ctx, "b.example.com"))
+	assert.Nil(t, endpoints(t, f)[2].Enabled)
+
+	updated := &monitor.UptimeCheck{Hostname: "a.example.com", Name: "renamed", CheckIntervalInMinutes: 2, StatusCodes: []int{204}, Namespace: "web"}
+	check(t, n.UpdateUptimeCheck(ctx, updated))
+	es = endpoints(t, f)
+	assert.Equal(t, "renamed", es[1].Name)
+	assert.Equal(t, "[STATUS] == 204", es[1].Conditions[0])
+	assert.Equal(t, updated, newFakeChecker(t, f, config).UptimeChecks()["a.example.com"])
+
+	check(t, n.DeleteUptimeCheck(ctx, "a.example.com"))
+	assert.Len(t, endpoints(t, f), 2)
+	assert.NotContains(t, n.UptimeChecks(), "a.example.com")
+	check(t, n.DeleteUptimeCheck(ctx, "a.example.com"))
+
+	assert.True(t, monitor.IsNotFound(n.UpdateUptimeCheck(ctx, &monitor.UptimeCheck{Hostname: "a.example.com"})))
+}
+
+func TestGatusOtherKeys(t *testing.T) {
+	f := newFakeConfigMaps()
+	f.configMaps["gatus"] = &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "gatus", ResourceVersion: "1"},
+		Data:       map[string]string{"config.yaml": "alerting: {}\n"},
+	}
+	c := newFakeChecker(t, f, Config{})
+	check(t, c.CreateUptimeCheck(context.Background(), &monitor.UptimeCheck{Hostname: "example.com", Name: "example"}))
+	assert.Equal(t, "alerting: {}\n", f.configMaps["gatus"].Data["config.yaml"])
+	assert.Len(t, endpoints(t, f), 1)
+}
+
+func TestGatusErrors(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeConfigMaps()
+	c := newFakeChecker(t, f, Config{})
+
+	err := c.CreateUptimeCheck(ctx, &monitor.UptimeCheck{Hostname: "example.com", HTTP2: true})
+	assert.Equal(t, monitor.ValidationFailed, monitor.KindOf(err))
+
+	f.err = apierrors.NewForbidden(configMapGR, "gatus", nil)
+	err = c.CreateUptimeCheck(ctx, &monitor.UptimeCheck{Hostname: "example.com", Name: "example"})
+	assert.Equal(t, monitor.AuthFailed, monitor.KindOf(err))
+	assert.Empty(t, c.UptimeChecks())
+
+	f.err = nil
+	f.configMaps["gatus"] = &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "gatus", ResourceVersion: "1"},
+		Data:       map[string]string{"cruise.yaml": "endpoints: {"},
+	}
+	_, err = newGatusUptimeChecker(ctx, f, Config{ConfigMap: "gatus"}, monitor.RateLimit{})
+	assert.Equal(t, monitor.ValidationFailed, monitor.KindOf(err))
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := map[time.Duration]string{
+		time.Minute:                  "1m",
+		90 * time.Minute:             "1h30m",
+		48 * time.Hour:               "48h",
+		time.Minute + 30*time.Second: "1m30s",
+		2*time.Hour + 30*time.Second: "2h0m30s",
+	}
+	for d, want := range tests {
+		assert.Equal(t, want, formatDuration(d))
+	}
+}
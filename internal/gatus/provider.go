@@ -0,0 +1,29 @@
+package gatus
+
+import (
+	"context"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+)
+
+func init() {
+	monitor.Register("gatus", func() monitor.Provider { return new(provider) })
+}
+
+// provider configures a GatusUptimeChecker from command line flags.
+type provider struct {
+	config Config
+}
+
+func (p *provider) Flags(fs monitor.FlagSet) {
+	fs.Flag("gatus-namespace", "namespace of the ConfigMap holding the Gatus configuration").Default("heptio-cruise").StringVar(&p.config.Namespace)
+	fs.Flag("gatus-configmap", "name of the ConfigMap holding the Gatus configuration").Default("gatus").StringVar(&p.config.ConfigMap)
+	fs.Flag("gatus-key", "key of the Gatus configuration file in the ConfigMap, which is owned by cruise").Default("cruise.yaml").StringVar(&p.config.Key)
+	fs.Flag("gatus-condition", "condition added to every endpoint, eg. \"[RESPONSE_TIME] < 1000\", may be repeated").StringsVar(&p.config.Conditions)
+	fs.Flag("gatus-certificate-expiry", "fail TLS endpoints whose certificate expires sooner, 0 to disable").Default("168h").DurationVar(&p.config.CertificateExpiry)
+	fs.Flag("gatus-alert", "type of the alert raised by default, eg. slack, may be repeated").StringsVar(&p.config.Alerts)
+}
+
+func (p *provider) New(ctx context.Context, opts monitor.Options) (monitor.UptimeChecker, error) {
+	return NewGatusUptimeChecker(ctx, p.config, opts)
+}
@@ -0,0 +1,501 @@
+// Package grafana implements an UptimeChecker backed by Grafana Synthetic
+// Monitoring HTTP checks.
+package grafana
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+)
+
+// DefaultBaseURL is the address of the Synthetic Monitoring API in the
+// default Grafana Cloud region.
+const DefaultBaseURL = "https://synthetic-monitoring-api.grafana.net"
+
+// Labels recorded on each check. Synthetic Monitoring label names may
+// contain only letters, digits and underscores.
+const (
+	managedByLabel = "managed_by"
+	clusterLabel   = "cluster"
+	namespaceLabel = "namespace"
+	ingressLabel   = "ingress"
+	contactsLabel  = "contacts"
+)
+
+// Config configures a GrafanaUptimeChecker.
+type Config struct {
+	// Token is the Synthetic Monitoring access token.
+	Token string
+
+	// Owner is the value of the managed_by label which marks the checks
+	// owned by cruise. Checks without it are ignored, and never
+	// modified.
+	Owner string
+
+	// Cluster, if set, is recorded in each check's labels.
+	Cluster string
+
+	// Probes are the names of the probes which run checks that do not
+	// specify their own regions.
+	Probes []string
+
+	// Timeout bounds each run of a check.
+	Timeout time.Duration
+
+	// BaseURL, if set, overrides DefaultBaseURL.
+	BaseURL string
+}
+
+type GrafanaUptimeChecker struct {
+	config       Config
+	client       *http.Client
+	throttle     *monitor.Throttle
+	uptimeChecks map[string]*monitor.UptimeCheck
+
+	// tenants maps hostnames to the tenant of their check, which must
+	// be given when it is updated.
+	tenants map[string]int64
+
+	// probes maps the names of the available probes to their IDs.
+	probes map[string]int64
+}
+
+// NewGrafanaUptimeChecker returns an UptimeChecker which manages the
+// Synthetic Monitoring checks labelled managed_by=config.Owner. Calls to
+// the Synthetic Monitoring API are limited to the rate given by limit.
+func NewGrafanaUptimeChecker(ctx context.Context, config Config, limit monitor.RateLimit) (monitor.UptimeChecker, error) {
+	return newGrafanaUptimeChecker(ctx, http.DefaultClient, config, limit)
+}
+
+func newGrafanaUptimeChecker(ctx context.Context, client *http.Client, config Config, limit monitor.RateLimit) (*GrafanaUptimeChecker, error) {
+	if config.BaseURL == "" {
+		config.BaseURL = DefaultBaseURL
+	}
+	if config.Owner == "" {
+		return nil, fmt.Errorf("grafana: an owner is required")
+	}
+	if len(config.Probes) == 0 {
+		return nil, fmt.Errorf("grafana: at least one probe is required")
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	c := &GrafanaUptimeChecker{
+		config:       config,
+		client:       client,
+		throttle:     monitor.NewThrottle(limit),
+		uptimeChecks: make(map[string]*monitor.UptimeCheck),
+		tenants:      make(map[string]int64),
+	}
+	return c, c.SyncUptimeChecks(ctx)
+}
+
+// Adopts returns false: only the checks labelled managed_by=config.Owner
+// are listed.
+func (c *GrafanaUptimeChecker) Adopts() bool { return false }
+
+func (c *GrafanaUptimeChecker) UptimeChecks() map[string]*monitor.UptimeCheck {
+	return c.uptimeChecks
+}
+
+// smCheck is a Synthetic Monitoring check as sent to and returned by the
+// API.
+type smCheck struct {
+	ID        int64    `json:"id,omitempty"`
+	TenantID  int64    `json:"tenantId,omitempty"`
+	Job       string   `json:"job"`
+	Target    string   `json:"target"`
+	Frequency int64    `json:"frequency"`
+	Timeout   int64    `json:"timeout"`
+	Enabled   bool     `json:"enabled"`
+	Labels    []label  `json:"labels"`
+	Probes    []int64  `json:"probes"`
+	Settings  settings `json:"settings"`
+}
+
+type label struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type settings struct {
+	HTTP *httpSettings `json:"http,omitempty"`
+}
+
+type httpSettings struct {
+	Method                     string   `json:"method"`
+	IPVersion                  string   `json:"ipVersion"`
+	ValidStatusCodes           []int    `json:"validStatusCodes,omitempty"`
+	ValidHTTPVersions          []string `json:"validHTTPVersions,omitempty"`
+	FailIfNotSSL               bool     `json:"failIfNotSSL"`
+	FailIfBodyNotMatchesRegexp []string `json:"failIfBodyNotMatchesRegexp,omitempty"`
+}
+
+type probe struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+func (c *GrafanaUptimeChecker) SyncUptimeChecks(ctx context.Context) error {
+	var probes []probe
+	if err := c.do(ctx, "list", "GET", "/api/v1/probe/list", nil, &probes); err != nil {
+		return err
+	}
+	byName := make(map[string]int64, len(probes))
+	for _, p := range probes {
+		byName[p.Name] = p.ID
+	}
+	c.probes = byName
+
+	var list []smCheck
+	if err := c.do(ctx, "list", "GET", "/api/v1/check/list", nil, &list); err != nil {
+		return err
+	}
+	checks := make(map[string]*monitor.UptimeCheck)
+	tenants := make(map[string]int64)
+	for _, sc := range list {
+		if labelValue(sc.Labels, managedByLabel) != c.config.Owner {
+			continue
+		}
+		if uc := c.toUptimeCheck(sc); uc != nil {
+			checks[uc.Hostname] = uc
+			tenants[uc.Hostname] = sc.TenantID
+		}
+	}
+	c.uptimeChecks = checks
+	c.tenants = tenants
+	return nil
+}
+
+func (c *GrafanaUptimeChecker) CreateUptimeCheck(ctx context.Context, uc *monitor.UptimeCheck) error {
+	sc, err := c.check(uc)
+	if err != nil {
+		return &monitor.Error{Kind: monitor.ValidationFailed, Op: "create", Err: err}
+	}
+	var created smCheck
+	if err := c.do(ctx, "create", "POST", "/api/v1/check/add", sc, &created); err != nil {
+		return err
+	}
+	uc.ID = int(created.ID)
+	uc.Cluster = c.config.Cluster
+	c.uptimeChecks[uc.Hostname] = uc
+	c.tenants[uc.Hostname] = created.TenantID
+	return nil
+}
+
+// UpdateUptimeCheck modifies the existing check for uc.Hostname to match
+// uc.
+func (c *GrafanaUptimeChecker) UpdateUptimeCheck(ctx context.Context, uc *monitor.UptimeCheck) error {
+	existing, exists := c.uptimeChecks[uc.Hostname]
+	if !exists {
+		return &monitor.Error{Kind: monitor.NotFound, Op: "update", Err: fmt.Errorf("no check for %q", uc.Hostname)}
+	}
+	sc, err := c.check(uc)
+	if err != nil {
+		return &monitor.Error{Kind: monitor.ValidationFailed, Op: "update", Err: err}
+	}
+	sc.ID = int64(existing.ID)
+	sc.TenantID = c.tenants[uc.Hostname]
+	if err := c.do(ctx, "update", "POST", "/api/v1/check/update", sc, nil); err != nil {
+		return err
+	}
+	uc.ID = existing.ID
+	uc.Cluster = c.config.Cluster
+	c.uptimeChecks[uc.Hostname] = uc
+	return nil
+}
+
+func (c *GrafanaUptimeChecker) DeleteUptimeCheck(ctx context.Context, hostName string) error {
+	uc, exists := c.uptimeChecks[hostName]
+	if !exists {
+		return nil
+	}
+
+	err := c.do(ctx, "delete", "DELETE", "/api/v1/check/delete/"+strconv.Itoa(uc.ID), nil, nil)
+	if err != nil && !monitor.IsNotFound(err) {
+		return err
+	}
+
+	delete(c.uptimeChecks, hostName)
+	delete(c.tenants, hostName)
+	return nil
+}
+
+func (c *GrafanaUptimeChecker) PauseUptimeCheck(ctx context.Context, hostName string) error {
+	return c.setPaused(ctx, "pause", hostName, true)
+}
+
+func (c *GrafanaUptimeChecker) ResumeUptimeCheck(ctx context.Context, hostName string) error {
+	return c.setPaused(ctx, "resume", hostName, false)
+}
+
+// setPaused disables or enables the check for hostName. The API has no
+// partial update, so the whole check is sent.
+func (c *GrafanaUptimeChecker) setPaused(ctx context.Context, op, hostName string, paused bool) error {
+	existing, exists := c.uptimeChecks[hostName]
+	if !exists {
+		return &monitor.Error{Kind: monitor.NotFound, Op: op, Err: fmt.Errorf("no check for %q", hostName)}
+	}
+	if existing.Paused == paused {
+		return nil
+	}
+	uc := *existing
+	uc.Paused = paused
+	sc, err := c.check(&uc)
+	if err != nil {
+		return &monitor.Error{Kind: monitor.ValidationFailed, Op: op, Err: err}
+	}
+	sc.ID = int64(existing.ID)
+	sc.TenantID = c.tenants[hostName]
+	if err := c.do(ctx, op, "POST", "/api/v1/check/update", sc, nil); err != nil {
+		return err
+	}
+	existing.Paused = paused
+	return nil
+}
+
+// check returns the Synthetic Monitoring check which implements uc.
+func (c *GrafanaUptimeChecker) check(uc *monitor.UptimeCheck) (*smCheck, error) {
+	names := uc.Regions
+	if len(names) == 0 {
+		names = c.config.Probes
+	}
+	var probes []int64
+	for _, name := range names {
+		id, ok := c.probes[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown probe %q", name)
+		}
+		probes = append(probes, id)
+	}
+
+	minutes := uc.CheckIntervalInMinutes
+	if minutes < 1 {
+		minutes = 1
+	}
+	hs := &httpSettings{
+		Method:           "GET",
+		IPVersion:        "V4",
+		ValidStatusCodes: uc.StatusCodes,
+		FailIfNotSSL:     uc.EnableTLS,
+	}
+	if uc.HTTP2 {
+		hs.ValidHTTPVersions = []string{"HTTP/2.0"}
+	}
+	if uc.Keyword != "" {
+		hs.FailIfBodyNotMatchesRegexp = []string{regexp.QuoteMeta(uc.Keyword)}
+	}
+	return &smCheck{
+		Job:       uc.Name,
+		Target:    targetURL(uc),
+		Frequency: int64(time.Duration(minutes) * time.Minute / time.Millisecond),
+		Timeout:   int64(c.config.Timeout / time.Millisecond),
+		Enabled:   !uc.Paused,
+		Labels:    c.labels(uc),
+		Probes:    probes,
+		Settings:  settings{HTTP: hs},
+	}, nil
+}
+
+// labels returns the labels of the check for uc, which identify its
+// origin so dashboards and alerts can be grouped by namespace.
+func (c *GrafanaUptimeChecker) labels(uc *monitor.UptimeCheck) []label {
+	labels := []label{{Name: managedByLabel, Value: c.config.Owner}}
+	if c.config.Cluster != "" {
+		labels = append(labels, label{Name: clusterLabel, Value: c.config.Cluster})
+	}
+	if uc.Namespace != "" {
+		labels = append(labels, label{Name: namespaceLabel, Value: uc.Namespace})
+	}
+	if uc.Ingress != "" {
+		labels = append(labels, label{Name: ingressLabel, Value: uc.Ingress})
+	}
+	if len(uc.Contacts) > 0 {
+		labels = append(labels, label{Name: contactsLabel, Value: strings.Join(uc.Contacts, ",")})
+	}
+	return labels
+}
+
+func labelValue(labels []label, name string) string {
+	for _, l := range labels {
+		if l.Name == name {
+			return l.Value
+		}
+	}
+	return ""
+}
+
+func targetURL(uc *monitor.UptimeCheck) string {
+	u := url.URL{
+		Scheme: "http",
+		Host:   uc.Hostname,
+		Path:   uc.Path,
+	}
+	if uc.EnableTLS {
+		u.Scheme = "https"
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return u.String()
+}
+
+// toUptimeCheck converts sc to an UptimeCheck, or returns nil if sc is
+// not an HTTP check of an HTTP(S) URL.
+func (c *GrafanaUptimeChecker) toUptimeCheck(sc smCheck) *monitor.UptimeCheck {
+	if sc.Settings.HTTP == nil {
+		return nil
+	}
+	u, err := url.Parse(sc.Target)
+	if err != nil || u.Hostname() == "" {
+		return nil
+	}
+	path := u.Path
+	if path == "/" {
+		path = ""
+	}
+	minutes := int(time.Duration(sc.Frequency) * time.Millisecond / time.Minute)
+	if minutes < 1 {
+		minutes = 1
+	}
+	hs := sc.Settings.HTTP
+	uc := &monitor.UptimeCheck{
+		Hostname:               u.Hostname(),
+		ID:                     int(sc.ID),
+		Name:                   sc.Job,
+		CheckIntervalInMinutes: minutes,
+		EnableTLS:              u.Scheme == "https",
+		Paused:                 !sc.Enabled,
+		Path:                   path,
+		StatusCodes:            hs.ValidStatusCodes,
+		HTTP2:                  len(hs.ValidHTTPVersions) == 1 && hs.ValidHTTPVersions[0] == "HTTP/2.0",
+		Cluster:                labelValue(sc.Labels, clusterLabel),
+		Namespace:              labelValue(sc.Labels, namespaceLabel),
+		Ingress:                labelValue(sc.Labels, ingressLabel),
+	}
+	if len(hs.FailIfBodyNotMatchesRegexp) == 1 {
+		uc.Keyword = unquoteMeta(hs.FailIfBodyNotMatchesRegexp[0])
+	}
+	if v := labelValue(sc.Labels, contactsLabel); v != "" {
+		uc.Contacts = strings.Split(v, ",")
+	}
+
+	ids := make(map[int64]string, len(c.probes))
+	for name, id := range c.probes {
+		ids[id] = name
+	}
+	var names []string
+	for _, id := range sc.Probes {
+		name, ok := ids[id]
+		if !ok {
+			name = strconv.FormatInt(id, 10)
+		}
+		names = append(names, name)
+	}
+	if !sameStrings(names, c.config.Probes) {
+		uc.Regions = names
+	}
+	return uc
+}
+
+// unquoteMeta reverses regexp.QuoteMeta.
+func unquoteMeta(s string) string {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b = append(b, s[i])
+	}
+	return string(b)
+}
+
+func sameStrings(a, b []string) bool {
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	return len(a) == len(b) && (len(a) == 0 || reflect.DeepEqual(a, b))
+}
+
+// apiError is the body of an unsuccessful Synthetic Monitoring API
+// response.
+type apiError struct {
+	StatusCode int
+	Msg        string `json:"msg"`
+	Err        string `json:"err"`
+}
+
+func (e *apiError) Error() string {
+	msg := e.Msg
+	if msg == "" {
+		msg = http.StatusText(e.StatusCode)
+	}
+	if e.Err != "" {
+		msg += ": " + e.Err
+	}
+	return fmt.Sprintf("grafana: %d %s", e.StatusCode, msg)
+}
+
+// do performs a single Synthetic Monitoring API request bounded by ctx,
+// sending body, if any, as JSON and decoding the response into v. Any
+// error is returned as a *monitor.Error.
+func (c *GrafanaUptimeChecker) do(ctx context.Context, op, method, rsc string, body, v interface{}) error {
+	if err := c.throttle.Wait(ctx, op); err != nil {
+		return err
+	}
+
+	var r io.Reader
+	if body != nil {
+		buf, err := json.Marshal(body)
+		if err != nil {
+			return &monitor.Error{Kind: monitor.Unknown, Op: op, Err: err}
+		}
+		r = bytes.NewReader(buf)
+	}
+	req, err := http.NewRequest(method, c.config.BaseURL+rsc, r)
+	if err != nil {
+		return &monitor.Error{Kind: monitor.Unknown, Op: op, Err: err}
+	}
+	req.Header.Set("Authorization", "Bearer "+c.config.Token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return monitor.Wrap(ctx, op, err)
+	}
+	defer resp.Body.Close()
+	c.throttle.Delay(monitor.RetryAfterHeader(resp))
+
+	if resp.StatusCode >= 300 {
+		e := &apiError{StatusCode: resp.StatusCode}
+		json.NewDecoder(resp.Body).Decode(e)
+		err := &monitor.Error{Kind: monitor.KindForStatus(resp.StatusCode), Op: op, Err: e}
+		if err.Kind == monitor.RateLimited {
+			err.RetryAfter = c.throttle.Backoff()
+		}
+		return err
+	}
+	if v == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return monitor.Wrap(ctx, op, err)
+	}
+	return nil
+}
@@ -0,0 +1,315 @@
+package grafana
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+	"github.com/heptiolabs/cruise/internal/monitor/monitortest"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeGrafana is an in memory stand in for the Synthetic Monitoring API.
+type fakeGrafana struct {
+	mu     sync.Mutex
+	nextID int64
+	checks map[int64]smCheck
+	probes []probe
+	fail   func(*http.Request) int
+	header http.Header
+}
+
+const tenant = 42
+
+func newFakeGrafana() *fakeGrafana {
+	return &fakeGrafana{
+		nextID: 1,
+		checks: make(map[int64]smCheck),
+		probes: []probe{{ID: 1, Name: "Atlanta"}, {ID: 2, Name: "London"}, {ID: 3, Name: "Tokyo"}},
+	}
+}
+
+func (f *fakeGrafana) add(c smCheck) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c.ID = f.nextID
+	c.TenantID = tenant
+	f.nextID++
+	f.checks[c.ID] = c
+}
+
+func (f *fakeGrafana) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for k, v := range f.header {
+		w.Header()[k] = v
+	}
+	if r.Header.Get("Authorization") != "Bearer token" {
+		writeError(w, http.StatusUnauthorized, "invalid token")
+		return
+	}
+	if f.fail != nil {
+		if status := f.fail(r); status != 0 {
+			writeError(w, status, "fake error")
+			return
+		}
+	}
+
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/api/v1/probe/list":
+		writeJSON(w, http.StatusOK, f.probes)
+	case r.Method == "GET" && r.URL.Path == "/api/v1/check/list":
+		var ids []int
+		for id := range f.checks {
+			ids = append(ids, int(id))
+		}
+		sort.Ints(ids)
+		list := []smCheck{}
+		for _, id := range ids {
+			list = append(list, f.checks[int64(id)])
+		}
+		writeJSON(w, http.StatusOK, list)
+	case r.Method == "POST" && r.URL.Path == "/api/v1/check/add":
+		var c smCheck
+		if err := json.NewDecoder(r.Body).Decode(&c); err != nil || c.Target == "" || len(c.Probes) == 0 {
+			writeError(w, http.StatusBadRequest, "invalid check")
+			return
+		}
+		c.ID = f.nextID
+		c.TenantID = tenant
+		f.nextID++
+		f.checks[c.ID] = c
+		writeJSON(w, http.StatusOK, c)
+	case r.Method == "POST" && r.URL.Path == "/api/v1/check/update":
+		var c smCheck
+		if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid check")
+			return
+		}
+		existing, ok := f.checks[c.ID]
+		if !ok {
+			writeError(w, http.StatusNotFound, "check not found")
+			return
+		}
+		if c.TenantID != existing.TenantID {
+			writeError(w, http.StatusBadRequest, "tenant mismatch")
+			return
+		}
+		f.checks[c.ID] = c
+		writeJSON(w, http.StatusOK, c)
+	case r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, "/api/v1/check/delete/"):
+		id, _ := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/api/v1/check/delete/"), 10, 64)
+		if _, ok := f.checks[id]; !ok {
+			writeError(w, http.StatusNotFound, "check not found")
+			return
+		}
+		delete(f.checks, id)
+		writeJSON(w, http.StatusOK, map[string]string{"msg": "check deleted"})
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"msg": msg, "err": "fake"})
+}
+
+func newFakeChecker(t *testing.T, f *fakeGrafana, config Config) (*GrafanaUptimeChecker, *httptest.Server) {
+	t.Helper()
+	srv := httptest.NewServer(f)
+	config.BaseURL = srv.URL
+	if config.Token == "" {
+		config.Token = "token"
+	}
+	if config.Owner == "" {
+		config.Owner = "cruise"
+	}
+	if len(config.Probes) == 0 {
+		config.Probes = []string{"Atlanta"}
+	}
+	c, err := newGrafanaUptimeChecker(context.Background(), srv.Client(), config, monitor.RateLimit{})
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	return c, srv
+}
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGrafanaUptimeChecker(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeGrafana()
+	config := Config{Cluster: "prod", Timeout: 5 * time.Second}
+	c, srv := newFakeChecker(t, f, config)
+	defer srv.Close()
+
+	uc := &monitor.UptimeCheck{
+		Hostname:               "example.com",
+		Name:                   "mynamespace/example (example.com:443)",
+		EnableTLS:              true,
+		CheckIntervalInMinutes: 5,
+		Path:                   "/healthz",
+		Keyword:                "ok (1.0)",
+		HTTP2:                  true,
+		StatusCodes:            []int{200, 301},
+		Contacts:               []string{"web", "oncall"},
+		Namespace:              "mynamespace",
+		Ingress:                "example",
+	}
+	check(t, c.CreateUptimeCheck(ctx, uc))
+	assert.Equal(t, 1, uc.ID)
+
+	created := f.checks[1]
+	assert.Equal(t, "mynamespace/example (example.com:443)", created.Job)
+	assert.Equal(t, "https://example.com/healthz", created.Target)
+	assert.Equal(t, int64(300000), created.Frequency)
+	assert.Equal(t, int64(5000), created.Timeout)
+	assert.True(t, created.Enabled)
+	assert.Equal(t, []int64{1}, created.Probes)
+	assert.Equal(t, []label{
+		{Name: "managed_by", Value: "cruise"},
+		{Name: "cluster", Value: "prod"},
+		{Name: "namespace", Value: "mynamespace"},
+		{Name: "ingress", Value: "example"},
+		{Name: "contacts", Value: "web,oncall"},
+	}, created.Labels)
+	assert.Equal(t, &httpSettings{
+		Method:                     "GET",
+		IPVersion:                  "V4",
+		ValidStatusCodes:           []int{200, 301},
+		ValidHTTPVersions:          []string{"HTTP/2.0"},
+		FailIfNotSSL:               true,
+		FailIfBodyNotMatchesRegexp: []string{`ok \(1\.0\)`},
+	}, created.Settings.HTTP)
+
+	n, srv2 := newFakeChecker(t, f, config)
+	defer srv2.Close()
+	assert.Equal(t, uc, n.UptimeChecks()["example.com"])
+
+	updated := &monitor.UptimeCheck{
+		Hostname:               "example.com",
+		Name:                   "renamed",
+		CheckIntervalInMinutes: 1,
+		Regions:                []string{"London", "Tokyo"},
+	}
+	check(t, n.UpdateUptimeCheck(ctx, updated))
+	assert.Equal(t, 1, updated.ID)
+	assert.Equal(t, "renamed", f.checks[1].Job)
+	assert.Equal(t, "http://example.com/", f.checks[1].Target)
+	assert.Equal(t, int64(60000), f.checks[1].Frequency)
+	assert.Equal(t, []int64{2, 3}, f.checks[1].Probes)
+	assert.Equal(t, int64(tenant), f.checks[1].TenantID)
+
+	n, srv3 := newFakeChecker(t, f, config)
+	defer srv3.Close()
+	assert.Equal(t, updated, n.UptimeChecks()["example.com"])
+
+	check(t, n.PauseUptimeCheck(ctx, "example.com"))
+	assert.False(t, f.checks[1].Enabled)
+	assert.Equal(t, "renamed", f.checks[1].Job)
+	check(t, n.ResumeUptimeCheck(ctx, "example.com"))
+	assert.True(t, f.checks[1].Enabled)
+
+	check(t, n.DeleteUptimeCheck(ctx, "example.com"))
+	assert.Empty(t, f.checks)
+	assert.Nil(t, n.UptimeChecks()["example.com"])
+}
+
+func TestGrafanaUnknownProbe(t *testing.T) {
+	f := newFakeGrafana()
+	c, srv := newFakeChecker(t, f, Config{})
+	defer srv.Close()
+
+	err := c.CreateUptimeCheck(context.Background(), &monitor.UptimeCheck{Hostname: "example.com", Regions: []string{"Atlantis"}})
+	assert.Equal(t, monitor.ValidationFailed, monitor.KindOf(err))
+	assert.Empty(t, f.checks)
+}
+
+func TestGrafanaOwnership(t *testing.T) {
+	f := newFakeGrafana()
+	hs := &httpSettings{Method: "GET"}
+	f.add(smCheck{Job: "theirs", Target: "https://theirs.example.com/", Frequency: 60000, Probes: []int64{1}, Settings: settings{HTTP: hs}})
+	f.add(smCheck{Job: "ping", Target: "ours.example.com", Frequency: 60000, Probes: []int64{1}, Labels: []label{{Name: "managed_by", Value: "cruise"}}})
+	f.add(smCheck{Job: "ours", Target: "https://ours.example.com/", Frequency: 60000, Probes: []int64{1}, Settings: settings{HTTP: hs},
+		Labels: []label{{Name: "team", Value: "web"}, {Name: "managed_by", Value: "cruise"}}})
+
+	c, srv := newFakeChecker(t, f, Config{})
+	defer srv.Close()
+
+	assert.Len(t, c.UptimeChecks(), 1)
+	assert.Equal(t, "ours", c.UptimeChecks()["ours.example.com"].Name)
+}
+
+func TestGrafanaErrorKinds(t *testing.T) {
+	tests := map[int]monitor.ErrorKind{
+		http.StatusUnauthorized:        monitor.AuthFailed,
+		http.StatusTooManyRequests:     monitor.RateLimited,
+		http.StatusBadRequest:          monitor.ValidationFailed,
+		http.StatusInternalServerError: monitor.Transient,
+	}
+
+	for status, want := range tests {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			f := newFakeGrafana()
+			c, srv := newFakeChecker(t, f, Config{})
+			defer srv.Close()
+
+			f.fail = func(r *http.Request) int {
+				if r.Method == "POST" {
+					return status
+				}
+				return 0
+			}
+			err := c.CreateUptimeCheck(context.Background(), &monitor.UptimeCheck{Hostname: "example.com", Name: "example"})
+			assert.Equal(t, want, monitor.KindOf(err))
+			assert.Contains(t, err.Error(), "fake error")
+		})
+	}
+}
+
+func TestGrafanaContract(t *testing.T) {
+	monitortest.Run(t, func() monitortest.Backend {
+		f := newFakeGrafana()
+		return monitortest.Backend{
+			New: func(t *testing.T) (monitor.UptimeChecker, *httptest.Server) {
+				return newFakeChecker(t, f, Config{})
+			},
+			Len: func() int { return len(f.checks) },
+			AddUnowned: func(hostname string) {
+				f.add(smCheck{Job: hostname, Target: "https://" + hostname + "/", Frequency: 60000, Probes: []int64{1}, Settings: settings{HTTP: &httpSettings{Method: "GET"}}})
+			},
+			RateLimit: func() {
+				f.header = http.Header{"Retry-After": []string{"120"}}
+				f.fail = func(r *http.Request) int { return http.StatusTooManyRequests }
+			},
+		}
+	})
+}
+
+func TestUnquoteMeta(t *testing.T) {
+	for _, s := range []string{"", "ok", `a.b*c\d`, "(1+1)?[x]{2}^$|"} {
+		assert.Equal(t, s, unquoteMeta(regexp.QuoteMeta(s)))
+	}
+}
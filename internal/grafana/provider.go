@@ -0,0 +1,33 @@
+package grafana
+
+import (
+	"context"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+	"github.com/heptiolabs/cruise/internal/secret"
+)
+
+func init() {
+	monitor.Register("grafana", func() monitor.Provider { return new(provider) })
+}
+
+// provider configures a GrafanaUptimeChecker from command line flags.
+type provider struct {
+	config Config
+	token  secret.Value
+}
+
+func (p *provider) Flags(fs monitor.FlagSet) {
+	p.token.Flags(fs, "grafana-token", "Grafana Synthetic Monitoring access token", "GRAFANA_SM_TOKEN")
+	fs.Flag("grafana-owner", "value of the managed_by label marking the checks managed by cruise").Default("cruise").StringVar(&p.config.Owner)
+	fs.Flag("grafana-probe", "name of a probe which runs checks by default, may be repeated").Default("Atlanta").StringsVar(&p.config.Probes)
+	fs.Flag("grafana-timeout", "timeout of each run of a check").Default("10s").DurationVar(&p.config.Timeout)
+	fs.Flag("grafana-url", "Synthetic Monitoring API base URL").Default(DefaultBaseURL).StringVar(&p.config.BaseURL)
+}
+
+func (p *provider) New(ctx context.Context, opts monitor.Options) (monitor.UptimeChecker, error) {
+	config := p.config
+	config.Token = p.token.Secret()
+	config.Cluster = opts.Cluster
+	return NewGrafanaUptimeChecker(ctx, config, opts.RateLimit)
+}
@@ -0,0 +1,307 @@
+// Package migrate copies checks from one UptimeChecker to another, so
+// that the hosts monitored by one provider can be moved to another
+// without a gap in their monitoring.
+package migrate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+	"github.com/sirupsen/logrus"
+)
+
+// The phases through which the migration of a host's check passes.
+const (
+	// Copied checks have been created at the destination.
+	Copied = "copied"
+
+	// Verified checks have been confirmed to exist at the destination
+	// as they were copied.
+	Verified = "verified"
+
+	// Removed checks have been verified and deleted from the source.
+	Removed = "removed"
+
+	// Failed checks could not be copied or verified; they are tried
+	// again when the migration is resumed.
+	Failed = "failed"
+)
+
+// Progress records the phase reached by the migration of each host.
+type Progress struct {
+	From  string           `json:"from"`
+	To    string           `json:"to"`
+	Hosts map[string]*Host `json:"hosts"`
+}
+
+// Host is the progress of the migration of one host's check.
+type Host struct {
+	Phase string `json:"phase"`
+	Error string `json:"error,omitempty"`
+}
+
+// Load returns the progress recorded in the file path of a migration
+// from the provider from to to. A missing file is a migration which has
+// not started.
+func Load(path, from, to string) (*Progress, error) {
+	p := &Progress{From: from, To: to, Hosts: make(map[string]*Host)}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, p); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if p.From != from || p.To != to {
+		return nil, fmt.Errorf("%s records a migration from %s to %s", path, p.From, p.To)
+	}
+	if p.Hosts == nil {
+		p.Hosts = make(map[string]*Host)
+	}
+	return p, nil
+}
+
+// Save records p in the file path, replacing it atomically.
+func (p *Progress) Save(path string) error {
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Migration copies the checks of From to To.
+type Migration struct {
+	From, To monitor.UptimeChecker
+
+	// Progress is updated as each host's check is migrated, and
+	// persisted by calling Save after each change. Hosts which have
+	// already reached their final phase are skipped.
+	Progress *Progress
+	Save     func() error
+
+	// RemoveSource deletes each check from From once it is verified
+	// at To.
+	RemoveSource bool
+
+	// RequestTimeout bounds each call to a provider.
+	RequestTimeout time.Duration
+
+	Logger logrus.FieldLogger
+}
+
+// Run migrates the checks of From for hosts, or for all of its hosts if
+// hosts is nil. Checks are first copied, then verified once To has been
+// synced, then, if RemoveSource is set, deleted from From; so the hosts
+// are monitored by at least one provider throughout. Hosts whose
+// migration fails are recorded as Failed and the others carry on; an
+// error reports how many failed.
+func (m *Migration) Run(ctx context.Context, hosts []string) error {
+	if hosts == nil {
+		for host := range m.From.UptimeChecks() {
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
+
+	for _, host := range hosts {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if m.done(host) || m.phase(host) == Verified {
+			continue
+		}
+		if err := m.record(host, Copied, m.copy(ctx, host)); err != nil {
+			return err
+		}
+	}
+
+	if err := m.sync(ctx); err != nil {
+		return err
+	}
+	for _, host := range hosts {
+		if m.phase(host) != Copied {
+			continue
+		}
+		if err := m.record(host, Verified, m.verify(host)); err != nil {
+			return err
+		}
+	}
+
+	if m.RemoveSource {
+		for _, host := range hosts {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if m.phase(host) != Verified {
+				continue
+			}
+			err := m.remove(ctx, host)
+			if err := m.record(host, Removed, err); err != nil {
+				return err
+			}
+		}
+	}
+
+	failed := 0
+	for _, host := range hosts {
+		if !m.done(host) {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to migrate %d of %d checks", failed, len(hosts))
+	}
+	return nil
+}
+
+// done reports whether the migration of host is complete.
+func (m *Migration) done(host string) bool {
+	switch m.phase(host) {
+	case Removed:
+		return true
+	case Verified:
+		return !m.RemoveSource
+	}
+	return false
+}
+
+func (m *Migration) phase(host string) string {
+	if h, ok := m.Progress.Hosts[host]; ok {
+		return h.Phase
+	}
+	return ""
+}
+
+// record sets the phase of host, or, if err is not nil, records that
+// it failed to reach it, and saves the progress.
+func (m *Migration) record(host, phase string, err error) error {
+	h := &Host{Phase: phase}
+	log := m.Logger.WithField("hostname", host)
+	if err != nil {
+		h.Phase = Failed
+		h.Error = fmt.Sprintf("%s: %v", phase, err)
+		if phase == Removed {
+			// the check is still verified at the destination.
+			h.Phase = Verified
+		}
+		log.Errorf("%s failed: %v", phase, err)
+	} else {
+		log.Info(phase)
+	}
+	m.Progress.Hosts[host] = h
+	return m.Save()
+}
+
+// copy creates the check for host at To, unless it already has it.
+func (m *Migration) copy(ctx context.Context, host string) error {
+	source, ok := m.From.UptimeChecks()[host]
+	if !ok {
+		return fmt.Errorf("no check for %q at the source", host)
+	}
+	if d, ok := m.From.(monitor.Definer); ok && !d.Defined(host) {
+		return fmt.Errorf("the check for %q at the source is of a kind which cannot be copied", host)
+	}
+	check := copyOf(source)
+
+	if existing, ok := m.To.UptimeChecks()[host]; ok {
+		if monitor.SameCheck(existing, monitor.Normalize(m.To, check)) {
+			return m.setPaused(ctx, existing, check.Paused)
+		}
+		if u, ok := m.To.(monitor.Updater); ok {
+			return m.call(ctx, func(ctx context.Context) error { return u.UpdateUptimeCheck(ctx, check) })
+		}
+		if err := m.call(ctx, func(ctx context.Context) error { return m.To.DeleteUptimeCheck(ctx, host) }); err != nil {
+			return err
+		}
+	}
+	if err := m.call(ctx, func(ctx context.Context) error { return m.To.CreateUptimeCheck(ctx, check) }); err != nil {
+		return err
+	}
+	if created, ok := m.To.UptimeChecks()[host]; ok {
+		return m.setPaused(ctx, created, check.Paused)
+	}
+	return nil
+}
+
+// copyOf returns the definition of source for another provider. The
+// fields assigned by the source provider, and its contacts and regions,
+// whose meaning is provider specific, are not copied.
+func copyOf(source *monitor.UptimeCheck) *monitor.UptimeCheck {
+	return &monitor.UptimeCheck{
+		Hostname:               source.Hostname,
+		Name:                   source.Name,
+		EnableTLS:              source.EnableTLS,
+		CheckIntervalInMinutes: source.CheckIntervalInMinutes,
+		Paused:                 source.Paused,
+		Path:                   source.Path,
+		Keyword:                source.Keyword,
+		HTTP2:                  source.HTTP2,
+		StatusCodes:            source.StatusCodes,
+		Namespace:              source.Namespace,
+		Ingress:                source.Ingress,
+	}
+}
+
+func (m *Migration) setPaused(ctx context.Context, existing *monitor.UptimeCheck, paused bool) error {
+	switch {
+	case paused && !existing.Paused:
+		return m.call(ctx, func(ctx context.Context) error { return m.To.PauseUptimeCheck(ctx, existing.Hostname) })
+	case !paused && existing.Paused:
+		return m.call(ctx, func(ctx context.Context) error { return m.To.ResumeUptimeCheck(ctx, existing.Hostname) })
+	}
+	return nil
+}
+
+// sync refreshes the checks of To, so that they are verified as the
+// provider has them rather than as they were requested.
+func (m *Migration) sync(ctx context.Context) error {
+	return m.call(ctx, m.To.SyncUptimeChecks)
+}
+
+// verify checks that To has the check for host as it was copied, as To
+// runs it, and that it does not find a host down which the source finds
+// up.
+func (m *Migration) verify(host string) error {
+	source, ok := m.From.UptimeChecks()[host]
+	if !ok {
+		return fmt.Errorf("no check for %q at the source", host)
+	}
+	check, ok := m.To.UptimeChecks()[host]
+	if !ok {
+		return fmt.Errorf("no check for %q at the destination", host)
+	}
+	if !monitor.SameCheck(check, monitor.Normalize(m.To, copyOf(source))) {
+		return fmt.Errorf("the check for %q at the destination differs from the source", host)
+	}
+	if source.Status == monitor.StatusUp && check.Status == monitor.StatusDown {
+		return fmt.Errorf("%q is down at the destination but up at the source", host)
+	}
+	return nil
+}
+
+// remove deletes the check for host from From.
+func (m *Migration) remove(ctx context.Context, host string) error {
+	return m.call(ctx, func(ctx context.Context) error { return m.From.DeleteUptimeCheck(ctx, host) })
+}
+
+// call calls fn with ctx bounded by RequestTimeout, waiting out the
+// rate limits of the providers.
+func (m *Migration) call(ctx context.Context, fn func(context.Context) error) error {
+	return monitor.Retry(ctx, m.RequestTimeout, func(d time.Duration, err error) {
+		m.Logger.Warnf("%v, retrying in %v", err, d)
+	}, fn)
+}
@@ -0,0 +1,242 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeChecker is an in memory UptimeChecker.
+type fakeChecker struct {
+	checks map[string]*monitor.UptimeCheck
+	calls  map[string]int
+	errs   map[string]error // returned by calls for the host, if set
+
+	// undefined holds the hosts whose checks cannot be copied.
+	undefined map[string]bool
+
+	// limited is the number of calls to create checks which are rate
+	// limited before they succeed.
+	limited int
+}
+
+func newFakeChecker(checks ...*monitor.UptimeCheck) *fakeChecker {
+	f := &fakeChecker{
+		checks:    make(map[string]*monitor.UptimeCheck),
+		calls:     make(map[string]int),
+		errs:      make(map[string]error),
+		undefined: make(map[string]bool),
+	}
+	for _, check := range checks {
+		f.checks[check.Hostname] = check
+	}
+	return f
+}
+
+func (f *fakeChecker) UptimeChecks() map[string]*monitor.UptimeCheck { return f.checks }
+
+func (f *fakeChecker) SyncUptimeChecks(ctx context.Context) error {
+	f.calls["sync"]++
+	return nil
+}
+
+func (f *fakeChecker) CreateUptimeCheck(ctx context.Context, check *monitor.UptimeCheck) error {
+	f.calls["create"]++
+	if f.limited > 0 {
+		f.limited--
+		return &monitor.Error{Kind: monitor.RateLimited, Op: "create", Err: errors.New("slow down"), RetryAfter: time.Millisecond}
+	}
+	if err := f.errs[check.Hostname]; err != nil {
+		return err
+	}
+	f.checks[check.Hostname] = check
+	return nil
+}
+
+func (f *fakeChecker) DeleteUptimeCheck(ctx context.Context, hostName string) error {
+	f.calls["delete"]++
+	if err := f.errs[hostName]; err != nil {
+		return err
+	}
+	delete(f.checks, hostName)
+	return nil
+}
+
+func (f *fakeChecker) Defined(hostName string) bool { return !f.undefined[hostName] }
+
+func (f *fakeChecker) PauseUptimeCheck(ctx context.Context, hostName string) error {
+	f.calls["pause"]++
+	f.checks[hostName].Paused = true
+	return nil
+}
+
+func (f *fakeChecker) ResumeUptimeCheck(ctx context.Context, hostName string) error {
+	f.calls["resume"]++
+	f.checks[hostName].Paused = false
+	return nil
+}
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newMigration(from, to *fakeChecker) *Migration {
+	logger, _ := test.NewNullLogger()
+	return &Migration{
+		From:     from,
+		To:       to,
+		Progress: &Progress{From: "from", To: "to", Hosts: make(map[string]*Host)},
+		Save:     func() error { return nil },
+		Logger:   logger,
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	from := newFakeChecker(
+		&monitor.UptimeCheck{Hostname: "a.example.com", Name: "a", ID: 1, CheckIntervalInMinutes: 5, Contacts: []string{"ops"}, Status: monitor.StatusUp},
+		&monitor.UptimeCheck{Hostname: "b.example.com", Name: "b", ID: 2, Paused: true},
+	)
+	to := newFakeChecker()
+	m := newMigration(from, to)
+
+	check(t, m.Run(ctx, nil))
+	assert.Equal(t, &monitor.UptimeCheck{Hostname: "a.example.com", Name: "a", CheckIntervalInMinutes: 5}, to.checks["a.example.com"])
+	assert.True(t, to.checks["b.example.com"].Paused)
+	assert.Equal(t, 1, to.calls["sync"])
+	assert.Equal(t, Verified, m.Progress.Hosts["a.example.com"].Phase)
+	assert.Len(t, from.checks, 2)
+
+	// resuming with RemoveSource only removes the source checks.
+	m.RemoveSource = true
+	check(t, m.Run(ctx, nil))
+	assert.Equal(t, 2, to.calls["create"])
+	assert.Empty(t, from.checks)
+	assert.Len(t, to.checks, 2)
+	assert.Equal(t, Removed, m.Progress.Hosts["b.example.com"].Phase)
+}
+
+func TestMigrateFailures(t *testing.T) {
+	ctx := context.Background()
+	from := newFakeChecker(
+		&monitor.UptimeCheck{Hostname: "a.example.com", Name: "a"},
+		&monitor.UptimeCheck{Hostname: "b.example.com", Name: "b"},
+	)
+	to := newFakeChecker()
+	to.errs["a.example.com"] = &monitor.Error{Kind: monitor.ValidationFailed, Op: "create", Err: errors.New("invalid")}
+	from.errs["b.example.com"] = &monitor.Error{Kind: monitor.Transient, Op: "delete", Err: errors.New("timeout")}
+	m := newMigration(from, to)
+	m.RemoveSource = true
+
+	err := m.Run(ctx, nil)
+	assert.EqualError(t, err, "failed to migrate 2 of 2 checks")
+	assert.Equal(t, &Host{Phase: Failed, Error: "copied: create: invalid"}, m.Progress.Hosts["a.example.com"])
+	assert.Equal(t, &Host{Phase: Verified, Error: "removed: delete: timeout"}, m.Progress.Hosts["b.example.com"])
+	assert.Contains(t, from.checks, "a.example.com", "an unverified check was removed from the source")
+
+	// resuming retries only what failed.
+	delete(to.errs, "a.example.com")
+	delete(from.errs, "b.example.com")
+	check(t, m.Run(ctx, nil))
+	assert.Equal(t, 3, to.calls["create"])
+	assert.Empty(t, from.checks)
+}
+
+func TestMigrateUndefined(t *testing.T) {
+	from := newFakeChecker(&monitor.UptimeCheck{Hostname: "a.example.com", Name: "a"})
+	from.undefined["a.example.com"] = true
+	to := newFakeChecker()
+	m := newMigration(from, to)
+	m.RemoveSource = true
+
+	assert.Error(t, m.Run(context.Background(), nil))
+	assert.Equal(t, Failed, m.Progress.Hosts["a.example.com"].Phase)
+	assert.Empty(t, to.checks)
+	assert.Contains(t, from.checks, "a.example.com")
+}
+
+func TestMigrateRateLimited(t *testing.T) {
+	from := newFakeChecker(
+		&monitor.UptimeCheck{Hostname: "a.example.com", Name: "a"},
+		&monitor.UptimeCheck{Hostname: "b.example.com", Name: "b"},
+	)
+	to := newFakeChecker()
+	to.limited = 2
+	m := newMigration(from, to)
+
+	check(t, m.Run(context.Background(), nil))
+	assert.Len(t, to.checks, 2)
+	assert.Equal(t, 4, to.calls["create"])
+}
+
+func TestMigrateVerify(t *testing.T) {
+	from := newFakeChecker(&monitor.UptimeCheck{Hostname: "a.example.com", Name: "a", Status: monitor.StatusUp})
+	to := newFakeChecker(&monitor.UptimeCheck{Hostname: "a.example.com", Name: "a", Status: monitor.StatusDown})
+	m := newMigration(from, to)
+	assert.EqualError(t, m.verify("a.example.com"), `"a.example.com" is down at the destination but up at the source`)
+
+	to.checks["a.example.com"] = &monitor.UptimeCheck{Hostname: "a.example.com", Name: "other"}
+	assert.EqualError(t, m.verify("a.example.com"), `the check for "a.example.com" at the destination differs from the source`)
+}
+
+// rounding is a fakeChecker which runs checks only every five minutes.
+type rounding struct {
+	*fakeChecker
+}
+
+func (r rounding) Normalize(check *monitor.UptimeCheck) *monitor.UptimeCheck {
+	n := *check
+	n.CheckIntervalInMinutes = (check.CheckIntervalInMinutes + 4) / 5 * 5
+	return &n
+}
+
+func (r rounding) CreateUptimeCheck(ctx context.Context, check *monitor.UptimeCheck) error {
+	return r.fakeChecker.CreateUptimeCheck(ctx, r.Normalize(check))
+}
+
+func TestMigrateNormalized(t *testing.T) {
+	from := newFakeChecker(&monitor.UptimeCheck{Hostname: "a.example.com", Name: "a", CheckIntervalInMinutes: 2})
+	to := newFakeChecker()
+	m := newMigration(from, to)
+	m.To = rounding{to}
+
+	check(t, m.Run(context.Background(), nil))
+	assert.Equal(t, 5, to.checks["a.example.com"].CheckIntervalInMinutes)
+	assert.Equal(t, Verified, m.Progress.Hosts["a.example.com"].Phase, "the check is verified as the destination runs it")
+
+	// copying again finds the check already as the destination runs it.
+	m.Progress.Hosts = make(map[string]*Host)
+	check(t, m.Run(context.Background(), nil))
+	assert.Equal(t, 1, to.calls["create"])
+}
+
+func TestProgress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate")
+	check(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "progress.json")
+
+	p, err := Load(path, "pingdom", "datadog")
+	check(t, err)
+	assert.Empty(t, p.Hosts)
+	p.Hosts["example.com"] = &Host{Phase: Copied}
+	check(t, p.Save(path))
+
+	p, err = Load(path, "pingdom", "datadog")
+	check(t, err)
+	assert.Equal(t, &Host{Phase: Copied}, p.Hosts["example.com"])
+
+	_, err = Load(path, "pingdom", "grafana")
+	assert.Error(t, err)
+}
@@ -0,0 +1,39 @@
+package monitor
+
+import (
+	"context"
+	"time"
+)
+
+// Availability summarises the results of a check over a period.
+type Availability struct {
+	// Up, Down and Unknown are how long the host was found up, found
+	// down, and not checked, eg. while the check was paused.
+	Up, Down, Unknown time.Duration
+
+	// Outages are the periods during which the host was down.
+	Outages []Outage
+}
+
+// Outage is a period during which a host was down.
+type Outage struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Ratio returns the proportion of the time the host was checked during
+// which it was up, or false if it was not checked at all.
+func (a *Availability) Ratio() (float64, bool) {
+	checked := a.Up + a.Down
+	if checked <= 0 {
+		return 0, false
+	}
+	return float64(a.Up) / float64(checked), true
+}
+
+// AvailabilityReporter is implemented by UptimeCheckers which report
+// the history of their checks. Availability returns the results of the
+// check for hostName between from and to.
+type AvailabilityReporter interface {
+	Availability(ctx context.Context, hostName string, from, to time.Time) (*Availability, error)
+}
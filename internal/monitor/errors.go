@@ -0,0 +1,156 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ErrorKind classifies the errors returned by an UptimeChecker so
+// that callers can decide whether to retry, ignore, or give up.
+type ErrorKind int
+
+const (
+	// Unknown is the kind of any error which could not be classified.
+	Unknown ErrorKind = iota
+
+	// NotFound indicates the check does not exist at the provider.
+	NotFound
+
+	// RateLimited indicates the provider rejected the call because
+	// too many requests were made.
+	RateLimited
+
+	// AuthFailed indicates the provider rejected the credentials.
+	AuthFailed
+
+	// ValidationFailed indicates the provider rejected the check
+	// definition; retrying the same request will not succeed.
+	ValidationFailed
+
+	// Transient indicates a network error, timeout, or server side
+	// failure which may succeed if retried.
+	Transient
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case NotFound:
+		return "not found"
+	case RateLimited:
+		return "rate limited"
+	case AuthFailed:
+		return "auth failed"
+	case ValidationFailed:
+		return "validation failed"
+	case Transient:
+		return "transient"
+	default:
+		return "unknown"
+	}
+}
+
+// Error is the error type returned by UptimeChecker implementations.
+type Error struct {
+	Kind ErrorKind
+	Op   string // the operation which failed, eg. "create"
+	Err  error  // the underlying error
+
+	// RetryAfter, if non zero, is how long the provider asked callers
+	// to wait before retrying a RateLimited operation.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %v", e.Op, e.Err)
+}
+
+// KindOf returns the ErrorKind of err. Errors not produced by an
+// UptimeChecker are reported as Unknown.
+func KindOf(err error) ErrorKind {
+	if e, ok := err.(*Error); ok {
+		return e.Kind
+	}
+	return Unknown
+}
+
+// IsNotFound returns true if err indicates the check does not exist.
+func IsNotFound(err error) bool { return KindOf(err) == NotFound }
+
+// IsRetryable returns true if the operation which returned err may
+// succeed if it is attempted again later.
+func IsRetryable(err error) bool {
+	switch KindOf(err) {
+	case RateLimited, Transient:
+		return true
+	default:
+		return false
+	}
+}
+
+// RetryAfter returns the delay requested by the provider before the
+// operation which returned err is retried, or zero if none was given.
+func RetryAfter(err error) time.Duration {
+	if e, ok := err.(*Error); ok {
+		return e.RetryAfter
+	}
+	return 0
+}
+
+// Wrap classifies err, returned by a provider's API during op, and wraps
+// it in an *Error. Network errors and exceeded deadlines are Transient;
+// anything else is Unknown. A nil err, or one which is already an
+// *Error, is returned unchanged.
+func Wrap(ctx context.Context, op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*Error); ok {
+		return err
+	}
+	return &Error{
+		Kind: classify(ctx, err),
+		Op:   op,
+		Err:  err,
+	}
+}
+
+func classify(ctx context.Context, err error) ErrorKind {
+	if ctx.Err() == context.DeadlineExceeded {
+		return Transient
+	}
+	switch err := err.(type) {
+	case *url.Error:
+		if err.Timeout() {
+			return Transient
+		}
+		if _, ok := err.Err.(net.Error); ok {
+			return Transient
+		}
+	case net.Error:
+		return Transient
+	}
+	return Unknown
+}
+
+// KindForStatus returns the ErrorKind for a provider's HTTP response
+// status code.
+func KindForStatus(code int) ErrorKind {
+	switch {
+	case code == http.StatusNotFound:
+		return NotFound
+	case code == http.StatusTooManyRequests:
+		return RateLimited
+	case code == http.StatusUnauthorized, code == http.StatusForbidden:
+		return AuthFailed
+	case code == http.StatusBadRequest, code == http.StatusUnprocessableEntity:
+		return ValidationFailed
+	case code >= 500:
+		return Transient
+	default:
+		return Unknown
+	}
+}
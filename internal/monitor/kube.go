@@ -0,0 +1,33 @@
+package monitor
+
+import (
+	"context"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// WrapKube classifies err, returned from the Kubernetes API during op,
+// for providers which keep their checks in the cluster. A nil err is
+// returned unchanged.
+func WrapKube(ctx context.Context, op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	kind := Unknown
+	switch {
+	case apierrors.IsNotFound(err):
+		kind = NotFound
+	case apierrors.IsUnauthorized(err), apierrors.IsForbidden(err):
+		kind = AuthFailed
+	case apierrors.IsInvalid(err), apierrors.IsBadRequest(err):
+		kind = ValidationFailed
+	case apierrors.IsTooManyRequests(err):
+		kind = RateLimited
+	case apierrors.IsConflict(err), apierrors.IsServerTimeout(err), apierrors.IsTimeout(err),
+		apierrors.IsInternalError(err), apierrors.IsServiceUnavailable(err):
+		kind = Transient
+	default:
+		return Wrap(ctx, op, err)
+	}
+	return &Error{Kind: kind, Op: op, Err: err}
+}
@@ -0,0 +1,91 @@
+// Package monitortest tests the behaviour shared by the UptimeCheckers of
+// every provider against a fake of the provider's API.
+package monitortest
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+	"github.com/stretchr/testify/assert"
+)
+
+// Backend is a fake of a provider's API, and the UptimeChecker which
+// uses it.
+type Backend struct {
+	// New returns an UptimeChecker for the fake, synced with the checks
+	// it holds, and the server of the fake, which the caller closes.
+	New func(t *testing.T) (monitor.UptimeChecker, *httptest.Server)
+
+	// Len returns the number of checks held by the fake.
+	Len func() int
+
+	// AddUnowned, if set, adds to the fake a check for hostname which
+	// cruise did not create, and so must neither list nor delete.
+	AddUnowned func(hostname string)
+
+	// RateLimit makes the fake refuse every request as rate limited,
+	// asking the client to retry after two minutes.
+	RateLimit func()
+}
+
+// Run tests the UptimeCheckers of the Backends returned by newBackend, a
+// new one for each test.
+func Run(t *testing.T, newBackend func() Backend) {
+	t.Run("delete", func(t *testing.T) { testDelete(t, newBackend()) })
+	t.Run("ownership", func(t *testing.T) { testOwnership(t, newBackend()) })
+	t.Run("retry after", func(t *testing.T) { testRetryAfter(t, newBackend()) })
+}
+
+func newCheck() *monitor.UptimeCheck {
+	return &monitor.UptimeCheck{Hostname: "example.com", Name: "example", CheckIntervalInMinutes: 1}
+}
+
+func testDelete(t *testing.T, b Backend) {
+	ctx := context.Background()
+	c, srv := b.New(t)
+	defer srv.Close()
+	check(t, c.CreateUptimeCheck(ctx, newCheck()))
+	assert.Equal(t, 1, b.Len())
+
+	n, srv2 := b.New(t)
+	defer srv2.Close()
+	check(t, n.DeleteUptimeCheck(ctx, "example.com"))
+	assert.Equal(t, 0, b.Len())
+	assert.Nil(t, n.UptimeChecks()["example.com"])
+
+	// the check is already gone remotely; deleting it again is not an error.
+	check(t, c.DeleteUptimeCheck(ctx, "example.com"))
+	assert.Nil(t, c.UptimeChecks()["example.com"])
+}
+
+func testOwnership(t *testing.T, b Backend) {
+	if b.AddUnowned == nil {
+		t.Skip("every check is listed")
+	}
+	b.AddUnowned("theirs.example.com")
+	c, srv := b.New(t)
+	defer srv.Close()
+	assert.NotContains(t, c.UptimeChecks(), "theirs.example.com")
+
+	check(t, c.DeleteUptimeCheck(context.Background(), "theirs.example.com"))
+	assert.Equal(t, 1, b.Len())
+}
+
+func testRetryAfter(t *testing.T, b Backend) {
+	c, srv := b.New(t)
+	defer srv.Close()
+	b.RateLimit()
+	err := c.CreateUptimeCheck(context.Background(), newCheck())
+	assert.Equal(t, monitor.RateLimited, monitor.KindOf(err))
+	assert.True(t, monitor.RetryAfter(err) > 119*time.Second, "RetryAfter: %v", monitor.RetryAfter(err))
+}
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,151 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimit configures the client side token bucket applied to every
+// call made to a provider.
+type RateLimit struct {
+	// QPS is the sustained number of requests per second.
+	// A value of zero disables client side rate limiting.
+	QPS float64
+
+	// Burst is the number of requests which may be made at once.
+	Burst int
+}
+
+func (r RateLimit) limiter() *rate.Limiter {
+	if r.QPS <= 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+	burst := r.Burst
+	if burst < 1 {
+		burst = 1
+	}
+	return rate.NewLimiter(rate.Limit(r.QPS), burst)
+}
+
+// Throttle combines a client side token bucket with the limits reported
+// by a provider in its responses.
+type Throttle struct {
+	limiter *rate.Limiter
+	now     func() time.Time
+
+	mu     sync.Mutex
+	resume time.Time // no requests may be made before resume
+}
+
+// NewThrottle returns a Throttle which limits requests to limit.
+func NewThrottle(limit RateLimit) *Throttle {
+	return &Throttle{
+		limiter: limit.limiter(),
+		now:     time.Now,
+	}
+}
+
+// Wait blocks until a request may be made. If the provider has asked
+// us to back off, Wait returns a RateLimited error immediately rather
+// than blocking so the caller can requeue the operation.
+func (t *Throttle) Wait(ctx context.Context, op string) error {
+	if d := t.Backoff(); d > 0 {
+		return &Error{
+			Kind:       RateLimited,
+			Op:         op,
+			Err:        fmt.Errorf("provider rate limit exceeded, retry in %v", d),
+			RetryAfter: d,
+		}
+	}
+	if err := t.limiter.Wait(ctx); err != nil {
+		return &Error{Kind: RateLimited, Op: op, Err: err}
+	}
+	return nil
+}
+
+// Backoff returns how long remains until requests may be made again.
+func (t *Throttle) Backoff() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if d := t.resume.Sub(t.now()); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// Delay prevents any further requests for d.
+func (t *Throttle) Delay(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if resume := t.now().Add(d); resume.After(t.resume) {
+		t.resume = resume
+	}
+}
+
+// RetryAfterHeader returns the delay requested by resp's Retry-After
+// header, given either in seconds or as an HTTP date. If resp has a 429
+// status but no Retry-After header a default of one minute is returned.
+func RetryAfterHeader(resp *http.Response) time.Duration {
+	if v := resp.Header.Get("Retry-After"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil {
+			return time.Duration(secs) * time.Second
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			return time.Until(t)
+		}
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		// rate limited, but the provider did not say for how long.
+		return time.Minute
+	}
+	return 0
+}
+
+// maxRetries is the most times Retry calls again a function which was
+// rate limited.
+const maxRetries = 5
+
+// Retry calls fn, with a context bounded by timeout if it is positive,
+// until it returns an error which is not RateLimited. After a RateLimited
+// error Retry waits for as long as the provider asked, or a second if it
+// did not say, reporting the wait to wait, if set, before calling fn
+// again. It is meant for commands which make a sequence of calls, each
+// of which would otherwise fail once a provider has asked for a pause.
+func Retry(ctx context.Context, timeout time.Duration, wait func(time.Duration, error), fn func(context.Context) error) error {
+	for retries := 0; ; retries++ {
+		err := call(ctx, timeout, fn)
+		if KindOf(err) != RateLimited || retries == maxRetries {
+			return err
+		}
+		d := RetryAfter(err)
+		if d <= 0 {
+			d = time.Second
+		}
+		if wait != nil {
+			wait(d, err)
+		}
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+func call(ctx context.Context, timeout time.Duration, fn func(context.Context) error) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return fn(ctx)
+}
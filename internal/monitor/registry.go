@@ -0,0 +1,86 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+	"k8s.io/client-go/rest"
+)
+
+// FlagSet is the set of command line flags to which a Provider adds its
+// configuration. It is satisfied by *kingpin.Application and
+// *kingpin.CmdClause.
+type FlagSet interface {
+	Flag(name, help string) *kingpin.FlagClause
+}
+
+// Provider constructs an UptimeChecker for an uptime monitoring service.
+type Provider interface {
+	// Flags adds the flags which configure the provider to fs. Flag
+	// names should be prefixed with the name of the provider so they
+	// do not collide with those of other providers.
+	Flags(fs FlagSet)
+
+	// New returns an UptimeChecker configured from the values of the
+	// provider's flags and opts.
+	New(ctx context.Context, opts Options) (UptimeChecker, error)
+}
+
+// Options holds the configuration shared by all providers.
+type Options struct {
+	// RateLimit limits the calls made to the provider's service.
+	RateLimit RateLimit
+
+	// KubeConfig configures access to the cluster cruise is watching,
+	// for providers which keep their checks in the cluster itself.
+	KubeConfig *rest.Config
+
+	// Cluster is the name of the cluster cruise is watching, for
+	// providers which label checks with their origin. It may be empty.
+	Cluster string
+}
+
+var (
+	mu        sync.Mutex
+	providers = make(map[string]func() Provider)
+)
+
+// Register makes a provider available by name, constructed by newFn.
+// Register is intended to be called from the init function of the
+// package implementing the provider; it panics if name is registered
+// twice.
+func Register(name string, newFn func() Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, dup := providers[name]; dup {
+		panic(fmt.Sprintf("monitor: provider %q registered twice", name))
+	}
+	providers[name] = newFn
+}
+
+// Lookup returns a new instance of the provider registered as name, so
+// that each set of flags configures its own.
+func Lookup(name string) (Provider, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	newFn, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown provider %q", name)
+	}
+	return newFn(), nil
+}
+
+// Providers returns the sorted names of the registered providers.
+func Providers() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	var names []string
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,35 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeProvider struct{}
+
+func (fakeProvider) Flags(fs FlagSet) {}
+
+func (fakeProvider) New(ctx context.Context, opts Options) (UptimeChecker, error) {
+	return nil, nil
+}
+
+func TestRegister(t *testing.T) {
+	Register("fake", func() Provider { return fakeProvider{} })
+	defer func() {
+		mu.Lock()
+		delete(providers, "fake")
+		mu.Unlock()
+	}()
+
+	p, err := Lookup("fake")
+	assert.Nil(t, err)
+	assert.Equal(t, fakeProvider{}, p)
+	assert.Contains(t, Providers(), "fake")
+
+	assert.Panics(t, func() { Register("fake", func() Provider { return fakeProvider{} }) })
+
+	_, err = Lookup("missing")
+	assert.EqualError(t, err, `unknown provider "missing"`)
+}
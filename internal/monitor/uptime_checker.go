@@ -0,0 +1,171 @@
+package monitor
+
+import (
+	"context"
+	"reflect"
+)
+
+type UptimeCheck struct {
+	Hostname               string
+	Name                   string
+	EnableTLS              bool
+	CheckIntervalInMinutes int
+	ID                     int
+	Paused                 bool
+
+	// Path is the path of the URL requested by the check, "/" if empty.
+	Path string
+
+	// Contacts identifies the contacts, or contact groups, alerted when
+	// the check fails. Their interpretation is provider specific; if
+	// empty the provider's default contacts are used.
+	Contacts []string
+
+	// Regions restricts the locations from which the check is run. If
+	// empty the provider's defaults are used.
+	Regions []string
+
+	// Keyword, if set, must appear in the response for the check to
+	// pass.
+	Keyword string
+
+	// HTTP2 requires the host to be served over HTTP/2.
+	HTTP2 bool
+
+	// StatusCodes are the HTTP status codes for which the check passes.
+	// If empty any 2xx status passes.
+	StatusCodes []int
+
+	// Namespace and Ingress identify the Ingress whose host is checked.
+	// Providers may record them, eg. as tags, but need not; they are
+	// also part of Name.
+	Namespace string
+	Ingress   string
+
+	// Cluster names the cluster of the Ingress, for providers which
+	// record it, as set by their configuration.
+	Cluster string
+
+	// Status is the result of the check when it last ran, StatusUp or
+	// StatusDown, for providers which report it when their checks are
+	// synced. It is empty if unknown.
+	Status string
+
+	// Providers selects, by name, which of the providers of a
+	// composite UptimeChecker run the check. If empty all of them do.
+	// Other UptimeCheckers ignore it.
+	Providers []string
+}
+
+// The values of UptimeCheck.Status.
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// Identifier is implemented by UptimeCheckers whose checks are
+// identified by something other than an integer ID. CheckID returns the
+// provider's identifier for the check for hostName, or "" if there is
+// none.
+type Identifier interface {
+	CheckID(hostName string) string
+}
+
+// ContactResolver is implemented by UptimeCheckers which resolve the
+// Contacts of checks against the provider's account. ResolveContacts
+// returns an error, of kind ValidationFailed, naming the first of
+// contacts which is unknown.
+type ContactResolver interface {
+	ResolveContacts(contacts []string) error
+}
+
+// Definer is implemented by UptimeCheckers which may hold checks, not
+// created by cruise, whose definition an UptimeCheck cannot express,
+// such as checks of other protocols. Defined returns false for the
+// hostName of such a check, whose UptimeCheck only describes it in part.
+type Definer interface {
+	Defined(hostName string) bool
+}
+
+// Adopter is implemented by UptimeCheckers which may be unable to adopt
+// checks which cruise did not create. Adopts returns false if the
+// provider lists only the checks cruise tagged as its own, so that the
+// existing checks for an Ingress' hosts cannot be found to be adopted.
+type Adopter interface {
+	Adopts() bool
+}
+
+// Adopts returns true unless checker is an Adopter which cannot adopt
+// checks.
+func Adopts(checker UptimeChecker) bool {
+	a, ok := checker.(Adopter)
+	return !ok || a.Adopts()
+}
+
+// Normalizer is implemented by UptimeCheckers whose provider cannot run
+// every check exactly as defined, eg. at any interval. Normalize returns
+// a copy of check as the provider runs it, which is how UptimeChecks
+// reports it once it is created.
+type Normalizer interface {
+	Normalize(check *UptimeCheck) *UptimeCheck
+}
+
+// Normalize returns check as checker runs it, so that it may be compared
+// with the checks checker reports.
+func Normalize(checker UptimeChecker, check *UptimeCheck) *UptimeCheck {
+	if n, ok := checker.(Normalizer); ok {
+		return n.Normalize(check)
+	}
+	return check
+}
+
+// QuotaReporter is implemented by UptimeCheckers whose provider limits
+// the number of checks an account may have. Quota returns the number of
+// checks the account has, and the most it may have.
+type QuotaReporter interface {
+	Quota(ctx context.Context) (used, limit int, err error)
+}
+
+// SameCheck reports whether the existing check a is defined the same as
+// b, ignoring whether they are paused.
+func SameCheck(a, b *UptimeCheck) bool {
+	return a.Name == b.Name &&
+		a.EnableTLS == b.EnableTLS &&
+		a.CheckIntervalInMinutes == b.CheckIntervalInMinutes &&
+		a.Path == b.Path &&
+		a.Keyword == b.Keyword &&
+		a.HTTP2 == b.HTTP2 &&
+		reflect.DeepEqual(a.StatusCodes, b.StatusCodes) &&
+		equalStrings(a.Contacts, b.Contacts) &&
+		equalStrings(a.Regions, b.Regions) &&
+		equalStrings(a.Providers, b.Providers)
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// UptimeChecker manages a set of remote uptime checks keyed by hostname.
+// Methods which call the remote API honour the deadline and cancellation
+// of their context and return an *Error describing any failure.
+type UptimeChecker interface {
+	UptimeChecks() map[string]*UptimeCheck
+	SyncUptimeChecks(ctx context.Context) error
+	CreateUptimeCheck(ctx context.Context, check *UptimeCheck) error
+	DeleteUptimeCheck(ctx context.Context, hostName string) error
+
+	// PauseUptimeCheck stops the check for hostName from running
+	// while preserving its history. ResumeUptimeCheck restarts it.
+	PauseUptimeCheck(ctx context.Context, hostName string) error
+	ResumeUptimeCheck(ctx context.Context, hostName string) error
+}
+
+// Updater is implemented by UptimeCheckers which can modify an existing
+// check in place, preserving its history. UpdateUptimeCheck replaces the
+// definition of the check for check.Hostname with check.
+type Updater interface {
+	UpdateUptimeCheck(ctx context.Context, check *UptimeCheck) error
+}
@@ -0,0 +1,21 @@
+package pingdom
+
+import (
+	"context"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+	"github.com/russellcardullo/go-pingdom/pingdom"
+)
+
+// wrapError classifies err, returned from the Pingdom API during op,
+// and wraps it in a *monitor.Error. A nil err is returned unchanged.
+func wrapError(ctx context.Context, op string, err error) error {
+	if pe, ok := err.(*pingdom.PingdomError); ok {
+		return &monitor.Error{
+			Kind: monitor.KindForStatus(pe.StatusCode),
+			Op:   op,
+			Err:  err,
+		}
+	}
+	return monitor.Wrap(ctx, op, err)
+}
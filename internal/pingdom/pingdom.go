@@ -1,99 +1,466 @@
 package pingdom
 
 import (
+	"context"
 	"fmt"
 	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/heptiolabs/cruise/internal/monitor"
 	"github.com/russellcardullo/go-pingdom/pingdom"
 )
 
 type PingdomUptimeChecker struct {
-	userID       int
+	userID int
+
+	// contacts holds the IDs of the account's notification contacts.
+	contacts map[int]bool
+
 	client       *pingdom.Client
-	uptimeChecks map[string]*UptimeCheck
+	throttle     *monitor.Throttle
+	uptimeChecks map[string]*monitor.UptimeCheck
+
+	// undefined holds the hostnames of the checks which are not HTTP
+	// checks, and so are described only in part by their UptimeCheck.
+	undefined map[string]bool
+}
+
+// NewPindomUptimeChecker returns an monitor.UptimeChecker backed by the Pingdom
+// account identified by user, password and key. Calls to the Pingdom API
+// are limited to the rate given by limit.
+func NewPindomUptimeChecker(ctx context.Context, user, password, key string, limit monitor.RateLimit) (monitor.UptimeChecker, error) {
+	return newPingdomUptimeChecker(ctx, pingdom.NewClient(user, password, key), limit)
 }
 
-func NewPindomUptimeChecker(user, password, key string) (UptimeChecker, error) {
-	client := pingdom.NewClient(user, password, key)
+func newPingdomUptimeChecker(ctx context.Context, client *pingdom.Client, limit monitor.RateLimit) (*PingdomUptimeChecker, error) {
+	c := &PingdomUptimeChecker{
+		contacts:     make(map[int]bool),
+		client:       client,
+		throttle:     monitor.NewThrottle(limit),
+		uptimeChecks: make(map[string]*monitor.UptimeCheck),
+		undefined:    make(map[string]bool),
+	}
 
 	// refresh contact list and locate the userid of c.Client.User
 	// because of a limitation in the 2.0 api we have to pick the first
 	// contact id and hope it's the billing contact.
-	contacts, err := client.Contacts.List()
-	if err != nil {
+	var contacts struct {
+		Contacts []struct {
+			ID int `json:"id"`
+		} `json:"contacts"`
+	}
+	if err := c.do(ctx, "list contacts", "GET", "/notification_contacts", nil, &contacts); err != nil {
 		return nil, err
 	}
 
-	if len(contacts) < 1 {
+	if len(contacts.Contacts) < 1 {
 		return nil, fmt.Errorf("cannot locate user id for Client.User %q", client.User)
 	}
-
-	c := &PingdomUptimeChecker{
-		userID:       contacts[0].ID,
-		client:       client,
-		uptimeChecks: make(map[string]*UptimeCheck),
+	c.userID = contacts.Contacts[0].ID
+	for _, contact := range contacts.Contacts {
+		c.contacts[contact.ID] = true
 	}
 
-	return c, c.SyncUptimeChecks()
+	return c, c.SyncUptimeChecks(ctx)
 }
 
-func (c *PingdomUptimeChecker) UptimeChecks() map[string]*UptimeCheck {
+func (c *PingdomUptimeChecker) UptimeChecks() map[string]*monitor.UptimeCheck {
 	return c.uptimeChecks
 }
 
-func (c *PingdomUptimeChecker) SyncUptimeChecks() error {
-	list, err := c.client.Checks.List()
+// SyncUptimeChecks refreshes the checks of the account. The list of
+// checks omits most of their definition, so the details of each HTTP
+// check are read too.
+func (c *PingdomUptimeChecker) SyncUptimeChecks(ctx context.Context) error {
+	var list struct {
+		Checks []listedCheck `json:"checks"`
+	}
+	if err := c.do(ctx, "list", "GET", "/checks", nil, &list); err != nil {
+		return err
+	}
+	for _, pc := range list.Checks {
+		check := toUptimeCheck(pc.CheckResponse)
+		if pc.Type == "http" {
+			err := c.readDetails(ctx, check)
+			if monitor.IsNotFound(err) {
+				// deleted since it was listed.
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+		c.uptimeChecks[pc.Hostname] = check
+		c.undefined[pc.Hostname] = pc.Type != "http"
+	}
+	return nil
+}
+
+// Defined returns false if the check for hostName is not an HTTP check.
+func (c *PingdomUptimeChecker) Defined(hostName string) bool {
+	return !c.undefined[hostName]
+}
+
+// listedCheck is a check as listed by GET /checks.
+type listedCheck struct {
+	pingdom.CheckResponse
+	Type string `json:"type"`
+}
+
+// checkDetails is the part of the definition of a check, as read by GET
+// /checks/{id}, which is not listed.
+type checkDetails struct {
+	Type struct {
+		HTTP *struct {
+			URL           string `json:"url"`
+			Encryption    bool   `json:"encryption"`
+			ShouldContain string `json:"shouldcontain"`
+		} `json:"http"`
+	} `json:"type"`
+	ContactIDs   []int    `json:"contactids"`
+	ProbeFilters []string `json:"probe_filters"`
+}
+
+// readDetails reads the definition of the HTTP check check from Pingdom.
+func (c *PingdomUptimeChecker) readDetails(ctx context.Context, check *monitor.UptimeCheck) error {
+	var res struct {
+		Check checkDetails `json:"check"`
+	}
+	if err := c.do(ctx, "read", "GET", "/checks/"+strconv.Itoa(check.ID), nil, &res); err != nil {
+		return err
+	}
+	d := res.Check
+	if h := d.Type.HTTP; h != nil {
+		check.EnableTLS = h.Encryption
+		if h.URL != "/" {
+			check.Path = h.URL
+		}
+		check.Keyword = h.ShouldContain
+	}
+	// checks alerting only the default contact were created without
+	// contacts of their own.
+	if len(d.ContactIDs) != 1 || d.ContactIDs[0] != c.userID {
+		for _, id := range d.ContactIDs {
+			check.Contacts = append(check.Contacts, strconv.Itoa(id))
+		}
+	}
+	for _, f := range d.ProbeFilters {
+		if r := strings.TrimPrefix(f, "region:"); r != f {
+			check.Regions = append(check.Regions, strings.TrimSpace(r))
+		}
+	}
+	return nil
+}
+
+func (c *PingdomUptimeChecker) CreateUptimeCheck(ctx context.Context, check *monitor.UptimeCheck) error {
+	params, err := c.checkParams("create", check, false)
 	if err != nil {
 		return err
 	}
-	for _, pc := range list {
-		c.uptimeChecks[pc.Hostname] = toUptimeCheck(pc)
+
+	var res struct {
+		Check pingdom.CheckResponse `json:"check"`
+	}
+	if err := c.do(ctx, "create", "POST", "/checks", params, &res); err != nil {
+		return err
 	}
+
+	check.ID = res.Check.ID
+	check.CheckIntervalInMinutes = resolution(check.CheckIntervalInMinutes)
+	c.uptimeChecks[check.Hostname] = check
+	delete(c.undefined, check.Hostname)
 	return nil
 }
 
-func (c *PingdomUptimeChecker) CreateUptimeCheck(check *UptimeCheck) error {
+// UpdateUptimeCheck modifies the existing check for check.Hostname to
+// match check.
+func (c *PingdomUptimeChecker) UpdateUptimeCheck(ctx context.Context, check *monitor.UptimeCheck) error {
+	existing, exists := c.uptimeChecks[check.Hostname]
+	if !exists {
+		return &monitor.Error{Kind: monitor.NotFound, Op: "update", Err: fmt.Errorf("no check for %q", check.Hostname)}
+	}
+	params, err := c.checkParams("update", check, true)
+	if err != nil {
+		return err
+	}
+	params["paused"] = strconv.FormatBool(check.Paused)
+	var res pingdom.PingdomResponse
+	if err := c.do(ctx, "update", "PUT", "/checks/"+strconv.Itoa(existing.ID), params, &res); err != nil {
+		return err
+	}
+
+	check.ID = existing.ID
+	check.CheckIntervalInMinutes = resolution(check.CheckIntervalInMinutes)
+	c.uptimeChecks[check.Hostname] = check
+	return nil
+}
+
+// Normalize returns check with its interval rounded up to a resolution
+// at which Pingdom can check.
+func (c *PingdomUptimeChecker) Normalize(check *monitor.UptimeCheck) *monitor.UptimeCheck {
+	n := *check
+	n.CheckIntervalInMinutes = resolution(check.CheckIntervalInMinutes)
+	return &n
+}
+
+// resolutions are the intervals, in minutes, at which Pingdom can check.
+var resolutions = []int{1, 5, 15, 30, 60}
+
+// resolution returns the shortest interval supported by Pingdom which
+// is at least minutes long.
+func resolution(minutes int) int {
+	for _, r := range resolutions {
+		if r >= minutes {
+			return r
+		}
+	}
+	return resolutions[len(resolutions)-1]
+}
+
+// Quota returns the number of checks the account has, and its limit.
+func (c *PingdomUptimeChecker) Quota(ctx context.Context) (used, limit int, err error) {
+	var res struct {
+		Credits struct {
+			CheckLimit      int `json:"checklimit"`
+			AvailableChecks int `json:"availablechecks"`
+		} `json:"credits"`
+	}
+	if err := c.do(ctx, "quota", "GET", "/credits", nil, &res); err != nil {
+		return 0, 0, err
+	}
+	return res.Credits.CheckLimit - res.Credits.AvailableChecks, res.Credits.CheckLimit, nil
+}
+
+// Availability returns the results of the check for hostName between
+// from and to, from Pingdom's outage summary.
+func (c *PingdomUptimeChecker) Availability(ctx context.Context, hostName string, from, to time.Time) (*monitor.Availability, error) {
+	check, exists := c.uptimeChecks[hostName]
+	if !exists {
+		return nil, &monitor.Error{Kind: monitor.NotFound, Op: "availability", Err: fmt.Errorf("no check for %q", hostName)}
+	}
+	var res struct {
+		Summary struct {
+			States []struct {
+				Status   string `json:"status"`
+				TimeFrom int64  `json:"timefrom"`
+				TimeTo   int64  `json:"timeto"`
+			} `json:"states"`
+		} `json:"summary"`
+	}
+	params := map[string]string{
+		"from":  strconv.FormatInt(from.Unix(), 10),
+		"to":    strconv.FormatInt(to.Unix(), 10),
+		"order": "asc",
+	}
+	if err := c.do(ctx, "availability", "GET", "/summary.outage/"+strconv.Itoa(check.ID), params, &res); err != nil {
+		return nil, err
+	}
+
+	a := new(monitor.Availability)
+	for _, s := range res.Summary.States {
+		start, end := time.Unix(s.TimeFrom, 0), time.Unix(s.TimeTo, 0)
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		if !end.After(start) {
+			continue
+		}
+		d := end.Sub(start)
+		switch s.Status {
+		case "up":
+			a.Up += d
+		case "down":
+			a.Down += d
+			if n := len(a.Outages); n > 0 && a.Outages[n-1].End.Equal(start) {
+				a.Outages[n-1].End = end
+			} else {
+				a.Outages = append(a.Outages, monitor.Outage{Start: start, End: end})
+			}
+		default:
+			a.Unknown += d
+		}
+	}
+	return a, nil
+}
+
+// checkParams returns the parameters with which check is created, or
+// updated if update is set, or an error of kind ValidationFailed if
+// Pingdom cannot run it.
+func (c *PingdomUptimeChecker) checkParams(op string, check *monitor.UptimeCheck, update bool) (map[string]string, error) {
+	if check.HTTP2 {
+		return nil, &monitor.Error{Kind: monitor.ValidationFailed, Op: op, Err: fmt.Errorf("pingdom cannot require HTTP/2 for %s", check.Hostname)}
+	}
+	if len(check.StatusCodes) > 0 {
+		return nil, &monitor.Error{Kind: monitor.ValidationFailed, Op: op, Err: fmt.Errorf("pingdom cannot check for status codes %v for %s", check.StatusCodes, check.Hostname)}
+	}
+	contactIDs, err := c.contactIDs(op, check.Contacts)
+	if err != nil {
+		return nil, err
+	}
+	probeFilters, err := probeFilters(op, check.Regions)
+	if err != nil {
+		return nil, err
+	}
 	pc := pingdom.HttpCheck{
 		Name:                     check.Name,
 		Hostname:                 check.Hostname,
-		Resolution:               check.CheckIntervalInMinutes,
+		Resolution:               resolution(check.CheckIntervalInMinutes),
 		Encryption:               check.EnableTLS,
+		Paused:                   check.Paused,
+		Url:                      check.Path,
+		ShouldContain:            check.Keyword,
 		SendNotificationWhenDown: 1, // TODO(dfc) no idea what this does, but the API barks if it is not set.
-		ContactIds:               []int{c.userID},
+		ContactIds:               contactIDs,
+	}
+	if err := pc.Valid(); err != nil {
+		return nil, &monitor.Error{Kind: monitor.ValidationFailed, Op: op, Err: err}
+	}
+	params := pc.PostParams()
+	if update {
+		params = pc.PutParams()
 	}
+	// always given, so that an update removes them when unset.
+	params["shouldcontain"] = check.Keyword
+	params["probe_filters"] = probeFilters
+	return params, nil
+}
 
-	res, err := c.client.Checks.Create(&pc)
-	if err == nil {
-		check.ID = res.ID
-		c.uptimeChecks[check.Hostname] = check
+// contactIDs returns the IDs of the notification contacts identified by
+// contacts, or the default contact if there are none.
+func (c *PingdomUptimeChecker) contactIDs(op string, contacts []string) ([]int, error) {
+	if len(contacts) == 0 {
+		return []int{c.userID}, nil
+	}
+	var ids []int
+	for _, contact := range contacts {
+		id, err := strconv.Atoi(contact)
+		if err != nil || !c.contacts[id] {
+			return nil, &monitor.Error{Kind: monitor.ValidationFailed, Op: op, Err: fmt.Errorf("unknown notification contact %q, expected the ID of one", contact)}
+		}
+		ids = append(ids, id)
 	}
+	return ids, nil
+}
 
+// ResolveContacts returns an error if any of contacts is not the ID of a
+// notification contact of the account.
+func (c *PingdomUptimeChecker) ResolveContacts(contacts []string) error {
+	_, err := c.contactIDs("resolve contacts", contacts)
 	return err
 }
 
-func (c *PingdomUptimeChecker) DeleteUptimeCheck(hostName string) error {
+// Regions are the regions from which Pingdom may run a check.
+var Regions = []string{"NA", "EU", "APAC", "LATAM"}
+
+// probeFilters returns the probe filter of a check run from regions.
+// Pingdom runs a check from every region, or from one.
+func probeFilters(op string, regions []string) (string, error) {
+	if len(regions) == 0 {
+		return "", nil
+	}
+	if len(regions) == 1 {
+		for _, r := range Regions {
+			if regions[0] == r {
+				return "region: " + r, nil
+			}
+		}
+	}
+	return "", &monitor.Error{Kind: monitor.ValidationFailed, Op: op, Err: fmt.Errorf("pingdom cannot check from regions %v, expected one of %s", regions, strings.Join(Regions, ", "))}
+}
+
+func (c *PingdomUptimeChecker) DeleteUptimeCheck(ctx context.Context, hostName string) error {
 	check, exists := c.uptimeChecks[hostName]
 	if !exists {
 		return nil
 	}
 
-	_, err := c.client.Checks.Delete(check.ID)
-	if err != nil {
+	var res pingdom.PingdomResponse
+	err := c.do(ctx, "delete", "DELETE", "/checks/"+strconv.Itoa(check.ID), nil, &res)
+	if err != nil && !monitor.IsNotFound(err) {
 		return err
 	}
 
 	delete(c.uptimeChecks, hostName)
+	delete(c.undefined, hostName)
 
 	return nil
 }
 
-func toUptimeCheck(c pingdom.CheckResponse) *UptimeCheck {
+func (c *PingdomUptimeChecker) PauseUptimeCheck(ctx context.Context, hostName string) error {
+	return c.setPaused(ctx, "pause", hostName, true)
+}
+
+func (c *PingdomUptimeChecker) ResumeUptimeCheck(ctx context.Context, hostName string) error {
+	return c.setPaused(ctx, "resume", hostName, false)
+}
+
+func (c *PingdomUptimeChecker) setPaused(ctx context.Context, op, hostName string, paused bool) error {
+	check, exists := c.uptimeChecks[hostName]
+	if !exists {
+		return &monitor.Error{Kind: monitor.NotFound, Op: op, Err: fmt.Errorf("no check for %q", hostName)}
+	}
+	if check.Paused == paused {
+		return nil
+	}
+
+	var res pingdom.PingdomResponse
+	params := map[string]string{"paused": strconv.FormatBool(paused)}
+	if err := c.do(ctx, op, "PUT", "/checks/"+strconv.Itoa(check.ID), params, &res); err != nil {
+		return err
+	}
+	check.Paused = paused
+	return nil
+}
+
+// do performs a single Pingdom API request bounded by ctx, decoding the
+// response into v. Requests are throttled according to the client side
+// rate limit and any limits reported by Pingdom. Any error is returned
+// as a *monitor.Error.
+func (c *PingdomUptimeChecker) do(ctx context.Context, op, method, rsc string, params map[string]string, v interface{}) error {
+	if err := c.throttle.Wait(ctx, op); err != nil {
+		return err
+	}
+	req, err := c.client.NewRequest(method, rsc, params)
+	if err != nil {
+		return &monitor.Error{Kind: monitor.Unknown, Op: op, Err: err}
+	}
+	resp, err := c.client.Do(req.WithContext(ctx), v)
+	if resp != nil {
+		c.throttle.Delay(retryAfter(resp))
+	}
+	err = wrapError(ctx, op, err)
+	if e, ok := err.(*monitor.Error); ok && e.Kind == monitor.RateLimited {
+		e.RetryAfter = c.throttle.Backoff()
+	}
+	return err
+}
+
+func toUptimeCheck(c pingdom.CheckResponse) *monitor.UptimeCheck {
 	rp := regexp.MustCompile("443")
-	return &UptimeCheck{
+	return &monitor.UptimeCheck{
 		Hostname:               c.Hostname,
 		ID:                     c.ID,
 		Name:                   c.Name,
 		CheckIntervalInMinutes: c.Resolution,
 		EnableTLS:              rp.MatchString(c.Name), // Pingdom API does not show it so we need to rely on the name
+		Paused:                 c.Status == "paused",
+		Status:                 status(c.Status),
+	}
+}
+
+// status returns the UptimeCheck.Status for a Pingdom check status.
+func status(s string) string {
+	switch s {
+	case "up":
+		return monitor.StatusUp
+	case "down", "unconfirmed_down":
+		return monitor.StatusDown
+	default:
+		return ""
 	}
 }
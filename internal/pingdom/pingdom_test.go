@@ -1,9 +1,21 @@
 package pingdom
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/heptiolabs/cruise/internal/monitor"
+	"github.com/heptiolabs/cruise/internal/monitor/monitortest"
+	"github.com/russellcardullo/go-pingdom/pingdom"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -29,17 +41,18 @@ func TestPingdomUptimeChecker(t *testing.T) {
 		t.Skip("skipping live test")
 	}
 
-	c, err := NewPindomUptimeChecker(username, password, apikey)
+	ctx := context.Background()
+	c, err := NewPindomUptimeChecker(ctx, username, password, apikey, monitor.RateLimit{})
 	assert.Nil(t, err)
 
-	check := &UptimeCheck{
+	check := &monitor.UptimeCheck{
 		Hostname:               "google.com",
 		Name:                   "mynamespace / google (google.com:443)",
 		EnableTLS:              true,
 		CheckIntervalInMinutes: 1,
 	}
 
-	err = c.CreateUptimeCheck(check)
+	err = c.CreateUptimeCheck(ctx, check)
 	assert.Nil(t, err)
 	assert.Equal(t, "google.com", c.UptimeChecks()["google.com"].Hostname)
 	assert.Equal(t, "mynamespace / google (google.com:443)", c.UptimeChecks()["google.com"].Name)
@@ -47,9 +60,9 @@ func TestPingdomUptimeChecker(t *testing.T) {
 	assert.True(t, c.UptimeChecks()["google.com"].EnableTLS)
 	assert.NotEqual(t, "", c.UptimeChecks()["google.com"].ID)
 
-	n, err := NewPindomUptimeChecker(username, password, apikey)
+	n, err := NewPindomUptimeChecker(ctx, username, password, apikey, monitor.RateLimit{})
 	assert.Nil(t, err)
-	err = n.SyncUptimeChecks()
+	err = n.SyncUptimeChecks(ctx)
 	assert.Nil(t, err)
 	assert.Equal(t, "google.com", c.UptimeChecks()["google.com"].Hostname)
 	assert.Equal(t, "mynamespace / google (google.com:443)", c.UptimeChecks()["google.com"].Name)
@@ -57,7 +70,642 @@ func TestPingdomUptimeChecker(t *testing.T) {
 	assert.True(t, c.UptimeChecks()["google.com"].EnableTLS)
 	assert.NotEqual(t, "", c.UptimeChecks()["google.com"].ID)
 
-	err = n.DeleteUptimeCheck(check.Hostname)
+	err = n.DeleteUptimeCheck(ctx, check.Hostname)
 	assert.Nil(t, err)
 	assert.Nil(t, n.UptimeChecks()["google.com"])
 }
+
+// fakePingdom is an in memory stand in for the Pingdom 2.0 API.
+type fakePingdom struct {
+	mu     sync.Mutex
+	nextID int
+	checks map[int]fakeCheck
+
+	// fail, if set, is consulted before each request is handled. A
+	// non zero status causes the request to fail with that status.
+	fail func(r *http.Request) int
+
+	// delay, if set, is slept before each request is handled.
+	delay time.Duration
+
+	// header is added to every response.
+	header http.Header
+
+	requests int
+}
+
+// fakeCheck is a check stored by fakePingdom.
+type fakeCheck struct {
+	pingdom.CheckResponse
+	Type          string // "http" if empty
+	URL           string
+	Encryption    bool
+	ShouldContain string
+	ContactIDs    []int
+	ProbeFilters  []string
+}
+
+func newFakePingdom() *fakePingdom {
+	return &fakePingdom{
+		nextID: 1,
+		checks: make(map[int]fakeCheck),
+	}
+}
+
+// set updates c from the parameters of a request to create or update it.
+func (c *fakeCheck) set(q url.Values) {
+	if name := q.Get("name"); name != "" {
+		c.Name = name
+	}
+	if host := q.Get("host"); host != "" {
+		c.Hostname = host
+	}
+	fmt.Sscan(q.Get("resolution"), &c.Resolution)
+	if _, ok := q["url"]; ok {
+		c.URL = q.Get("url")
+		if c.URL == "" {
+			c.URL = "/"
+		}
+	}
+	if _, ok := q["encryption"]; ok {
+		c.Encryption = q.Get("encryption") == "true"
+	}
+	if _, ok := q["shouldcontain"]; ok {
+		c.ShouldContain = q.Get("shouldcontain")
+	}
+	if ids := q.Get("contactids"); ids != "" {
+		c.ContactIDs = nil
+		for _, id := range strings.Split(ids, ",") {
+			var n int
+			fmt.Sscan(id, &n)
+			c.ContactIDs = append(c.ContactIDs, n)
+		}
+	}
+	if _, ok := q["probe_filters"]; ok {
+		c.ProbeFilters = nil
+		if f := q.Get("probe_filters"); f != "" {
+			c.ProbeFilters = []string{f}
+		}
+	}
+	switch q.Get("paused") {
+	case "true":
+		c.Status = "paused"
+	case "false":
+		c.Status = "up"
+	}
+}
+
+func (f *fakePingdom) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if f.delay > 0 {
+		select {
+		case <-time.After(f.delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests++
+	for k, v := range f.header {
+		w.Header()[k] = v
+	}
+	if f.fail != nil {
+		if status := f.fail(r); status != 0 {
+			writeError(w, status)
+			return
+		}
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/api/2.0")
+	switch {
+	case r.Method == "GET" && path == "/notification_contacts":
+		writeJSON(w, map[string]interface{}{
+			"contacts": []map[string]interface{}{{"id": 42, "name": "billing"}, {"id": 7, "name": "ops"}},
+		})
+	case r.Method == "GET" && path == "/credits":
+		writeJSON(w, map[string]interface{}{
+			"credits": map[string]interface{}{"checklimit": 10, "availablechecks": 10 - len(f.checks)},
+		})
+	case r.Method == "GET" && strings.HasPrefix(path, "/summary.outage/"):
+		writeJSON(w, map[string]interface{}{
+			"summary": map[string]interface{}{"states": []map[string]interface{}{
+				{"status": "up", "timefrom": 1000, "timeto": 2000},
+				{"status": "down", "timefrom": 2000, "timeto": 2060},
+				{"status": "up", "timefrom": 2060, "timeto": 3000},
+				{"status": "unknown", "timefrom": 3000, "timeto": 3600},
+				{"status": "down", "timefrom": 3600, "timeto": 4000},
+			}},
+		})
+	case r.Method == "GET" && path == "/checks":
+		var list []listedCheck
+		for _, c := range f.checks {
+			typ := c.Type
+			if typ == "" {
+				typ = "http"
+			}
+			list = append(list, listedCheck{CheckResponse: c.CheckResponse, Type: typ})
+		}
+		writeJSON(w, map[string]interface{}{"checks": list})
+	case r.Method == "GET" && strings.HasPrefix(path, "/checks/"):
+		var id int
+		fmt.Sscan(strings.TrimPrefix(path, "/checks/"), &id)
+		c, ok := f.checks[id]
+		if !ok {
+			writeError(w, http.StatusNotFound)
+			return
+		}
+		writeJSON(w, map[string]interface{}{
+			"check": map[string]interface{}{
+				"id":       c.ID,
+				"name":     c.Name,
+				"hostname": c.Hostname,
+				"type": map[string]interface{}{
+					"http": map[string]interface{}{
+						"url":           c.URL,
+						"encryption":    c.Encryption,
+						"shouldcontain": c.ShouldContain,
+					},
+				},
+				"contactids":    c.ContactIDs,
+				"probe_filters": c.ProbeFilters,
+			},
+		})
+	case r.Method == "POST" && path == "/checks":
+		id := f.nextID
+		f.nextID++
+		c := fakeCheck{CheckResponse: pingdom.CheckResponse{ID: id}}
+		c.set(r.URL.Query())
+		f.checks[id] = c
+		writeJSON(w, map[string]interface{}{
+			"check": map[string]interface{}{"id": id, "name": r.URL.Query().Get("name")},
+		})
+	case r.Method == "PUT" && strings.HasPrefix(path, "/checks/"):
+		var id int
+		fmt.Sscan(strings.TrimPrefix(path, "/checks/"), &id)
+		c, ok := f.checks[id]
+		if !ok {
+			writeError(w, http.StatusNotFound)
+			return
+		}
+		c.set(r.URL.Query())
+		f.checks[id] = c
+		writeJSON(w, map[string]interface{}{"message": "Modification of check was successful!"})
+	case r.Method == "DELETE" && strings.HasPrefix(path, "/checks/"):
+		var id int
+		fmt.Sscan(strings.TrimPrefix(path, "/checks/"), &id)
+		if _, ok := f.checks[id]; !ok {
+			writeError(w, http.StatusNotFound)
+			return
+		}
+		delete(f.checks, id)
+		writeJSON(w, map[string]interface{}{"message": "Deletion of check was successful!"})
+	default:
+		writeError(w, http.StatusBadRequest)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"statuscode":   status,
+			"statusdesc":   http.StatusText(status),
+			"errormessage": "fake error",
+		},
+	})
+}
+
+// newFakeClient returns a Pingdom client which talks to f. The caller
+// must close the returned server.
+func newFakeClient(t *testing.T, f *fakePingdom) (*pingdom.Client, *httptest.Server) {
+	srv := httptest.NewServer(f)
+	client := pingdom.NewClient("user", "password", "key")
+	u, err := url.Parse(srv.URL + "/api/2.0")
+	check(t, err)
+	client.BaseURL = u
+	return client, srv
+}
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPingdomUptimeCheckerFake(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePingdom()
+	client, srv := newFakeClient(t, f)
+	defer srv.Close()
+	c, err := newPingdomUptimeChecker(ctx, client, monitor.RateLimit{})
+	check(t, err)
+	assert.Equal(t, 42, c.userID)
+
+	uc := &monitor.UptimeCheck{
+		Hostname:               "example.com",
+		Name:                   "mynamespace/example (example.com:443)",
+		EnableTLS:              true,
+		CheckIntervalInMinutes: 1,
+	}
+	check(t, c.CreateUptimeCheck(ctx, uc))
+	assert.Equal(t, 1, uc.ID)
+	assert.Len(t, f.checks, 1)
+
+	n, err := newPingdomUptimeChecker(ctx, client, monitor.RateLimit{})
+	check(t, err)
+	assert.Equal(t, "mynamespace/example (example.com:443)", n.UptimeChecks()["example.com"].Name)
+	assert.True(t, n.UptimeChecks()["example.com"].EnableTLS)
+
+	check(t, n.DeleteUptimeCheck(ctx, "example.com"))
+	assert.Empty(t, f.checks)
+	assert.Nil(t, n.UptimeChecks()["example.com"])
+}
+
+func TestPingdomUptimeCheckerUpdate(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePingdom()
+	client, srv := newFakeClient(t, f)
+	defer srv.Close()
+	c, err := newPingdomUptimeChecker(ctx, client, monitor.RateLimit{})
+	check(t, err)
+
+	check(t, c.CreateUptimeCheck(ctx, &monitor.UptimeCheck{Hostname: "example.com", Name: "example", CheckIntervalInMinutes: 1}))
+	updated := &monitor.UptimeCheck{Hostname: "example.com", Name: "renamed", CheckIntervalInMinutes: 5}
+	check(t, c.UpdateUptimeCheck(ctx, updated))
+	assert.Equal(t, 1, updated.ID)
+	assert.Equal(t, "renamed", f.checks[1].Name)
+	assert.Equal(t, 5, f.checks[1].Resolution)
+	assert.True(t, updated == c.UptimeChecks()["example.com"])
+
+	err = c.UpdateUptimeCheck(ctx, &monitor.UptimeCheck{Hostname: "example.org", Name: "missing"})
+	assert.True(t, monitor.IsNotFound(err))
+}
+
+func TestPingdomUptimeCheckerDefinition(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePingdom()
+	client, srv := newFakeClient(t, f)
+	defer srv.Close()
+	c, err := newPingdomUptimeChecker(ctx, client, monitor.RateLimit{})
+	check(t, err)
+
+	uc := &monitor.UptimeCheck{
+		Hostname:               "example.com",
+		Name:                   "mynamespace/example (example.com:443)",
+		EnableTLS:              true,
+		CheckIntervalInMinutes: 5,
+		Path:                   "/healthz",
+		Keyword:                "ok",
+		Contacts:               []string{"7"},
+		Regions:                []string{"EU"},
+	}
+	check(t, c.CreateUptimeCheck(ctx, uc))
+	assert.Equal(t, "/healthz", f.checks[1].URL)
+	assert.Equal(t, "ok", f.checks[1].ShouldContain)
+	assert.Equal(t, []int{7}, f.checks[1].ContactIDs)
+	assert.Equal(t, []string{"region: EU"}, f.checks[1].ProbeFilters)
+
+	// a restarted checker reads back the same definition, so the check
+	// is not updated needlessly.
+	n, err := newPingdomUptimeChecker(ctx, client, monitor.RateLimit{})
+	check(t, err)
+	assert.True(t, monitor.SameCheck(n.UptimeChecks()["example.com"], uc), "%+v", n.UptimeChecks()["example.com"])
+
+	plain := &monitor.UptimeCheck{Hostname: "example.com", Name: "mynamespace/example (example.com:80)", CheckIntervalInMinutes: 5}
+	check(t, n.UpdateUptimeCheck(ctx, plain))
+	assert.Equal(t, "", f.checks[1].ShouldContain)
+	assert.Equal(t, []int{42}, f.checks[1].ContactIDs)
+	assert.Empty(t, f.checks[1].ProbeFilters)
+
+	n, err = newPingdomUptimeChecker(ctx, client, monitor.RateLimit{})
+	check(t, err)
+	assert.True(t, monitor.SameCheck(n.UptimeChecks()["example.com"], plain), "%+v", n.UptimeChecks()["example.com"])
+}
+
+func TestPingdomUptimeCheckerDefined(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePingdom()
+	f.checks[100] = fakeCheck{CheckResponse: pingdom.CheckResponse{ID: 100, Name: "ping", Hostname: "ping.example.com", Resolution: 1}, Type: "ping"}
+	client, srv := newFakeClient(t, f)
+	defer srv.Close()
+	c, err := newPingdomUptimeChecker(ctx, client, monitor.RateLimit{})
+	check(t, err)
+	check(t, c.CreateUptimeCheck(ctx, &monitor.UptimeCheck{Hostname: "example.com", Name: "example", CheckIntervalInMinutes: 1}))
+
+	assert.Contains(t, c.UptimeChecks(), "ping.example.com")
+	assert.False(t, c.Defined("ping.example.com"))
+	assert.True(t, c.Defined("example.com"))
+}
+
+func TestPingdomUptimeCheckerResolution(t *testing.T) {
+	tests := map[int]int{0: 1, 1: 1, 2: 5, 10: 15, 30: 30, 45: 60, 120: 60}
+
+	ctx := context.Background()
+	f := newFakePingdom()
+	client, srv := newFakeClient(t, f)
+	defer srv.Close()
+	c, err := newPingdomUptimeChecker(ctx, client, monitor.RateLimit{})
+	check(t, err)
+
+	for minutes, want := range tests {
+		uc := &monitor.UptimeCheck{Hostname: fmt.Sprintf("%d.example.com", minutes), Name: "example", CheckIntervalInMinutes: minutes}
+		assert.Equal(t, want, c.Normalize(uc).CheckIntervalInMinutes)
+
+		// HttpCheck.Valid rejects the resolutions Pingdom does not support.
+		_, err := c.checkParams("create", uc, false)
+		check(t, err)
+		check(t, c.CreateUptimeCheck(ctx, uc))
+		assert.Equal(t, want, f.checks[uc.ID].Resolution)
+	}
+
+	n, err := newPingdomUptimeChecker(ctx, client, monitor.RateLimit{})
+	check(t, err)
+	for minutes := range tests {
+		uc := &monitor.UptimeCheck{Hostname: fmt.Sprintf("%d.example.com", minutes), Name: "example", CheckIntervalInMinutes: minutes}
+		assert.True(t, monitor.SameCheck(n.UptimeChecks()[uc.Hostname], n.Normalize(uc)), "%d minutes", minutes)
+	}
+}
+
+func TestPingdomUptimeCheckerUnsupported(t *testing.T) {
+	tests := map[string]monitor.UptimeCheck{
+		"http2":           {HTTP2: true},
+		"status codes":    {StatusCodes: []int{200, 301}},
+		"several regions": {Regions: []string{"EU", "NA"}},
+		"unknown region":  {Regions: []string{"eu-west-1"}},
+		"contact name":    {Contacts: []string{"ops"}},
+		"unknown contact": {Contacts: []string{"99"}},
+	}
+
+	ctx := context.Background()
+	f := newFakePingdom()
+	client, srv := newFakeClient(t, f)
+	defer srv.Close()
+	c, err := newPingdomUptimeChecker(ctx, client, monitor.RateLimit{})
+	check(t, err)
+	check(t, c.ResolveContacts([]string{"42", "7"}))
+
+	for name, uc := range tests {
+		t.Run(name, func(t *testing.T) {
+			uc.Hostname, uc.Name = "example.com", "example"
+			requests := f.requests
+			err := c.CreateUptimeCheck(ctx, &uc)
+			assert.Equal(t, monitor.ValidationFailed, monitor.KindOf(err), "%v", err)
+			assert.Equal(t, requests, f.requests)
+			assert.Empty(t, c.UptimeChecks())
+		})
+	}
+	assert.Equal(t, monitor.ValidationFailed, monitor.KindOf(c.ResolveContacts([]string{"ops"})))
+}
+
+func TestPingdomUptimeCheckerPause(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePingdom()
+	client, srv := newFakeClient(t, f)
+	defer srv.Close()
+	c, err := newPingdomUptimeChecker(ctx, client, monitor.RateLimit{})
+	check(t, err)
+
+	check(t, c.CreateUptimeCheck(ctx, &monitor.UptimeCheck{Hostname: "example.com", Name: "example"}))
+	check(t, c.PauseUptimeCheck(ctx, "example.com"))
+	assert.True(t, c.UptimeChecks()["example.com"].Paused)
+	assert.Equal(t, "paused", f.checks[1].Status)
+
+	n, err := newPingdomUptimeChecker(ctx, client, monitor.RateLimit{})
+	check(t, err)
+	assert.True(t, n.UptimeChecks()["example.com"].Paused)
+
+	check(t, n.ResumeUptimeCheck(ctx, "example.com"))
+	assert.False(t, n.UptimeChecks()["example.com"].Paused)
+	assert.Equal(t, "up", f.checks[1].Status)
+
+	err = n.PauseUptimeCheck(ctx, "example.org")
+	assert.True(t, monitor.IsNotFound(err))
+}
+
+func TestPingdomUptimeCheckerQuota(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePingdom()
+	client, srv := newFakeClient(t, f)
+	defer srv.Close()
+	c, err := newPingdomUptimeChecker(ctx, client, monitor.RateLimit{})
+	check(t, err)
+
+	check(t, c.CreateUptimeCheck(ctx, &monitor.UptimeCheck{Hostname: "example.com", Name: "example"}))
+	used, limit, err := c.Quota(ctx)
+	check(t, err)
+	assert.Equal(t, 1, used)
+	assert.Equal(t, 10, limit)
+}
+
+func TestPingdomUptimeCheckerAvailability(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePingdom()
+	client, srv := newFakeClient(t, f)
+	defer srv.Close()
+	c, err := newPingdomUptimeChecker(ctx, client, monitor.RateLimit{})
+	check(t, err)
+
+	check(t, c.CreateUptimeCheck(ctx, &monitor.UptimeCheck{Hostname: "example.com", Name: "example"}))
+	a, err := c.Availability(ctx, "example.com", time.Unix(1500, 0), time.Unix(3700, 0))
+	check(t, err)
+	assert.Equal(t, 1440*time.Second, a.Up)
+	assert.Equal(t, 160*time.Second, a.Down)
+	assert.Equal(t, 600*time.Second, a.Unknown)
+	assert.Equal(t, []monitor.Outage{
+		{Start: time.Unix(2000, 0), End: time.Unix(2060, 0)},
+		{Start: time.Unix(3600, 0), End: time.Unix(3700, 0)},
+	}, a.Outages)
+
+	_, err = c.Availability(ctx, "example.org", time.Unix(0, 0), time.Unix(1, 0))
+	assert.True(t, monitor.IsNotFound(err))
+}
+
+func TestPingdomUptimeCheckerErrorKinds(t *testing.T) {
+	tests := map[int]monitor.ErrorKind{
+		http.StatusUnauthorized:        monitor.AuthFailed,
+		http.StatusForbidden:           monitor.AuthFailed,
+		http.StatusTooManyRequests:     monitor.RateLimited,
+		http.StatusBadRequest:          monitor.ValidationFailed,
+		http.StatusInternalServerError: monitor.Transient,
+		http.StatusServiceUnavailable:  monitor.Transient,
+	}
+	for status, want := range tests {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			ctx := context.Background()
+			f := newFakePingdom()
+			client, srv := newFakeClient(t, f)
+			defer srv.Close()
+			c, err := newPingdomUptimeChecker(ctx, client, monitor.RateLimit{})
+			check(t, err)
+
+			f.fail = func(*http.Request) int { return status }
+			err = c.CreateUptimeCheck(ctx, &monitor.UptimeCheck{Hostname: "example.com", Name: "example"})
+			assert.Equal(t, want, monitor.KindOf(err))
+			assert.Empty(t, c.UptimeChecks())
+		})
+	}
+}
+
+func TestPingdomUptimeCheckerContract(t *testing.T) {
+	monitortest.Run(t, func() monitortest.Backend {
+		f := newFakePingdom()
+		return monitortest.Backend{
+			New: func(t *testing.T) (monitor.UptimeChecker, *httptest.Server) {
+				client, srv := newFakeClient(t, f)
+				c, err := newPingdomUptimeChecker(context.Background(), client, monitor.RateLimit{})
+				if err != nil {
+					srv.Close()
+					t.Fatal(err)
+				}
+				return c, srv
+			},
+			Len: func() int { return len(f.checks) },
+			RateLimit: func() {
+				f.header = http.Header{"Retry-After": []string{"120"}}
+				f.fail = func(*http.Request) int { return http.StatusTooManyRequests }
+			},
+		}
+	})
+}
+
+func TestPingdomUptimeCheckerDeadline(t *testing.T) {
+	f := newFakePingdom()
+	client, srv := newFakeClient(t, f)
+	defer srv.Close()
+	c, err := newPingdomUptimeChecker(context.Background(), client, monitor.RateLimit{})
+	check(t, err)
+
+	f.delay = time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = c.SyncUptimeChecks(ctx)
+	assert.Equal(t, monitor.Transient, monitor.KindOf(err))
+	assert.True(t, monitor.IsRetryable(err))
+}
+
+func TestPingdomUptimeCheckerRetryAfter(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePingdom()
+	client, srv := newFakeClient(t, f)
+	defer srv.Close()
+	c, err := newPingdomUptimeChecker(ctx, client, monitor.RateLimit{})
+	check(t, err)
+
+	f.header = http.Header{"Retry-After": []string{"120"}}
+	f.fail = func(*http.Request) int { return http.StatusTooManyRequests }
+	err = c.CreateUptimeCheck(ctx, &monitor.UptimeCheck{Hostname: "example.com", Name: "example"})
+	assert.Equal(t, monitor.RateLimited, monitor.KindOf(err))
+
+	// subsequent calls fail without contacting Pingdom until the limit resets.
+	requests := f.requests
+	err = c.SyncUptimeChecks(ctx)
+	assert.Equal(t, monitor.RateLimited, monitor.KindOf(err))
+	assert.True(t, monitor.RetryAfter(err) > 0)
+	assert.Equal(t, requests, f.requests)
+}
+
+func TestPingdomUptimeCheckerReqLimitExhausted(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePingdom()
+	client, srv := newFakeClient(t, f)
+	defer srv.Close()
+	c, err := newPingdomUptimeChecker(ctx, client, monitor.RateLimit{})
+	check(t, err)
+
+	f.header = http.Header{
+		"Req-Limit-Short": []string{"Remaining: 0 Time until reset: 30"},
+		"Req-Limit-Long":  []string{"Remaining: 9000 Time until reset: 2000"},
+	}
+	check(t, c.CreateUptimeCheck(ctx, &monitor.UptimeCheck{Hostname: "example.com", Name: "example"}))
+
+	err = c.CreateUptimeCheck(ctx, &monitor.UptimeCheck{Hostname: "example.org", Name: "example"})
+	assert.Equal(t, monitor.RateLimited, monitor.KindOf(err))
+	assert.True(t, monitor.RetryAfter(err) <= 30*time.Second)
+	assert.Len(t, f.checks, 1)
+}
+
+func TestPingdomUptimeCheckerClientRateLimit(t *testing.T) {
+	f := newFakePingdom()
+	client, srv := newFakeClient(t, f)
+	defer srv.Close()
+
+	// a burst of two permits the contact and check lists made at startup.
+	c, err := newPingdomUptimeChecker(context.Background(), client, monitor.RateLimit{QPS: 0.01, Burst: 2})
+	check(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = c.SyncUptimeChecks(ctx)
+	assert.Equal(t, monitor.RateLimited, monitor.KindOf(err))
+	assert.Equal(t, 2, f.requests)
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := map[string]struct {
+		status int
+		header http.Header
+		want   time.Duration
+	}{
+		"no headers": {
+			status: http.StatusOK,
+			want:   0,
+		},
+		"retry after": {
+			status: http.StatusTooManyRequests,
+			header: http.Header{"Retry-After": []string{"7"}},
+			want:   7 * time.Second,
+		},
+		"limits remaining": {
+			status: http.StatusOK,
+			header: http.Header{
+				"Req-Limit-Short": []string{"Remaining: 394 Time until reset: 3589"},
+				"Req-Limit-Long":  []string{"Remaining: 71964 Time until reset: 2591989"},
+			},
+			want: 0,
+		},
+		"long limit exhausted": {
+			status: http.StatusOK,
+			header: http.Header{
+				"Req-Limit-Short": []string{"Remaining: 394 Time until reset: 3589"},
+				"Req-Limit-Long":  []string{"Remaining: 0 Time until reset: 60"},
+			},
+			want: time.Minute,
+		},
+		"too many requests without hint": {
+			status: http.StatusTooManyRequests,
+			want:   time.Minute,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tc.status, Header: tc.header}
+			if resp.Header == nil {
+				resp.Header = http.Header{}
+			}
+			assert.Equal(t, tc.want, retryAfter(resp))
+		})
+	}
+}
+
+func TestStatus(t *testing.T) {
+	tests := map[string]string{
+		"up":               monitor.StatusUp,
+		"down":             monitor.StatusDown,
+		"unconfirmed_down": monitor.StatusDown,
+		"unknown":          "",
+		"paused":           "",
+	}
+	for s, want := range tests {
+		assert.Equal(t, want, status(s), s)
+	}
+}
@@ -0,0 +1,47 @@
+package pingdom
+
+import (
+	"context"
+	"os"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+	"github.com/heptiolabs/cruise/internal/secret"
+)
+
+func init() {
+	monitor.Register("pingdom", func() monitor.Provider { return new(provider) })
+}
+
+// provider configures a PingdomUptimeChecker from command line flags.
+type provider struct {
+	username         string
+	password, apikey secret.Value
+
+	// deprecated unprefixed flags, retained for compatibility.
+	oldUsername, oldPassword, oldAPIKey string
+}
+
+func (p *provider) Flags(fs monitor.FlagSet) {
+	fs.Flag("pingdom-username", "Pingdom Username").Default(os.Getenv("PINGDOM_USERNAME")).StringVar(&p.username)
+	p.password.Flags(fs, "pingdom-password", "Pingdom Password", "PINGDOM_PASSWORD")
+	p.apikey.Flags(fs, "pingdom-apikey", "Pingdom API Key", "PINGDOM_APIKEY")
+	fs.Flag("username", "Pingdom Username (deprecated, use --pingdom-username)").Hidden().StringVar(&p.oldUsername)
+	fs.Flag("password", "Pingdom Password (deprecated, use --pingdom-password-file)").Hidden().Action(secret.Deprecated("password", "pingdom-password", "PINGDOM_PASSWORD")).SetValue(secret.String(&p.oldPassword))
+	fs.Flag("apikey", "Pingdom API Key (deprecated, use --pingdom-apikey-file)").Hidden().Action(secret.Deprecated("apikey", "pingdom-apikey", "PINGDOM_APIKEY")).SetValue(secret.String(&p.oldAPIKey))
+}
+
+func (p *provider) New(ctx context.Context, opts monitor.Options) (monitor.UptimeChecker, error) {
+	return NewPindomUptimeChecker(ctx,
+		either(p.oldUsername, p.username),
+		either(p.oldPassword, p.password.Secret()),
+		either(p.oldAPIKey, p.apikey.Secret()),
+		opts.RateLimit)
+}
+
+// either returns a if it is not empty, otherwise b.
+func either(a, b string) string {
+	if a != "" {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,40 @@
+package pingdom
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+)
+
+// retryAfter returns how long resp asks the client to wait before making
+// another request. Pingdom reports its short and long term limits in the
+// Req-Limit-Short and Req-Limit-Long headers, eg.
+//
+//	Req-Limit-Short: Remaining: 394 Time until reset: 3589
+//
+// Once either limit is exhausted no further requests are permitted until
+// it resets. A Retry-After header, if present, takes precedence.
+func retryAfter(resp *http.Response) time.Duration {
+	if resp.Header.Get("Retry-After") != "" {
+		return monitor.RetryAfterHeader(resp)
+	}
+
+	var d time.Duration
+	for _, h := range []string{"Req-Limit-Short", "Req-Limit-Long"} {
+		var remaining, reset int
+		if _, err := fmt.Sscanf(resp.Header.Get(h), "Remaining: %d Time until reset: %d", &remaining, &reset); err != nil {
+			continue
+		}
+		if remaining <= 0 {
+			if r := time.Duration(reset) * time.Second; r > d {
+				d = r
+			}
+		}
+	}
+	if d == 0 {
+		d = monitor.RetryAfterHeader(resp)
+	}
+	return d
+}
@@ -0,0 +1,83 @@
+package prober
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	probeUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "cruise",
+		Subsystem: "probe",
+		Name:      "up",
+		Help:      "Whether the host is up, ie. fewer than the failure threshold of consecutive probes have failed.",
+	}, []string{"hostname"})
+
+	probeSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "cruise",
+		Subsystem: "probe",
+		Name:      "success",
+		Help:      "Whether the last probe of the host passed.",
+	}, []string{"hostname"})
+
+	probeStatusCode = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "cruise",
+		Subsystem: "probe",
+		Name:      "status_code",
+		Help:      "Status code of the response to the last probe of the host, 0 if there was none.",
+	}, []string{"hostname"})
+
+	probeDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "cruise",
+		Subsystem: "probe",
+		Name:      "duration_seconds",
+		Help:      "Duration of the last probe of the host.",
+	}, []string{"hostname"})
+
+	probeTLSExpiry = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "cruise",
+		Subsystem: "probe",
+		Name:      "tls_expiry_timestamp_seconds",
+		Help:      "Expiry of the certificate presented by the host, as a Unix timestamp.",
+	}, []string{"hostname"})
+
+	probeFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cruise",
+		Subsystem: "probe",
+		Name:      "failures_total",
+		Help:      "Number of failed probes of the host.",
+	}, []string{"hostname"})
+)
+
+func init() {
+	prometheus.MustRegister(probeUp, probeSuccess, probeStatusCode, probeDuration, probeTLSExpiry, probeFailures)
+}
+
+func updateMetrics(hostname string, s *Status) {
+	probeUp.WithLabelValues(hostname).Set(boolValue(s.Up))
+	probeSuccess.WithLabelValues(hostname).Set(boolValue(s.Last.OK()))
+	probeStatusCode.WithLabelValues(hostname).Set(float64(s.Last.StatusCode))
+	probeDuration.WithLabelValues(hostname).Set(s.Last.Latency.Seconds())
+	if !s.Last.TLSExpiry.IsZero() {
+		probeTLSExpiry.WithLabelValues(hostname).Set(float64(s.Last.TLSExpiry.Unix()))
+	}
+	failures := probeFailures.WithLabelValues(hostname)
+	if !s.Last.OK() {
+		failures.Inc()
+	}
+}
+
+func deleteMetrics(hostname string) {
+	probeUp.DeleteLabelValues(hostname)
+	probeSuccess.DeleteLabelValues(hostname)
+	probeStatusCode.DeleteLabelValues(hostname)
+	probeDuration.DeleteLabelValues(hostname)
+	probeTLSExpiry.DeleteLabelValues(hostname)
+	probeFailures.DeleteLabelValues(hostname)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,119 @@
+package prober
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Alert reports that a host has gone down or come back up.
+type Alert struct {
+	Status Status
+}
+
+// Notifier raises alerts.
+type Notifier interface {
+	Notify(alert Alert) error
+}
+
+// LogNotifier logs alerts.
+type LogNotifier struct {
+	Logger logrus.FieldLogger
+}
+
+func (n *LogNotifier) Notify(alert Alert) error {
+	s := &alert.Status
+	logger := n.Logger.WithField("hostname", s.Check.Hostname).WithField("name", s.Check.Name)
+	if s.Up {
+		logger.Infof("up: status %d in %v", s.Last.StatusCode, s.Last.Latency)
+		return nil
+	}
+	logger.Warnf("down after %d failed probes: %s", s.Failures, s.Last.Err)
+	return nil
+}
+
+// WebhookNotifier posts alerts as JSON to a URL.
+type WebhookNotifier struct {
+	URL     string
+	Client  *http.Client
+	Timeout time.Duration
+}
+
+// webhookPayload is the body posted by a WebhookNotifier.
+type webhookPayload struct {
+	Hostname   string    `json:"hostname"`
+	Name       string    `json:"name"`
+	URL        string    `json:"url"`
+	Up         bool      `json:"up"`
+	Failures   int       `json:"failures"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+func (n *WebhookNotifier) Notify(alert Alert) error {
+	s := &alert.Status
+	buf, err := json.Marshal(&webhookPayload{
+		Hostname:   s.Check.Hostname,
+		Name:       s.Check.Name,
+		URL:        checkURL(&s.Check),
+		Up:         s.Up,
+		Failures:   s.Failures,
+		StatusCode: s.Last.StatusCode,
+		Error:      s.Last.Err,
+		Time:       s.Last.Time,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", n.URL, bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	timeout := n.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	client := n.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s: %s", n.URL, resp.Status)
+	}
+	return nil
+}
+
+// Notifiers raises each alert with every Notifier.
+type Notifiers []Notifier
+
+func (ns Notifiers) Notify(alert Alert) error {
+	var errs []error
+	for _, n := range ns {
+		if err := n.Notify(alert); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return fmt.Errorf("%d notifiers failed, first: %v", len(errs), errs[0])
+	}
+}
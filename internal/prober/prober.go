@@ -0,0 +1,382 @@
+// Package prober implements an UptimeChecker which probes hosts itself,
+// for clusters which cannot reach a monitoring service.
+package prober
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/http2"
+)
+
+// maxBody is the most of a response body searched for a check's keyword.
+const maxBody = 1 << 20
+
+// Config configures a ProberUptimeChecker.
+type Config struct {
+	// Timeout bounds each probe.
+	Timeout time.Duration
+
+	// FailureThreshold is the number of consecutive failed probes after
+	// which a host is considered down.
+	FailureThreshold int
+
+	// InsecureSkipVerify disables verification of hosts' certificates.
+	InsecureSkipVerify bool
+
+	// Notifier is alerted when a host goes down or comes back up.
+	Notifier Notifier
+}
+
+// Result is the outcome of a single probe.
+type Result struct {
+	Time       time.Time
+	StatusCode int
+	Latency    time.Duration
+
+	// TLSExpiry is when the host's certificate expires, if it was
+	// probed over TLS.
+	TLSExpiry time.Time
+
+	// Err describes why the probe failed, or is empty if it passed.
+	Err string
+}
+
+// OK reports whether the probe passed.
+func (r *Result) OK() bool { return r.Err == "" }
+
+// Status is the state of the probes of a host.
+type Status struct {
+	Check monitor.UptimeCheck
+	Last  Result
+
+	// Up is false once FailureThreshold consecutive probes have failed.
+	Up bool
+
+	// Failures is the number of consecutive failed probes.
+	Failures int
+}
+
+type ProberUptimeChecker struct {
+	config Config
+	client *http.Client
+	logger logrus.FieldLogger
+	nextID int
+
+	// unit is the duration of a check interval of one; it is a minute
+	// except during tests.
+	unit time.Duration
+
+	uptimeChecks map[string]*monitor.UptimeCheck
+
+	mu     sync.Mutex
+	probes map[string]*probe
+	closed bool
+}
+
+// probe schedules the probes of a single check.
+type probe struct {
+	check  monitor.UptimeCheck
+	stop   chan struct{}
+	status Status
+}
+
+// NewProberUptimeChecker returns an UptimeChecker which probes each
+// check's host at its interval.
+func NewProberUptimeChecker(config Config, logger logrus.FieldLogger) *ProberUptimeChecker {
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	if config.FailureThreshold < 1 {
+		config.FailureThreshold = 1
+	}
+	if config.Notifier == nil {
+		config.Notifier = &LogNotifier{Logger: logger}
+	}
+	transport := &http.Transport{
+		Proxy:             http.ProxyFromEnvironment,
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify},
+		DisableKeepAlives: true,
+	}
+	// a transport with its own TLS configuration only negotiates HTTP/2
+	// if configured to.
+	if err := http2.ConfigureTransport(transport); err != nil {
+		logger.Warnf("probes will not use HTTP/2: %v", err)
+	}
+	return &ProberUptimeChecker{
+		config: config,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   config.Timeout,
+			// a redirect is the response probed, not the page it leads to.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		logger:       logger,
+		nextID:       1,
+		unit:         time.Minute,
+		uptimeChecks: make(map[string]*monitor.UptimeCheck),
+		probes:       make(map[string]*probe),
+	}
+}
+
+func (c *ProberUptimeChecker) UptimeChecks() map[string]*monitor.UptimeCheck {
+	return c.uptimeChecks
+}
+
+// SyncUptimeChecks does nothing; the checks of a ProberUptimeChecker
+// exist only in memory.
+func (c *ProberUptimeChecker) SyncUptimeChecks(ctx context.Context) error {
+	return nil
+}
+
+func (c *ProberUptimeChecker) CreateUptimeCheck(ctx context.Context, check *monitor.UptimeCheck) error {
+	if check.Hostname == "" {
+		return &monitor.Error{Kind: monitor.ValidationFailed, Op: "create", Err: fmt.Errorf("check has no hostname")}
+	}
+	c.stop(check.Hostname)
+	check.ID = c.nextID
+	c.nextID++
+	c.uptimeChecks[check.Hostname] = check
+	c.start(check)
+	return nil
+}
+
+// UpdateUptimeCheck replaces the check for check.Hostname with check,
+// retaining the results of its previous probes.
+func (c *ProberUptimeChecker) UpdateUptimeCheck(ctx context.Context, check *monitor.UptimeCheck) error {
+	existing, exists := c.uptimeChecks[check.Hostname]
+	if !exists {
+		return &monitor.Error{Kind: monitor.NotFound, Op: "update", Err: fmt.Errorf("no check for %q", check.Hostname)}
+	}
+	check.ID = existing.ID
+	c.uptimeChecks[check.Hostname] = check
+	c.start(check)
+	return nil
+}
+
+func (c *ProberUptimeChecker) DeleteUptimeCheck(ctx context.Context, hostName string) error {
+	if _, exists := c.uptimeChecks[hostName]; !exists {
+		return nil
+	}
+	delete(c.uptimeChecks, hostName)
+	c.stop(hostName)
+
+	c.mu.Lock()
+	delete(c.probes, hostName)
+	deleteMetrics(hostName)
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *ProberUptimeChecker) PauseUptimeCheck(ctx context.Context, hostName string) error {
+	return c.setPaused("pause", hostName, true)
+}
+
+func (c *ProberUptimeChecker) ResumeUptimeCheck(ctx context.Context, hostName string) error {
+	return c.setPaused("resume", hostName, false)
+}
+
+func (c *ProberUptimeChecker) setPaused(op, hostName string, paused bool) error {
+	check, exists := c.uptimeChecks[hostName]
+	if !exists {
+		return &monitor.Error{Kind: monitor.NotFound, Op: op, Err: fmt.Errorf("no check for %q", hostName)}
+	}
+	check.Paused = paused
+	c.start(check)
+	return nil
+}
+
+// Statuses returns the status of every check.
+func (c *ProberUptimeChecker) Statuses() []Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var statuses []Status
+	for _, p := range c.probes {
+		statuses = append(statuses, p.status)
+	}
+	return statuses
+}
+
+// start (re)schedules the probes of check. Paused checks are not probed.
+func (c *ProberUptimeChecker) start(check *monitor.UptimeCheck) {
+	c.stop(check.Hostname)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, ok := c.probes[check.Hostname]
+	if !ok {
+		p = &probe{status: Status{Up: true}}
+		c.probes[check.Hostname] = p
+	}
+	p.check = *check
+	p.status.Check = *check
+	if check.Paused || c.closed {
+		return
+	}
+	p.stop = make(chan struct{})
+	go c.run(check.Hostname, p.check, p.stop)
+}
+
+// Close stops probing every host, eg. when c is replaced by a checker
+// with other settings. The checks of c are kept, but no longer probed.
+func (c *ProberUptimeChecker) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	for _, p := range c.probes {
+		if p.stop != nil {
+			close(p.stop)
+			p.stop = nil
+		}
+	}
+	return nil
+}
+
+// stop cancels the scheduled probes of hostname.
+func (c *ProberUptimeChecker) stop(hostname string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if p, ok := c.probes[hostname]; ok && p.stop != nil {
+		close(p.stop)
+		p.stop = nil
+	}
+}
+
+// run probes check every interval until stop is closed.
+func (c *ProberUptimeChecker) run(hostname string, check monitor.UptimeCheck, stop chan struct{}) {
+	minutes := check.CheckIntervalInMinutes
+	if minutes < 1 {
+		minutes = 1
+	}
+	ticker := time.NewTicker(time.Duration(minutes) * c.unit)
+	defer ticker.Stop()
+	for {
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			select {
+			case <-stop:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		result := c.probe(ctx, &check)
+		cancel()
+		c.record(hostname, stop, result)
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// record updates the status of hostname with result, unless its probes
+// have been stopped, and alerts the Notifier if it has changed state.
+func (c *ProberUptimeChecker) record(hostname string, stop chan struct{}, result Result) {
+	c.mu.Lock()
+	p, ok := c.probes[hostname]
+	if !ok || p.stop != stop {
+		c.mu.Unlock()
+		return
+	}
+	s := &p.status
+	s.Last = result
+	wasUp := s.Up
+	if result.OK() {
+		s.Failures = 0
+		s.Up = true
+	} else {
+		s.Failures++
+		if s.Failures >= c.config.FailureThreshold {
+			s.Up = false
+		}
+	}
+	status := *s
+	updateMetrics(hostname, &status)
+	c.mu.Unlock()
+
+	if status.Up != wasUp {
+		alert := Alert{Status: status}
+		if err := c.config.Notifier.Notify(alert); err != nil {
+			c.logger.WithField("hostname", hostname).Errorf("notify: %v", err)
+		}
+	}
+}
+
+// probe requests the URL of check and returns the result.
+func (c *ProberUptimeChecker) probe(ctx context.Context, check *monitor.UptimeCheck) Result {
+	result := Result{Time: time.Now()}
+	req, err := http.NewRequest("GET", checkURL(check), nil)
+	if err != nil {
+		result.Err = err.Error()
+		return result
+	}
+	req.Header.Set("User-Agent", "cruise-prober")
+
+	resp, err := c.client.Do(req.WithContext(ctx))
+	result.Latency = time.Since(result.Time)
+	if err != nil {
+		result.Err = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+	result.StatusCode = resp.StatusCode
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		result.TLSExpiry = resp.TLS.PeerCertificates[0].NotAfter
+	}
+
+	switch {
+	case !expected(check.StatusCodes, resp.StatusCode):
+		result.Err = fmt.Sprintf("unexpected status %s", resp.Status)
+	case check.HTTP2 && resp.ProtoMajor != 2:
+		result.Err = fmt.Sprintf("served over %s, not HTTP/2", resp.Proto)
+	case check.Keyword != "":
+		body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBody))
+		if err != nil {
+			result.Err = err.Error()
+		} else if !strings.Contains(string(body), check.Keyword) {
+			result.Err = fmt.Sprintf("response does not contain %q", check.Keyword)
+		}
+	}
+	return result
+}
+
+// checkURL returns the URL probed by check.
+func checkURL(check *monitor.UptimeCheck) string {
+	u := url.URL{
+		Scheme: "http",
+		Host:   check.Hostname,
+		Path:   check.Path,
+	}
+	if check.EnableTLS {
+		u.Scheme = "https"
+	}
+	return u.String()
+}
+
+// expected reports whether status is one of codes, or is 2xx if codes is
+// empty.
+func expected(codes []int, status int) bool {
+	if len(codes) == 0 {
+		return status >= 200 && status < 300
+	}
+	for _, c := range codes {
+		if c == status {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,273 @@
+package prober
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func hostOf(t *testing.T, s *httptest.Server) string {
+	t.Helper()
+	u, err := url.Parse(s.URL)
+	check(t, err)
+	return u.Host
+}
+
+// fakeNotifier records alerts.
+type fakeNotifier struct {
+	alerts chan Alert
+}
+
+func (f *fakeNotifier) Notify(alert Alert) error {
+	f.alerts <- alert
+	return nil
+}
+
+func (f *fakeNotifier) next(t *testing.T) Alert {
+	t.Helper()
+	select {
+	case a := <-f.alerts:
+		return a
+	case <-time.After(5 * time.Second):
+		t.Fatal("no alert")
+		return Alert{}
+	}
+}
+
+func newTestChecker(config Config) *ProberUptimeChecker {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	c := NewProberUptimeChecker(config, logger)
+	c.unit = 10 * time.Millisecond
+	return c
+}
+
+func TestProbe(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/moved":
+			http.Redirect(w, r, "/", http.StatusMovedPermanently)
+		case "/missing":
+			http.NotFound(w, r)
+		default:
+			w.Write([]byte("hello, world"))
+		}
+	}))
+	defer s.Close()
+	host := hostOf(t, s)
+
+	c := newTestChecker(Config{})
+
+	tests := map[string]struct {
+		check monitor.UptimeCheck
+		ok    bool
+	}{
+		"ok":               {check: monitor.UptimeCheck{}, ok: true},
+		"not found":        {check: monitor.UptimeCheck{Path: "/missing"}},
+		"expected code":    {check: monitor.UptimeCheck{Path: "/missing", StatusCodes: []int{404}}, ok: true},
+		"unexpected code":  {check: monitor.UptimeCheck{Path: "/moved"}},
+		"redirect":         {check: monitor.UptimeCheck{Path: "/moved", StatusCodes: []int{301, 302}}, ok: true},
+		"keyword":          {check: monitor.UptimeCheck{Keyword: "world"}, ok: true},
+		"missing keyword":  {check: monitor.UptimeCheck{Keyword: "goodbye"}},
+		"http2 not served": {check: monitor.UptimeCheck{HTTP2: true}},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tc.check.Hostname = host
+			r := c.probe(context.Background(), &tc.check)
+			assert.Equal(t, tc.ok, r.OK(), r.Err)
+		})
+	}
+
+	s.Close()
+	r := c.probe(context.Background(), &monitor.UptimeCheck{Hostname: host})
+	assert.False(t, r.OK())
+	assert.Equal(t, 0, r.StatusCode)
+}
+
+func TestProbeTLS(t *testing.T) {
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer s.Close()
+	host := hostOf(t, s)
+
+	r := newTestChecker(Config{}).probe(context.Background(), &monitor.UptimeCheck{Hostname: host, EnableTLS: true})
+	assert.False(t, r.OK(), "untrusted certificate")
+
+	c := newTestChecker(Config{InsecureSkipVerify: true})
+	r = c.probe(context.Background(), &monitor.UptimeCheck{Hostname: host, EnableTLS: true})
+	assert.True(t, r.OK(), r.Err)
+	assert.Equal(t, 200, r.StatusCode)
+	assert.Equal(t, s.Certificate().NotAfter, r.TLSExpiry)
+}
+
+func TestProbeHTTP2(t *testing.T) {
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	s.TLS = &tls.Config{NextProtos: []string{"h2"}}
+	s.StartTLS()
+	defer s.Close()
+	host := hostOf(t, s)
+
+	c := newTestChecker(Config{InsecureSkipVerify: true})
+	r := c.probe(context.Background(), &monitor.UptimeCheck{Hostname: host, EnableTLS: true, HTTP2: true})
+	assert.True(t, r.OK(), r.Err)
+}
+
+func TestSchedule(t *testing.T) {
+	var failing int32
+	var requests int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer s.Close()
+	host := hostOf(t, s)
+
+	n := &fakeNotifier{alerts: make(chan Alert, 10)}
+	c := newTestChecker(Config{FailureThreshold: 2, Notifier: n})
+	ctx := context.Background()
+
+	check(t, c.CreateUptimeCheck(ctx, &monitor.UptimeCheck{Hostname: host, Name: "test", CheckIntervalInMinutes: 1}))
+	assert.Equal(t, 1, c.UptimeChecks()[host].ID)
+
+	atomic.StoreInt32(&failing, 1)
+	a := n.next(t)
+	assert.False(t, a.Status.Up)
+	assert.Equal(t, 2, a.Status.Failures)
+	assert.Equal(t, 503, a.Status.Last.StatusCode)
+	assert.Equal(t, "test", a.Status.Check.Name)
+
+	atomic.StoreInt32(&failing, 0)
+	a = n.next(t)
+	assert.True(t, a.Status.Up)
+	assert.Equal(t, 0, a.Status.Failures)
+
+	check(t, c.PauseUptimeCheck(ctx, host))
+	time.Sleep(20 * time.Millisecond)
+	paused := atomic.LoadInt32(&requests)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, paused, atomic.LoadInt32(&requests))
+	statuses := c.Statuses()
+	if assert.Len(t, statuses, 1) {
+		assert.True(t, statuses[0].Check.Paused)
+	}
+
+	check(t, c.ResumeUptimeCheck(ctx, host))
+	time.Sleep(50 * time.Millisecond)
+	assert.True(t, atomic.LoadInt32(&requests) > paused)
+
+	check(t, c.UpdateUptimeCheck(ctx, &monitor.UptimeCheck{Hostname: host, Name: "renamed", CheckIntervalInMinutes: 1}))
+	assert.Equal(t, 1, c.UptimeChecks()[host].ID)
+	assert.Equal(t, "renamed", c.Statuses()[0].Check.Name)
+
+	check(t, c.DeleteUptimeCheck(ctx, host))
+	assert.Empty(t, c.UptimeChecks())
+	assert.Empty(t, c.Statuses())
+	check(t, c.DeleteUptimeCheck(ctx, host))
+
+	assert.True(t, monitor.IsNotFound(c.PauseUptimeCheck(ctx, host)))
+	assert.True(t, monitor.IsNotFound(c.UpdateUptimeCheck(ctx, &monitor.UptimeCheck{Hostname: host})))
+	assert.Equal(t, monitor.ValidationFailed, monitor.KindOf(c.CreateUptimeCheck(ctx, &monitor.UptimeCheck{})))
+}
+
+func TestClose(t *testing.T) {
+	var requests int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+	}))
+	defer s.Close()
+	host := hostOf(t, s)
+
+	c := newTestChecker(Config{FailureThreshold: 2, Notifier: &fakeNotifier{alerts: make(chan Alert, 10)}})
+	ctx := context.Background()
+	check(t, c.CreateUptimeCheck(ctx, &monitor.UptimeCheck{Hostname: host, Name: "test", CheckIntervalInMinutes: 1}))
+	time.Sleep(20 * time.Millisecond)
+
+	check(t, c.Close())
+	time.Sleep(20 * time.Millisecond)
+	closed := atomic.LoadInt32(&requests)
+	assert.True(t, closed > 0)
+	check(t, c.ResumeUptimeCheck(ctx, host))
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, closed, atomic.LoadInt32(&requests), "a closed checker probes nothing")
+}
+
+func TestHandler(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer s.Close()
+	host := hostOf(t, s)
+
+	n := &fakeNotifier{alerts: make(chan Alert, 10)}
+	c := newTestChecker(Config{Notifier: n})
+	check(t, c.CreateUptimeCheck(context.Background(), &monitor.UptimeCheck{Hostname: host, Name: "<test>"}))
+	defer c.DeleteUptimeCheck(context.Background(), host)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	c.Handler().ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "&lt;test&gt;")
+	assert.Contains(t, w.Body.String(), "http://"+host)
+
+	req.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	c.Handler().ServeHTTP(w, req)
+	var statuses []Status
+	check(t, json.Unmarshal(w.Body.Bytes(), &statuses))
+	if assert.Len(t, statuses, 1) {
+		assert.Equal(t, host, statuses[0].Check.Hostname)
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var mu sync.Mutex
+	var got webhookPayload
+	status := http.StatusOK
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		check(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(status)
+	}))
+	defer s.Close()
+
+	n := &WebhookNotifier{URL: s.URL}
+	alert := Alert{Status: Status{
+		Check:    monitor.UptimeCheck{Hostname: "example.com", Name: "example", EnableTLS: true, Path: "/healthz"},
+		Last:     Result{StatusCode: 500, Err: "unexpected status 500"},
+		Failures: 3,
+	}}
+	check(t, n.Notify(alert))
+	mu.Lock()
+	assert.Equal(t, "example.com", got.Hostname)
+	assert.Equal(t, "https://example.com/healthz", got.URL)
+	assert.False(t, got.Up)
+	assert.Equal(t, 3, got.Failures)
+	assert.Equal(t, 500, got.StatusCode)
+	status = http.StatusInternalServerError
+	mu.Unlock()
+
+	assert.Error(t, n.Notify(alert))
+	assert.Error(t, Notifiers{&LogNotifier{Logger: logrus.New()}, n}.Notify(alert))
+}
@@ -0,0 +1,37 @@
+package prober
+
+import (
+	"context"
+	"time"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+	"github.com/heptiolabs/cruise/internal/secret"
+)
+
+func init() {
+	monitor.Register("prober", func() monitor.Provider { return new(provider) })
+}
+
+// provider configures a ProberUptimeChecker from command line flags.
+type provider struct {
+	config   Config
+	webhooks []string
+}
+
+func (p *provider) Flags(fs monitor.FlagSet) {
+	fs.Flag("prober-timeout", "timeout of each probe").Default("10s").DurationVar(&p.config.Timeout)
+	fs.Flag("prober-failure-threshold", "number of consecutive failed probes after which a host is down").Default("2").IntVar(&p.config.FailureThreshold)
+	fs.Flag("prober-insecure-skip-verify", "do not verify the certificates of probed hosts").BoolVar(&p.config.InsecureSkipVerify)
+	fs.Flag("prober-webhook-url", "URL to post alerts to as JSON, may be repeated; alerts are always logged").StringsVar(&p.webhooks)
+}
+
+func (p *provider) New(ctx context.Context, opts monitor.Options) (monitor.UptimeChecker, error) {
+	logger := secret.NewLogger().WithField("context", "prober")
+	config := p.config
+	notifiers := Notifiers{&LogNotifier{Logger: logger}}
+	for _, url := range p.webhooks {
+		notifiers = append(notifiers, &WebhookNotifier{URL: url, Timeout: 10 * time.Second})
+	}
+	config.Notifier = notifiers
+	return NewProberUptimeChecker(config, logger), nil
+}
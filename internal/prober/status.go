@@ -0,0 +1,80 @@
+package prober
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+)
+
+var statusTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"url": func(check monitor.UptimeCheck) string {
+		return checkURL(&check)
+	},
+	"ago": func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return time.Since(t).Round(time.Second).String() + " ago"
+	},
+	"expiry": func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.UTC().Format("2006-01-02")
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>cruise prober</title>
+<style>
+body { font-family: sans-serif; }
+td, th { padding: 0.2em 0.8em; text-align: left; }
+.up { color: green; }
+.down { color: red; }
+.paused { color: grey; }
+</style>
+</head>
+<body>
+<h1>cruise prober</h1>
+<table>
+<tr><th>Status</th><th>Name</th><th>URL</th><th>Code</th><th>Latency</th><th>Certificate expires</th><th>Checked</th><th>Error</th></tr>
+{{range .}}<tr>
+{{if .Check.Paused}}<td class="paused">paused</td>{{else if .Up}}<td class="up">up</td>{{else}}<td class="down">down</td>{{end}}
+<td>{{.Check.Name}}</td>
+<td><a href="{{url .Check}}">{{url .Check}}</a></td>
+<td>{{if .Last.StatusCode}}{{.Last.StatusCode}}{{end}}</td>
+<td>{{.Last.Latency}}</td>
+<td>{{expiry .Last.TLSExpiry}}</td>
+<td>{{ago .Last.Time}}</td>
+<td>{{.Last.Err}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// Handler returns an http.Handler which serves the status of every check,
+// as an HTML page or, if requested with an Accept header of
+// application/json, as JSON.
+func (c *ProberUptimeChecker) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		statuses := c.Statuses()
+		sort.Slice(statuses, func(i, j int) bool {
+			return statuses[i].Check.Hostname < statuses[j].Check.Hostname
+		})
+		if strings.Contains(r.Header.Get("Accept"), "application/json") {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(statuses)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := statusTemplate.Execute(w, statuses); err != nil {
+			c.logger.Errorf("status page: %v", err)
+		}
+	})
+}
@@ -0,0 +1,222 @@
+// Package report summarises the availability of the hosts checked by
+// cruise over a period, grouped eg. by namespace or team, against a
+// service level objective.
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+)
+
+// Check is the availability of one host, at one provider.
+type Check struct {
+	Provider  string `json:"provider"`
+	Hostname  string `json:"hostname"`
+	Namespace string `json:"namespace,omitempty"`
+	Ingress   string `json:"ingress,omitempty"`
+
+	// Group is the name of the group in which the check is reported.
+	Group string `json:"-"`
+
+	// Availability is the history of the check, unless Error is set.
+	Availability monitor.Availability `json:"-"`
+	Error        string               `json:"error,omitempty"`
+
+	// Uptime is the percentage of the time checked that the host was
+	// up, or nil if it was not checked. Met reports whether it meets
+	// the report's target.
+	Uptime   *float64         `json:"uptime"`
+	Downtime string           `json:"downtime"`
+	Outages  []monitor.Outage `json:"outages"`
+	Met      bool             `json:"sloMet"`
+}
+
+// Group is the availability of the hosts of a group.
+type Group struct {
+	Name   string  `json:"name"`
+	Checks []Check `json:"checks"`
+
+	// Uptime is the percentage of the time checked that the group's
+	// hosts were up, or nil if none was checked. Met reports whether
+	// it meets the report's target, and MetChecks how many of the
+	// group's checks do.
+	Uptime    *float64 `json:"uptime"`
+	Downtime  string   `json:"downtime"`
+	Outages   int      `json:"outages"`
+	Met       bool     `json:"sloMet"`
+	MetChecks int      `json:"sloMetChecks"`
+}
+
+// Report is the availability of a set of checks between From and To.
+type Report struct {
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	Target float64   `json:"sloTarget"` // percent, eg. 99.9
+	Groups []Group   `json:"groups"`
+}
+
+// New returns the report of checks between from and to, against the
+// target uptime percentage.
+func New(from, to time.Time, target float64, checks []Check) *Report {
+	r := &Report{From: from, To: to, Target: target, Groups: []Group{}}
+	groups := make(map[string]*Group)
+	var names []string
+	for _, c := range checks {
+		g, ok := groups[c.Group]
+		if !ok {
+			g = &Group{Name: c.Group}
+			groups[c.Group] = g
+			names = append(names, c.Group)
+		}
+		g.Checks = append(g.Checks, c)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		g := groups[name]
+		sort.Slice(g.Checks, func(i, j int) bool {
+			a, b := g.Checks[i], g.Checks[j]
+			if a.Hostname != b.Hostname {
+				return a.Hostname < b.Hostname
+			}
+			return a.Provider < b.Provider
+		})
+		var total monitor.Availability
+		for i := range g.Checks {
+			c := &g.Checks[i]
+			a := c.Availability
+			c.Uptime, c.Met = r.attainment(&a)
+			c.Downtime = a.Down.String()
+			c.Outages = a.Outages
+			if c.Outages == nil {
+				c.Outages = []monitor.Outage{}
+			}
+			if c.Met {
+				g.MetChecks++
+			}
+			total.Up += a.Up
+			total.Down += a.Down
+			g.Outages += len(a.Outages)
+		}
+		g.Uptime, g.Met = r.attainment(&total)
+		g.Downtime = total.Down.String()
+		r.Groups = append(r.Groups, *g)
+	}
+	return r
+}
+
+// attainment returns the uptime percentage of a, and whether it meets
+// the target.
+func (r *Report) attainment(a *monitor.Availability) (*float64, bool) {
+	ratio, ok := a.Ratio()
+	if !ok {
+		return nil, false
+	}
+	uptime := ratio * 100
+	return &uptime, uptime >= r.Target
+}
+
+// WriteJSON writes r to w as JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteCSV writes a row for each check of r to w.
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"group", "provider", "hostname", "namespace", "ingress", "uptime_percent", "downtime_seconds", "outages", "slo_met", "error"})
+	for _, g := range r.Groups {
+		for _, c := range g.Checks {
+			uptime := ""
+			if c.Uptime != nil {
+				uptime = strconv.FormatFloat(*c.Uptime, 'f', 4, 64)
+			}
+			cw.Write([]string{
+				g.Name,
+				c.Provider,
+				c.Hostname,
+				c.Namespace,
+				c.Ingress,
+				uptime,
+				strconv.FormatInt(int64(c.Availability.Down/time.Second), 10),
+				strconv.Itoa(len(c.Outages)),
+				strconv.FormatBool(c.Met),
+				c.Error,
+			})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteMarkdown writes r to w as Markdown: a summary table of the groups
+// followed by a table of the checks of each.
+func (r *Report) WriteMarkdown(w io.Writer) error {
+	ew := &errWriter{w: w}
+	ew.printf("# Availability from %s to %s\n\n", r.From.Format(time.RFC3339), r.To.Format(time.RFC3339))
+	ew.printf("SLO target: %s%%\n\n", strconv.FormatFloat(r.Target, 'f', -1, 64))
+	ew.printf("| Group | Checks | Uptime | Downtime | Outages | SLO |\n")
+	ew.printf("|-------|--------|--------|----------|---------|-----|\n")
+	for _, g := range r.Groups {
+		ew.printf("| %s | %d | %s | %s | %d | %s (%d/%d) |\n",
+			g.Name, len(g.Checks), percent(g.Uptime), g.Downtime, g.Outages, met(g.Uptime, g.Met), g.MetChecks, len(g.Checks))
+	}
+	for _, g := range r.Groups {
+		ew.printf("\n## %s\n\n", g.Name)
+		ew.printf("| Hostname | Provider | Ingress | Uptime | Downtime | Outages | SLO |\n")
+		ew.printf("|----------|----------|---------|--------|----------|---------|-----|\n")
+		for _, c := range g.Checks {
+			ingress := "-"
+			if c.Ingress != "" {
+				ingress = c.Namespace + "/" + c.Ingress
+			}
+			slo := met(c.Uptime, c.Met)
+			if c.Error != "" {
+				slo = "error: " + c.Error
+			}
+			ew.printf("| %s | %s | %s | %s | %s | %d | %s |\n",
+				c.Hostname, c.Provider, ingress, percent(c.Uptime), c.Downtime, len(c.Outages), slo)
+		}
+	}
+	return ew.err
+}
+
+func percent(p *float64) string {
+	if p == nil {
+		return "n/a"
+	}
+	return fmt.Sprintf("%.3f%%", *p)
+}
+
+func met(uptime *float64, ok bool) string {
+	switch {
+	case uptime == nil:
+		return "n/a"
+	case ok:
+		return "met"
+	default:
+		return "missed"
+	}
+}
+
+// errWriter formats output to w, recording the first error after which
+// output is discarded.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) printf(format string, args ...interface{}) {
+	if ew.err == nil {
+		_, ew.err = fmt.Fprintf(ew.w, format, args...)
+	}
+}
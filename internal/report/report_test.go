@@ -0,0 +1,75 @@
+package report
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+	"github.com/stretchr/testify/assert"
+)
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newReport() *Report {
+	from := time.Date(2018, 5, 1, 0, 0, 0, 0, time.UTC)
+	outage := monitor.Outage{Start: from.Add(time.Hour), End: from.Add(time.Hour + 10*time.Minute)}
+	return New(from, from.AddDate(0, 1, 0), 99.9, []Check{
+		{Group: "web", Provider: "pingdom", Hostname: "b.example.com", Namespace: "web", Ingress: "b",
+			Availability: monitor.Availability{Up: 990 * time.Minute, Down: 10 * time.Minute, Outages: []monitor.Outage{outage}}},
+		{Group: "web", Provider: "pingdom", Hostname: "a.example.com", Namespace: "web", Ingress: "a",
+			Availability: monitor.Availability{Up: 1000 * time.Minute}},
+		{Group: "api", Provider: "pingdom", Hostname: "api.example.com", Error: "auth failed"},
+	})
+}
+
+func TestNew(t *testing.T) {
+	r := newReport()
+	if !assert.Len(t, r.Groups, 2) {
+		return
+	}
+
+	api := r.Groups[0]
+	assert.Equal(t, "api", api.Name)
+	assert.Nil(t, api.Uptime)
+	assert.False(t, api.Met)
+
+	web := r.Groups[1]
+	assert.Equal(t, "a.example.com", web.Checks[0].Hostname)
+	assert.Equal(t, 100.0, *web.Checks[0].Uptime)
+	assert.True(t, web.Checks[0].Met)
+	assert.Equal(t, 99.0, *web.Checks[1].Uptime)
+	assert.False(t, web.Checks[1].Met)
+	assert.InDelta(t, 99.5, *web.Uptime, 1e-9)
+	assert.Equal(t, "10m0s", web.Downtime)
+	assert.Equal(t, 1, web.Outages)
+	assert.Equal(t, 1, web.MetChecks)
+}
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	check(t, newReport().WriteCSV(&buf))
+	assert.Equal(t, strings.Join([]string{
+		"group,provider,hostname,namespace,ingress,uptime_percent,downtime_seconds,outages,slo_met,error",
+		"api,pingdom,api.example.com,,,,0,0,false,auth failed",
+		"web,pingdom,a.example.com,web,a,100.0000,0,0,true,",
+		"web,pingdom,b.example.com,web,b,99.0000,600,1,false,",
+		"",
+	}, "\n"), buf.String())
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	check(t, newReport().WriteMarkdown(&buf))
+	out := buf.String()
+	assert.Contains(t, out, "# Availability from 2018-05-01T00:00:00Z to 2018-06-01T00:00:00Z\n")
+	assert.Contains(t, out, "SLO target: 99.9%\n")
+	assert.Contains(t, out, "| web | 2 | 99.500% | 10m0s | 1 | missed (1/2) |\n")
+	assert.Contains(t, out, "| api.example.com | pingdom | - | n/a | 0s | 0 | error: auth failed |\n")
+}
@@ -0,0 +1,38 @@
+package route53
+
+import (
+	"context"
+	"os"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+	"github.com/heptiolabs/cruise/internal/secret"
+)
+
+func init() {
+	monitor.Register("route53", func() monitor.Provider { return new(provider) })
+}
+
+// provider configures a Route53UptimeChecker from command line flags.
+type provider struct {
+	config                        Config
+	secretAccessKey, sessionToken secret.Value
+}
+
+func (p *provider) Flags(fs monitor.FlagSet) {
+	fs.Flag("route53-access-key-id", "AWS access key ID").Default(os.Getenv("AWS_ACCESS_KEY_ID")).StringVar(&p.config.Credentials.AccessKeyID)
+	p.secretAccessKey.Flags(fs, "route53-secret-access-key", "AWS secret access key", "AWS_SECRET_ACCESS_KEY")
+	p.sessionToken.Flags(fs, "route53-session-token", "AWS session token, for temporary credentials", "AWS_SESSION_TOKEN")
+	fs.Flag("route53-tag", "key of the tag marking the health checks managed by cruise").Default("managed-by").StringVar(&p.config.Tag)
+	fs.Flag("route53-owner", "value of the tag marking the health checks managed by cruise").Default("cruise").StringVar(&p.config.Owner)
+	fs.Flag("route53-request-interval", "seconds between requests by each Route 53 checker, 10 or 30").Default("30").IntVar(&p.config.RequestInterval)
+	fs.Flag("route53-failure-threshold", "consecutive failures after which a host is unhealthy").Default("3").IntVar(&p.config.FailureThreshold)
+	fs.Flag("route53-url", "Route 53 API base URL").Default(DefaultBaseURL).StringVar(&p.config.BaseURL)
+}
+
+func (p *provider) New(ctx context.Context, opts monitor.Options) (monitor.UptimeChecker, error) {
+	config := p.config
+	config.Credentials.SecretAccessKey = p.secretAccessKey.Secret()
+	config.Credentials.SessionToken = p.sessionToken.Secret()
+	config.Cluster = opts.Cluster
+	return NewRoute53UptimeChecker(ctx, config, opts.RateLimit)
+}
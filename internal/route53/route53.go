@@ -0,0 +1,617 @@
+// Package route53 implements an UptimeChecker backed by AWS Route 53
+// health checks, which may then be used for DNS failover.
+package route53
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+)
+
+// DefaultBaseURL is the address of the Route 53 API.
+const DefaultBaseURL = "https://route53.amazonaws.com"
+
+const (
+	apiVersion = "/2013-04-01"
+	xmlns      = "https://route53.amazonaws.com/doc/2013-04-01/"
+
+	// pageSize is the number of health checks requested per page when
+	// listing.
+	pageSize = 100
+
+	// tagBatch is the most resources whose tags may be listed at once.
+	tagBatch = 10
+)
+
+// Tags recorded on each health check. Route 53 cannot express every
+// property of a check, so those it cannot are kept in tags from which
+// the check is recovered.
+const (
+	nameTag      = "Name"
+	clusterTag   = "kubernetes-cluster"
+	namespaceTag = "kubernetes-namespace"
+	ingressTag   = "kubernetes-ingress"
+	intervalTag  = "cruise-interval"
+	contactsTag  = "cruise-contacts"
+)
+
+// Config configures a Route53UptimeChecker.
+type Config struct {
+	Credentials Credentials
+
+	// Tag is the key, and Owner the value, of the tag which marks the
+	// health checks owned by cruise. Health checks without it are
+	// ignored, and never modified.
+	Tag   string
+	Owner string
+
+	// Cluster, if set, is recorded in each health check's tags.
+	Cluster string
+
+	// RequestInterval is the number of seconds between checks by each
+	// Route 53 checker, 10 or 30. Route 53 checks far more often than
+	// the intervals of cruise's checks, which are recorded only as tags.
+	RequestInterval int
+
+	// FailureThreshold is the number of consecutive failed checks
+	// after which a host is unhealthy.
+	FailureThreshold int
+
+	// BaseURL, if set, overrides DefaultBaseURL.
+	BaseURL string
+}
+
+type Route53UptimeChecker struct {
+	config       Config
+	client       *http.Client
+	throttle     *monitor.Throttle
+	uptimeChecks map[string]*monitor.UptimeCheck
+
+	// ids maps hostnames to the ID of their health check.
+	ids map[string]string
+
+	// now returns the time at which requests are signed.
+	now func() time.Time
+}
+
+// NewRoute53UptimeChecker returns an UptimeChecker which manages the
+// Route 53 health checks tagged config.Tag=config.Owner. Calls to the
+// Route 53 API are limited to the rate given by limit.
+func NewRoute53UptimeChecker(ctx context.Context, config Config, limit monitor.RateLimit) (monitor.UptimeChecker, error) {
+	return newRoute53UptimeChecker(ctx, http.DefaultClient, config, limit)
+}
+
+func newRoute53UptimeChecker(ctx context.Context, client *http.Client, config Config, limit monitor.RateLimit) (*Route53UptimeChecker, error) {
+	if config.BaseURL == "" {
+		config.BaseURL = DefaultBaseURL
+	}
+	if config.Tag == "" || config.Owner == "" {
+		return nil, fmt.Errorf("route53: an ownership tag is required")
+	}
+	if config.Credentials.AccessKeyID == "" || config.Credentials.SecretAccessKey == "" {
+		return nil, fmt.Errorf("route53: AWS credentials are required")
+	}
+	if config.RequestInterval != 10 {
+		config.RequestInterval = 30
+	}
+	if config.FailureThreshold < 1 {
+		config.FailureThreshold = 3
+	}
+	c := &Route53UptimeChecker{
+		config:       config,
+		client:       client,
+		throttle:     monitor.NewThrottle(limit),
+		uptimeChecks: make(map[string]*monitor.UptimeCheck),
+		ids:          make(map[string]string),
+		now:          time.Now,
+	}
+	return c, c.SyncUptimeChecks(ctx)
+}
+
+func (c *Route53UptimeChecker) UptimeChecks() map[string]*monitor.UptimeCheck {
+	return c.uptimeChecks
+}
+
+type healthCheck struct {
+	ID                 string            `xml:"Id"`
+	CallerReference    string            `xml:"CallerReference"`
+	HealthCheckConfig  healthCheckConfig `xml:"HealthCheckConfig"`
+	HealthCheckVersion int64             `xml:"HealthCheckVersion"`
+}
+
+type healthCheckConfig struct {
+	Port                     int      `xml:"Port,omitempty"`
+	Type                     string   `xml:"Type,omitempty"`
+	ResourcePath             string   `xml:"ResourcePath,omitempty"`
+	FullyQualifiedDomainName string   `xml:"FullyQualifiedDomainName,omitempty"`
+	SearchString             string   `xml:"SearchString,omitempty"`
+	RequestInterval          int      `xml:"RequestInterval,omitempty"`
+	FailureThreshold         int      `xml:"FailureThreshold,omitempty"`
+	Disabled                 *bool    `xml:"Disabled,omitempty"`
+	EnableSNI                *bool    `xml:"EnableSNI,omitempty"`
+	Regions                  []string `xml:"Regions>Region,omitempty"`
+}
+
+type tag struct {
+	Key   string `xml:"Key"`
+	Value string `xml:"Value"`
+}
+
+func (c *Route53UptimeChecker) SyncUptimeChecks(ctx context.Context) error {
+	var all []healthCheck
+	marker := ""
+	for {
+		var list struct {
+			HealthChecks []healthCheck `xml:"HealthChecks>HealthCheck"`
+			IsTruncated  bool          `xml:"IsTruncated"`
+			NextMarker   string        `xml:"NextMarker"`
+		}
+		query := url.Values{"maxitems": {strconv.Itoa(pageSize)}}
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+		if err := c.do(ctx, "list", "GET", "/healthcheck?"+query.Encode(), nil, &list); err != nil {
+			return err
+		}
+		all = append(all, list.HealthChecks...)
+		if !list.IsTruncated || list.NextMarker == "" {
+			break
+		}
+		marker = list.NextMarker
+	}
+
+	tags := make(map[string]map[string]string)
+	for i := 0; i < len(all); i += tagBatch {
+		var ids []string
+		for j := i; j < len(all) && j < i+tagBatch; j++ {
+			ids = append(ids, all[j].ID)
+		}
+		batch, err := c.listTags(ctx, ids)
+		if err != nil {
+			return err
+		}
+		for id, t := range batch {
+			tags[id] = t
+		}
+	}
+
+	checks := make(map[string]*monitor.UptimeCheck)
+	ids := make(map[string]string)
+	for _, hc := range all {
+		t := tags[hc.ID]
+		if t[c.config.Tag] != c.config.Owner {
+			continue
+		}
+		if check := toUptimeCheck(hc, t); check != nil {
+			checks[check.Hostname] = check
+			ids[check.Hostname] = hc.ID
+		}
+	}
+	c.uptimeChecks = checks
+	c.ids = ids
+	return nil
+}
+
+// listTags returns the tags of the health checks ids, keyed by ID.
+func (c *Route53UptimeChecker) listTags(ctx context.Context, ids []string) (map[string]map[string]string, error) {
+	req := struct {
+		XMLName     xml.Name `xml:"ListTagsForResourcesRequest"`
+		Xmlns       string   `xml:"xmlns,attr"`
+		ResourceIDs []string `xml:"ResourceIds>ResourceId"`
+	}{Xmlns: xmlns, ResourceIDs: ids}
+	var resp struct {
+		Sets []struct {
+			ResourceID string `xml:"ResourceId"`
+			Tags       []tag  `xml:"Tags>Tag"`
+		} `xml:"ResourceTagSets>ResourceTagSet"`
+	}
+	if err := c.do(ctx, "list", "POST", "/tags/healthcheck", &req, &resp); err != nil {
+		return nil, err
+	}
+	tags := make(map[string]map[string]string)
+	for _, set := range resp.Sets {
+		m := make(map[string]string)
+		for _, t := range set.Tags {
+			m[t.Key] = t.Value
+		}
+		tags[set.ResourceID] = m
+	}
+	return tags, nil
+}
+
+func (c *Route53UptimeChecker) CreateUptimeCheck(ctx context.Context, check *monitor.UptimeCheck) error {
+	config, err := c.healthCheckConfig(check)
+	if err != nil {
+		return &monitor.Error{Kind: monitor.ValidationFailed, Op: "create", Err: err}
+	}
+	req := struct {
+		XMLName           xml.Name           `xml:"CreateHealthCheckRequest"`
+		Xmlns             string             `xml:"xmlns,attr"`
+		CallerReference   string             `xml:"CallerReference"`
+		HealthCheckConfig *healthCheckConfig `xml:"HealthCheckConfig"`
+	}{
+		Xmlns:             xmlns,
+		CallerReference:   callerReference(check.Hostname, c.now()),
+		HealthCheckConfig: config,
+	}
+	var resp struct {
+		HealthCheck healthCheck `xml:"HealthCheck"`
+	}
+	if err := c.do(ctx, "create", "POST", "/healthcheck", &req, &resp); err != nil {
+		return err
+	}
+	id := resp.HealthCheck.ID
+	if id == "" {
+		return &monitor.Error{Kind: monitor.Unknown, Op: "create", Err: fmt.Errorf("no id for created health check")}
+	}
+
+	// A health check which is not tagged as owned by cruise would be
+	// forgotten by the next sync, and never deleted, so if it cannot be
+	// tagged it is deleted and the create fails, to be retried afresh.
+	if err := c.tag(ctx, "create", id, check, nil); err != nil {
+		if derr := c.do(ctx, "create", "DELETE", "/healthcheck/"+id, nil, nil); derr != nil && !monitor.IsNotFound(derr) {
+			return &monitor.Error{
+				Kind:       monitor.KindOf(err),
+				Op:         "create",
+				Err:        fmt.Errorf("tagging health check %s: %v; deleting it: %v", id, err, derr),
+				RetryAfter: monitor.RetryAfter(err),
+			}
+		}
+		return err
+	}
+	check.Cluster = c.config.Cluster
+	c.ids[check.Hostname] = id
+	c.uptimeChecks[check.Hostname] = check
+	return nil
+}
+
+// UpdateUptimeCheck modifies the existing health check for
+// check.Hostname to match check. The type of a health check cannot be
+// changed, so if check switches between HTTP and HTTPS, or adds or
+// removes a keyword, the health check is replaced.
+func (c *Route53UptimeChecker) UpdateUptimeCheck(ctx context.Context, check *monitor.UptimeCheck) error {
+	existing, exists := c.uptimeChecks[check.Hostname]
+	if !exists {
+		return &monitor.Error{Kind: monitor.NotFound, Op: "update", Err: fmt.Errorf("no check for %q", check.Hostname)}
+	}
+	config, err := c.healthCheckConfig(check)
+	if err != nil {
+		return &monitor.Error{Kind: monitor.ValidationFailed, Op: "update", Err: err}
+	}
+	if checkType(existing) != config.Type {
+		if err := c.DeleteUptimeCheck(ctx, check.Hostname); err != nil {
+			return err
+		}
+		return c.CreateUptimeCheck(ctx, check)
+	}
+
+	// Type and RequestInterval may not be updated; an empty
+	// ResourcePath or SearchString would leave the existing value.
+	config.Type = ""
+	config.RequestInterval = 0
+	if config.ResourcePath == "" {
+		config.ResourcePath = "/"
+	}
+	req := struct {
+		XMLName xml.Name `xml:"UpdateHealthCheckRequest"`
+		Xmlns   string   `xml:"xmlns,attr"`
+		*healthCheckConfig
+		ResetElements []string `xml:"ResetElements>ResettableElementName,omitempty"`
+	}{Xmlns: xmlns, healthCheckConfig: config}
+	if len(config.Regions) == 0 {
+		// restore the default regions
+		req.ResetElements = []string{"Regions"}
+	}
+	id := c.ids[check.Hostname]
+	if err := c.do(ctx, "update", "POST", "/healthcheck/"+id, &req, nil); err != nil {
+		return err
+	}
+	check.Cluster = c.config.Cluster
+	c.uptimeChecks[check.Hostname] = check
+	return c.tag(ctx, "update", id, check, existing)
+}
+
+// Adopts returns false: only the health checks tagged as owned by
+// cruise are listed.
+func (c *Route53UptimeChecker) Adopts() bool { return false }
+
+// CheckID returns the ID of the health check for hostName.
+func (c *Route53UptimeChecker) CheckID(hostName string) string {
+	return c.ids[hostName]
+}
+
+func (c *Route53UptimeChecker) DeleteUptimeCheck(ctx context.Context, hostName string) error {
+	id, exists := c.ids[hostName]
+	if !exists {
+		return nil
+	}
+
+	err := c.do(ctx, "delete", "DELETE", "/healthcheck/"+id, nil, nil)
+	if err != nil && !monitor.IsNotFound(err) {
+		return err
+	}
+
+	delete(c.uptimeChecks, hostName)
+	delete(c.ids, hostName)
+	return nil
+}
+
+func (c *Route53UptimeChecker) PauseUptimeCheck(ctx context.Context, hostName string) error {
+	return c.setPaused(ctx, "pause", hostName, true)
+}
+
+func (c *Route53UptimeChecker) ResumeUptimeCheck(ctx context.Context, hostName string) error {
+	return c.setPaused(ctx, "resume", hostName, false)
+}
+
+// setPaused disables or enables the health check for hostName. Route 53
+// considers a disabled health check healthy.
+func (c *Route53UptimeChecker) setPaused(ctx context.Context, op, hostName string, paused bool) error {
+	check, exists := c.uptimeChecks[hostName]
+	if !exists {
+		return &monitor.Error{Kind: monitor.NotFound, Op: op, Err: fmt.Errorf("no check for %q", hostName)}
+	}
+	if check.Paused == paused {
+		return nil
+	}
+	req := struct {
+		XMLName  xml.Name `xml:"UpdateHealthCheckRequest"`
+		Xmlns    string   `xml:"xmlns,attr"`
+		Disabled bool     `xml:"Disabled"`
+	}{Xmlns: xmlns, Disabled: paused}
+	if err := c.do(ctx, op, "POST", "/healthcheck/"+c.ids[hostName], &req, nil); err != nil {
+		return err
+	}
+	check.Paused = paused
+	return nil
+}
+
+// tag sets the tags of the health check id for check, removing those of
+// existing, if any, which no longer apply.
+func (c *Route53UptimeChecker) tag(ctx context.Context, op, id string, check, existing *monitor.UptimeCheck) error {
+	tags := c.tags(check)
+	var keys []string
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	type change struct {
+		XMLName       xml.Name `xml:"ChangeTagsForResourceRequest"`
+		Xmlns         string   `xml:"xmlns,attr"`
+		AddTags       []tag    `xml:"AddTags>Tag,omitempty"`
+		RemoveTagKeys []string `xml:"RemoveTagKeys>Key,omitempty"`
+	}
+	req := change{Xmlns: xmlns}
+	for _, k := range keys {
+		req.AddTags = append(req.AddTags, tag{Key: k, Value: tags[k]})
+	}
+	if existing != nil {
+		for k := range c.tags(existing) {
+			if _, ok := tags[k]; !ok {
+				req.RemoveTagKeys = append(req.RemoveTagKeys, k)
+			}
+		}
+		sort.Strings(req.RemoveTagKeys)
+	}
+	return c.do(ctx, op, "POST", "/tags/healthcheck/"+id, &req, nil)
+}
+
+// tags returns the tags of the health check for check.
+func (c *Route53UptimeChecker) tags(check *monitor.UptimeCheck) map[string]string {
+	tags := map[string]string{
+		c.config.Tag: c.config.Owner,
+		nameTag:      check.Name,
+		intervalTag:  strconv.Itoa(interval(check)),
+	}
+	if c.config.Cluster != "" {
+		tags[clusterTag] = c.config.Cluster
+	}
+	if check.Namespace != "" {
+		tags[namespaceTag] = check.Namespace
+	}
+	if check.Ingress != "" {
+		tags[ingressTag] = check.Ingress
+	}
+	if len(check.Contacts) > 0 {
+		tags[contactsTag] = strings.Join(check.Contacts, " ")
+	}
+	return tags
+}
+
+// healthCheckConfig returns the configuration of the health check for
+// check, or an error if Route 53 cannot check it.
+func (c *Route53UptimeChecker) healthCheckConfig(check *monitor.UptimeCheck) (*healthCheckConfig, error) {
+	if check.HTTP2 {
+		return nil, fmt.Errorf("route 53 cannot require HTTP/2 for %s", check.Hostname)
+	}
+	if len(check.StatusCodes) > 0 {
+		return nil, fmt.Errorf("route 53 cannot check for status codes %v for %s; any 2xx or 3xx status passes", check.StatusCodes, check.Hostname)
+	}
+	if len(check.Regions) > 0 && len(check.Regions) < 3 {
+		return nil, fmt.Errorf("route 53 requires at least 3 regions, got %v", check.Regions)
+	}
+	disabled := check.Paused
+	config := &healthCheckConfig{
+		Type:                     checkType(check),
+		FullyQualifiedDomainName: check.Hostname,
+		ResourcePath:             check.Path,
+		SearchString:             check.Keyword,
+		RequestInterval:          c.config.RequestInterval,
+		FailureThreshold:         c.config.FailureThreshold,
+		Disabled:                 &disabled,
+		Regions:                  check.Regions,
+		Port:                     80,
+	}
+	if check.EnableTLS {
+		sni := true
+		config.EnableSNI = &sni
+		config.Port = 443
+	}
+	return config, nil
+}
+
+// checkType returns the Route 53 health check type which implements
+// check.
+func checkType(check *monitor.UptimeCheck) string {
+	t := "HTTP"
+	if check.EnableTLS {
+		t = "HTTPS"
+	}
+	if check.Keyword != "" {
+		t += "_STR_MATCH"
+	}
+	return t
+}
+
+func interval(check *monitor.UptimeCheck) int {
+	if check.CheckIntervalInMinutes < 1 {
+		return 1
+	}
+	return check.CheckIntervalInMinutes
+}
+
+// callerReference returns a unique reference for the creation of a
+// health check for hostname, which Route 53 uses to make creation
+// idempotent.
+func callerReference(hostname string, now time.Time) string {
+	ref := "cruise-" + hostname + "-" + strconv.FormatInt(now.UnixNano(), 36)
+	if len(ref) > 64 {
+		ref = ref[len(ref)-64:]
+	}
+	return ref
+}
+
+// toUptimeCheck converts hc, tagged tags, to an UptimeCheck, or returns
+// nil if hc is not an HTTP(S) check of a domain name.
+func toUptimeCheck(hc healthCheck, tags map[string]string) *monitor.UptimeCheck {
+	config := hc.HealthCheckConfig
+	if !strings.HasPrefix(config.Type, "HTTP") || config.FullyQualifiedDomainName == "" {
+		return nil
+	}
+	path := config.ResourcePath
+	if path == "/" {
+		path = ""
+	}
+	minutes, err := strconv.Atoi(tags[intervalTag])
+	if err != nil || minutes < 1 {
+		minutes = 1
+	}
+	check := &monitor.UptimeCheck{
+		Hostname:               config.FullyQualifiedDomainName,
+		Name:                   tags[nameTag],
+		CheckIntervalInMinutes: minutes,
+		EnableTLS:              strings.HasPrefix(config.Type, "HTTPS"),
+		Paused:                 config.Disabled != nil && *config.Disabled,
+		Path:                   path,
+		Keyword:                config.SearchString,
+		Regions:                config.Regions,
+		Cluster:                tags[clusterTag],
+		Namespace:              tags[namespaceTag],
+		Ingress:                tags[ingressTag],
+	}
+	if v := tags[contactsTag]; v != "" {
+		check.Contacts = strings.Fields(v)
+	}
+	return check
+}
+
+// apiError is the body of an unsuccessful Route 53 API response.
+type apiError struct {
+	StatusCode int
+	Type       string `xml:"Error>Type"`
+	Code       string `xml:"Error>Code"`
+	Message    string `xml:"Error>Message"`
+}
+
+func (e *apiError) Error() string {
+	code := e.Code
+	if code == "" {
+		code = http.StatusText(e.StatusCode)
+	}
+	return fmt.Sprintf("route53: %d %s: %s", e.StatusCode, code, e.Message)
+}
+
+// kind classifies e. Route 53 reports throttling, among others, as a
+// 400 Bad Request, so the error code is consulted before the status.
+func (e *apiError) kind() monitor.ErrorKind {
+	switch e.Code {
+	case "NoSuchHealthCheck":
+		return monitor.NotFound
+	case "Throttling", "ThrottlingException":
+		return monitor.RateLimited
+	case "PriorRequestNotComplete", "HealthCheckVersionMismatch":
+		return monitor.Transient
+	case "InvalidClientTokenId", "SignatureDoesNotMatch", "AccessDenied", "ExpiredToken", "IncompleteSignature":
+		return monitor.AuthFailed
+	case "InvalidInput", "TooManyHealthChecks", "HealthCheckAlreadyExists", "HealthCheckInUse", "InvalidTagKey", "InvalidTagValue":
+		return monitor.ValidationFailed
+	}
+	return monitor.KindForStatus(e.StatusCode)
+}
+
+// do performs a single Route 53 API request bounded by ctx, sending
+// body, if any, as XML and decoding the response into v. Any error is
+// returned as a *monitor.Error.
+func (c *Route53UptimeChecker) do(ctx context.Context, op, method, rsc string, body, v interface{}) error {
+	if err := c.throttle.Wait(ctx, op); err != nil {
+		return err
+	}
+
+	var buf []byte
+	if body != nil {
+		b, err := xml.Marshal(body)
+		if err != nil {
+			return &monitor.Error{Kind: monitor.Unknown, Op: op, Err: err}
+		}
+		buf = append([]byte(xml.Header), b...)
+	}
+	var r io.Reader
+	if buf != nil {
+		r = bytes.NewReader(buf)
+	}
+	req, err := http.NewRequest(method, c.config.BaseURL+apiVersion+rsc, r)
+	if err != nil {
+		return &monitor.Error{Kind: monitor.Unknown, Op: op, Err: err}
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/xml")
+	}
+	sign(req, buf, c.config.Credentials, c.now())
+
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return monitor.Wrap(ctx, op, err)
+	}
+	defer resp.Body.Close()
+	c.throttle.Delay(monitor.RetryAfterHeader(resp))
+
+	if resp.StatusCode >= 300 {
+		e := &apiError{StatusCode: resp.StatusCode}
+		b, _ := ioutil.ReadAll(resp.Body)
+		xml.Unmarshal(b, e)
+		err := &monitor.Error{Kind: e.kind(), Op: op, Err: e}
+		if err.Kind == monitor.RateLimited {
+			err.RetryAfter = c.throttle.Backoff()
+		}
+		return err
+	}
+	if v == nil {
+		return nil
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(v); err != nil {
+		return monitor.Wrap(ctx, op, err)
+	}
+	return nil
+}
@@ -0,0 +1,524 @@
+package route53
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+	"github.com/heptiolabs/cruise/internal/monitor/monitortest"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRoute53 is an in memory stand in for the Route 53 health check
+// API.
+type fakeRoute53 struct {
+	mu       sync.Mutex
+	nextID   int
+	checks   map[string]*healthCheck
+	tags     map[string]map[string]string
+	refs     map[string]bool
+	pageSize int
+	fail     func(*http.Request) (int, string)
+	header   http.Header
+}
+
+func newFakeRoute53() *fakeRoute53 {
+	return &fakeRoute53{
+		nextID:   1,
+		checks:   make(map[string]*healthCheck),
+		tags:     make(map[string]map[string]string),
+		refs:     make(map[string]bool),
+		pageSize: 2,
+	}
+}
+
+func (f *fakeRoute53) add(config healthCheckConfig, tags map[string]string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := fmt.Sprintf("hc-%03d", f.nextID)
+	f.nextID++
+	f.checks[id] = &healthCheck{ID: id, HealthCheckConfig: config, HealthCheckVersion: 1}
+	f.tags[id] = tags
+	return id
+}
+
+func (f *fakeRoute53) ids() []string {
+	var ids []string
+	for id := range f.checks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+const prefix = "/2013-04-01"
+
+func (f *fakeRoute53) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for k, v := range f.header {
+		w.Header()[k] = v
+	}
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") || r.Header.Get("X-Amz-Date") == "" {
+		writeError(w, http.StatusForbidden, "IncompleteSignature", "missing signature")
+		return
+	}
+	if f.fail != nil {
+		if status, code := f.fail(r); status != 0 {
+			writeError(w, status, code, "fake error")
+			return
+		}
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, prefix)
+	switch {
+	case r.Method == "GET" && path == "/healthcheck":
+		max, _ := strconv.Atoi(r.URL.Query().Get("maxitems"))
+		if max <= 0 || max > f.pageSize {
+			max = f.pageSize
+		}
+		var resp struct {
+			XMLName      xml.Name      `xml:"ListHealthChecksResponse"`
+			HealthChecks []healthCheck `xml:"HealthChecks>HealthCheck"`
+			IsTruncated  bool
+			NextMarker   string `xml:",omitempty"`
+		}
+		marker := r.URL.Query().Get("marker")
+		for _, id := range f.ids() {
+			if id < marker {
+				continue
+			}
+			if len(resp.HealthChecks) == max {
+				resp.IsTruncated = true
+				resp.NextMarker = id
+				break
+			}
+			resp.HealthChecks = append(resp.HealthChecks, *f.checks[id])
+		}
+		writeXML(w, http.StatusOK, resp)
+	case r.Method == "POST" && path == "/healthcheck":
+		var req struct {
+			CallerReference   string
+			HealthCheckConfig healthCheckConfig
+		}
+		if err := xml.NewDecoder(r.Body).Decode(&req); err != nil || req.CallerReference == "" || req.HealthCheckConfig.Type == "" {
+			writeError(w, http.StatusBadRequest, "InvalidInput", "invalid health check")
+			return
+		}
+		if f.refs[req.CallerReference] {
+			writeError(w, http.StatusConflict, "HealthCheckAlreadyExists", "duplicate caller reference")
+			return
+		}
+		f.refs[req.CallerReference] = true
+		id := fmt.Sprintf("hc-%03d", f.nextID)
+		f.nextID++
+		hc := &healthCheck{ID: id, CallerReference: req.CallerReference, HealthCheckConfig: req.HealthCheckConfig, HealthCheckVersion: 1}
+		f.checks[id] = hc
+		writeXML(w, http.StatusCreated, struct {
+			XMLName     xml.Name `xml:"CreateHealthCheckResponse"`
+			HealthCheck *healthCheck
+		}{HealthCheck: hc})
+	case r.Method == "POST" && strings.HasPrefix(path, "/healthcheck/"):
+		hc, ok := f.checks[strings.TrimPrefix(path, "/healthcheck/")]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchHealthCheck", "no such health check")
+			return
+		}
+		var req struct {
+			healthCheckConfig
+			ResetElements []string `xml:"ResetElements>ResettableElementName"`
+		}
+		if err := xml.NewDecoder(r.Body).Decode(&req); err != nil || req.Type != "" || req.RequestInterval != 0 {
+			writeError(w, http.StatusBadRequest, "InvalidInput", "invalid update")
+			return
+		}
+		c := &hc.HealthCheckConfig
+		if req.FullyQualifiedDomainName != "" {
+			c.FullyQualifiedDomainName = req.FullyQualifiedDomainName
+		}
+		if req.ResourcePath != "" {
+			c.ResourcePath = req.ResourcePath
+		}
+		if req.SearchString != "" {
+			c.SearchString = req.SearchString
+		}
+		if req.Port != 0 {
+			c.Port = req.Port
+		}
+		if req.FailureThreshold != 0 {
+			c.FailureThreshold = req.FailureThreshold
+		}
+		if req.Disabled != nil {
+			c.Disabled = req.Disabled
+		}
+		if req.EnableSNI != nil {
+			c.EnableSNI = req.EnableSNI
+		}
+		if req.Regions != nil {
+			c.Regions = req.Regions
+		}
+		for _, e := range req.ResetElements {
+			if e == "Regions" {
+				c.Regions = nil
+			}
+		}
+		hc.HealthCheckVersion++
+		writeXML(w, http.StatusOK, struct {
+			XMLName     xml.Name `xml:"UpdateHealthCheckResponse"`
+			HealthCheck *healthCheck
+		}{HealthCheck: hc})
+	case r.Method == "DELETE" && strings.HasPrefix(path, "/healthcheck/"):
+		id := strings.TrimPrefix(path, "/healthcheck/")
+		if _, ok := f.checks[id]; !ok {
+			writeError(w, http.StatusNotFound, "NoSuchHealthCheck", "no such health check")
+			return
+		}
+		delete(f.checks, id)
+		delete(f.tags, id)
+		writeXML(w, http.StatusOK, struct {
+			XMLName xml.Name `xml:"DeleteHealthCheckResponse"`
+		}{})
+	case r.Method == "POST" && path == "/tags/healthcheck":
+		var req struct {
+			ResourceIDs []string `xml:"ResourceIds>ResourceId"`
+		}
+		if err := xml.NewDecoder(r.Body).Decode(&req); err != nil || len(req.ResourceIDs) == 0 || len(req.ResourceIDs) > 10 {
+			writeError(w, http.StatusBadRequest, "InvalidInput", "invalid resource ids")
+			return
+		}
+		type set struct {
+			ResourceType string
+			ResourceID   string `xml:"ResourceId"`
+			Tags         []tag  `xml:"Tags>Tag"`
+		}
+		var resp struct {
+			XMLName xml.Name `xml:"ListTagsForResourcesResponse"`
+			Sets    []set    `xml:"ResourceTagSets>ResourceTagSet"`
+		}
+		for _, id := range req.ResourceIDs {
+			s := set{ResourceType: "healthcheck", ResourceID: id}
+			for k, v := range f.tags[id] {
+				s.Tags = append(s.Tags, tag{Key: k, Value: v})
+			}
+			resp.Sets = append(resp.Sets, s)
+		}
+		writeXML(w, http.StatusOK, resp)
+	case r.Method == "POST" && strings.HasPrefix(path, "/tags/healthcheck/"):
+		id := strings.TrimPrefix(path, "/tags/healthcheck/")
+		if _, ok := f.checks[id]; !ok {
+			writeError(w, http.StatusNotFound, "NoSuchHealthCheck", "no such health check")
+			return
+		}
+		var req struct {
+			AddTags       []tag    `xml:"AddTags>Tag"`
+			RemoveTagKeys []string `xml:"RemoveTagKeys>Key"`
+		}
+		if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "InvalidInput", "invalid tags")
+			return
+		}
+		if f.tags[id] == nil {
+			f.tags[id] = make(map[string]string)
+		}
+		for _, t := range req.AddTags {
+			f.tags[id][t.Key] = t.Value
+		}
+		for _, k := range req.RemoveTagKeys {
+			delete(f.tags[id], k)
+		}
+		writeXML(w, http.StatusOK, struct {
+			XMLName xml.Name `xml:"ChangeTagsForResourceResponse"`
+		}{})
+	default:
+		writeError(w, http.StatusNotFound, "NotFound", "not found")
+	}
+}
+
+func writeXML(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, msg string) {
+	type e struct {
+		Type    string
+		Code    string
+		Message string
+	}
+	writeXML(w, status, struct {
+		XMLName   xml.Name `xml:"ErrorResponse"`
+		Error     e
+		RequestID string `xml:"RequestId"`
+	}{Error: e{Type: "Sender", Code: code, Message: msg}, RequestID: "fake"})
+}
+
+func newFakeChecker(t *testing.T, f *fakeRoute53, config Config) (*Route53UptimeChecker, *httptest.Server) {
+	t.Helper()
+	srv := httptest.NewServer(f)
+	config.BaseURL = srv.URL
+	config.Credentials = Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}
+	if config.Tag == "" {
+		config.Tag = "managed-by"
+		config.Owner = "cruise"
+	}
+	c, err := newRoute53UptimeChecker(context.Background(), srv.Client(), config, monitor.RateLimit{})
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	return c, srv
+}
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRoute53UptimeChecker(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeRoute53()
+	config := Config{Cluster: "prod", FailureThreshold: 2}
+	c, srv := newFakeChecker(t, f, config)
+	defer srv.Close()
+
+	uc := &monitor.UptimeCheck{
+		Hostname:               "example.com",
+		Name:                   "mynamespace/example (example.com:443)",
+		EnableTLS:              true,
+		CheckIntervalInMinutes: 5,
+		Path:                   "/healthz",
+		Keyword:                "ok",
+		Contacts:               []string{"web", "oncall"},
+		Regions:                []string{"us-east-1", "eu-west-1", "ap-southeast-1"},
+		Namespace:              "mynamespace",
+		Ingress:                "example",
+	}
+	check(t, c.CreateUptimeCheck(ctx, uc))
+	if !assert.Len(t, f.checks, 1) {
+		return
+	}
+	id := f.ids()[0]
+	assert.Equal(t, id, c.CheckID("example.com"))
+	assert.Equal(t, "prod", uc.Cluster)
+	disabled, sni := false, true
+	assert.Equal(t, healthCheckConfig{
+		Port:                     443,
+		Type:                     "HTTPS_STR_MATCH",
+		ResourcePath:             "/healthz",
+		FullyQualifiedDomainName: "example.com",
+		SearchString:             "ok",
+		RequestInterval:          30,
+		FailureThreshold:         2,
+		Disabled:                 &disabled,
+		EnableSNI:                &sni,
+		Regions:                  []string{"us-east-1", "eu-west-1", "ap-southeast-1"},
+	}, f.checks[id].HealthCheckConfig)
+	assert.Equal(t, map[string]string{
+		"managed-by":           "cruise",
+		"Name":                 "mynamespace/example (example.com:443)",
+		"kubernetes-cluster":   "prod",
+		"kubernetes-namespace": "mynamespace",
+		"kubernetes-ingress":   "example",
+		"cruise-interval":      "5",
+		"cruise-contacts":      "web oncall",
+	}, f.tags[id])
+
+	n, srv2 := newFakeChecker(t, f, config)
+	defer srv2.Close()
+	assert.Equal(t, uc, n.UptimeChecks()["example.com"])
+
+	updated := &monitor.UptimeCheck{
+		Hostname:               "example.com",
+		Name:                   "renamed",
+		EnableTLS:              true,
+		CheckIntervalInMinutes: 1,
+		Keyword:                "healthy",
+	}
+	check(t, n.UpdateUptimeCheck(ctx, updated))
+	assert.Equal(t, []string{id}, f.ids(), "the health check is updated in place")
+	assert.Equal(t, "/", f.checks[id].HealthCheckConfig.ResourcePath)
+	assert.Equal(t, "healthy", f.checks[id].HealthCheckConfig.SearchString)
+	assert.Nil(t, f.checks[id].HealthCheckConfig.Regions)
+	assert.Equal(t, "renamed", f.tags[id]["Name"])
+	assert.NotContains(t, f.tags[id], "cruise-contacts")
+	assert.NotContains(t, f.tags[id], "kubernetes-namespace")
+
+	n, srv3 := newFakeChecker(t, f, config)
+	defer srv3.Close()
+	assert.Equal(t, updated, n.UptimeChecks()["example.com"])
+
+	check(t, n.PauseUptimeCheck(ctx, "example.com"))
+	assert.True(t, *f.checks[id].HealthCheckConfig.Disabled)
+	assert.Equal(t, "healthy", f.checks[id].HealthCheckConfig.SearchString)
+	check(t, n.ResumeUptimeCheck(ctx, "example.com"))
+	assert.False(t, *f.checks[id].HealthCheckConfig.Disabled)
+
+	// the type of a health check is fixed, so dropping TLS replaces it.
+	plain := &monitor.UptimeCheck{Hostname: "example.com", Name: "renamed", CheckIntervalInMinutes: 1}
+	check(t, n.UpdateUptimeCheck(ctx, plain))
+	if assert.Len(t, f.checks, 1) {
+		replaced := f.ids()[0]
+		assert.NotEqual(t, id, replaced)
+		assert.Equal(t, "HTTP", f.checks[replaced].HealthCheckConfig.Type)
+		assert.Equal(t, 80, f.checks[replaced].HealthCheckConfig.Port)
+		assert.Equal(t, "cruise", f.tags[replaced]["managed-by"])
+	}
+
+	check(t, n.DeleteUptimeCheck(ctx, "example.com"))
+	assert.Empty(t, f.checks)
+	assert.Nil(t, n.UptimeChecks()["example.com"])
+}
+
+func TestRoute53Ownership(t *testing.T) {
+	f := newFakeRoute53()
+	owned := map[string]string{"managed-by": "cruise", "Name": "ours"}
+	f.add(healthCheckConfig{Type: "HTTPS", FullyQualifiedDomainName: "theirs.example.com"}, map[string]string{"Name": "theirs"})
+	f.add(healthCheckConfig{Type: "TCP", FullyQualifiedDomainName: "tcp.example.com"}, owned)
+	f.add(healthCheckConfig{Type: "HTTPS", FullyQualifiedDomainName: "ours.example.com", ResourcePath: "/"}, owned)
+	f.add(healthCheckConfig{Type: "HTTP", FullyQualifiedDomainName: "other.example.com"}, map[string]string{"managed-by": "someone-else"})
+	for i := 0; i < 12; i++ {
+		f.add(healthCheckConfig{Type: "HTTP", FullyQualifiedDomainName: fmt.Sprintf("%d.example.com", i)}, owned)
+	}
+
+	// listing spans several pages, and tag batches.
+	c, srv := newFakeChecker(t, f, Config{})
+	defer srv.Close()
+
+	assert.Len(t, c.UptimeChecks(), 13)
+	assert.Equal(t, &monitor.UptimeCheck{
+		Hostname:               "ours.example.com",
+		Name:                   "ours",
+		EnableTLS:              true,
+		CheckIntervalInMinutes: 1,
+	}, c.UptimeChecks()["ours.example.com"])
+	assert.NotContains(t, c.UptimeChecks(), "theirs.example.com")
+	assert.NotContains(t, c.UptimeChecks(), "tcp.example.com")
+	assert.NotContains(t, c.UptimeChecks(), "other.example.com")
+}
+
+func TestRoute53Validation(t *testing.T) {
+	f := newFakeRoute53()
+	c, srv := newFakeChecker(t, f, Config{})
+	defer srv.Close()
+
+	for _, uc := range []*monitor.UptimeCheck{
+		{Hostname: "example.com", HTTP2: true},
+		{Hostname: "example.com", StatusCodes: []int{200}},
+		{Hostname: "example.com", Regions: []string{"us-east-1"}},
+	} {
+		err := c.CreateUptimeCheck(context.Background(), uc)
+		assert.Equal(t, monitor.ValidationFailed, monitor.KindOf(err))
+	}
+	assert.Empty(t, f.checks)
+}
+
+func TestRoute53ErrorKinds(t *testing.T) {
+	tests := []struct {
+		status int
+		code   string
+		want   monitor.ErrorKind
+	}{
+		{http.StatusBadRequest, "Throttling", monitor.RateLimited},
+		{http.StatusBadRequest, "InvalidInput", monitor.ValidationFailed},
+		{http.StatusForbidden, "SignatureDoesNotMatch", monitor.AuthFailed},
+		{http.StatusForbidden, "InvalidClientTokenId", monitor.AuthFailed},
+		{http.StatusBadRequest, "PriorRequestNotComplete", monitor.Transient},
+		{http.StatusServiceUnavailable, "ServiceUnavailable", monitor.Transient},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			f := newFakeRoute53()
+			c, srv := newFakeChecker(t, f, Config{})
+			defer srv.Close()
+
+			f.fail = func(r *http.Request) (int, string) {
+				if r.Method == "POST" {
+					return tt.status, tt.code
+				}
+				return 0, ""
+			}
+			err := c.CreateUptimeCheck(context.Background(), &monitor.UptimeCheck{Hostname: "example.com", Name: "example"})
+			assert.Equal(t, tt.want, monitor.KindOf(err))
+			assert.Contains(t, err.Error(), "fake error")
+		})
+	}
+}
+
+func TestRoute53TagFailure(t *testing.T) {
+	f := newFakeRoute53()
+	c, srv := newFakeChecker(t, f, Config{})
+	defer srv.Close()
+
+	f.fail = func(r *http.Request) (int, string) {
+		if strings.HasPrefix(r.URL.Path, prefix+"/tags/healthcheck/") {
+			return http.StatusServiceUnavailable, "ServiceUnavailable"
+		}
+		return 0, ""
+	}
+	uc := &monitor.UptimeCheck{Hostname: "example.com", Name: "example", CheckIntervalInMinutes: 1}
+	err := c.CreateUptimeCheck(context.Background(), uc)
+	assert.Equal(t, monitor.Transient, monitor.KindOf(err))
+	assert.Empty(t, f.checks, "the untagged health check is deleted")
+	assert.Empty(t, c.UptimeChecks())
+
+	f.fail = nil
+	check(t, c.CreateUptimeCheck(context.Background(), uc))
+	assert.Len(t, f.checks, 1)
+	assert.Equal(t, f.ids()[0], c.CheckID("example.com"))
+}
+
+func TestRoute53Contract(t *testing.T) {
+	monitortest.Run(t, func() monitortest.Backend {
+		f := newFakeRoute53()
+		return monitortest.Backend{
+			New: func(t *testing.T) (monitor.UptimeChecker, *httptest.Server) {
+				return newFakeChecker(t, f, Config{})
+			},
+			Len: func() int { return len(f.checks) },
+			AddUnowned: func(hostname string) {
+				f.add(healthCheckConfig{Type: "HTTPS", FullyQualifiedDomainName: hostname}, map[string]string{"Name": "theirs"})
+			},
+			RateLimit: func() {
+				f.header = http.Header{"Retry-After": []string{"120"}}
+				f.fail = func(r *http.Request) (int, string) { return http.StatusBadRequest, "Throttling" }
+			},
+		}
+	})
+}
+
+func TestSign(t *testing.T) {
+	now := time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC)
+	creds := Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret", SessionToken: "token"}
+	signed := func(body string) string {
+		req, _ := http.NewRequest("POST", "https://route53.amazonaws.com/2013-04-01/healthcheck?b=2&a=1", strings.NewReader(body))
+		sign(req, []byte(body), creds, now)
+		assert.Equal(t, "20180501T120000Z", req.Header.Get("X-Amz-Date"))
+		assert.Equal(t, "token", req.Header.Get("X-Amz-Security-Token"))
+		return req.Header.Get("Authorization")
+	}
+
+	auth := signed("<a/>")
+	assert.True(t, strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/20180501/us-east-1/route53/aws4_request, "+
+		"SignedHeaders=host;x-amz-content-sha256;x-amz-date;x-amz-security-token, Signature="), auth)
+	assert.Equal(t, auth, signed("<a/>"))
+	assert.NotEqual(t, auth, signed("<b/>"))
+}
+
+func TestEscape(t *testing.T) {
+	assert.Equal(t, "a-b_c.d~e", escape("a-b_c.d~e"))
+	assert.Equal(t, "a%20b%2Fc%3D", escape("a b/c="))
+}
@@ -0,0 +1,202 @@
+// Package secret handles the credentials given to cruise, such as the
+// passwords and API keys of monitoring providers: it reads them from
+// flags, environment variables or files, and redacts them from logs.
+package secret
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+// Redacted replaces secrets in redacted text.
+const Redacted = "[redacted]"
+
+// Value is a secret given by a flag, an environment variable or a file.
+// Files suit Kubernetes Secrets mounted as volumes: unlike flags they
+// do not appear in the process list, and unlike environment variables
+// they may be rotated while cruise runs.
+type Value struct {
+	value string
+
+	// path is the file given for the secret, and contents what it
+	// held when the flag was parsed.
+	path, contents string
+}
+
+// FlagSet is the set of command line flags to which a Value adds its
+// own.
+type FlagSet interface {
+	Flag(name, help string) *kingpin.FlagClause
+}
+
+// Flags adds to fs the flags which give v: --name, which may instead be
+// given by the environment variable envVar, and --name-file, the path
+// of a file holding the secret, which takes precedence.
+func (v *Value) Flags(fs FlagSet, name, help, envVar string) {
+	fs.Flag(name, help).Envar(envVar).SetValue(String(&v.value))
+	fs.Flag(name+"-file", "path of a file holding the "+help).SetValue(&fileValue{v})
+}
+
+// Secret returns the secret.
+func (v *Value) Secret() string {
+	if v.path != "" {
+		return v.contents
+	}
+	return v.value
+}
+
+// String returns v redacted, so that it is not revealed if printed.
+func (v Value) String() string {
+	if v.Secret() == "" {
+		return ""
+	}
+	return Redacted
+}
+
+// String returns a kingpin.Value, for a flag, which sets target to a
+// secret to be redacted.
+func String(target *string) kingpin.Value {
+	return &stringValue{target}
+}
+
+type stringValue struct {
+	target *string
+}
+
+func (s *stringValue) Set(v string) error {
+	add(v)
+	*s.target = v
+	return nil
+}
+
+func (s *stringValue) String() string {
+	if *s.target == "" {
+		return ""
+	}
+	return Redacted
+}
+
+// IsSecret reports whether v, the value of a flag, holds a secret. Such
+// a flag is set rather than given a default, which --help would print.
+func IsSecret(v kingpin.Value) bool {
+	_, ok := v.(*stringValue)
+	return ok
+}
+
+// Deprecated returns the action of a deprecated flag which gives a
+// secret on the command line, where other users of the host may read it,
+// eg. with ps. It warns that instead, a flag added by Value.Flags, should
+// be given its file or environment variable.
+func Deprecated(flag, instead, envVar string) kingpin.Action {
+	return func(*kingpin.ParseContext) error {
+		logrus.Warnf("--%s is deprecated and reveals its secret to the other users of the host; use --%s-file or $%s instead", flag, instead, envVar)
+		return nil
+	}
+}
+
+// fileValue is the value of the flag giving the file which holds a
+// Value.
+type fileValue struct {
+	v *Value
+}
+
+func (f *fileValue) Set(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	contents := strings.TrimRight(string(data), "\r\n")
+	if contents == "" {
+		return fmt.Errorf("%s is empty", path)
+	}
+	add(contents)
+	f.v.path, f.v.contents = path, contents
+	return nil
+}
+
+func (f *fileValue) String() string {
+	return f.v.path
+}
+
+// Files returns the paths of the files given for secrets by the flags of
+// cmd, so that they may be watched for changes.
+func Files(cmd *kingpin.CmdClause) []string {
+	var files []string
+	for _, flag := range cmd.Model().Flags {
+		if f, ok := flag.Value.(*fileValue); ok && f.v.path != "" {
+			files = append(files, f.v.path)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+var (
+	mu      sync.Mutex
+	secrets = make(map[string]bool)
+)
+
+// add records s as a secret to be redacted.
+func add(s string) {
+	if s == "" {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	secrets[s] = true
+}
+
+// Redact returns s with every secret given to a flag replaced by
+// Redacted.
+func Redact(s string) string {
+	mu.Lock()
+	defer mu.Unlock()
+	if len(secrets) == 0 {
+		return s
+	}
+	// replace the longest first, in case one secret contains another.
+	var olds []string
+	for secret := range secrets {
+		olds = append(olds, secret)
+	}
+	sort.Slice(olds, func(i, j int) bool { return len(olds[i]) > len(olds[j]) })
+	var oldnew []string
+	for _, old := range olds {
+		oldnew = append(oldnew, old, Redacted)
+	}
+	return strings.NewReplacer(oldnew...).Replace(s)
+}
+
+// Formatter is a logrus.Formatter which redacts the secrets from the
+// entries formatted by another.
+type Formatter struct {
+	logrus.Formatter
+}
+
+// Format implements logrus.Formatter.
+func (f *Formatter) Format(e *logrus.Entry) ([]byte, error) {
+	b, err := f.Formatter.Format(e)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(Redact(string(b))), nil
+}
+
+// RedactLogs redacts the output of logger from now on.
+func RedactLogs(logger *logrus.Logger) {
+	logger.Formatter = &Formatter{logger.Formatter}
+}
+
+// NewLogger returns a logrus.Logger, as logrus.New, whose output is
+// redacted.
+func NewLogger() *logrus.Logger {
+	logger := logrus.New()
+	RedactLogs(logger)
+	return logger
+}
@@ -0,0 +1,136 @@
+package secret
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+func TestValue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secret")
+	check(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "password")
+	check(t, ioutil.WriteFile(path, []byte("from-file-password\n"), 0600))
+	check(t, ioutil.WriteFile(filepath.Join(dir, "empty"), nil, 0600))
+
+	os.Setenv("TEST_SECRET_PASSWORD", "from-env-password")
+	defer os.Unsetenv("TEST_SECRET_PASSWORD")
+
+	tests := map[string]struct {
+		args []string
+		want string
+		err  string
+	}{
+		"environment": {
+			want: "from-env-password",
+		},
+		"flag": {
+			args: []string{"--password=from-flag-password"},
+			want: "from-flag-password",
+		},
+		"file takes precedence": {
+			args: []string{"--password=from-flag-password", "--password-file=" + path},
+			want: "from-file-password",
+		},
+		"missing file": {
+			args: []string{"--password-file=" + filepath.Join(dir, "missing")},
+			err:  "no such file",
+		},
+		"empty file": {
+			args: []string{"--password-file=" + filepath.Join(dir, "empty")},
+			err:  "is empty",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			app := kingpin.New("test", "")
+			cmd := app.Command("serve", "")
+			var v Value
+			v.Flags(cmd, "password", "password", "TEST_SECRET_PASSWORD")
+			_, err := app.Parse(append([]string{"serve"}, tc.args...))
+			if tc.err != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tc.err)
+				}
+				return
+			}
+			check(t, err)
+			assert.Equal(t, tc.want, v.Secret())
+			assert.Equal(t, Redacted, fmt.Sprint(v))
+			assert.Equal(t, "login "+Redacted, Redact("login "+tc.want))
+		})
+	}
+}
+
+func TestDeprecated(t *testing.T) {
+	hook := test.NewGlobal()
+	defer func() { logrus.StandardLogger().Hooks = make(logrus.LevelHooks) }()
+
+	app := kingpin.New("test", "")
+	cmd := app.Command("serve", "")
+	var old string
+	flag := cmd.Flag("password", "password").Action(Deprecated("password", "new-password", "TEST_SECRET_PASSWORD"))
+	flag.SetValue(String(&old))
+	assert.True(t, IsSecret(flag.Model().Value))
+
+	_, err := app.Parse([]string{"serve"})
+	check(t, err)
+	assert.Nil(t, hook.LastEntry())
+
+	_, err = app.Parse([]string{"serve", "--password=deprecated-secret"})
+	check(t, err)
+	assert.Equal(t, "deprecated-secret", old)
+	if assert.NotNil(t, hook.LastEntry()) {
+		assert.Equal(t, logrus.WarnLevel, hook.LastEntry().Level)
+		assert.Contains(t, hook.LastEntry().Message, "use --new-password-file or $TEST_SECRET_PASSWORD instead")
+	}
+}
+
+func TestFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secret")
+	check(t, err)
+	defer os.RemoveAll(dir)
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	check(t, ioutil.WriteFile(a, []byte("files-secret-a"), 0600))
+	check(t, ioutil.WriteFile(b, []byte("files-secret-b"), 0600))
+
+	app := kingpin.New("test", "")
+	cmd := app.Command("serve", "")
+	var x, y, z Value
+	x.Flags(cmd, "x", "x", "TEST_SECRET_X")
+	y.Flags(cmd, "y", "y", "TEST_SECRET_Y")
+	z.Flags(cmd, "z", "z", "TEST_SECRET_Z")
+	_, err = app.Parse([]string{"serve", "--y-file=" + b, "--x-file=" + a, "--z=files-secret-z"})
+	check(t, err)
+	assert.Equal(t, []string{a, b}, Files(cmd))
+}
+
+func TestFormatter(t *testing.T) {
+	var target string
+	check(t, String(&target).Set("formatter-secret"))
+	check(t, String(&target).Set("formatter-secret-longer"))
+
+	var buf bytes.Buffer
+	logger := NewLogger()
+	logger.Out = &buf
+	logger.Formatter.(*Formatter).Formatter = &logrus.TextFormatter{DisableTimestamp: true}
+	logger.WithField("token", "formatter-secret").Infof("connecting with formatter-secret-longer")
+	assert.Equal(t, "level=info msg=\"connecting with [redacted]\" token=[redacted]\n", buf.String())
+}
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
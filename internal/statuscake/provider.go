@@ -0,0 +1,31 @@
+package statuscake
+
+import (
+	"context"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+	"github.com/heptiolabs/cruise/internal/secret"
+)
+
+func init() {
+	monitor.Register("statuscake", func() monitor.Provider { return new(provider) })
+}
+
+// provider configures a StatusCakeUptimeChecker from command line flags.
+type provider struct {
+	config Config
+	apikey secret.Value
+}
+
+func (p *provider) Flags(fs monitor.FlagSet) {
+	p.apikey.Flags(fs, "statuscake-apikey", "StatusCake API Key", "STATUSCAKE_APIKEY")
+	fs.Flag("statuscake-tag", "tag marking the StatusCake tests managed by cruise").Default("cruise").StringVar(&p.config.Tag)
+	fs.Flag("statuscake-contact-group", "ID of a StatusCake contact group alerted by default, may be repeated").StringsVar(&p.config.ContactGroups)
+	fs.Flag("statuscake-url", "StatusCake API base URL").Default(DefaultBaseURL).StringVar(&p.config.BaseURL)
+}
+
+func (p *provider) New(ctx context.Context, opts monitor.Options) (monitor.UptimeChecker, error) {
+	config := p.config
+	config.APIKey = p.apikey.Secret()
+	return NewStatusCakeUptimeChecker(ctx, config, opts.RateLimit)
+}
@@ -0,0 +1,422 @@
+// Package statuscake implements an UptimeChecker backed by the StatusCake
+// v1 API.
+package statuscake
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+)
+
+// DefaultBaseURL is the address of the StatusCake v1 API.
+const DefaultBaseURL = "https://api.statuscake.com/v1"
+
+// pageSize is the number of checks requested per page when listing.
+const pageSize = 100
+
+// checkRates are the intervals, in seconds, supported by StatusCake.
+var checkRates = []int{60, 300, 900, 1800, 3600, 86400}
+
+// Config configures a StatusCakeUptimeChecker.
+type Config struct {
+	// APIKey is the StatusCake API token.
+	APIKey string
+
+	// Tag marks the checks owned by cruise. Checks without it are
+	// ignored, and never modified.
+	Tag string
+
+	// ContactGroups are the IDs of the contact groups alerted by
+	// checks which do not specify their own contacts.
+	ContactGroups []string
+
+	// BaseURL, if set, overrides DefaultBaseURL.
+	BaseURL string
+}
+
+type StatusCakeUptimeChecker struct {
+	config       Config
+	client       *http.Client
+	throttle     *monitor.Throttle
+	uptimeChecks map[string]*monitor.UptimeCheck
+}
+
+// NewStatusCakeUptimeChecker returns an UptimeChecker which manages the
+// StatusCake uptime tests tagged with config.Tag. Calls to the StatusCake
+// API are limited to the rate given by limit.
+func NewStatusCakeUptimeChecker(ctx context.Context, config Config, limit monitor.RateLimit) (monitor.UptimeChecker, error) {
+	return newStatusCakeUptimeChecker(ctx, http.DefaultClient, config, limit)
+}
+
+func newStatusCakeUptimeChecker(ctx context.Context, client *http.Client, config Config, limit monitor.RateLimit) (*StatusCakeUptimeChecker, error) {
+	if config.BaseURL == "" {
+		config.BaseURL = DefaultBaseURL
+	}
+	if config.Tag == "" {
+		return nil, fmt.Errorf("statuscake: an ownership tag is required")
+	}
+	c := &StatusCakeUptimeChecker{
+		config:       config,
+		client:       client,
+		throttle:     monitor.NewThrottle(limit),
+		uptimeChecks: make(map[string]*monitor.UptimeCheck),
+	}
+	return c, c.SyncUptimeChecks(ctx)
+}
+
+// Adopts returns false: only the tests tagged config.Tag are listed.
+func (c *StatusCakeUptimeChecker) Adopts() bool { return false }
+
+func (c *StatusCakeUptimeChecker) UptimeChecks() map[string]*monitor.UptimeCheck {
+	return c.uptimeChecks
+}
+
+// test is an uptime test as returned by the StatusCake API.
+type test struct {
+	ID            string   `json:"id"`
+	Name          string   `json:"name"`
+	WebsiteURL    string   `json:"website_url"`
+	TestType      string   `json:"test_type"`
+	CheckRate     int      `json:"check_rate"`
+	ContactGroups []string `json:"contact_groups"`
+	Regions       []string `json:"regions"`
+	FindString    string   `json:"find_string"`
+	Paused        bool     `json:"paused"`
+	Status        string   `json:"status"`
+	Tags          []string `json:"tags"`
+}
+
+func (c *StatusCakeUptimeChecker) SyncUptimeChecks(ctx context.Context) error {
+	checks := make(map[string]*monitor.UptimeCheck)
+	for page := 1; ; page++ {
+		var list struct {
+			Data     []test `json:"data"`
+			Metadata struct {
+				Page      int `json:"page"`
+				PageCount int `json:"page_count"`
+			} `json:"metadata"`
+		}
+		query := url.Values{
+			"page":  {strconv.Itoa(page)},
+			"limit": {strconv.Itoa(pageSize)},
+			"tags":  {c.config.Tag},
+		}
+		if err := c.do(ctx, "list", "GET", "/uptime?"+query.Encode(), nil, &list); err != nil {
+			return err
+		}
+		for _, t := range list.Data {
+			if !c.owns(t) {
+				continue
+			}
+			if check := c.toUptimeCheck(t); check != nil {
+				checks[check.Hostname] = check
+			}
+		}
+		if page >= list.Metadata.PageCount {
+			break
+		}
+	}
+	c.uptimeChecks = checks
+	return nil
+}
+
+// owns reports whether t is tagged as being managed by cruise.
+func (c *StatusCakeUptimeChecker) owns(t test) bool {
+	for _, tag := range t.Tags {
+		if tag == c.config.Tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *StatusCakeUptimeChecker) CreateUptimeCheck(ctx context.Context, check *monitor.UptimeCheck) error {
+	form := c.form(check)
+	form.Set("test_type", "HTTP")
+
+	var res struct {
+		Data struct {
+			NewID string `json:"new_id"`
+		} `json:"data"`
+	}
+	if err := c.do(ctx, "create", "POST", "/uptime", form, &res); err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(res.Data.NewID)
+	if err != nil {
+		return &monitor.Error{Kind: monitor.Unknown, Op: "create", Err: fmt.Errorf("invalid test id %q", res.Data.NewID)}
+	}
+	check.ID = id
+	c.normalize(check)
+	c.uptimeChecks[check.Hostname] = check
+	return nil
+}
+
+// UpdateUptimeCheck modifies the existing test for check.Hostname to
+// match check.
+func (c *StatusCakeUptimeChecker) UpdateUptimeCheck(ctx context.Context, check *monitor.UptimeCheck) error {
+	existing, exists := c.uptimeChecks[check.Hostname]
+	if !exists {
+		return &monitor.Error{Kind: monitor.NotFound, Op: "update", Err: fmt.Errorf("no check for %q", check.Hostname)}
+	}
+	if err := c.do(ctx, "update", "PUT", "/uptime/"+strconv.Itoa(existing.ID), c.form(check), nil); err != nil {
+		return err
+	}
+	check.ID = existing.ID
+	c.normalize(check)
+	c.uptimeChecks[check.Hostname] = check
+	return nil
+}
+
+func (c *StatusCakeUptimeChecker) DeleteUptimeCheck(ctx context.Context, hostName string) error {
+	check, exists := c.uptimeChecks[hostName]
+	if !exists {
+		return nil
+	}
+
+	err := c.do(ctx, "delete", "DELETE", "/uptime/"+strconv.Itoa(check.ID), nil, nil)
+	if err != nil && !monitor.IsNotFound(err) {
+		return err
+	}
+
+	delete(c.uptimeChecks, hostName)
+	return nil
+}
+
+func (c *StatusCakeUptimeChecker) PauseUptimeCheck(ctx context.Context, hostName string) error {
+	return c.setPaused(ctx, "pause", hostName, true)
+}
+
+func (c *StatusCakeUptimeChecker) ResumeUptimeCheck(ctx context.Context, hostName string) error {
+	return c.setPaused(ctx, "resume", hostName, false)
+}
+
+func (c *StatusCakeUptimeChecker) setPaused(ctx context.Context, op, hostName string, paused bool) error {
+	check, exists := c.uptimeChecks[hostName]
+	if !exists {
+		return &monitor.Error{Kind: monitor.NotFound, Op: op, Err: fmt.Errorf("no check for %q", hostName)}
+	}
+	if check.Paused == paused {
+		return nil
+	}
+
+	form := url.Values{"paused": {strconv.FormatBool(paused)}}
+	if err := c.do(ctx, op, "PUT", "/uptime/"+strconv.Itoa(check.ID), form, nil); err != nil {
+		return err
+	}
+	check.Paused = paused
+	return nil
+}
+
+// form returns the StatusCake parameters which define check.
+func (c *StatusCakeUptimeChecker) form(check *monitor.UptimeCheck) url.Values {
+	form := url.Values{
+		"name":        {check.Name},
+		"website_url": {websiteURL(check)},
+		"check_rate":  {strconv.Itoa(checkRate(check.CheckIntervalInMinutes))},
+		"paused":      {strconv.FormatBool(check.Paused)},
+		"tags[]":      {c.config.Tag},
+	}
+	contacts := check.Contacts
+	if len(contacts) == 0 {
+		contacts = c.config.ContactGroups
+	}
+	for _, id := range contacts {
+		form.Add("contact_groups[]", id)
+	}
+	for _, r := range check.Regions {
+		form.Add("regions[]", r)
+	}
+	if check.EnableTLS {
+		form.Set("enable_ssl_alert", "true")
+	}
+	form.Set("find_string", check.Keyword)
+	return form
+}
+
+func websiteURL(check *monitor.UptimeCheck) string {
+	u := url.URL{
+		Scheme: "http",
+		Host:   check.Hostname,
+		Path:   check.Path,
+	}
+	if check.EnableTLS {
+		u.Scheme = "https"
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return u.String()
+}
+
+// checkRate returns the shortest interval supported by StatusCake which
+// is at least minutes long.
+func checkRate(minutes int) int {
+	secs := minutes * 60
+	for _, r := range checkRates {
+		if r >= secs {
+			return r
+		}
+	}
+	return checkRates[len(checkRates)-1]
+}
+
+// Normalize returns check with its interval rounded up to a rate at
+// which StatusCake can check, and without its contacts if they are the
+// default contact groups.
+func (c *StatusCakeUptimeChecker) Normalize(check *monitor.UptimeCheck) *monitor.UptimeCheck {
+	n := *check
+	c.normalize(&n)
+	return &n
+}
+
+func (c *StatusCakeUptimeChecker) normalize(check *monitor.UptimeCheck) {
+	check.CheckIntervalInMinutes = checkRate(check.CheckIntervalInMinutes) / 60
+	if c.defaultContacts(check.Contacts) {
+		check.Contacts = nil
+	}
+}
+
+// defaultContacts reports whether groups are the default contact groups,
+// in any order.
+func (c *StatusCakeUptimeChecker) defaultContacts(groups []string) bool {
+	if len(groups) != len(c.config.ContactGroups) {
+		return false
+	}
+	a := append([]string(nil), groups...)
+	b := append([]string(nil), c.config.ContactGroups...)
+	sort.Strings(a)
+	sort.Strings(b)
+	return reflect.DeepEqual(a, b)
+}
+
+// toUptimeCheck converts t to an UptimeCheck, or returns nil if t is not
+// a check for an HTTP(S) URL.
+func (c *StatusCakeUptimeChecker) toUptimeCheck(t test) *monitor.UptimeCheck {
+	u, err := url.Parse(t.WebsiteURL)
+	if err != nil || u.Hostname() == "" {
+		return nil
+	}
+	id, err := strconv.Atoi(t.ID)
+	if err != nil {
+		return nil
+	}
+	path := u.Path
+	if path == "/" {
+		path = ""
+	}
+	minutes := t.CheckRate / 60
+	if minutes < 1 {
+		minutes = 1
+	}
+	// tests alerting only the default contact groups were created
+	// without contacts of their own.
+	contacts := t.ContactGroups
+	if c.defaultContacts(contacts) {
+		contacts = nil
+	}
+	return &monitor.UptimeCheck{
+		Hostname:               u.Hostname(),
+		ID:                     id,
+		Name:                   t.Name,
+		CheckIntervalInMinutes: minutes,
+		EnableTLS:              u.Scheme == "https",
+		Paused:                 t.Paused,
+		Path:                   path,
+		Contacts:               contacts,
+		Regions:                t.Regions,
+		Keyword:                t.FindString,
+		Status:                 status(t.Status),
+	}
+}
+
+// status returns the UptimeCheck.Status for a StatusCake test status.
+func status(s string) string {
+	switch strings.ToLower(s) {
+	case "up":
+		return monitor.StatusUp
+	case "down":
+		return monitor.StatusDown
+	default:
+		return ""
+	}
+}
+
+// apiError is the body of an unsuccessful StatusCake API response.
+type apiError struct {
+	StatusCode int
+	Message    string              `json:"message"`
+	Errors     map[string][]string `json:"errors"`
+}
+
+func (e *apiError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = http.StatusText(e.StatusCode)
+	}
+	var details []string
+	for field, errs := range e.Errors {
+		details = append(details, field+": "+strings.Join(errs, ", "))
+	}
+	if len(details) > 0 {
+		msg += " (" + strings.Join(details, "; ") + ")"
+	}
+	return fmt.Sprintf("statuscake: %d %s", e.StatusCode, msg)
+}
+
+// do performs a single StatusCake API request bounded by ctx, sending
+// form, if any, as the request body and decoding the response into v.
+// Any error is returned as a *monitor.Error.
+func (c *StatusCakeUptimeChecker) do(ctx context.Context, op, method, rsc string, form url.Values, v interface{}) error {
+	if err := c.throttle.Wait(ctx, op); err != nil {
+		return err
+	}
+
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequest(method, c.config.BaseURL+rsc, body)
+	if err != nil {
+		return &monitor.Error{Kind: monitor.Unknown, Op: op, Err: err}
+	}
+	req.Header.Set("Authorization", "Bearer "+c.config.APIKey)
+	req.Header.Set("Accept", "application/json")
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return monitor.Wrap(ctx, op, err)
+	}
+	defer resp.Body.Close()
+	c.throttle.Delay(monitor.RetryAfterHeader(resp))
+
+	if resp.StatusCode >= 300 {
+		e := &apiError{StatusCode: resp.StatusCode}
+		json.NewDecoder(resp.Body).Decode(e)
+		err := &monitor.Error{Kind: monitor.KindForStatus(resp.StatusCode), Op: op, Err: e}
+		if err.Kind == monitor.RateLimited {
+			err.RetryAfter = c.throttle.Backoff()
+		}
+		return err
+	}
+	if v == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return monitor.Wrap(ctx, op, err)
+	}
+	return nil
+}
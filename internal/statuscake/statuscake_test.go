@@ -0,0 +1,373 @@
+package statuscake
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+	"github.com/heptiolabs/cruise/internal/monitor/monitortest"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeStatusCake is an in memory stand in for the StatusCake v1 API.
+type fakeStatusCake struct {
+	mu      sync.Mutex
+	nextID  int
+	tests   map[string]test
+	perPage int
+	fail    func(*http.Request) int
+	header  http.Header
+	pages   int // number of list requests
+}
+
+func newFakeStatusCake() *fakeStatusCake {
+	return &fakeStatusCake{
+		nextID:  1,
+		tests:   make(map[string]test),
+		perPage: 2,
+	}
+}
+
+func (f *fakeStatusCake) add(t test) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t.ID = strconv.Itoa(f.nextID)
+	f.nextID++
+	f.tests[t.ID] = t
+}
+
+func (f *fakeStatusCake) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for k, v := range f.header {
+		w.Header()[k] = v
+	}
+	if r.Header.Get("Authorization") != "Bearer key" {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	if f.fail != nil {
+		if status := f.fail(r); status != 0 {
+			writeError(w, status, "fake error")
+			return
+		}
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/uptime/")
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/uptime":
+		f.pages++
+		var ids []int
+		for id := range f.tests {
+			n, _ := strconv.Atoi(id)
+			ids = append(ids, n)
+		}
+		sort.Ints(ids)
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		var data []test
+		for i, n := range ids {
+			if i/f.perPage+1 == page {
+				data = append(data, f.tests[strconv.Itoa(n)])
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"data": data,
+			"metadata": map[string]interface{}{
+				"page":       page,
+				"per_page":   f.perPage,
+				"page_count": (len(ids) + f.perPage - 1) / f.perPage,
+			},
+		})
+	case r.Method == "POST" && r.URL.Path == "/uptime":
+		r.ParseForm()
+		if r.PostForm.Get("website_url") == "" {
+			writeError(w, http.StatusBadRequest, "website_url is required")
+			return
+		}
+		t := test{ID: strconv.Itoa(f.nextID)}
+		f.nextID++
+		update(&t, r)
+		f.tests[t.ID] = t
+		writeJSON(w, http.StatusCreated, map[string]interface{}{
+			"data": map[string]string{"new_id": t.ID},
+		})
+	case r.Method == "PUT" && id != r.URL.Path:
+		t, ok := f.tests[id]
+		if !ok {
+			writeError(w, http.StatusNotFound, "no such test")
+			return
+		}
+		r.ParseForm()
+		update(&t, r)
+		f.tests[id] = t
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "DELETE" && id != r.URL.Path:
+		if _, ok := f.tests[id]; !ok {
+			writeError(w, http.StatusNotFound, "no such test")
+			return
+		}
+		delete(f.tests, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusBadRequest, "bad request")
+	}
+}
+
+// update applies the form parameters of r to t.
+func update(t *test, r *http.Request) {
+	form := r.PostForm
+	if v, ok := form["name"]; ok {
+		t.Name = v[0]
+	}
+	if v, ok := form["website_url"]; ok {
+		t.WebsiteURL = v[0]
+	}
+	if v, ok := form["test_type"]; ok {
+		t.TestType = v[0]
+	}
+	if v, ok := form["check_rate"]; ok {
+		t.CheckRate, _ = strconv.Atoi(v[0])
+	}
+	if v, ok := form["paused"]; ok {
+		t.Paused = v[0] == "true"
+	}
+	if v, ok := form["contact_groups[]"]; ok {
+		t.ContactGroups = v
+	}
+	if v, ok := form["regions[]"]; ok {
+		t.Regions = v
+	}
+	if v, ok := form["find_string"]; ok {
+		t.FindString = v[0]
+	}
+	if v, ok := form["tags[]"]; ok {
+		t.Tags = v
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]interface{}{
+		"message": msg,
+		"errors":  map[string][]string{},
+	})
+}
+
+func newFakeChecker(t *testing.T, f *fakeStatusCake, config Config) (*StatusCakeUptimeChecker, *httptest.Server) {
+	t.Helper()
+	srv := httptest.NewServer(f)
+	config.BaseURL = srv.URL
+	if config.APIKey == "" {
+		config.APIKey = "key"
+	}
+	if config.Tag == "" {
+		config.Tag = "cruise"
+	}
+	c, err := newStatusCakeUptimeChecker(context.Background(), srv.Client(), config, monitor.RateLimit{})
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	return c, srv
+}
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStatusCakeUptimeChecker(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeStatusCake()
+	c, srv := newFakeChecker(t, f, Config{ContactGroups: []string{"7"}})
+	defer srv.Close()
+
+	uc := &monitor.UptimeCheck{
+		Hostname:               "example.com",
+		Name:                   "mynamespace/example (example.com:443)",
+		EnableTLS:              true,
+		CheckIntervalInMinutes: 5,
+		Path:                   "/healthz",
+		Regions:                []string{"london", "dallas"},
+		Keyword:                "ok",
+	}
+	check(t, c.CreateUptimeCheck(ctx, uc))
+	assert.Equal(t, 1, uc.ID)
+
+	created := f.tests["1"]
+	assert.Equal(t, "https://example.com/healthz", created.WebsiteURL)
+	assert.Equal(t, "HTTP", created.TestType)
+	assert.Equal(t, 300, created.CheckRate)
+	assert.Equal(t, []string{"7"}, created.ContactGroups)
+	assert.Equal(t, []string{"london", "dallas"}, created.Regions)
+	assert.Equal(t, []string{"cruise"}, created.Tags)
+
+	n, srv2 := newFakeChecker(t, f, Config{ContactGroups: []string{"7"}})
+	defer srv2.Close()
+	synced := n.UptimeChecks()["example.com"]
+	assert.Equal(t, "mynamespace/example (example.com:443)", synced.Name)
+	assert.True(t, synced.EnableTLS)
+	assert.Equal(t, 5, synced.CheckIntervalInMinutes)
+	assert.Equal(t, "/healthz", synced.Path)
+	assert.Empty(t, synced.Contacts)
+	assert.Equal(t, "ok", synced.Keyword)
+	assert.True(t, monitor.SameCheck(synced, uc))
+
+	updated := &monitor.UptimeCheck{
+		Hostname:               "example.com",
+		Name:                   "renamed",
+		CheckIntervalInMinutes: 1,
+		Contacts:               []string{"8", "9"},
+	}
+	check(t, n.UpdateUptimeCheck(ctx, updated))
+	assert.Equal(t, 1, updated.ID)
+	assert.Equal(t, "renamed", f.tests["1"].Name)
+	assert.Equal(t, "http://example.com/", f.tests["1"].WebsiteURL)
+	assert.Equal(t, 60, f.tests["1"].CheckRate)
+	assert.Equal(t, []string{"8", "9"}, f.tests["1"].ContactGroups)
+
+	check(t, n.PauseUptimeCheck(ctx, "example.com"))
+	assert.True(t, f.tests["1"].Paused)
+	check(t, n.ResumeUptimeCheck(ctx, "example.com"))
+	assert.False(t, f.tests["1"].Paused)
+
+	check(t, n.DeleteUptimeCheck(ctx, "example.com"))
+	assert.Empty(t, f.tests)
+	assert.Nil(t, n.UptimeChecks()["example.com"])
+}
+
+func TestStatusCakeOwnership(t *testing.T) {
+	f := newFakeStatusCake()
+	f.add(test{Name: "theirs", WebsiteURL: "https://theirs.example.com", CheckRate: 300, Tags: []string{"other"}})
+	f.add(test{Name: "untagged", WebsiteURL: "https://untagged.example.com", CheckRate: 300})
+	f.add(test{Name: "ours", WebsiteURL: "https://ours.example.com", CheckRate: 300, Tags: []string{"other", "cruise"}})
+
+	c, srv := newFakeChecker(t, f, Config{})
+	defer srv.Close()
+
+	assert.Len(t, c.UptimeChecks(), 1)
+	assert.Contains(t, c.UptimeChecks(), "ours.example.com")
+}
+
+func TestStatusCakePagination(t *testing.T) {
+	f := newFakeStatusCake()
+	for _, h := range []string{"a", "b", "c", "d", "e"} {
+		f.add(test{Name: h, WebsiteURL: "http://" + h + ".example.com/", CheckRate: 60, Tags: []string{"cruise"}})
+	}
+
+	c, srv := newFakeChecker(t, f, Config{})
+	defer srv.Close()
+
+	assert.Equal(t, 3, f.pages)
+	assert.Len(t, c.UptimeChecks(), 5)
+	assert.Equal(t, "", c.UptimeChecks()["e.example.com"].Path)
+}
+
+func TestStatusCakeErrorKinds(t *testing.T) {
+	tests := map[int]monitor.ErrorKind{
+		http.StatusUnauthorized:        monitor.AuthFailed,
+		http.StatusTooManyRequests:     monitor.RateLimited,
+		http.StatusBadRequest:          monitor.ValidationFailed,
+		http.StatusInternalServerError: monitor.Transient,
+	}
+
+	for status, want := range tests {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			f := newFakeStatusCake()
+			c, srv := newFakeChecker(t, f, Config{})
+			defer srv.Close()
+
+			f.fail = func(r *http.Request) int {
+				if r.Method == "POST" {
+					return status
+				}
+				return 0
+			}
+			err := c.CreateUptimeCheck(context.Background(), &monitor.UptimeCheck{Hostname: "example.com", Name: "example"})
+			assert.Equal(t, want, monitor.KindOf(err))
+			assert.Contains(t, err.Error(), "fake error")
+		})
+	}
+}
+
+func TestStatusCakeContract(t *testing.T) {
+	monitortest.Run(t, func() monitortest.Backend {
+		f := newFakeStatusCake()
+		return monitortest.Backend{
+			New: func(t *testing.T) (monitor.UptimeChecker, *httptest.Server) {
+				return newFakeChecker(t, f, Config{})
+			},
+			Len: func() int { return len(f.tests) },
+			AddUnowned: func(hostname string) {
+				f.add(test{Name: hostname, WebsiteURL: "https://" + hostname, CheckRate: 300, Tags: []string{"other"}})
+			},
+			RateLimit: func() {
+				f.header = http.Header{"Retry-After": []string{"120"}}
+				f.fail = func(r *http.Request) int { return http.StatusTooManyRequests }
+			},
+		}
+	})
+}
+
+func TestStatusCakeNormalize(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeStatusCake()
+	config := Config{ContactGroups: []string{"7", "8"}}
+	c, srv := newFakeChecker(t, f, config)
+	defer srv.Close()
+
+	uc := &monitor.UptimeCheck{
+		Hostname:               "example.com",
+		Name:                   "example",
+		CheckIntervalInMinutes: 10,
+		Contacts:               []string{"8", "7"},
+	}
+	want := c.Normalize(uc)
+	assert.Equal(t, 15, want.CheckIntervalInMinutes)
+	assert.Empty(t, want.Contacts)
+	assert.Equal(t, 10, uc.CheckIntervalInMinutes, "Normalize modified its argument")
+
+	check(t, c.CreateUptimeCheck(ctx, uc))
+	assert.Equal(t, 900, f.tests["1"].CheckRate)
+	assert.True(t, monitor.SameCheck(c.UptimeChecks()["example.com"], want))
+
+	n, srv2 := newFakeChecker(t, f, config)
+	defer srv2.Close()
+	assert.True(t, monitor.SameCheck(n.UptimeChecks()["example.com"], want))
+
+	other := c.Normalize(&monitor.UptimeCheck{Hostname: "example.com", Contacts: []string{"7"}})
+	assert.Equal(t, []string{"7"}, other.Contacts)
+}
+
+func TestCheckRate(t *testing.T) {
+	tests := map[int]int{0: 60, 1: 60, 2: 300, 5: 300, 30: 1800, 2000: 86400}
+	for minutes, want := range tests {
+		assert.Equal(t, want, checkRate(minutes), "checkRate(%d)", minutes)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	tests := map[string]string{
+		"Up":   monitor.StatusUp,
+		"Down": monitor.StatusDown,
+		"":     "",
+	}
+	for s, want := range tests {
+		assert.Equal(t, want, status(s), s)
+	}
+}
@@ -0,0 +1,30 @@
+package uptimerobot
+
+import (
+	"context"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+	"github.com/heptiolabs/cruise/internal/secret"
+)
+
+func init() {
+	monitor.Register("uptimerobot", func() monitor.Provider { return new(provider) })
+}
+
+// provider configures an UptimeRobotUptimeChecker from command line flags.
+type provider struct {
+	config Config
+	apikey secret.Value
+}
+
+func (p *provider) Flags(fs monitor.FlagSet) {
+	p.apikey.Flags(fs, "uptimerobot-apikey", "UptimeRobot main API Key", "UPTIMEROBOT_APIKEY")
+	fs.Flag("uptimerobot-alert-contact", "ID or friendly name of an UptimeRobot alert contact notified by default, may be repeated").StringsVar(&p.config.AlertContacts)
+	fs.Flag("uptimerobot-url", "UptimeRobot API base URL").Default(DefaultBaseURL).StringVar(&p.config.BaseURL)
+}
+
+func (p *provider) New(ctx context.Context, opts monitor.Options) (monitor.UptimeChecker, error) {
+	config := p.config
+	config.APIKey = p.apikey.Secret()
+	return NewUptimeRobotUptimeChecker(ctx, config, opts.RateLimit)
+}
@@ -0,0 +1,649 @@
+// Package uptimerobot implements an UptimeChecker backed by the
+// UptimeRobot v2 API.
+package uptimerobot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+)
+
+// DefaultBaseURL is the address of the UptimeRobot v2 API.
+const DefaultBaseURL = "https://api.uptimerobot.com/v2"
+
+// pageSize is the number of records requested per page when listing; 50
+// is the most UptimeRobot permits.
+const pageSize = 50
+
+// monitor types and statuses, as defined by the UptimeRobot API.
+const (
+	typeHTTP    = 1
+	typeKeyword = 2
+
+	// keywordNotExists raises an alert if the keyword is missing.
+	keywordNotExists = 2
+
+	statusPaused = 0
+	statusActive = 1
+
+	// statuses reported for active monitors.
+	statusUp        = 2
+	statusSeemsDown = 8
+	statusDown      = 9
+)
+
+// Config configures an UptimeRobotUptimeChecker.
+type Config struct {
+	// APIKey is the UptimeRobot main API key.
+	APIKey string
+
+	// AlertContacts are the IDs or friendly names of the alert contacts
+	// notified by checks which do not specify their own contacts. If
+	// empty the account's first alert contact is used.
+	AlertContacts []string
+
+	// BaseURL, if set, overrides DefaultBaseURL.
+	BaseURL string
+}
+
+type UptimeRobotUptimeChecker struct {
+	config   Config
+	client   *http.Client
+	throttle *monitor.Throttle
+
+	// contacts maps the IDs and friendly names of the account's alert
+	// contacts to their IDs.
+	contacts        map[string]string
+	defaultContacts []string
+
+	uptimeChecks map[string]*monitor.UptimeCheck
+}
+
+// NewUptimeRobotUptimeChecker returns an UptimeChecker backed by the
+// UptimeRobot account identified by config.APIKey. Calls to the
+// UptimeRobot API are limited to the rate given by limit.
+func NewUptimeRobotUptimeChecker(ctx context.Context, config Config, limit monitor.RateLimit) (monitor.UptimeChecker, error) {
+	return newUptimeRobotUptimeChecker(ctx, http.DefaultClient, config, limit)
+}
+
+func newUptimeRobotUptimeChecker(ctx context.Context, client *http.Client, config Config, limit monitor.RateLimit) (*UptimeRobotUptimeChecker, error) {
+	if config.BaseURL == "" {
+		config.BaseURL = DefaultBaseURL
+	}
+	c := &UptimeRobotUptimeChecker{
+		config:       config,
+		client:       client,
+		throttle:     monitor.NewThrottle(limit),
+		contacts:     make(map[string]string),
+		uptimeChecks: make(map[string]*monitor.UptimeCheck),
+	}
+
+	if err := c.syncAlertContacts(ctx); err != nil {
+		return nil, err
+	}
+	if len(config.AlertContacts) > 0 {
+		ids, err := c.resolve("setup", config.AlertContacts)
+		if err != nil {
+			return nil, err
+		}
+		c.defaultContacts = ids
+	}
+
+	return c, c.SyncUptimeChecks(ctx)
+}
+
+// alertContact is an alert contact as returned by the UptimeRobot API.
+type alertContact struct {
+	ID           string `json:"id"`
+	FriendlyName string `json:"friendly_name"`
+}
+
+// syncAlertContacts refreshes the account's alert contacts. As with the
+// Pingdom backend, if no default contacts are configured the first
+// contact, usually the account owner, is used.
+func (c *UptimeRobotUptimeChecker) syncAlertContacts(ctx context.Context) error {
+	var first string
+	for offset := 0; ; {
+		var res struct {
+			Offset        int            `json:"offset"`
+			Total         int            `json:"total"`
+			AlertContacts []alertContact `json:"alert_contacts"`
+		}
+		params := url.Values{
+			"offset": {strconv.Itoa(offset)},
+			"limit":  {strconv.Itoa(pageSize)},
+		}
+		if err := c.do(ctx, "list contacts", "getAlertContacts", params, &res); err != nil {
+			return err
+		}
+		for _, ac := range res.AlertContacts {
+			if first == "" {
+				first = ac.ID
+			}
+			c.contacts[ac.ID] = ac.ID
+			c.contacts[ac.FriendlyName] = ac.ID
+		}
+		offset += len(res.AlertContacts)
+		if len(res.AlertContacts) == 0 || offset >= res.Total {
+			break
+		}
+	}
+	if first == "" {
+		return fmt.Errorf("uptimerobot: account has no alert contacts")
+	}
+	c.defaultContacts = []string{first}
+	return nil
+}
+
+// resolve returns the IDs of the alert contacts identified by contacts.
+func (c *UptimeRobotUptimeChecker) resolve(op string, contacts []string) ([]string, error) {
+	var ids []string
+	for _, name := range contacts {
+		id, ok := c.contacts[name]
+		if !ok {
+			return nil, &monitor.Error{Kind: monitor.ValidationFailed, Op: op, Err: fmt.Errorf("unknown alert contact %q", name)}
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// ResolveContacts returns an error if any of contacts is not an alert
+// contact of the account.
+func (c *UptimeRobotUptimeChecker) ResolveContacts(contacts []string) error {
+	_, err := c.resolve("resolve contacts", contacts)
+	return err
+}
+
+// Quota returns the number of monitors the account has, and its limit.
+func (c *UptimeRobotUptimeChecker) Quota(ctx context.Context) (used, limit int, err error) {
+	var res struct {
+		Account struct {
+			MonitorLimit   int `json:"monitor_limit"`
+			UpMonitors     int `json:"up_monitors"`
+			DownMonitors   int `json:"down_monitors"`
+			PausedMonitors int `json:"paused_monitors"`
+		} `json:"account"`
+	}
+	if err := c.do(ctx, "quota", "getAccountDetails", url.Values{}, &res); err != nil {
+		return 0, 0, err
+	}
+	a := res.Account
+	return a.UpMonitors + a.DownMonitors + a.PausedMonitors, a.MonitorLimit, nil
+}
+
+// The types of the log entries of a monitor.
+const (
+	logDown    = 1
+	logUp      = 2
+	logStarted = 98
+	logPaused  = 99
+)
+
+// Availability returns the results of the check for hostName between
+// from and to, from the logs of its monitor. Each log entry records a
+// change of state and how long it lasted.
+func (c *UptimeRobotUptimeChecker) Availability(ctx context.Context, hostName string, from, to time.Time) (*monitor.Availability, error) {
+	check, exists := c.uptimeChecks[hostName]
+	if !exists {
+		return nil, &monitor.Error{Kind: monitor.NotFound, Op: "availability", Err: fmt.Errorf("no check for %q", hostName)}
+	}
+	var res struct {
+		Monitors []struct {
+			Logs []struct {
+				Type     int   `json:"type"`
+				Datetime int64 `json:"datetime"`
+				Duration int64 `json:"duration"`
+			} `json:"logs"`
+		} `json:"monitors"`
+	}
+	params := url.Values{
+		"monitors":        {strconv.Itoa(check.ID)},
+		"logs":            {"1"},
+		"logs_start_date": {strconv.FormatInt(from.Unix(), 10)},
+		"logs_end_date":   {strconv.FormatInt(to.Unix(), 10)},
+	}
+	if err := c.do(ctx, "availability", "getMonitors", params, &res); err != nil {
+		return nil, err
+	}
+
+	a := new(monitor.Availability)
+	var checked time.Duration
+	for _, m := range res.Monitors {
+		for _, l := range m.Logs {
+			start := time.Unix(l.Datetime, 0)
+			end := start.Add(time.Duration(l.Duration) * time.Second)
+			if start.Before(from) {
+				start = from
+			}
+			if end.After(to) {
+				end = to
+			}
+			if !end.After(start) {
+				continue
+			}
+			d := end.Sub(start)
+			switch l.Type {
+			case logUp, logStarted:
+				a.Up += d
+			case logDown:
+				a.Down += d
+				a.Outages = append(a.Outages, monitor.Outage{Start: start, End: end})
+			default: // logPaused, the monitor was not checking
+				continue
+			}
+			checked += d
+		}
+	}
+	a.Unknown = to.Sub(from) - checked
+	sort.Slice(a.Outages, func(i, j int) bool { return a.Outages[i].Start.Before(a.Outages[j].Start) })
+	return a, nil
+}
+
+func (c *UptimeRobotUptimeChecker) UptimeChecks() map[string]*monitor.UptimeCheck {
+	return c.uptimeChecks
+}
+
+// uptimeMonitor is a monitor as returned by the UptimeRobot API.
+type uptimeMonitor struct {
+	ID            int    `json:"id"`
+	FriendlyName  string `json:"friendly_name"`
+	URL           string `json:"url"`
+	Type          int    `json:"type"`
+	KeywordValue  string `json:"keyword_value"`
+	Interval      int    `json:"interval"`
+	Status        int    `json:"status"`
+	AlertContacts []struct {
+		ID string `json:"id"`
+	} `json:"alert_contacts"`
+}
+
+func (c *UptimeRobotUptimeChecker) SyncUptimeChecks(ctx context.Context) error {
+	for offset := 0; ; {
+		var res struct {
+			Pagination struct {
+				Offset int `json:"offset"`
+				Total  int `json:"total"`
+			} `json:"pagination"`
+			Monitors []uptimeMonitor `json:"monitors"`
+		}
+		params := url.Values{
+			"offset":         {strconv.Itoa(offset)},
+			"limit":          {strconv.Itoa(pageSize)},
+			"alert_contacts": {"1"},
+			"types":          {fmt.Sprintf("%d-%d", typeHTTP, typeKeyword)},
+		}
+		if err := c.do(ctx, "list", "getMonitors", params, &res); err != nil {
+			return err
+		}
+		for _, m := range res.Monitors {
+			if check := c.toUptimeCheck(m); check != nil {
+				c.uptimeChecks[check.Hostname] = check
+			}
+		}
+		offset += len(res.Monitors)
+		if len(res.Monitors) == 0 || offset >= res.Pagination.Total {
+			break
+		}
+	}
+	return nil
+}
+
+func (c *UptimeRobotUptimeChecker) CreateUptimeCheck(ctx context.Context, check *monitor.UptimeCheck) error {
+	params, err := c.params("create", check)
+	if err != nil {
+		return err
+	}
+
+	var res struct {
+		Monitor struct {
+			ID int `json:"id"`
+		} `json:"monitor"`
+	}
+	if err := c.do(ctx, "create", "newMonitor", params, &res); err != nil {
+		return err
+	}
+	check.ID = res.Monitor.ID
+	c.normalize(check)
+
+	// monitors cannot be created paused. The monitor is recorded as
+	// running before it is paused, so that it is not created again if
+	// pausing it fails.
+	paused := check.Paused
+	check.Paused = false
+	c.uptimeChecks[check.Hostname] = check
+	if paused {
+		return c.setPaused(ctx, "create", check.Hostname, true)
+	}
+	return nil
+}
+
+// UpdateUptimeCheck modifies the existing monitor for check.Hostname to
+// match check.
+func (c *UptimeRobotUptimeChecker) UpdateUptimeCheck(ctx context.Context, check *monitor.UptimeCheck) error {
+	existing, exists := c.uptimeChecks[check.Hostname]
+	if !exists {
+		return &monitor.Error{Kind: monitor.NotFound, Op: "update", Err: fmt.Errorf("no check for %q", check.Hostname)}
+	}
+	if (existing.Keyword == "") != (check.Keyword == "") {
+		// the type of a monitor cannot be changed once created.
+		return c.recreate(ctx, check)
+	}
+	params, err := c.params("update", check)
+	if err != nil {
+		return err
+	}
+	params.Del("type")
+	params.Set("id", strconv.Itoa(existing.ID))
+	params.Set("status", strconv.Itoa(status(check.Paused)))
+
+	if err := c.do(ctx, "update", "editMonitor", params, nil); err != nil {
+		return err
+	}
+	check.ID = existing.ID
+	c.normalize(check)
+	c.uptimeChecks[check.Hostname] = check
+	return nil
+}
+
+// recreate replaces the existing monitor for check.Hostname with check.
+func (c *UptimeRobotUptimeChecker) recreate(ctx context.Context, check *monitor.UptimeCheck) error {
+	if err := c.DeleteUptimeCheck(ctx, check.Hostname); err != nil {
+		return err
+	}
+	return c.CreateUptimeCheck(ctx, check)
+}
+
+func (c *UptimeRobotUptimeChecker) DeleteUptimeCheck(ctx context.Context, hostName string) error {
+	check, exists := c.uptimeChecks[hostName]
+	if !exists {
+		return nil
+	}
+
+	params := url.Values{"id": {strconv.Itoa(check.ID)}}
+	err := c.do(ctx, "delete", "deleteMonitor", params, nil)
+	if err != nil && !monitor.IsNotFound(err) {
+		return err
+	}
+
+	delete(c.uptimeChecks, hostName)
+	return nil
+}
+
+func (c *UptimeRobotUptimeChecker) PauseUptimeCheck(ctx context.Context, hostName string) error {
+	return c.setPaused(ctx, "pause", hostName, true)
+}
+
+func (c *UptimeRobotUptimeChecker) ResumeUptimeCheck(ctx context.Context, hostName string) error {
+	return c.setPaused(ctx, "resume", hostName, false)
+}
+
+func (c *UptimeRobotUptimeChecker) setPaused(ctx context.Context, op, hostName string, paused bool) error {
+	check, exists := c.uptimeChecks[hostName]
+	if !exists {
+		return &monitor.Error{Kind: monitor.NotFound, Op: op, Err: fmt.Errorf("no check for %q", hostName)}
+	}
+	if check.Paused == paused {
+		return nil
+	}
+	if err := c.setStatus(ctx, op, check.ID, status(paused)); err != nil {
+		return err
+	}
+	check.Paused = paused
+	return nil
+}
+
+func (c *UptimeRobotUptimeChecker) setStatus(ctx context.Context, op string, id, status int) error {
+	params := url.Values{
+		"id":     {strconv.Itoa(id)},
+		"status": {strconv.Itoa(status)},
+	}
+	return c.do(ctx, op, "editMonitor", params, nil)
+}
+
+func status(paused bool) int {
+	if paused {
+		return statusPaused
+	}
+	return statusActive
+}
+
+// params returns the UptimeRobot parameters which define check.
+func (c *UptimeRobotUptimeChecker) params(op string, check *monitor.UptimeCheck) (url.Values, error) {
+	contacts := c.defaultContacts
+	if len(check.Contacts) > 0 {
+		ids, err := c.resolve(op, check.Contacts)
+		if err != nil {
+			return nil, err
+		}
+		contacts = ids
+	}
+	var alertContacts []string
+	for _, id := range contacts {
+		// notify immediately, without repeating.
+		alertContacts = append(alertContacts, id+"_0_0")
+	}
+
+	params := url.Values{
+		"friendly_name":  {check.Name},
+		"url":            {monitorURL(check)},
+		"type":           {strconv.Itoa(typeHTTP)},
+		"interval":       {strconv.Itoa(interval(check.CheckIntervalInMinutes))},
+		"alert_contacts": {strings.Join(alertContacts, "-")},
+	}
+	if check.Keyword != "" {
+		params.Set("type", strconv.Itoa(typeKeyword))
+		params.Set("keyword_type", strconv.Itoa(keywordNotExists))
+		params.Set("keyword_value", check.Keyword)
+	}
+	return params, nil
+}
+
+func monitorURL(check *monitor.UptimeCheck) string {
+	u := url.URL{
+		Scheme: "http",
+		Host:   check.Hostname,
+		Path:   check.Path,
+	}
+	if check.EnableTLS {
+		u.Scheme = "https"
+	}
+	return u.String()
+}
+
+// interval returns the monitoring interval, in seconds, for a check every
+// minutes.
+func interval(minutes int) int {
+	if minutes < 1 {
+		minutes = 1
+	}
+	return minutes * 60
+}
+
+// Normalize returns check with an interval of at least a minute, and its
+// contacts identified by ID, or none if they are the default alert
+// contacts.
+func (c *UptimeRobotUptimeChecker) Normalize(check *monitor.UptimeCheck) *monitor.UptimeCheck {
+	n := *check
+	c.normalize(&n)
+	return &n
+}
+
+func (c *UptimeRobotUptimeChecker) normalize(check *monitor.UptimeCheck) {
+	check.CheckIntervalInMinutes = interval(check.CheckIntervalInMinutes) / 60
+	if ids, err := c.resolve("normalize", check.Contacts); err == nil {
+		check.Contacts = ids
+	}
+	if c.defaults(check.Contacts) {
+		check.Contacts = nil
+	}
+}
+
+// defaults reports whether the alert contacts ids are the default alert
+// contacts, in any order.
+func (c *UptimeRobotUptimeChecker) defaults(ids []string) bool {
+	if len(ids) != len(c.defaultContacts) {
+		return false
+	}
+	a := append([]string(nil), ids...)
+	b := append([]string(nil), c.defaultContacts...)
+	sort.Strings(a)
+	sort.Strings(b)
+	return reflect.DeepEqual(a, b)
+}
+
+// toUptimeCheck converts m to an UptimeCheck, or returns nil if m is not
+// a monitor for an HTTP(S) URL.
+func (c *UptimeRobotUptimeChecker) toUptimeCheck(m uptimeMonitor) *monitor.UptimeCheck {
+	if m.Type != typeHTTP && m.Type != typeKeyword {
+		return nil
+	}
+	u, err := url.Parse(m.URL)
+	if err != nil || u.Hostname() == "" {
+		return nil
+	}
+	minutes := m.Interval / 60
+	if minutes < 1 {
+		minutes = 1
+	}
+	var contacts []string
+	for _, ac := range m.AlertContacts {
+		contacts = append(contacts, ac.ID)
+	}
+	// monitors alerting only the default alert contacts were created
+	// without contacts of their own.
+	if c.defaults(contacts) {
+		contacts = nil
+	}
+	check := &monitor.UptimeCheck{
+		Hostname:               u.Hostname(),
+		ID:                     m.ID,
+		Name:                   m.FriendlyName,
+		CheckIntervalInMinutes: minutes,
+		EnableTLS:              u.Scheme == "https",
+		Paused:                 m.Status == statusPaused,
+		Path:                   u.Path,
+		Contacts:               contacts,
+	}
+	switch m.Status {
+	case statusUp:
+		check.Status = monitor.StatusUp
+	case statusSeemsDown, statusDown:
+		check.Status = monitor.StatusDown
+	}
+	if m.Type == typeKeyword {
+		check.Keyword = m.KeywordValue
+	}
+	return check
+}
+
+// apiError is the error reported by an UptimeRobot API response whose
+// stat is "fail".
+type apiError struct {
+	Type          string `json:"type"`
+	ParameterName string `json:"parameter_name"`
+	PassedValue   string `json:"passed_value"`
+	Message       string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = e.Type
+	}
+	if e.ParameterName != "" {
+		msg += " (" + e.ParameterName + ")"
+	}
+	return "uptimerobot: " + msg
+}
+
+func (e *apiError) kind() monitor.ErrorKind {
+	switch {
+	case e.ParameterName == "api_key":
+		return monitor.AuthFailed
+	case e.Type == "not_found":
+		return monitor.NotFound
+	case e.Type == "invalid_parameter", e.Type == "missing_parameter", e.Type == "already_exists":
+		return monitor.ValidationFailed
+	case e.Type == "internal":
+		return monitor.Transient
+	default:
+		return monitor.Unknown
+	}
+}
+
+// do calls the UptimeRobot API method with params, bounded by ctx, and
+// decodes the response into v. Any error is returned as a
+// *monitor.Error.
+func (c *UptimeRobotUptimeChecker) do(ctx context.Context, op, method string, params url.Values, v interface{}) error {
+	if err := c.throttle.Wait(ctx, op); err != nil {
+		return err
+	}
+
+	form := url.Values{}
+	for k, vs := range params {
+		form[k] = vs
+	}
+	form.Set("api_key", c.config.APIKey)
+	form.Set("format", "json")
+	req, err := http.NewRequest("POST", c.config.BaseURL+"/"+method, strings.NewReader(form.Encode()))
+	if err != nil {
+		return &monitor.Error{Kind: monitor.Unknown, Op: op, Err: err}
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Cache-Control", "no-cache")
+
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return monitor.Wrap(ctx, op, err)
+	}
+	defer resp.Body.Close()
+	c.throttle.Delay(monitor.RetryAfterHeader(resp))
+
+	if resp.StatusCode >= 300 {
+		err := &monitor.Error{
+			Kind: monitor.KindForStatus(resp.StatusCode),
+			Op:   op,
+			Err:  fmt.Errorf("uptimerobot: %s", resp.Status),
+		}
+		if err.Kind == monitor.RateLimited {
+			err.RetryAfter = c.throttle.Backoff()
+		}
+		return err
+	}
+
+	var body json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return monitor.Wrap(ctx, op, err)
+	}
+	var stat struct {
+		Stat  string    `json:"stat"`
+		Error *apiError `json:"error"`
+	}
+	if err := json.Unmarshal(body, &stat); err != nil {
+		return monitor.Wrap(ctx, op, err)
+	}
+	if stat.Stat != "ok" {
+		e := stat.Error
+		if e == nil {
+			e = &apiError{Message: "request failed"}
+		}
+		return &monitor.Error{Kind: e.kind(), Op: op, Err: e}
+	}
+	if v == nil {
+		return nil
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return monitor.Wrap(ctx, op, err)
+	}
+	return nil
+}
@@ -0,0 +1,511 @@
+package uptimerobot
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/heptiolabs/cruise/internal/monitor"
+	"github.com/heptiolabs/cruise/internal/monitor/monitortest"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeMonitor is a monitor held by fakeUptimeRobot.
+type fakeMonitor struct {
+	ID            int                 `json:"id"`
+	FriendlyName  string              `json:"friendly_name"`
+	URL           string              `json:"url"`
+	Type          int                 `json:"type"`
+	KeywordType   int                 `json:"keyword_type,omitempty"`
+	KeywordValue  string              `json:"keyword_value"`
+	Interval      int                 `json:"interval"`
+	Status        int                 `json:"status"`
+	AlertContacts []map[string]string `json:"alert_contacts"`
+	Logs          []map[string]int64  `json:"logs,omitempty"`
+}
+
+// fakeUptimeRobot is an in memory stand in for the UptimeRobot v2 API.
+type fakeUptimeRobot struct {
+	mu       sync.Mutex
+	nextID   int
+	monitors map[int]*fakeMonitor
+	contacts []alertContact
+	limit    int // maximum page size
+	calls    map[string]int
+	fail     func(method string) (status int, errType string)
+	header   http.Header
+}
+
+func newFakeUptimeRobot() *fakeUptimeRobot {
+	return &fakeUptimeRobot{
+		nextID:   100,
+		monitors: make(map[int]*fakeMonitor),
+		contacts: []alertContact{
+			{ID: "1", FriendlyName: "owner"},
+			{ID: "2", FriendlyName: "ops"},
+			{ID: "3", FriendlyName: "dev"},
+		},
+		limit: 2,
+		calls: make(map[string]int),
+	}
+}
+
+func (f *fakeUptimeRobot) add(m fakeMonitor) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	m.ID = f.nextID
+	f.nextID++
+	f.monitors[m.ID] = &m
+}
+
+func (f *fakeUptimeRobot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for k, v := range f.header {
+		w.Header()[k] = v
+	}
+	method := strings.TrimPrefix(r.URL.Path, "/")
+	f.calls[method]++
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	r.ParseForm()
+	if r.PostForm.Get("api_key") != "key" {
+		fail(w, "invalid_parameter", "api_key")
+		return
+	}
+	if f.fail != nil {
+		if status, errType := f.fail(method); status != 0 {
+			w.WriteHeader(status)
+			return
+		} else if errType != "" {
+			fail(w, errType, "")
+			return
+		}
+	}
+
+	offset, _ := strconv.Atoi(r.PostForm.Get("offset"))
+	limit, _ := strconv.Atoi(r.PostForm.Get("limit"))
+	if limit == 0 || limit > f.limit {
+		limit = f.limit
+	}
+
+	switch method {
+	case "getAlertContacts":
+		end := offset + limit
+		if end > len(f.contacts) {
+			end = len(f.contacts)
+		}
+		ok(w, map[string]interface{}{
+			"offset":         offset,
+			"limit":          limit,
+			"total":          len(f.contacts),
+			"alert_contacts": f.contacts[offset:end],
+		})
+	case "getAccountDetails":
+		ok(w, map[string]interface{}{
+			"account": map[string]int{"monitor_limit": 50, "up_monitors": len(f.monitors), "down_monitors": 0, "paused_monitors": 0},
+		})
+	case "getMonitors":
+		var ids []int
+		for id := range f.monitors {
+			ids = append(ids, id)
+		}
+		sort.Ints(ids)
+		var page []*fakeMonitor
+		for i := offset; i < offset+limit && i < len(ids); i++ {
+			page = append(page, f.monitors[ids[i]])
+		}
+		ok(w, map[string]interface{}{
+			"pagination": map[string]int{"offset": offset, "limit": limit, "total": len(ids)},
+			"monitors":   page,
+		})
+	case "newMonitor":
+		if r.PostForm.Get("url") == "" {
+			fail(w, "missing_parameter", "url")
+			return
+		}
+		m := &fakeMonitor{ID: f.nextID, Status: statusActive}
+		f.nextID++
+		f.update(m, r)
+		f.monitors[m.ID] = m
+		ok(w, map[string]interface{}{"monitor": map[string]int{"id": m.ID, "status": m.Status}})
+	case "editMonitor", "deleteMonitor":
+		id, _ := strconv.Atoi(r.PostForm.Get("id"))
+		m, exists := f.monitors[id]
+		if !exists {
+			fail(w, "not_found", "id")
+			return
+		}
+		if method == "deleteMonitor" {
+			delete(f.monitors, id)
+		} else {
+			if _, ok := r.PostForm["type"]; ok {
+				fail(w, "invalid_parameter", "type")
+				return
+			}
+			f.update(m, r)
+		}
+		ok(w, map[string]interface{}{"monitor": map[string]int{"id": id}})
+	default:
+		fail(w, "invalid_parameter", "method")
+	}
+}
+
+// update applies the form parameters of r to m.
+func (f *fakeUptimeRobot) update(m *fakeMonitor, r *http.Request) {
+	form := r.PostForm
+	if v, ok := form["friendly_name"]; ok {
+		m.FriendlyName = v[0]
+	}
+	if v, ok := form["url"]; ok {
+		m.URL = v[0]
+	}
+	if v, ok := form["type"]; ok {
+		m.Type, _ = strconv.Atoi(v[0])
+	}
+	if v, ok := form["interval"]; ok {
+		m.Interval, _ = strconv.Atoi(v[0])
+	}
+	if v, ok := form["status"]; ok {
+		m.Status, _ = strconv.Atoi(v[0])
+	}
+	if v, ok := form["keyword_type"]; ok {
+		m.KeywordType, _ = strconv.Atoi(v[0])
+	}
+	if v, ok := form["keyword_value"]; ok {
+		m.KeywordValue = v[0]
+	}
+	if v, ok := form["alert_contacts"]; ok {
+		m.AlertContacts = nil
+		for _, ac := range strings.Split(v[0], "-") {
+			m.AlertContacts = append(m.AlertContacts, map[string]string{"id": strings.SplitN(ac, "_", 2)[0]})
+		}
+	}
+}
+
+func (f *fakeUptimeRobot) contactIDs(id int) []string {
+	var ids []string
+	for _, ac := range f.monitors[id].AlertContacts {
+		ids = append(ids, ac["id"])
+	}
+	return ids
+}
+
+func ok(w http.ResponseWriter, v map[string]interface{}) {
+	v["stat"] = "ok"
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func fail(w http.ResponseWriter, errType, param string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"stat": "fail",
+		"error": map[string]string{
+			"type":           errType,
+			"parameter_name": param,
+			"message":        "fake error",
+		},
+	})
+}
+
+func newFakeChecker(t *testing.T, f *fakeUptimeRobot, config Config) (*UptimeRobotUptimeChecker, *httptest.Server) {
+	t.Helper()
+	srv := httptest.NewServer(f)
+	config.BaseURL = srv.URL
+	if config.APIKey == "" {
+		config.APIKey = "key"
+	}
+	c, err := newUptimeRobotUptimeChecker(context.Background(), srv.Client(), config, monitor.RateLimit{})
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	return c, srv
+}
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUptimeRobotUptimeChecker(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeUptimeRobot()
+	c, srv := newFakeChecker(t, f, Config{})
+	defer srv.Close()
+
+	uc := &monitor.UptimeCheck{
+		Hostname:               "example.com",
+		Name:                   "mynamespace/example (example.com:443)",
+		EnableTLS:              true,
+		CheckIntervalInMinutes: 5,
+		Path:                   "/healthz",
+	}
+	check(t, c.CreateUptimeCheck(ctx, uc))
+	assert.Equal(t, 100, uc.ID)
+
+	created := f.monitors[100]
+	assert.Equal(t, "https://example.com/healthz", created.URL)
+	assert.Equal(t, typeHTTP, created.Type)
+	assert.Equal(t, 300, created.Interval)
+	assert.Equal(t, []string{"1"}, f.contactIDs(100))
+
+	n, srv2 := newFakeChecker(t, f, Config{})
+	defer srv2.Close()
+	synced := n.UptimeChecks()["example.com"]
+	assert.Equal(t, "mynamespace/example (example.com:443)", synced.Name)
+	assert.True(t, synced.EnableTLS)
+	assert.Equal(t, 5, synced.CheckIntervalInMinutes)
+	assert.Equal(t, "/healthz", synced.Path)
+	assert.Empty(t, synced.Contacts)
+	assert.True(t, monitor.SameCheck(synced, uc))
+
+	updated := &monitor.UptimeCheck{
+		Hostname:               "example.com",
+		Name:                   "renamed",
+		CheckIntervalInMinutes: 1,
+		Contacts:               []string{"ops", "3"},
+	}
+	check(t, n.UpdateUptimeCheck(ctx, updated))
+	assert.Equal(t, 100, updated.ID)
+	assert.Equal(t, "renamed", f.monitors[100].FriendlyName)
+	assert.Equal(t, "http://example.com", f.monitors[100].URL)
+	assert.Equal(t, 60, f.monitors[100].Interval)
+	assert.Equal(t, []string{"2", "3"}, f.contactIDs(100))
+
+	check(t, n.PauseUptimeCheck(ctx, "example.com"))
+	assert.Equal(t, statusPaused, f.monitors[100].Status)
+	check(t, n.ResumeUptimeCheck(ctx, "example.com"))
+	assert.Equal(t, statusActive, f.monitors[100].Status)
+
+	check(t, n.DeleteUptimeCheck(ctx, "example.com"))
+	assert.Empty(t, f.monitors)
+	assert.Nil(t, n.UptimeChecks()["example.com"])
+}
+
+func TestUptimeRobotKeywordMonitor(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeUptimeRobot()
+	c, srv := newFakeChecker(t, f, Config{AlertContacts: []string{"dev"}})
+	defer srv.Close()
+
+	check(t, c.CreateUptimeCheck(ctx, &monitor.UptimeCheck{Hostname: "example.com", Name: "example", Keyword: "ok", Paused: true}))
+	m := f.monitors[100]
+	assert.Equal(t, typeKeyword, m.Type)
+	assert.Equal(t, keywordNotExists, m.KeywordType)
+	assert.Equal(t, "ok", m.KeywordValue)
+	assert.Equal(t, statusPaused, m.Status)
+	assert.Equal(t, []string{"3"}, f.contactIDs(100))
+
+	n, srv2 := newFakeChecker(t, f, Config{})
+	defer srv2.Close()
+	assert.Equal(t, "ok", n.UptimeChecks()["example.com"].Keyword)
+	assert.True(t, n.UptimeChecks()["example.com"].Paused)
+
+	// changing the type of a monitor replaces it.
+	check(t, n.UpdateUptimeCheck(ctx, &monitor.UptimeCheck{Hostname: "example.com", Name: "example"}))
+	assert.NotContains(t, f.monitors, 100)
+	assert.Equal(t, typeHTTP, f.monitors[101].Type)
+	assert.Equal(t, 101, n.UptimeChecks()["example.com"].ID)
+}
+
+func TestUptimeRobotCreatePausedFails(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeUptimeRobot()
+	c, srv := newFakeChecker(t, f, Config{})
+	defer srv.Close()
+
+	f.fail = func(method string) (int, string) {
+		if method == "editMonitor" {
+			return http.StatusBadGateway, ""
+		}
+		return 0, ""
+	}
+	uc := &monitor.UptimeCheck{Hostname: "example.com", Name: "example", Paused: true}
+	assert.Equal(t, monitor.Transient, monitor.KindOf(c.CreateUptimeCheck(ctx, uc)))
+	assert.Len(t, f.monitors, 1)
+
+	// the monitor created is known, so is paused rather than created again.
+	recorded := c.UptimeChecks()["example.com"]
+	if assert.NotNil(t, recorded) {
+		assert.Equal(t, 100, recorded.ID)
+		assert.False(t, recorded.Paused)
+	}
+	f.fail = nil
+	check(t, c.PauseUptimeCheck(ctx, "example.com"))
+	assert.Len(t, f.monitors, 1)
+	assert.Equal(t, statusPaused, f.monitors[100].Status)
+}
+
+func TestUptimeRobotNormalize(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeUptimeRobot()
+	config := Config{AlertContacts: []string{"ops", "dev"}}
+	c, srv := newFakeChecker(t, f, config)
+	defer srv.Close()
+
+	uc := &monitor.UptimeCheck{Hostname: "example.com", Name: "example", Contacts: []string{"3", "ops"}}
+	want := c.Normalize(uc)
+	assert.Empty(t, want.Contacts)
+	assert.Equal(t, 1, want.CheckIntervalInMinutes)
+	assert.Equal(t, []string{"3", "ops"}, uc.Contacts, "Normalize modified its argument")
+
+	check(t, c.CreateUptimeCheck(ctx, uc))
+	assert.Equal(t, []string{"3", "2"}, f.contactIDs(100))
+	assert.True(t, monitor.SameCheck(c.UptimeChecks()["example.com"], want))
+
+	n, srv2 := newFakeChecker(t, f, config)
+	defer srv2.Close()
+	assert.True(t, monitor.SameCheck(n.UptimeChecks()["example.com"], want))
+
+	other := c.Normalize(&monitor.UptimeCheck{Hostname: "example.com", Contacts: []string{"owner"}})
+	assert.Equal(t, []string{"1"}, other.Contacts)
+}
+
+func TestUptimeRobotPagination(t *testing.T) {
+	f := newFakeUptimeRobot()
+	for _, h := range []string{"a", "b", "c", "d", "e"} {
+		f.add(fakeMonitor{FriendlyName: h, URL: "http://" + h + ".example.com", Type: typeHTTP, Interval: 60, Status: statusActive})
+	}
+	f.add(fakeMonitor{FriendlyName: "ping", URL: "ping.example.com", Type: 3, Interval: 60})
+
+	c, srv := newFakeChecker(t, f, Config{AlertContacts: []string{"dev"}})
+	defer srv.Close()
+
+	assert.Equal(t, 2, f.calls["getAlertContacts"])
+	assert.Equal(t, 3, f.calls["getMonitors"])
+	assert.Len(t, c.UptimeChecks(), 5)
+	assert.Equal(t, []string{"3"}, c.defaultContacts)
+}
+
+func TestUptimeRobotUnknownContact(t *testing.T) {
+	f := newFakeUptimeRobot()
+	c, srv := newFakeChecker(t, f, Config{})
+	defer srv.Close()
+
+	err := c.CreateUptimeCheck(context.Background(), &monitor.UptimeCheck{Hostname: "example.com", Name: "example", Contacts: []string{"nobody"}})
+	assert.Equal(t, monitor.ValidationFailed, monitor.KindOf(err))
+	assert.Empty(t, f.monitors)
+
+	srv2 := httptest.NewServer(f)
+	defer srv2.Close()
+	_, err = newUptimeRobotUptimeChecker(context.Background(), srv2.Client(), Config{APIKey: "key", BaseURL: srv2.URL, AlertContacts: []string{"nobody"}}, monitor.RateLimit{})
+	assert.Equal(t, monitor.ValidationFailed, monitor.KindOf(err))
+}
+
+func TestUptimeRobotDoctor(t *testing.T) {
+	f := newFakeUptimeRobot()
+	f.add(fakeMonitor{FriendlyName: "example", URL: "http://example.com/", Type: typeHTTP, Interval: 300})
+	c, srv := newFakeChecker(t, f, Config{})
+	defer srv.Close()
+
+	check(t, c.ResolveContacts([]string{"ops", "3"}))
+	err := c.ResolveContacts([]string{"ops", "nobody"})
+	assert.Equal(t, monitor.ValidationFailed, monitor.KindOf(err))
+	assert.Contains(t, err.Error(), `"nobody"`)
+
+	used, limit, err := c.Quota(context.Background())
+	check(t, err)
+	assert.Equal(t, 1, used)
+	assert.Equal(t, 50, limit)
+}
+
+func TestUptimeRobotAvailability(t *testing.T) {
+	f := newFakeUptimeRobot()
+	f.add(fakeMonitor{FriendlyName: "example", URL: "http://example.com/", Type: typeHTTP, Interval: 300, Logs: []map[string]int64{
+		{"type": logUp, "datetime": 3060, "duration": 1000},
+		{"type": logDown, "datetime": 3000, "duration": 60},
+		{"type": logPaused, "datetime": 2000, "duration": 1000},
+		{"type": logStarted, "datetime": 1000, "duration": 1000},
+	}})
+	c, srv := newFakeChecker(t, f, Config{})
+	defer srv.Close()
+
+	a, err := c.Availability(context.Background(), "example.com", time.Unix(1500, 0), time.Unix(3500, 0))
+	check(t, err)
+	assert.Equal(t, 940*time.Second, a.Up)
+	assert.Equal(t, 60*time.Second, a.Down)
+	assert.Equal(t, 1000*time.Second, a.Unknown)
+	assert.Equal(t, []monitor.Outage{{Start: time.Unix(3000, 0), End: time.Unix(3060, 0)}}, a.Outages)
+}
+
+func TestUptimeRobotErrorKinds(t *testing.T) {
+	tests := map[string]struct {
+		status  int
+		errType string
+		want    monitor.ErrorKind
+	}{
+		"too many requests": {status: http.StatusTooManyRequests, want: monitor.RateLimited},
+		"server error":      {status: http.StatusBadGateway, want: monitor.Transient},
+		"invalid parameter": {errType: "invalid_parameter", want: monitor.ValidationFailed},
+		"not found":         {errType: "not_found", want: monitor.NotFound},
+		"internal":          {errType: "internal", want: monitor.Transient},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := newFakeUptimeRobot()
+			c, srv := newFakeChecker(t, f, Config{})
+			defer srv.Close()
+
+			f.fail = func(method string) (int, string) {
+				if method == "newMonitor" {
+					return tc.status, tc.errType
+				}
+				return 0, ""
+			}
+			err := c.CreateUptimeCheck(context.Background(), &monitor.UptimeCheck{Hostname: "example.com", Name: "example"})
+			assert.Equal(t, tc.want, monitor.KindOf(err))
+		})
+	}
+
+	f := newFakeUptimeRobot()
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	_, err := newUptimeRobotUptimeChecker(context.Background(), srv.Client(), Config{APIKey: "wrong", BaseURL: srv.URL}, monitor.RateLimit{})
+	assert.Equal(t, monitor.AuthFailed, monitor.KindOf(err))
+}
+
+func TestUptimeRobotContract(t *testing.T) {
+	monitortest.Run(t, func() monitortest.Backend {
+		f := newFakeUptimeRobot()
+		return monitortest.Backend{
+			New: func(t *testing.T) (monitor.UptimeChecker, *httptest.Server) {
+				return newFakeChecker(t, f, Config{})
+			},
+			Len: func() int { return len(f.monitors) },
+			RateLimit: func() {
+				f.header = http.Header{"Retry-After": []string{"120"}}
+				f.fail = func(string) (int, string) { return http.StatusTooManyRequests, "" }
+			},
+		}
+	})
+}
+
+func TestUptimeRobotStatus(t *testing.T) {
+	tests := map[int]string{
+		statusPaused:    "",
+		statusActive:    "",
+		statusUp:        monitor.StatusUp,
+		statusSeemsDown: monitor.StatusDown,
+		statusDown:      monitor.StatusDown,
+	}
+	c := &UptimeRobotUptimeChecker{}
+	for s, want := range tests {
+		check := c.toUptimeCheck(uptimeMonitor{Type: typeHTTP, URL: "https://example.com/", Status: s})
+		assert.Equal(t, want, check.Status, "status %d", s)
+	}
+}